@@ -104,6 +104,11 @@ function updateData(data) {
 	var type = data["IEC61850"]
 	var value = fixed(data["Value"])
 
+	// skip implausible readings
+	if (data["Quality"] && data["Quality"] != "good") {
+		return
+	}
+
 	// create or update data table
 	var dict = dataapp.meters[id] || {}
 	dict[type] = value
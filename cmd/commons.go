@@ -5,16 +5,23 @@ import (
 	golog "log"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/meters/d0"
+	"github.com/volkszaehler/mbmd/meters/mbus"
+	"github.com/volkszaehler/mbmd/meters/rest"
 	"github.com/volkszaehler/mbmd/meters/rs485"
+	"github.com/volkszaehler/mbmd/meters/sml"
+	"github.com/volkszaehler/mbmd/meters/speedwire"
+	"github.com/volkszaehler/mbmd/server"
 )
 
 const DefaultTimeout = 300 * time.Millisecond
 
-// logger is the golang compatible logger interface used by all commands
-type logger interface {
+// printfLogger is the golang compatible logger interface used by all commands
+type printfLogger interface {
 	Printf(format string, v ...interface{})
 	Println(v ...interface{})
 	Fatalf(format string, v ...interface{})
@@ -30,7 +37,7 @@ func (l *quietlogger) Printf(format string, v ...interface{}) {}
 func (l *quietlogger) Println(v ...interface{})               {}
 
 // log variable replaces golang log package functions
-var log logger = golog.New(os.Stderr, "", golog.LstdFlags)
+var log printfLogger = golog.New(os.Stderr, "", golog.LstdFlags)
 
 // configureLogger sets default logger.
 // According to verbosity flag only fatal messages are shown
@@ -60,6 +67,28 @@ func meterHelp() string {
 	s += fmt.Sprintf("\n  %s", "TCP")
 	s += fmt.Sprintf("\n    %-10s%s", "SUNS", "Sunspec-compatible MODBUS TCP device (SMA, SolarEdge, KOSTAL, etc)")
 
+	s += fmt.Sprintf("\n  %s", "Optical (serial or TCP)")
+	s += fmt.Sprintf("\n    %-10s%s", sml.Type, "Smart meters pushing SML telegrams (EMH, EasyMeter, ISKRA, Itron, etc)")
+	s += fmt.Sprintf("\n    %-10s%s", d0.Type, "IEC 62056-21 meters with mode A, B or C readout (Landis+Gyr, ISKRA, Elster, etc)")
+
+	s += fmt.Sprintf("\n  %s", "M-Bus (serial level converter or TCP gateway)")
+	s += fmt.Sprintf("\n    %-10s%s", mbus.Type, "Heat, water, gas and electricity meters. Use MBUS:<id>.<secondary> for secondary addressing")
+
+	s += fmt.Sprintf("\n  %s", "Speedwire multicast (network interface)")
+	s += fmt.Sprintf("\n    %-10s%s", speedwire.Type, "SMA Energy Meter and Sunny Home Manager. Use SMAEM:<id>.<serial>@<interface>")
+
+	presets := make([]string, 0, len(rest.Presets))
+	for p := range rest.Presets {
+		presets = append(presets, p)
+	}
+	sort.Strings(presets)
+
+	s += fmt.Sprintf("\n  %s", "HTTP JSON (config file only)")
+	s += fmt.Sprintf("\n    %-10s%s", rest.Type, "Devices polled via http. Presets: "+strings.Join(presets, ", "))
+
+	s += fmt.Sprintf("\n  %s", "MQTT (config file only)")
+	s += fmt.Sprintf("\n    %-10s%s", server.MqttInputType, "Devices publishing their readings to the MQTT broker (Tasmota, ESPHome, etc)")
+
 	return s
 }
 
@@ -9,79 +9,466 @@ import (
 	"time"
 
 	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/meters/d0"
+	"github.com/volkszaehler/mbmd/meters/mbus"
+	"github.com/volkszaehler/mbmd/meters/rest"
 	"github.com/volkszaehler/mbmd/meters/rs485"
+	"github.com/volkszaehler/mbmd/meters/sml"
+	"github.com/volkszaehler/mbmd/meters/speedwire"
 	"github.com/volkszaehler/mbmd/meters/sunspec"
+	"github.com/volkszaehler/mbmd/server"
 )
 
 // Config describes the entire configuration
 type Config struct {
-	API      string
-	Rate     time.Duration
-	Mqtt     MqttConfig
-	Influx   InfluxConfig
-	Adapters []AdapterConfig
-	Devices  []DeviceConfig
-	Other    map[string]any `mapstructure:",remain"`
+	API          string
+	Rate         time.Duration
+	Backoff      time.Duration
+	Counters     string
+	Mqtt         MqttConfig
+	Sparkplug    SparkplugConfig
+	OpcUa        OpcUaConfig
+	Influx       InfluxConfig
+	Volkszaehler VolkszaehlerConfig
+	Webhooks     []WebhookConfig
+	Spool        SpoolConfig
+	Queue        QueueConfig
+	Quality      QualityConfig
+	Log          LogConfig
+	Adapters     []AdapterConfig
+	Devices      []DeviceConfig
+	Other        map[string]any `mapstructure:",remain"`
 }
 
 // MqttConfig describes the mqtt broker configuration
 type MqttConfig struct {
+	Broker       string
+	Topic        string
+	User         string
+	Password     string
+	ClientID     string
+	Qos          int
+	Homie        string
+	HomieVersion int
+	Targets      []MqttTargetConfig
+}
+
+// MqttTargetConfig describes an additional MQTT publisher
+type MqttTargetConfig struct {
+	Broker   string
+	User     string
+	Password string
+	ClientID string
+	Qos      int
+	TLS      TLSConfig
+	Topic    string        // root topic
+	Template string        // topic template
+	Payload  string        // plain, json or batch
+	Retain   bool          // publish retained messages
+	Throttle time.Duration // minimum interval between messages per topic
+}
+
+// TLSConfig describes TLS certificates and verification
+type TLSConfig struct {
+	CA       string
+	Cert     string
+	Key      string
+	Insecure bool
+}
+
+// SparkplugConfig describes the Sparkplug B edge node
+type SparkplugConfig struct {
 	Broker   string
-	Topic    string
 	User     string
 	Password string
 	ClientID string
 	Qos      int
-	Homie    string
+	TLS      TLSConfig
+	Group    string // group id
+	Node     string // edge node id, defaults to hostname
+}
+
+// OpcUaConfig describes the OPC UA server configuration
+type OpcUaConfig struct {
+	Listen string
 }
 
 // InfluxConfig describes the InfluxDB configuration
 type InfluxConfig struct {
 	URL          string
+	API          string
 	Database     string
 	Measurement  string
 	Organization string
 	Token        string
 	User         string
 	Password     string
+	Batch        bool
+	Metadata     bool
+	Tags         map[string]string
+}
+
+// VolkszaehlerConfig describes the volkszaehler middleware configuration
+type VolkszaehlerConfig struct {
+	URL      string
+	Interval time.Duration // post interval
+	Buffer   int           // maximum number of buffered readings per channel
+	Channels []VolkszaehlerChannelConfig
+}
+
+// VolkszaehlerChannelConfig maps a device's measurement to a middleware channel
+type VolkszaehlerChannelConfig struct {
+	Device      string // device id or configured name
+	Measurement string
+	UUID        string
+	Interval    time.Duration // minimum interval between readings
+	Type        string        // channel type for creating the channel
+	Title       string        // channel title for creating the channel
+}
+
+// VolkszaehlerOptions creates the middleware publisher options
+func (conf VolkszaehlerConfig) VolkszaehlerOptions() (server.VolkszaehlerOptions, error) {
+	opts := server.VolkszaehlerOptions{
+		URL:          conf.URL,
+		PostInterval: conf.Interval,
+		Buffer:       conf.Buffer,
+	}
+
+	for _, c := range conf.Channels {
+		m, err := meters.MeasurementString(c.Measurement)
+		if err != nil {
+			return opts, err
+		}
+
+		opts.Channels = append(opts.Channels, server.VolkszaehlerChannel{
+			Device:      c.Device,
+			Measurement: m,
+			UUID:        c.UUID,
+			Interval:    c.Interval,
+		})
+	}
+
+	return opts, nil
+}
+
+// WebhookConfig describes an http push target
+type WebhookConfig struct {
+	Name         string
+	URL          string
+	Method       string
+	Headers      map[string]string
+	User         string
+	Password     string
+	Token        string
+	Template     string        // body template
+	Window       time.Duration // batching window
+	Retries      int
+	Backoff      time.Duration // initial retry delay
+	Devices      []string      // device ids or names
+	Measurements []string
+}
+
+// WebhookOptions creates the webhook publisher options
+func (conf WebhookConfig) WebhookOptions() (server.WebhookOptions, error) {
+	opts := server.WebhookOptions{
+		Name:     conf.Name,
+		URL:      conf.URL,
+		Method:   strings.ToUpper(conf.Method),
+		Headers:  conf.Headers,
+		User:     conf.User,
+		Password: conf.Password,
+		Token:    conf.Token,
+		Template: conf.Template,
+		Window:   conf.Window,
+		Retries:  conf.Retries,
+		Backoff:  conf.Backoff,
+		Devices:  conf.Devices,
+	}
+
+	for _, name := range conf.Measurements {
+		m, err := meters.MeasurementString(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.Measurements = append(opts.Measurements, m)
+	}
+
+	return opts, nil
+}
+
+// SpoolConfig describes the store-and-forward spool
+type SpoolConfig struct {
+	Dir  string
+	Size int // MB
+	Age  time.Duration
+}
+
+// QueueConfig describes the per-output queues decoupling outputs from device polling
+type QueueConfig struct {
+	Size    int
+	Policy  string            // block, dropoldest, dropnewest or coalesce
+	Outputs map[string]string // policy per output
+}
+
+// LogConfig describes log format and per-subsystem log levels
+type LogConfig struct {
+	Format string
+	Level  string
+	Levels map[string]string
+}
+
+// QualityConfig describes the handling of implausible readings
+type QualityConfig struct {
+	Publish bool
 }
 
 // AdapterConfig describes device communication parameters
 type AdapterConfig struct {
-	Device   string
-	RTU      bool
-	Baudrate int
-	Comset   string
+	Device      string
+	RTU         bool
+	Baudrate    int
+	Comset      string
+	Concurrency int // devices queried concurrently, TCP only
 }
 
 // DeviceConfig describes a single device's configuration
 type DeviceConfig struct {
-	Type      string
-	ID        uint8
-	SubDevice int
-	Name      string
-	Adapter   string
+	Type         string
+	ID           uint8
+	SubDevice    int
+	Name         string
+	Adapter      string
+	Plausibility PlausibilityConfig
+	Transforms   []TransformConfig
+	HTTP         HTTPConfig
+	MQTT         MqttDeviceConfig
+}
+
+// TransformConfig describes a step of a device's transform chain
+type TransformConfig struct {
+	Op           string   // multiply, invert, swap, offset, rename or drop
+	Measurements []string // measurements the step applies to
+	Units        []string // units of measurements the step applies to, all measurements if both are empty
+	Value        float64  // factor or offset
+	To           string   // rename target
+}
+
+// MqttDeviceConfig describes a device whose readings are received via MQTT
+type MqttDeviceConfig struct {
+	Availability string        // availability topic
+	Online       string        // availability payload
+	Offline      string        // availability payload
+	Timeout      time.Duration // staleness timeout
+	Values       []MqttValueConfig
+}
+
+// MqttValueConfig maps a topic's payload to a measurement
+type MqttValueConfig struct {
+	Topic       string
+	Path        string // gjson-style path of JSON payloads
+	Measurement string
+	Scale       float64
+}
+
+// HTTPConfig describes a device polled via http returning JSON
+type HTTPConfig struct {
+	URL      string
+	Preset   string        // fronius-inverter, fronius-meter, shelly-em, shelly-3em or tasmota
+	Interval time.Duration // minimum interval between requests
+	Timeout  time.Duration
+	User     string
+	Password string
+	Token    string
+	Headers  map[string]string
+	Values   []HTTPValueConfig
+}
+
+// HTTPValueConfig maps a JSON value to a measurement
+type HTTPValueConfig struct {
+	Path        string // gjson-style path
+	Measurement string
+	Scale       float64
+}
+
+// PlausibilityConfig overrides a device's default plausibility limits
+type PlausibilityConfig struct {
+	MaxPower float64
+	Rules    map[string]LimitsConfig
+}
+
+// LimitsConfig overrides a single measurement's plausibility limits
+type LimitsConfig struct {
+	Min  *float64
+	Max  *float64
+	Rate *float64
 }
 
 // DeviceConfigHandler creates map of meter managers from given configuration
 type DeviceConfigHandler struct {
 	DefaultDevice string
 	Managers      map[string]*meters.Manager
+	Devices       map[meters.Device]DeviceConfig
+	MqttDevices   []DeviceConfig // devices received via MQTT instead of being queried
+	adapters      map[string]AdapterConfig
 }
 
 // NewDeviceConfigHandler creates a configuration handler
 func NewDeviceConfigHandler() *DeviceConfigHandler {
 	conf := &DeviceConfigHandler{
 		Managers: make(map[string]*meters.Manager),
+		Devices:  make(map[meters.Device]DeviceConfig),
+		adapters: make(map[string]AdapterConfig),
 	}
 	return conf
 }
 
+// plausibility creates the plausibility validator for a device configuration
+func plausibility(conf PlausibilityConfig) *server.Plausibility {
+	limits := make(map[meters.Measurement]meters.Limits)
+
+	for key, rule := range conf.Rules {
+		m, err := meters.MeasurementString(key)
+		if err != nil {
+			log.Fatalf("config: invalid plausibility rule: %v", err)
+		}
+
+		l := m.Limits()
+		if rule.Min != nil {
+			l.Min = *rule.Min
+		}
+		if rule.Max != nil {
+			l.Max = *rule.Max
+		}
+		if rule.Rate != nil {
+			l.Rate = *rule.Rate
+		}
+		limits[m] = l
+	}
+
+	return server.NewPlausibility(conf.MaxPower, limits)
+}
+
+// defaultMqttTimeout is the staleness timeout of MQTT devices without availability topic
+const defaultMqttTimeout = 5 * time.Minute
+
+// MqttInputDevices returns the configured devices received via MQTT
+func (conf *DeviceConfigHandler) MqttInputDevices(publishInvalid bool) ([]server.MqttInputDevice, error) {
+	res := make([]server.MqttInputDevice, 0, len(conf.MqttDevices))
+
+	for _, devConf := range conf.MqttDevices {
+		c := devConf.MQTT
+
+		dev := server.MqttInputDevice{
+			ID:           devConf.ID,
+			Availability: c.Availability,
+			Online:       c.Online,
+			Offline:      c.Offline,
+			Timeout:      c.Timeout,
+			DeviceOptions: server.DeviceOptions{
+				Name:           devConf.Name,
+				Plausibility:   plausibility(devConf.Plausibility),
+				PublishInvalid: publishInvalid,
+				Transforms:     transforms(devConf.Transforms),
+			},
+		}
+
+		if dev.Availability == "" && dev.Timeout == 0 {
+			dev.Timeout = defaultMqttTimeout
+		}
+
+		for _, v := range c.Values {
+			m, err := meters.MeasurementString(v.Measurement)
+			if err != nil {
+				return nil, err
+			}
+
+			dev.Values = append(dev.Values, server.MqttInputValue{
+				Topic:       v.Topic,
+				Path:        v.Path,
+				Measurement: m,
+				Scale:       v.Scale,
+			})
+		}
+
+		res = append(res, dev)
+	}
+
+	return res, nil
+}
+
+// DeviceOptions returns the handler options for all configured devices
+func (conf *DeviceConfigHandler) DeviceOptions(publishInvalid bool) map[meters.Device]server.DeviceOptions {
+	res := make(map[meters.Device]server.DeviceOptions, len(conf.Devices))
+
+	for dev, devConf := range conf.Devices {
+		res[dev] = server.DeviceOptions{
+			Name:           devConf.Name,
+			Plausibility:   plausibility(devConf.Plausibility),
+			PublishInvalid: publishInvalid,
+			Transforms:     transforms(devConf.Transforms),
+		}
+	}
+
+	return res
+}
+
+// transforms creates the transform chain for a device configuration
+func transforms(conf []TransformConfig) server.Transforms {
+	res := make(server.Transforms, 0, len(conf))
+
+	for _, c := range conf {
+		op, err := server.TransformOpString(c.Op)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+
+		t := server.Transform{
+			Op:    op,
+			Units: c.Units,
+			Value: c.Value,
+		}
+
+		for _, name := range c.Measurements {
+			m, err := meters.MeasurementString(name)
+			if err != nil {
+				log.Fatalf("config: invalid %s transform: %v", c.Op, err)
+			}
+			t.Measurements = append(t.Measurements, m)
+		}
+
+		// steps changing values must not apply to all measurements
+		switch op {
+		case server.TransformMultiply, server.TransformInvert, server.TransformOffset, server.TransformDrop:
+			if len(t.Measurements) == 0 && len(t.Units) == 0 {
+				log.Fatalf("config: %s transform requires measurements or units", c.Op)
+			}
+		}
+
+		switch op {
+		case server.TransformMultiply:
+			if c.Value == 0 {
+				log.Fatalf("config: missing multiply transform value")
+			}
+		case server.TransformRename:
+			if len(t.Measurements) != 1 || len(t.Units) > 0 {
+				log.Fatalf("config: rename transform requires a single measurement")
+			}
+			if t.To, err = meters.MeasurementString(c.To); err != nil {
+				log.Fatalf("config: invalid rename transform: %v", err)
+			}
+		}
+
+		res = append(res, t)
+	}
+
+	return res
+}
+
 // createConnection parses adapter string to create TCP or RTU connection
 func createConnection(device string, rtu bool, baudrate int, comset string, timeout time.Duration) (res meters.Connection) {
 	if device == "mock" {
 		res = meters.NewMock(device) // mocked connection
-	} else if tcp, _ := regexp.MatchString(":[0-9]+$", device); tcp {
+	} else if tcp, _ := regexp.MatchString(":[0-9]+$", device); tcp && !strings.HasPrefix(device, meters.USBPrefix) {
 		if rtu {
 			// special case: RTU over TCP
 			log.Printf("config: creating RTU over TCP connection for %s", device)
@@ -96,8 +483,18 @@ func createConnection(device string, rtu bool, baudrate int, comset string, time
 		if baudrate == 0 || comset == "" {
 			log.Fatal("Missing comset configuration. See -h for help.")
 		}
-		if _, err := os.Stat(device); err != nil {
-			log.Fatal(err)
+		// missing adapters are opened once plugged in
+		if strings.HasPrefix(device, meters.USBPrefix) {
+			if err := meters.ValidateUSB(device); err != nil {
+				log.Fatalf("config: %v", err)
+			}
+			if path, err := meters.ResolveUSB(device); err != nil {
+				log.Printf("config: %v - waiting for adapter", err)
+			} else {
+				log.Printf("config: %s resolved to %s", device, path)
+			}
+		} else if _, err := os.Stat(device); err != nil {
+			log.Printf("config: %v - waiting for adapter", err)
 		}
 		res = meters.NewRTU(device, baudrate, comset) // serial connection
 		res.Timeout(timeout)
@@ -112,6 +509,124 @@ func (conf *DeviceConfigHandler) ConnectionManager(connSpec string, rtu bool, ba
 		conn := createConnection(connSpec, rtu, baudrate, comset, timeout)
 		manager = meters.NewManager(conn)
 		conf.Managers[connSpec] = manager
+		conf.adapters[connSpec] = AdapterConfig{Device: connSpec, RTU: rtu, Baudrate: baudrate, Comset: comset}
+	}
+
+	return manager
+}
+
+// streamDefaults are the default serial parameters of device types read from a raw byte stream instead of modbus
+var streamDefaults = map[string]AdapterConfig{
+	sml.Type:  {Baudrate: 9600, Comset: "8N1"},
+	d0.Type:   {Baudrate: 300, Comset: "7E1"}, // sign-on baud rate
+	mbus.Type: {Baudrate: 2400, Comset: "8E1"},
+}
+
+// isStreamType returns true if the device type is read from a raw byte stream instead of modbus
+func isStreamType(meterType string) bool {
+	_, ok := streamDefaults[strings.ToUpper(meterType)]
+	return ok
+}
+
+// StreamManager returns the manager of a byte stream connection. Adapters that have been created
+// as modbus connections are converted unless they are already used by modbus devices.
+func (conf *DeviceConfigHandler) StreamManager(connSpec string, meterType string) *meters.Manager {
+	manager, ok := conf.Managers[connSpec]
+	if ok {
+		if _, isStream := manager.Conn.(*meters.Stream); isStream {
+			return manager
+		}
+		if manager.Count() > 0 {
+			log.Fatalf("Adapter %s is used by MODBUS devices and cannot be shared with non-MODBUS devices.", connSpec)
+		}
+	}
+
+	// serial defaults of optical heads
+	defaults := streamDefaults[strings.ToUpper(meterType)]
+	adapter := conf.adapters[connSpec]
+	if adapter.Baudrate == 0 {
+		adapter.Baudrate = defaults.Baudrate
+	}
+	if adapter.Comset == "" {
+		adapter.Comset = defaults.Comset
+	}
+
+	log.Printf("config: creating stream connection for %s", connSpec)
+	stream, err := meters.NewStream(connSpec, adapter.Baudrate, adapter.Comset)
+	if err != nil {
+		log.Fatalf("Error creating stream connection for %s: %v. See -h for help.", connSpec, err)
+	}
+
+	manager = meters.NewManager(stream)
+	conf.Managers[connSpec] = manager
+
+	return manager
+}
+
+// HTTPManager returns the manager of the http connection of the configured device.
+// Devices polling the same URL share the connection.
+func (conf *DeviceConfigHandler) HTTPManager(devConf DeviceConfig) (*meters.Manager, meters.Device) {
+	c := devConf.HTTP
+	if c.URL == "" {
+		log.Fatalf("Missing http url for device %v", devConf)
+	}
+
+	var preset rest.Preset
+	if c.Preset != "" {
+		var err error
+		if preset, err = rest.LookupPreset(strings.ToLower(c.Preset)); err != nil {
+			log.Fatalf("Error creating device %v: %v.", devConf, err)
+		}
+	}
+
+	values := make([]rest.Value, 0, len(c.Values))
+	for _, v := range c.Values {
+		m, err := meters.MeasurementString(v.Measurement)
+		if err != nil {
+			log.Fatalf("Error creating device %v: %v.", devConf, err)
+		}
+		values = append(values, rest.Value{Path: v.Path, Measurement: m, Scale: v.Scale})
+	}
+
+	uri := preset.URL(c.URL)
+	key := rest.Type + "@" + uri
+
+	manager, ok := conf.Managers[key]
+	if !ok {
+		conn := rest.NewConnection(uri, c.User, c.Password, c.Token, c.Headers)
+		if c.Timeout > 0 {
+			conn.Timeout(c.Timeout)
+		}
+		log.Printf("config: creating http connection for %s", conn)
+
+		manager = meters.NewManager(conn)
+		conf.Managers[key] = manager
+	}
+
+	return manager, rest.NewDevice(manager.Conn.(*rest.Connection), preset, values, c.Interval)
+}
+
+// isAdapter returns true if the manager's connection is a configured adapter
+func isAdapter(manager *meters.Manager) bool {
+	switch manager.Conn.(type) {
+	case *speedwire.Receiver, *rest.Connection:
+		return false
+	default:
+		return true
+	}
+}
+
+// SpeedwireManager returns the manager of the multicast receiver for the given network interface
+func (conf *DeviceConfigHandler) SpeedwireManager(iface string) *meters.Manager {
+	key := speedwire.Type + "@" + iface
+
+	manager, ok := conf.Managers[key]
+	if !ok {
+		receiver := speedwire.NewReceiver(iface)
+		log.Printf("config: creating speedwire receiver for %s", receiver)
+
+		manager = meters.NewManager(receiver)
+		conf.Managers[key] = manager
 	}
 
 	return manager
@@ -120,11 +635,44 @@ func (conf *DeviceConfigHandler) ConnectionManager(connSpec string, rtu bool, ba
 func (conf *DeviceConfigHandler) createDeviceForManager(
 	manager *meters.Manager,
 	meterType string,
+	id uint8,
 	subdevice int,
 ) meters.Device {
 	var meter meters.Device
 	meterType = strings.ToUpper(meterType)
 
+	if receiver, ok := manager.Conn.(*speedwire.Receiver); ok {
+		if meterType != speedwire.Type {
+			log.Fatalf("Device %s cannot be used with speedwire receiver %s.", meterType, receiver)
+		}
+
+		// energy meters share the receiver and use the subdevice as serial number
+		return speedwire.NewDevice(receiver, subdevice)
+	}
+
+	if stream, ok := manager.Conn.(*meters.Stream); ok {
+		if !isStreamType(meterType) {
+			log.Fatalf("Device %s cannot be used with non-MODBUS adapter %s.", meterType, stream)
+		}
+
+		// M-Bus devices share the bus and use the subdevice as secondary address
+		if meterType == mbus.Type {
+			return mbus.NewDevice(stream, id, subdevice)
+		}
+
+		if subdevice > 0 {
+			log.Fatalf("Invalid subdevice number for device %s: %d", meterType, subdevice)
+		}
+		if manager.Count() > 0 {
+			log.Fatalf("Adapter %s supports only a single %s device.", stream, meterType)
+		}
+
+		if meterType == d0.Type {
+			return d0.NewDevice(stream)
+		}
+		return sml.NewDevice(stream)
+	}
+
 	var isSunspec bool
 	sunspecTypes := []string{"FRONIUS", "KOSTAL", "KACO", "SE", "SMA", "SOLAREDGE", "STECA", "SUNS", "SUNSPEC"}
 	for _, t := range sunspecTypes {
@@ -154,13 +702,40 @@ func (conf *DeviceConfigHandler) createDeviceForManager(
 
 // CreateDevice creates new device and adds it to the connection manager
 func (conf *DeviceConfigHandler) CreateDevice(devConf DeviceConfig) {
+	switch strings.ToUpper(devConf.Type) {
+	case speedwire.Type:
+		// energy meters are received on a network interface instead of an adapter
+		conf.addDevice(conf.SpeedwireManager(devConf.Adapter), devConf)
+		return
+
+	case rest.Type:
+		manager, meter := conf.HTTPManager(devConf)
+		if err := manager.Add(devConf.ID, meter); err != nil {
+			log.Fatalf("Error adding device %v: %v.", devConf, err)
+		}
+		conf.Devices[meter] = devConf
+		return
+
+	case server.MqttInputType:
+		if len(devConf.MQTT.Values) == 0 {
+			log.Fatalf("Missing mqtt values for device %v", devConf)
+		}
+		conf.MqttDevices = append(conf.MqttDevices, devConf)
+		return
+	}
+
 	if devConf.Adapter == "" {
 		// find default adapter
-		if len(conf.Managers) == 1 {
-			for a := range conf.Managers {
-				log.Printf("config: using default adapter %s for device %v", a, devConf)
-				devConf.Adapter = a
+		var adapters []string
+		for a, m := range conf.Managers {
+			if isAdapter(m) {
+				adapters = append(adapters, a)
 			}
+		}
+
+		if len(adapters) == 1 {
+			log.Printf("config: using default adapter %s for device %v", adapters[0], devConf)
+			devConf.Adapter = adapters[0]
 		} else {
 			log.Fatalf("Missing adapter configuration for device %v", devConf)
 		}
@@ -170,11 +745,22 @@ func (conf *DeviceConfigHandler) CreateDevice(devConf DeviceConfig) {
 	if !ok {
 		log.Fatalf("Missing adapter configuration for device %v", devConf)
 	}
-	meter := conf.createDeviceForManager(manager, devConf.Type, devConf.SubDevice)
+	if isStreamType(devConf.Type) {
+		manager = conf.StreamManager(devConf.Adapter, devConf.Type)
+	}
+
+	conf.addDevice(manager, devConf)
+}
+
+// addDevice creates the configured device and adds it to the connection manager
+func (conf *DeviceConfigHandler) addDevice(manager *meters.Manager, devConf DeviceConfig) {
+	meter := conf.createDeviceForManager(manager, devConf.Type, devConf.ID, devConf.SubDevice)
 
 	if err := manager.Add(devConf.ID, meter); err != nil {
 		log.Fatalf("Error adding device %v: %v.", devConf, err)
 	}
+
+	conf.Devices[meter] = devConf
 }
 
 // CreateDeviceFromSpec creates new device from specification string and adds
@@ -191,7 +777,13 @@ func (conf *DeviceConfigHandler) CreateDeviceFromSpec(deviceDef string, timeout
 		connSpec = deviceSplit[1]
 	}
 
-	if connSpec == "" {
+	// energy meters are received on any network interface unless specified
+	isSpeedwire := strings.HasPrefix(strings.ToUpper(meterDef), speedwire.Type+":")
+	if isSpeedwire && len(deviceSplit) < 2 {
+		connSpec = ""
+	}
+
+	if connSpec == "" && !isSpeedwire {
 		log.Fatalf("Cannot parse connect string- missing physical device or connection for %s. See -h for help.", deviceDef)
 	}
 
@@ -204,6 +796,9 @@ func (conf *DeviceConfigHandler) CreateDeviceFromSpec(deviceDef string, timeout
 	if len(strings.TrimSpace(meterType)) == 0 {
 		log.Fatalf("Cannot parse device definition- meter type empty: %s. See -h for help.", meterDef)
 	}
+	if t := strings.ToUpper(meterType); t == rest.Type || t == server.MqttInputType {
+		log.Fatalf("Device %s requires configuration using config file. See -h for help.", meterDef)
+	}
 
 	var subdevice int
 	devIDSplit := strings.SplitN(devID, ".", 2)
@@ -224,10 +819,24 @@ func (conf *DeviceConfigHandler) CreateDeviceFromSpec(deviceDef string, timeout
 
 	// If this is an RTU over TCP device, a default RTU over TCP should already
 	// have been created of the --rtu flag was specified. We'll not re-check this here.
-	manager := conf.ConnectionManager(connSpec, false, 0, "", timeout)
+	var manager *meters.Manager
+	if isSpeedwire {
+		manager = conf.SpeedwireManager(connSpec)
+	} else if isStreamType(meterType) {
+		manager = conf.StreamManager(connSpec, meterType)
+	} else {
+		manager = conf.ConnectionManager(connSpec, false, 0, "", timeout)
+	}
 
-	meter := conf.createDeviceForManager(manager, meterType, subdevice)
+	meter := conf.createDeviceForManager(manager, meterType, uint8(id), subdevice)
 	if err := manager.Add(uint8(id), meter); err != nil {
 		log.Fatalf("Error adding device %s: %v. See -h for help.", meterDef, err)
 	}
+
+	conf.Devices[meter] = DeviceConfig{
+		Type:      meterType,
+		ID:        uint8(id),
+		SubDevice: subdevice,
+		Adapter:   connSpec,
+	}
 }
@@ -40,7 +40,7 @@ func init() {
 		"adapter", "a",
 		"",
 		`Default MODBUS adapter. This option can be used if all devices are attached to a single adapter.
-Can be either an RTU device (/dev/ttyUSB0) or TCP socket (localhost:502).
+Can be either an RTU device (/dev/ttyUSB0 or usb:vid=0403,pid=6001,serial=A10KZ1XY) or TCP socket (localhost:502).
 The default adapter can be overridden per device`,
 	)
 	rootCmd.PersistentFlags().IntP(
@@ -51,7 +51,7 @@ The default adapter can be overridden per device`,
 	rootCmd.PersistentFlags().String(
 		"comset",
 		"8N1",
-		`Communication parameters for default adapter, either 8N1 or 8E1.
+		`Communication parameters for default adapter, either 8N1, 8N2, 8E1 or 7E1 (D0 optical heads).
 Only applicable if the default adapter is an RTU device`,
 	)
 	rootCmd.PersistentFlags().Duration(
@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"context"
-	golog "log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,6 +17,8 @@ import (
 	"github.com/spf13/viper"
 	latest "github.com/tcnksm/go-latest"
 
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
 	"github.com/volkszaehler/mbmd/server"
 )
 
@@ -76,6 +81,17 @@ any type is considered valid.
 		time.Second,
 		"Rate limit. Devices will not be queried more often than rate limit.",
 	)
+	runCmd.PersistentFlags().Duration(
+		"backoff",
+		5*time.Minute,
+		"Maximum retry interval for offline devices. Retries back off exponentially up to this limit.",
+	)
+	runCmd.PersistentFlags().String(
+		"counters",
+		"",
+		`File persisting energy counters (Import, Export, Sum) to publish continuous virtual totals
+(VirtualImport, VirtualExport, VirtualSum) across counter resets, wraps and meter replacement. Set empty to disable.`,
+	)
 	runCmd.PersistentFlags().String(
 		"api",
 		"0.0.0.0:8080",
@@ -86,6 +102,22 @@ any type is considered valid.
 		"",
 		"Add pprof debug information",
 	)
+	runCmd.PersistentFlags().String(
+		"log-format",
+		"text",
+		"Log format: text (logfmt) or json",
+	)
+	runCmd.PersistentFlags().String(
+		"log-level",
+		"info",
+		"Default log level: debug, info, warn or error. Verbose mode defaults to debug.",
+	)
+	runCmd.PersistentFlags().StringToString(
+		"log-levels",
+		nil,
+		`Log levels per subsystem (bus, handler, mqtt, homie, influx, sparkplug, opcua, volkszaehler, webhook, spool, http, main).
+  Example: --log-levels bus=debug,mqtt=warn`,
+	)
 	runCmd.PersistentFlags().StringP(
 		"mqtt-broker", "m",
 		"",
@@ -121,10 +153,75 @@ any type is considered valid.
 		"homie",
 		"MQTT Homie IoT discovery base topic (homieiot.github.io). Set empty to disable.",
 	)
+	runCmd.PersistentFlags().Int(
+		"mqtt-homieversion",
+		4,
+		"MQTT Homie convention version (4 or 5). Homie 5 devices are published below <homie>/5.",
+	)
+	runCmd.PersistentFlags().Bool(
+		"quality-publish",
+		false,
+		"Publish implausible readings tagged with their quality instead of dropping them, where outputs support quality flags",
+	)
+	runCmd.PersistentFlags().String(
+		"spool-dir",
+		"",
+		`Directory for spooling readings to disk while MQTT, InfluxDB or webhook outputs are unavailable.
+Spooled readings are forwarded in order once the output is available again. Set empty to disable.`,
+	)
+	runCmd.PersistentFlags().Int(
+		"spool-size",
+		100,
+		"Maximum spool size per output in MB. Oldest readings are dropped if exceeded.",
+	)
+	runCmd.PersistentFlags().Duration(
+		"spool-age",
+		0,
+		"Maximum age of spooled readings. Older readings are dropped. Zero for unlimited.",
+	)
+	runCmd.PersistentFlags().Int(
+		"queue-size",
+		server.DefaultQueueSize,
+		"Maximum number of readings queued per output",
+	)
+	runCmd.PersistentFlags().String(
+		"queue-policy",
+		"block",
+		`Overflow policy for output queues (block, dropoldest, dropnewest, coalesce).
+Block delays device polling but loses no readings. Coalesce keeps only the latest queued reading per device and measurement.`,
+	)
+	runCmd.PersistentFlags().String(
+		"opcua-listen",
+		"",
+		`OPC UA server listen address. ex: :4840
+Devices are exposed as objects below the Objects folder. Set empty to disable.`,
+	)
 	runCmd.PersistentFlags().StringP(
 		"influx-url", "i",
 		"",
-		"InfluxDB URL. ex: http://10.10.1.1:8086",
+		`InfluxDB URL. ex: http://10.10.1.1:8086
+Line protocol is written to file:///path, udp://host:port, tcp://host:port or unix:///path urls.`,
+	)
+	runCmd.PersistentFlags().String(
+		"influx-api",
+		"v2",
+		"InfluxDB http API version: v2 (InfluxDB 1.8+) or v1",
+	)
+	runCmd.PersistentFlags().Bool(
+		"influx-batch",
+		false,
+		"Write one point per device and query cycle with each measurement as field",
+	)
+	runCmd.PersistentFlags().Bool(
+		"influx-metadata",
+		false,
+		"Tag points with device manufacturer, model, serial and configured name",
+	)
+	runCmd.PersistentFlags().StringToString(
+		"influx-tags",
+		nil,
+		`Static tags added to each point.
+  Example: --influx-tags site=home,building=garage`,
 	)
 	runCmd.PersistentFlags().String(
 		"influx-database",
@@ -163,10 +260,169 @@ any type is considered valid.
 	bindPflagsWithExceptions(pflags, "devices")
 
 	// mqtt
-	bindPFlagsWithPrefix(pflags, "mqtt", "broker", "topic", "user", "password", "clientid", "qos", "homie")
+	bindPFlagsWithPrefix(pflags, "mqtt", "broker", "topic", "user", "password", "clientid", "qos", "homie", "homieversion")
+
+	// logging
+	bindPFlagsWithPrefix(pflags, "log", "format", "level", "levels")
+
+	// quality
+	bindPFlagsWithPrefix(pflags, "quality", "publish")
+
+	// spool
+	bindPFlagsWithPrefix(pflags, "spool", "dir", "size", "age")
+
+	// queue
+	bindPFlagsWithPrefix(pflags, "queue", "size", "policy")
+
+	// opcua
+	bindPFlagsWithPrefix(pflags, "opcua", "listen")
 
 	// influx
-	bindPFlagsWithPrefix(pflags, "influx", "url", "database", "measurement", "organization", "token", "user", "password")
+	bindPFlagsWithPrefix(pflags, "influx", "url", "api", "database", "measurement", "organization", "token", "user", "password", "batch", "metadata", "tags")
+}
+
+// queueOptions returns the output's queue options, applying configured per-output policies
+func queueOptions(conf QueueConfig, name string) server.QueueOptions {
+	policy := viper.GetString("queue.policy")
+	if p, ok := conf.Outputs[name]; ok {
+		policy = p
+	}
+
+	overflow, err := server.OverflowPolicyString(policy)
+	if err != nil {
+		log.Fatalf("config: queue %s: %v", name, err)
+	}
+
+	return server.QueueOptions{
+		Size:   viper.GetInt("queue.size"),
+		Policy: overflow,
+	}
+}
+
+// attachRunner attaches the named output's runner using its configured queue
+func attachRunner(tee *server.Broadcaster, conf QueueConfig, name string, run func(<-chan server.QuerySnip)) {
+	tee.AttachQueuedRunner(name, queueOptions(conf, name), server.NewSnipRunner(run))
+}
+
+// attachOutput attaches the output's runner to the broadcaster. If spooling is configured,
+// readings are spooled to disk and forwarded instead. Returns true if spooled.
+func attachOutput(tee *server.Broadcaster, status *server.Status, conf QueueConfig, name string, run func(<-chan server.QuerySnip), fwd server.Forwarder) bool {
+	dir := viper.GetString("spool.dir")
+	if dir == "" {
+		attachRunner(tee, conf, name, run)
+		return false
+	}
+
+	spool, err := server.NewSpool(name, fwd, server.SpoolOptions{
+		Dir:     dir,
+		MaxSize: int64(viper.GetInt("spool.size")) << 20,
+		MaxAge:  viper.GetDuration("spool.age"),
+	})
+	if err != nil {
+		log.Fatalf("spool: %s: %v", name, err)
+	}
+
+	status.AddOutput(spool)
+	attachRunner(tee, conf, name, spool.Run)
+
+	return true
+}
+
+// createSparkplug creates a Sparkplug B edge node publisher
+func createSparkplug(conf SparkplugConfig, qe *server.QueryEngine, cc <-chan server.ControlSnip) (*server.SparkplugRunner, error) {
+	if conf.ClientID == "" {
+		conf.ClientID = "mbmd-sparkplug"
+	}
+	if conf.Group == "" {
+		conf.Group = "mbmd"
+	}
+	if conf.Node == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		conf.Node = strings.Split(hostname, ".")[0]
+	}
+
+	options := server.NewMqttOptions(conf.Broker, conf.User, conf.Password, conf.ClientID)
+
+	tlsConf, err := server.MqttTLS(conf.TLS).Config()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf != nil {
+		options.SetTLSConfig(tlsConf)
+	}
+
+	opts := server.SparkplugOptions{
+		Group: conf.Group,
+		Node:  conf.Node,
+	}
+
+	return server.NewSparkplugRunner(options, opts, byte(conf.Qos), qe, cc)
+}
+
+// createMqttTarget creates a publisher for an MQTT target configuration
+func createMqttTarget(conf MqttTargetConfig, i int, qe *server.QueryEngine) (*server.MqttRunner, error) {
+	if conf.Broker == "" {
+		return nil, errors.New("missing broker")
+	}
+	if conf.Topic == "" {
+		conf.Topic = "mbmd"
+	}
+	if conf.ClientID == "" {
+		// client ids must be unique per broker
+		conf.ClientID = fmt.Sprintf("mbmd-%d", i+1)
+	}
+
+	payload, err := server.PayloadFormatString(conf.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	options := server.NewMqttOptions(conf.Broker, conf.User, conf.Password, conf.ClientID)
+
+	tlsConf, err := server.MqttTLS(conf.TLS).Config()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf != nil {
+		options.SetTLSConfig(tlsConf)
+	}
+
+	target := server.MqttTarget{
+		Topic:    conf.Topic,
+		Template: conf.Template,
+		Payload:  payload,
+		Qos:      byte(conf.Qos),
+		Retain:   conf.Retain,
+		Throttle: conf.Throttle,
+	}
+
+	return server.NewMqttRunner(options, target, qe)
+}
+
+// createMqttInput creates the input receiving devices' readings from the default MQTT broker
+func createMqttInput(confHandler *DeviceConfigHandler, publishInvalid bool) (*server.MqttInput, error) {
+	broker := viper.GetString("mqtt.broker")
+	if broker == "" {
+		return nil, errors.New("missing broker")
+	}
+
+	devices, err := confHandler.MqttInputDevices(publishInvalid)
+	if err != nil {
+		return nil, err
+	}
+
+	// client ids must be unique per broker
+	clientID := "mbmd-input"
+	if id := viper.GetString("mqtt.clientid"); id != "" {
+		clientID = id + "-input"
+	}
+
+	options := server.NewMqttOptions(broker, viper.GetString("mqtt.user"), viper.GetString("mqtt.password"), clientID)
+
+	return server.NewMqttInput(options, byte(viper.GetInt("mqtt.qos")), devices), nil
 }
 
 // checkVersion validates if updates are available
@@ -199,7 +455,39 @@ func validateRemainingKeys(cmd *cobra.Command, other map[string]any) {
 	}
 }
 
+// configureLogging sets log format and levels from configuration
+func configureLogging(cmd *cobra.Command) {
+	conf := logger.Config{
+		Format: viper.GetString("log.format"),
+		Level:  viper.GetString("log.level"),
+		Levels: viper.GetStringMapString("log.levels"),
+	}
+
+	// verbose mode defaults to debug level unless configured explicitly
+	if viper.GetBool("verbose") && !viper.IsSet("log.level") && !cmd.Flags().Changed("log-level") {
+		conf.Level = "debug"
+	}
+
+	// raw mode enables bus logging
+	if viper.GetBool("raw") {
+		if _, ok := conf.Levels[logger.Bus]; !ok {
+			if conf.Levels == nil {
+				conf.Levels = make(map[string]string)
+			}
+			conf.Levels[logger.Bus] = "debug"
+		}
+	}
+
+	if err := logger.Configure(os.Stderr, conf); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	log = logger.Get(logger.Main)
+}
+
 func run(cmd *cobra.Command, args []string) {
+	configureLogging(cmd)
+
 	log.Printf("mbmd %s (%s)", server.Version, server.Commit)
 	if len(args) > 0 {
 		log.Fatalf("excess arguments, aborting: %v", args)
@@ -223,11 +511,11 @@ func run(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	var conf Config
 	if cfgFile != "" {
 		// config file found
 		log.Printf("config: using %s", viper.ConfigFileUsed())
 
-		var conf Config
 		if err := viper.UnmarshalExact(&conf); err != nil {
 			log.Fatalf("config: failed parsing config file %s: %v", cfgFile, err)
 		}
@@ -239,7 +527,15 @@ func run(cmd *cobra.Command, args []string) {
 		if len(devices) == 0 {
 			// add adapters from configuration
 			for _, a := range conf.Adapters {
-				confHandler.ConnectionManager(a.Device, a.RTU, a.Baudrate, a.Comset, viper.GetDuration("timeout"))
+				manager := confHandler.ConnectionManager(a.Device, a.RTU, a.Baudrate, a.Comset, viper.GetDuration("timeout"))
+
+				if a.Concurrency > 1 {
+					if _, ok := manager.Conn.(*meters.TCP); !ok {
+						log.Printf("config: concurrency is only supported for TCP adapters, ignoring for %s", a.Device)
+						continue
+					}
+					manager.Concurrency = a.Concurrency
+				}
 			}
 
 			// add devices from configuration
@@ -249,17 +545,43 @@ func run(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if countDevices(confHandler.Managers) == 0 {
+	if countDevices(confHandler.Managers)+len(confHandler.MqttDevices) == 0 {
 		log.Fatal("config: no devices found - terminating")
 	}
 
-	// raw log
-	if viper.GetBool("raw") {
-		setLogger(confHandler.Managers, golog.New(os.Stderr, "", golog.LstdFlags))
+	// raw bus log
+	if busLog := logger.Get(logger.Bus); busLog.Enabled(context.Background(), slog.LevelDebug) {
+		for _, m := range confHandler.Managers {
+			m.Conn.Logger(busLog.With("adapter", m.Conn.String()).Printer(slog.LevelDebug))
+		}
 	}
 
 	// query engine
 	qe := server.NewQueryEngine(confHandler.Managers)
+	qe.SetMaxBackoff(viper.GetDuration("backoff"))
+	for dev, opts := range confHandler.DeviceOptions(viper.GetBool("quality.publish")) {
+		qe.Configure(dev, opts)
+	}
+
+	// energy counter continuity
+	var counters *server.Counters
+	if file := viper.GetString("counters"); file != "" {
+		var err error
+		if counters, err = server.NewCounters(file); err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		qe.SetCounters(counters)
+	}
+
+	// devices received via MQTT
+	if len(confHandler.MqttDevices) > 0 {
+		input, err := createMqttInput(confHandler, viper.GetBool("quality.publish"))
+		if err != nil {
+			log.Fatalf("config: mqtt devices: %v", err)
+		}
+		input.Counters = counters
+		qe.AddInput(input)
+	}
 
 	// results- and control channels
 	rc := make(chan server.QuerySnip)
@@ -273,21 +595,29 @@ func run(cmd *cobra.Command, args []string) {
 	teeC := server.NewBroadcaster(server.FromControlChannel(cc))
 	go teeC.Run()
 
+	// control messages are coalesced per device
+	controlQueue := server.QueueOptions{Size: server.DefaultQueueSize, Policy: server.OverflowCoalesce}
+
 	// status cache (always needed to consume control messages)
-	status := server.NewStatus(qe, server.ToControlChannel(teeC.Attach()))
+	status := server.NewStatus(qe, server.ToControlChannel(teeC.AttachQueue("status", controlQueue)))
+	status.AddQueues(tee)
+	status.AddQueues(teeC)
 
 	// web server
 	if viper.GetString("api") != "" {
 		// measurement cache for REST api
 		cache := server.NewCache(cacheDuration, status, viper.GetBool("verbose"))
-		tee.AttachRunner(server.NewSnipRunner(cache.Run))
+		attachRunner(tee, conf.Queue, "cache", cache.Run)
 
 		// websocket hub
 		hub := server.NewSocketHub(status)
-		tee.AttachRunner(server.NewSnipRunner(hub.Run))
+		attachRunner(tee, conf.Queue, "websocket", hub.Run)
 
 		// http daemon
 		httpd := server.NewHttpd(hub, status, qe, cache)
+		if counters != nil {
+			httpd.AddCounters(counters)
+		}
 		go httpd.Run(viper.GetString("api"))
 
 		if viper.GetBool("profile") {
@@ -300,8 +630,6 @@ func run(cmd *cobra.Command, args []string) {
 	// MQTT client
 	if viper.GetString("mqtt.broker") != "" {
 		qos := byte(viper.GetInt("mqtt.qos"))
-		verbose := viper.GetBool("verbose")
-
 		// default mqtt runner
 		if topic := viper.GetString("mqtt.topic"); topic != "" {
 			options := server.NewMqttOptions(
@@ -310,8 +638,15 @@ func run(cmd *cobra.Command, args []string) {
 				viper.GetString("mqtt.password"),
 				viper.GetString("mqtt.clientid"),
 			)
-			mqttRunner := server.NewMqttRunner(options, qos, topic, verbose)
-			tee.AttachRunner(server.NewSnipRunner(mqttRunner.Run))
+			target := server.MqttTarget{
+				Topic: topic,
+				Qos:   qos,
+			}
+			mqttRunner, err := server.NewMqttRunner(options, target, qe)
+			if err != nil {
+				log.Fatalf("config: %v", err)
+			}
+			attachOutput(tee, status, conf.Queue, "mqtt", mqttRunner.Run, mqttRunner)
 		}
 
 		// homie runner
@@ -322,25 +657,95 @@ func run(cmd *cobra.Command, args []string) {
 				viper.GetString("mqtt.password"),
 				viper.GetString("mqtt.clientid"),
 			)
-			cc := server.ToControlChannel(teeC.Attach())
-			homieRunner := server.NewHomieRunner(qe, cc, options, qos, topic, verbose)
-			tee.AttachRunner(server.NewSnipRunner(homieRunner.Run))
+			cc := server.ToControlChannel(teeC.AttachQueue("homie-status", controlQueue))
+			homieRunner, err := server.NewHomieRunner(qe, cc, options, qos, topic, viper.GetInt("mqtt.homieversion"))
+			if err != nil {
+				log.Fatalf("config: %v", err)
+			}
+			attachRunner(tee, conf.Queue, "homie", homieRunner.Run)
 		}
 	}
 
+	// additional MQTT targets
+	for i, t := range conf.Mqtt.Targets {
+		mqttRunner, err := createMqttTarget(t, i, qe)
+		if err != nil {
+			log.Fatalf("config: mqtt target %d: %v", i+1, err)
+		}
+		attachOutput(tee, status, conf.Queue, fmt.Sprintf("mqtt-%d", i+1), mqttRunner.Run, mqttRunner)
+	}
+
+	// Sparkplug B edge node
+	if conf.Sparkplug.Broker != "" {
+		cc := server.ToControlChannel(teeC.AttachQueue("sparkplug-status", controlQueue))
+		sp, err := createSparkplug(conf.Sparkplug, qe, cc)
+		if err != nil {
+			log.Fatalf("config: sparkplug: %v", err)
+		}
+		attachRunner(tee, conf.Queue, "sparkplug", sp.Run)
+	}
+
+	// OPC UA server
+	if viper.GetString("opcua.listen") != "" {
+		cc := server.ToControlChannel(teeC.AttachQueue("opcua-status", controlQueue))
+		ua, err := server.NewOpcUaServer(server.OpcUaOptions{
+			Listen: viper.GetString("opcua.listen"),
+		}, qe, cc)
+		if err != nil {
+			log.Fatalf("config: opcua: %v", err)
+		}
+		attachRunner(tee, conf.Queue, "opcua", ua.Run)
+	}
+
 	// InfluxDB client
 	if viper.GetString("influx.url") != "" {
-		influx := server.NewInfluxClient(
-			viper.GetString("influx.url"),
-			viper.GetString("influx.database"),
-			viper.GetString("influx.measurement"),
-			viper.GetString("influx.organization"),
-			viper.GetString("influx.token"),
-			viper.GetString("influx.user"),
-			viper.GetString("influx.password"),
-		)
+		influx := server.NewInfluxClient(server.InfluxOptions{
+			URL:          viper.GetString("influx.url"),
+			API:          viper.GetString("influx.api"),
+			Database:     viper.GetString("influx.database"),
+			Measurement:  viper.GetString("influx.measurement"),
+			Organization: viper.GetString("influx.organization"),
+			Token:        viper.GetString("influx.token"),
+			User:         viper.GetString("influx.user"),
+			Password:     viper.GetString("influx.password"),
+			Batch:        viper.GetBool("influx.batch"),
+			Metadata:     viper.GetBool("influx.metadata"),
+			Tags:         viper.GetStringMapString("influx.tags"),
+		}, qe)
+
+		attachOutput(tee, status, conf.Queue, "influx", influx.Run, influx)
+	}
 
-		tee.AttachRunner(server.NewSnipRunner(influx.Run))
+	// volkszaehler middleware
+	if conf.Volkszaehler.URL != "" {
+		opts, err := conf.Volkszaehler.VolkszaehlerOptions()
+		if err != nil {
+			log.Fatalf("config: volkszaehler: %v", err)
+		}
+
+		vz, err := server.NewVolkszaehler(opts, qe)
+		if err != nil {
+			log.Fatalf("config: volkszaehler: %v", err)
+		}
+
+		attachRunner(tee, conf.Queue, "volkszaehler", vz.Run)
+	}
+
+	// webhooks
+	for i, c := range conf.Webhooks {
+		opts, err := c.WebhookOptions()
+		if err != nil {
+			log.Fatalf("config: webhook %d: %v", i+1, err)
+		}
+
+		webhook, err := server.NewWebhook(opts, qe)
+		if err != nil {
+			log.Fatalf("config: webhook %d: %v", i+1, err)
+		}
+
+		if !attachOutput(tee, status, conf.Queue, fmt.Sprintf("webhook-%d", i+1), webhook.Run, webhook) {
+			status.AddOutput(webhook)
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -355,5 +760,12 @@ func run(cmd *cobra.Command, args []string) {
 
 	// wait for Run methods attached to tee to finish
 	<-tee.Done()
+
+	if counters != nil {
+		if err := counters.Save(); err != nil {
+			log.Printf("saving counters failed: %v", err)
+		}
+	}
+
 	log.Println("stopped")
 }
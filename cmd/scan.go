@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/meters/mbus"
 	"github.com/volkszaehler/mbmd/meters/rs485"
 	"github.com/volkszaehler/mbmd/meters/sunspec"
 )
@@ -25,12 +26,27 @@ For RTU devices the common value is most likely the L1 voltage,
 for TCP devices it tries to read the SunSpec common block.
 If successful the detected device type and device id are displayed.
 
+With --mbus the adapter is scanned for M-Bus devices instead, either by primary
+address (0 to 250) or, with --mbus-secondary, by secondary address search.
+M-Bus adapters default to 2400 8E1 unless baudrate or comset are given.
+
 Scan will ignore the config file and requires adapter configuration using command line.`,
 	Run: scan,
 }
 
 func init() {
 	rootCmd.AddCommand(scanCmd)
+
+	scanCmd.Flags().Bool(
+		"mbus",
+		false,
+		"Scan for M-Bus devices",
+	)
+	scanCmd.Flags().Bool(
+		"mbus-secondary",
+		false,
+		"Scan M-Bus secondary addresses instead of primary addresses",
+	)
 }
 
 func addDesc(s *string, key string, val string) {
@@ -68,6 +84,11 @@ func scan(cmd *cobra.Command, args []string) {
 		log.Fatal("missing adapter configuration")
 	}
 
+	if mb, _ := cmd.Flags().GetBool("mbus"); mb {
+		scanMbus(cmd, adapter)
+		return
+	}
+
 	conn := createConnection(adapter, viper.GetBool("rtu"), viper.GetInt("baudrate"), viper.GetString("comset"), viper.GetDuration("timeout"))
 	client := conn.ModbusClient()
 
@@ -154,3 +175,46 @@ SCAN:
 		"a known probe request. Devices with different " +
 		"function code definitions might not be detected.")
 }
+
+// scanMbus scans the adapter for M-Bus devices
+func scanMbus(cmd *cobra.Command, adapter string) {
+	baudrate, comset := 2400, "8E1"
+	if cmd.Flags().Changed("baudrate") {
+		baudrate = viper.GetInt("baudrate")
+	}
+	if cmd.Flags().Changed("comset") {
+		comset = viper.GetString("comset")
+	}
+
+	stream, err := meters.NewStream(adapter, baudrate, comset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stream.Close()
+
+	// raw log
+	if viper.GetBool("raw") {
+		stream.Logger(golog.New(os.Stderr, "", golog.LstdFlags))
+	}
+
+	var count int
+	found := func(id string, res *mbus.Response) {
+		count++
+		log.Printf("* %s type %s (Medium: %s Version: %d Serial: %s)",
+			id, res.Manufacturer, mbus.MediumName(res.Medium), res.Version, res.ID)
+	}
+
+	if secondary, _ := cmd.Flags().GetBool("mbus-secondary"); secondary {
+		log.Printf("starting M-Bus secondary address search on %s", adapter)
+		mbus.ScanSecondary(stream, func(res *mbus.Response) {
+			found(fmt.Sprintf("%s:1.%s", mbus.Type, res.ID), res)
+		})
+	} else {
+		log.Printf("starting M-Bus primary address scan on %s", adapter)
+		mbus.ScanPrimary(stream, func(address byte, res *mbus.Response) {
+			found(fmt.Sprintf("%s:%d", mbus.Type, address), res)
+		})
+	}
+
+	log.Printf("found %d M-Bus devices", count)
+}
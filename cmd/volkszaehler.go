@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/server"
+)
+
+// volkszaehlerCmd represents the volkszaehler command
+var volkszaehlerCmd = &cobra.Command{
+	Use:   "volkszaehler",
+	Short: "Create missing volkszaehler middleware channels",
+	Long: `Volkszaehler creates middleware channels for all configured volkszaehler channels
+without uuid. The channel type is derived from the measurement's unit (powersensor for power,
+electric meter for energy counters) unless configured explicitly.
+The resulting channel configuration is printed for adding it to the config file.`,
+	Run: volkszaehler,
+}
+
+func init() {
+	rootCmd.AddCommand(volkszaehlerCmd)
+}
+
+func volkszaehler(cmd *cobra.Command, args []string) {
+	if cfgFile == "" {
+		log.Fatal("config: missing config file")
+	}
+
+	var conf VolkszaehlerConfig
+	if err := viper.UnmarshalKey("volkszaehler", &conf); err != nil {
+		log.Fatalf("config: failed parsing config file %s: %v", cfgFile, err)
+	}
+
+	if conf.URL == "" {
+		log.Fatal("config: missing volkszaehler url")
+	}
+
+	for i, c := range conf.Channels {
+		if c.UUID != "" {
+			continue
+		}
+
+		m, err := meters.MeasurementString(c.Measurement)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+
+		typ := c.Type
+		if typ == "" {
+			if typ, err = server.VolkszaehlerChannelType(m); err != nil {
+				log.Fatalf("config: %v", err)
+			}
+		}
+
+		title := c.Title
+		if title == "" {
+			description, _ := m.DescriptionAndUnit()
+			title = fmt.Sprintf("%s %s", c.Device, description)
+		}
+
+		uuid, err := server.CreateVolkszaehlerChannel(conf.URL, typ, title)
+		if err != nil {
+			log.Fatalf("creating channel %s: %v", title, err)
+		}
+
+		log.Printf("created %s channel %s: %s", typ, title, uuid)
+		conf.Channels[i].UUID = uuid
+	}
+
+	fmt.Println("volkszaehler:")
+	fmt.Println("  channels:")
+	for _, c := range conf.Channels {
+		fmt.Printf("  - device: %s\n", c.Device)
+		fmt.Printf("    measurement: %s\n", c.Measurement)
+		fmt.Printf("    uuid: %s\n", c.UUID)
+		if c.Interval > 0 {
+			fmt.Printf("    interval: %s\n", c.Interval)
+		}
+	}
+}
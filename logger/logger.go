@@ -0,0 +1,206 @@
+// Package logger provides structured, leveled logging with per-subsystem verbosity
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Subsystems with individually configurable log levels
+const (
+	Main         = "main"
+	Bus          = "bus"
+	Handler      = "handler"
+	MQTT         = "mqtt"
+	Homie        = "homie"
+	Influx       = "influx"
+	Volkszaehler = "volkszaehler"
+	Webhook      = "webhook"
+	Spool        = "spool"
+	Sparkplug    = "sparkplug"
+	OPCUA        = "opcua"
+	HTTP         = "http"
+)
+
+var (
+	mu           sync.RWMutex
+	base         slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	defaultLevel              = new(slog.LevelVar)
+	levels                    = make(map[string]*slog.LevelVar)
+)
+
+// Config describes the logging configuration
+type Config struct {
+	Format string            // text (logfmt) or json
+	Level  string            // default level
+	Levels map[string]string // per-subsystem levels
+}
+
+// Configure sets output format and log levels for all loggers, including already created ones
+func Configure(w io.Writer, conf Config) error {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var h slog.Handler
+	switch strings.ToLower(conf.Format) {
+	case "", "text", "logfmt":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format: %s", conf.Format)
+	}
+
+	if conf.Level != "" {
+		level, err := ParseLevel(conf.Level)
+		if err != nil {
+			return err
+		}
+		defaultLevel.Set(level)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	base = h
+
+	for _, l := range levels {
+		l.Set(defaultLevel.Level())
+	}
+
+	for subsystem, lvl := range conf.Levels {
+		level, err := ParseLevel(lvl)
+		if err != nil {
+			return err
+		}
+		levelVar(strings.ToLower(subsystem)).Set(level)
+	}
+
+	return nil
+}
+
+// ParseLevel parses a level name like debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if strings.EqualFold(s, "warning") {
+		s = "warn"
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// levelVar returns the subsystem's level. Must be called with lock held.
+func levelVar(subsystem string) *slog.LevelVar {
+	l, ok := levels[subsystem]
+	if !ok {
+		l = new(slog.LevelVar)
+		l.Set(defaultLevel.Level())
+		levels[subsystem] = l
+	}
+	return l
+}
+
+// Get returns the logger for the given subsystem
+func Get(subsystem string) *Logger {
+	mu.Lock()
+	level := levelVar(subsystem)
+	mu.Unlock()
+
+	h := &handler{level: level}
+	return &Logger{slog.New(h).With("subsystem", subsystem)}
+}
+
+// handler delegates to the configured output handler at log time,
+// allowing loggers to be created before configuration
+type handler struct {
+	level *slog.LevelVar
+	ops   []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	mu.RLock()
+	out := base
+	mu.RUnlock()
+
+	for _, op := range h.ops {
+		out = op(out)
+	}
+
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	return &handler{
+		level: h.level,
+		ops:   append(h.ops[:len(h.ops):len(h.ops)], op),
+	}
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler {
+		return out.WithAttrs(attrs)
+	})
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler {
+		return out.WithGroup(name)
+	})
+}
+
+// Logger is a structured subsystem logger. It also implements the printf-style
+// logging interfaces used by the modbus implementation and the command line tools.
+type Logger struct {
+	*slog.Logger
+}
+
+// With returns a logger that includes the given attributes in each output
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l.Logger.With(args...)}
+}
+
+// Printf logs a formatted message at info level
+func (l *Logger) Printf(format string, v ...any) {
+	l.Info(fmt.Sprintf(format, v...))
+}
+
+// Println logs a message at info level
+func (l *Logger) Println(v ...any) {
+	l.Info(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+// Fatalf logs a formatted message at error level and terminates
+func (l *Logger) Fatalf(format string, v ...any) {
+	l.Error(fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+// Fatal logs a message at error level and terminates
+func (l *Logger) Fatal(v ...any) {
+	l.Error(fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// Printer returns a printf-style logger that logs at the given level
+func (l *Logger) Printer(level slog.Level) *Printer {
+	return &Printer{l, level}
+}
+
+// Printer adapts a Logger to printf-style logging at fixed level
+type Printer struct {
+	l     *Logger
+	level slog.Level
+}
+
+// Printf logs a formatted message
+func (p *Printer) Printf(format string, v ...any) {
+	p.l.Log(context.Background(), p.level, strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
@@ -0,0 +1,242 @@
+// Package d0 implements meters with IEC 62056-21 (D0) optical interfaces
+// that are read out in protocol mode A, B or C.
+package d0
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Type is the device type of D0 meters
+const Type = "D0"
+
+const (
+	// idleTimeout is the maximum time without received characters during readout
+	idleTimeout = 3 * time.Second
+	// switchDelay is the delay before switching baud rates after sending the acknowledgement
+	switchDelay = 300 * time.Millisecond
+)
+
+var (
+	requestMessage = []byte("/?!\r\n")
+	errTimeout     = errors.New("d0: timeout")
+)
+
+// serial number data set addresses
+var serialAddresses = []string{"0.0.0", "1-0:0.0.0*255", "C.1.0", "0-0:C.1.0*255", "96.1.0", "0-0:96.1.0*255"}
+
+// Device is a D0 meter attached to a serial optical head
+type Device struct {
+	stream   *meters.Stream
+	baudrate int // sign-on baud rate
+
+	mu         sync.Mutex
+	unmapped   map[string]bool // unmapped data set addresses already logged
+	descriptor meters.DeviceDescriptor
+}
+
+// NewDevice creates a D0 device. The stream's baud rate is used for sign-on.
+func NewDevice(stream *meters.Stream) *Device {
+	return &Device{
+		stream:   stream,
+		baudrate: stream.Baudrate(),
+		unmapped: make(map[string]bool),
+		descriptor: meters.DeviceDescriptor{
+			Type: Type,
+		},
+	}
+}
+
+// reader reads messages from the stream
+type reader struct {
+	stream *meters.Stream
+	buf    []byte
+}
+
+// read reads until complete returns the message length
+func (r *reader) read(complete func([]byte) int) ([]byte, error) {
+	b := make([]byte, 256)
+	last := time.Now()
+
+	for {
+		if n := complete(r.buf); n > 0 {
+			res := r.buf[:n]
+			r.buf = r.buf[n:]
+			return res, nil
+		}
+
+		n, err := r.stream.Read(b)
+		if n > 0 {
+			r.buf = append(r.buf, b[:n]...)
+			last = time.Now()
+		}
+
+		if err != nil {
+			if !meters.IsTimeout(err) {
+				return nil, err
+			}
+			if time.Since(last) > idleTimeout {
+				return nil, errTimeout
+			}
+		}
+	}
+}
+
+// identification reads the identification message, skipping echoed requests
+func (r *reader) identification() (Identification, error) {
+	for {
+		line, err := r.read(func(b []byte) int {
+			return bytes.IndexByte(b, '\n') + 1
+		})
+		if err != nil {
+			return Identification{}, err
+		}
+
+		if i := bytes.IndexByte(line, '/'); i >= 0 && !bytes.Equal(line[i:], requestMessage) {
+			return ParseIdentification(line[i:])
+		}
+	}
+}
+
+// data reads the data message up to the block check character
+func (r *reader) data() ([]byte, error) {
+	return r.read(func(b []byte) int {
+		if i := bytes.IndexByte(b, etx); i >= 0 && len(b) > i+1 {
+			return i + 2
+		}
+		return 0
+	})
+}
+
+// readout performs a readout cycle
+func (d *Device) readout() (Identification, []DataSet, error) {
+	d.stream.SetBaudrate(d.baudrate)
+
+	if _, err := d.stream.Write(requestMessage); err != nil {
+		return Identification{}, nil, err
+	}
+
+	r := &reader{stream: d.stream}
+
+	id, err := r.identification()
+	if err != nil {
+		return id, nil, err
+	}
+
+	switch mode, baudrate := id.Mode(); mode {
+	case 'B':
+		d.stream.SetBaudrate(baudrate)
+
+	case 'C':
+		// propose the meter's baud rate unless the stream can't switch
+		c := id.Baud
+		if meters.IsTCPAddress(d.stream.String()) {
+			var ok bool
+			if c, ok = baudChar(d.baudrate); !ok {
+				c = '0'
+			}
+		}
+
+		// option select message for data readout
+		if _, err := d.stream.Write([]byte{ack, '0', c, '0', '\r', '\n'}); err != nil {
+			return id, nil, err
+		}
+
+		time.Sleep(switchDelay)
+		d.stream.SetBaudrate(300 << (c - '0'))
+	}
+
+	msg, err := r.data()
+	if err != nil {
+		return id, nil, err
+	}
+
+	ds, err := ParseData(msg)
+	return id, ds, err
+}
+
+// Initialize performs a readout and prepares the device descriptor
+func (d *Device) Initialize(client modbus.Client) error {
+	id, ds, err := d.readout()
+	if err != nil {
+		return err
+	}
+
+	d.descriptor.Manufacturer = id.Manufacturer
+	d.descriptor.Model = id.Model
+
+	for _, addr := range serialAddresses {
+		for _, s := range ds {
+			if s.Address == addr && s.Value != "" {
+				d.descriptor.Serial = s.Value
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// Descriptor returns the device descriptor
+func (d *Device) Descriptor() meters.DeviceDescriptor {
+	return d.descriptor
+}
+
+// results converts data sets to measurements. Unmapped data sets are logged once.
+func (d *Device) results(ds []DataSet) []meters.MeasurementResult {
+	res := make([]meters.MeasurementResult, 0, len(ds))
+	ts := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range ds {
+		m, v, ok := s.Measurement()
+		if !ok {
+			if !d.unmapped[s.Address] {
+				d.unmapped[s.Address] = true
+				d.stream.Printf("d0: unmapped data set %s(%s) %s", s.Address, s.Value, s.Unit)
+			}
+			continue
+		}
+
+		res = append(res, meters.MeasurementResult{
+			Measurement: m,
+			Value:       v,
+			Timestamp:   ts,
+		})
+	}
+
+	return res
+}
+
+// Probe performs a readout and returns its first reading
+func (d *Device) Probe(client modbus.Client) (res meters.MeasurementResult, err error) {
+	_, ds, err := d.readout()
+	if err != nil {
+		return res, err
+	}
+
+	results := d.results(ds)
+	if len(results) == 0 {
+		return res, fmt.Errorf("d0: no known measurements")
+	}
+
+	return results[0], nil
+}
+
+// Query performs a readout and returns its readings
+func (d *Device) Query(client modbus.Client) ([]meters.MeasurementResult, error) {
+	_, ds, err := d.readout()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.results(ds), nil
+}
@@ -0,0 +1,164 @@
+package d0
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// control characters
+const (
+	stx = 0x02
+	etx = 0x03
+	ack = 0x06
+)
+
+// ErrChecksum is returned for data messages with invalid block check character
+var ErrChecksum = errors.New("d0: checksum mismatch")
+
+// Identification is the meter's identification message /XXXZ<ident>
+type Identification struct {
+	Manufacturer string // FLAG id
+	Baud         byte   // baud rate identification character
+	Model        string
+}
+
+// ParseIdentification parses the identification message
+func ParseIdentification(line []byte) (Identification, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 5 || line[0] != '/' {
+		return Identification{}, fmt.Errorf("d0: invalid identification %q", line)
+	}
+
+	model := string(line[5:])
+	// enhanced identification like \2 (mode E)
+	for len(model) >= 2 && model[0] == '\\' {
+		model = model[2:]
+	}
+
+	return Identification{
+		Manufacturer: string(line[1:4]),
+		Baud:         line[4],
+		Model:        strings.TrimSpace(model),
+	}, nil
+}
+
+// Mode returns the protocol mode (A, B or C) and baud rate indicated by the identification
+func (id Identification) Mode() (mode byte, baudrate int) {
+	switch {
+	case id.Baud >= '0' && id.Baud <= '6':
+		return 'C', 300 << (id.Baud - '0')
+	case id.Baud >= 'A' && id.Baud <= 'F':
+		return 'B', 600 << (id.Baud - 'A')
+	default:
+		return 'A', 0
+	}
+}
+
+// baudChar returns the mode C baud rate identification character
+func baudChar(baudrate int) (byte, bool) {
+	for c := byte('0'); c <= '6'; c++ {
+		if 300<<(c-'0') == baudrate {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// DataSet is a single data set address(value*unit)
+type DataSet struct {
+	Address string
+	Value   string
+	Unit    string
+}
+
+var dataSetRegex = regexp.MustCompile(`([^()\r\n]*)\(([^()]*)\)`)
+
+// ParseData verifies the data message STX ... ! CR LF ETX BCC and returns its data sets
+func ParseData(msg []byte) ([]DataSet, error) {
+	start := bytes.IndexByte(msg, stx)
+	if start < 0 || len(msg) < start+3 || msg[len(msg)-2] != etx {
+		return nil, fmt.Errorf("d0: invalid data message")
+	}
+
+	var bcc byte
+	for _, b := range msg[start+1 : len(msg)-1] {
+		bcc ^= b
+	}
+	if bcc != msg[len(msg)-1] {
+		return nil, ErrChecksum
+	}
+
+	block := msg[start+1 : len(msg)-2]
+	if end := bytes.LastIndexByte(block, '!'); end >= 0 {
+		block = block[:end]
+	}
+
+	var res []DataSet
+	for _, match := range dataSetRegex.FindAllSubmatch(block, -1) {
+		address := strings.TrimSpace(string(match[1]))
+		if address == "" {
+			continue // additional values of previous data set
+		}
+
+		value, unit, _ := strings.Cut(string(match[2]), "*")
+		res = append(res, DataSet{
+			Address: address,
+			Value:   value,
+			Unit:    unit,
+		})
+	}
+
+	return res, nil
+}
+
+// unitScale converts units to the measurement's base units
+var unitScale = map[string]float64{
+	"":      1,
+	"kWh":   1,
+	"Wh":    1e-3,
+	"kvarh": 1,
+	"varh":  1e-3,
+	"W":     1,
+	"kW":    1e3,
+	"var":   1,
+	"kvar":  1e3,
+	"V":     1,
+	"A":     1,
+	"Hz":    1,
+}
+
+// Measurement returns the data set's measurement and scaled value. Codes without
+// predefined measurement are passed through unscaled as dynamic OBIS measurement.
+func (ds DataSet) Measurement() (meters.Measurement, float64, bool) {
+	obis, err := meters.ParseOBIS(ds.Address)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	m, ok := obis.Measurement()
+	scale, known := unitScale[ds.Unit]
+
+	if !ok {
+		if m, ok = obis.Dynamic(); !ok {
+			return 0, 0, false
+		}
+		scale, known = 1, true
+	}
+
+	if !known {
+		return 0, 0, false
+	}
+
+	v, err := strconv.ParseFloat(ds.Value, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return m, v * scale, true
+}
@@ -0,0 +1,156 @@
+package d0
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// message wraps data lines into a data message with block check character
+func message(lines string) []byte {
+	msg := append([]byte{stx}, []byte(lines+"!\r\n")...)
+	msg = append(msg, etx)
+
+	var bcc byte
+	for _, b := range msg[1:] {
+		bcc ^= b
+	}
+
+	return append(msg, bcc)
+}
+
+const lines = "0.0.0(12345678)\r\n" +
+	"1.8.0(001234.5678*kWh)\r\n" +
+	"1.8.1(000100.0000*kWh)\r\n" +
+	"1.8.3(000005.0000*kWh)\r\n" +
+	"1-0:2.8.0*255(0000500*Wh)\r\n" +
+	"16.7.0(000.512*kW)\r\n" +
+	"32.7.0(230.1*V)(ignored)\r\n" +
+	"1.8.0*01(001000.0000*kWh)\r\n" +
+	"130.7.0(17.5*kW)\r\n" +
+	"F.F(00000000)\r\n"
+
+func TestParseIdentification(t *testing.T) {
+	tc := []struct {
+		line     string
+		id       Identification
+		mode     byte
+		baudrate int
+	}{
+		{"/ISk5MT174-0001\r\n", Identification{"ISk", '5', "MT174-0001"}, 'C', 9600},
+		{"/EMH4\\@01LZQJL0014F\r\n", Identification{"EMH", '4', "01LZQJL0014F"}, 'C', 4800},
+		{"/HAGxMA1234\r\n", Identification{"HAG", 'x', "MA1234"}, 'A', 0},
+		{"/LGZC ZMD\r\n", Identification{"LGZ", 'C', "ZMD"}, 'B', 2400},
+	}
+
+	for _, c := range tc {
+		id, err := ParseIdentification([]byte(c.line))
+		if err != nil || id != c.id {
+			t.Errorf("%q: unexpected identification %+v %v", c.line, id, err)
+		}
+
+		if mode, baudrate := id.Mode(); mode != c.mode || baudrate != c.baudrate {
+			t.Errorf("%q: unexpected mode %c %d", c.line, mode, baudrate)
+		}
+	}
+}
+
+func TestParseData(t *testing.T) {
+	ds, err := ParseData(message(lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds) != 10 || ds[0] != (DataSet{"0.0.0", "12345678", ""}) {
+		t.Fatalf("unexpected data sets %+v", ds)
+	}
+
+	expected := map[meters.Measurement]float64{
+		meters.Import:   1234.5678,
+		meters.ImportT1: 100,
+		meters.Indexed(meters.Import, meters.TariffIndex, 3): 5,
+		meters.Export:    0.5,
+		meters.Power:     512,
+		meters.VoltageL1: 230.1,
+	}
+
+	// unmapped codes are passed through as dynamic measurement in the meter's unit
+	dynamic, err := meters.MeasurementString("OBIS_130_7_0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected[dynamic] = 17.5
+
+	var count int
+	for _, s := range ds {
+		m, v, ok := s.Measurement()
+		if !ok {
+			continue
+		}
+
+		count++
+		if expected[m] != v {
+			t.Errorf("%s: unexpected value %s %f", s.Address, m, v)
+		}
+	}
+
+	if count != len(expected) {
+		t.Errorf("expected %d measurements, got %d", len(expected), count)
+	}
+
+	msg := message(lines)
+	msg[len(msg)-1] ^= 0xff
+	if _, err := ParseData(msg); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+}
+
+func TestReadoutModeC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// simulated meter
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if line, _ := r.ReadBytes('\n'); !bytes.Equal(line, requestMessage) {
+			t.Errorf("unexpected request %q", line)
+			return
+		}
+		_, _ = conn.Write([]byte("/ISk5MT174-0001\r\n"))
+
+		// tcp connections keep the sign-on baud rate
+		if line, _ := r.ReadBytes('\n'); !bytes.Equal(line, []byte{ack, '0', '0', '0', '\r', '\n'}) {
+			t.Errorf("unexpected option select %q", line)
+			return
+		}
+		_, _ = conn.Write(message(lines))
+	}()
+
+	stream, err := meters.NewStream(l.Addr().String(), 300, "7E1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	dev := NewDevice(stream)
+	if err := dev.Initialize(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if desc := dev.Descriptor(); desc.Manufacturer != "ISk" || desc.Model != "MT174-0001" || desc.Serial != "12345678" {
+		t.Errorf("unexpected descriptor %+v", desc)
+	}
+}
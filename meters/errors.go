@@ -1,6 +1,11 @@
 package meters
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grid-x/modbus"
+)
 
 var (
 	// ErrNaN indicates a NaN reading result
@@ -9,3 +14,80 @@ var (
 	// ErrPartiallyOpened indicates a partially opened device
 	ErrPartiallyOpened = errors.New("Device partially opened")
 )
+
+// UnsupportedError indicates a measurement not supported by the device.
+// Devices skip unsupported measurements in subsequent queries.
+type UnsupportedError struct {
+	Measurement Measurement
+	Err         error
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s not supported: %v", e.Measurement, e.Err)
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return e.Err
+}
+
+// leafErrors returns the errors joined by errors.Join
+func leafErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var res []error
+		for _, e := range joined.Unwrap() {
+			res = append(res, leafErrors(e)...)
+		}
+		return res
+	}
+
+	return []error{err}
+}
+
+// exception returns the modbus exception code of the error if any
+func exception(err error) (byte, bool) {
+	var mbErr *modbus.Error
+	if errors.As(err, &mbErr) {
+		return mbErr.ExceptionCode, true
+	}
+	return 0, false
+}
+
+// IsIllegalAddress returns true if the device rejected the request with an illegal data address exception
+func IsIllegalAddress(err error) bool {
+	code, ok := exception(err)
+	return ok && code == modbus.ExceptionCodeIllegalDataAddress
+}
+
+// IsTransportError returns true if any of the errors is not a response of the device.
+// Modbus exceptions are device responses unless raised by a gateway unable to reach the device.
+func IsTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, e := range leafErrors(err) {
+		code, ok := exception(e)
+		if !ok || code == modbus.ExceptionCodeGatewayPathUnavailable || code == modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unsupported returns the measurements of all unsupported errors contained in err
+func Unsupported(err error) []Measurement {
+	if err == nil {
+		return nil
+	}
+
+	var res []Measurement
+	for _, e := range leafErrors(err) {
+		var unsupported *UnsupportedError
+		if errors.As(e, &unsupported) {
+			res = append(res, unsupported.Measurement)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,217 @@
+package meters
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IndexType qualifies a base measurement by phase, string, tariff or battery number
+type IndexType int
+
+const (
+	NoIndex IndexType = iota
+	PhaseIndex
+	StringIndex
+	TariffIndex
+	BatteryIndex
+)
+
+// indexed measurements beyond the predefined constants are encoded as
+// flag | base << shift | type << 8 | index
+const (
+	indexedFlag  = 1 << 24
+	indexedShift = 12
+	maxIndex     = 0xFF
+)
+
+var (
+	indexSuffix = map[IndexType]string{
+		PhaseIndex:   "L",
+		StringIndex:  "S",
+		TariffIndex:  "T",
+		BatteryIndex: "B",
+	}
+
+	indexLabel = map[IndexType]string{
+		PhaseIndex:   "L%d",
+		StringIndex:  "String %d",
+		TariffIndex:  "Tariff %d",
+		BatteryIndex: "Battery %d",
+	}
+
+	indexedRE = regexp.MustCompile(`(?i)^(\w+?)([LSTB])(\d+)$`)
+
+	// lookup tables between predefined indexed measurements like DCPowerS1 and their base/index
+	lookup    = make(map[string]Measurement)
+	indexes   = make(map[Measurement]indexKey)
+	predefine = make(map[indexKey]Measurement)
+)
+
+type indexKey struct {
+	base  Measurement
+	typ   IndexType
+	index int
+}
+
+func init() {
+	for m, name := range names {
+		lookup[strings.ToLower(name)] = m
+	}
+
+	// register predefined measurements that follow the <base><suffix><index> naming scheme
+	for m, name := range names {
+		base, typ, index, ok := parseIndexed(name)
+		if !ok {
+			continue
+		}
+
+		key := indexKey{base, typ, index}
+		indexes[m] = key
+		predefine[key] = m
+	}
+}
+
+// parseIndexed splits a measurement name into its base measurement and index
+func parseIndexed(name string) (Measurement, IndexType, int, bool) {
+	match := indexedRE.FindStringSubmatch(name)
+	if len(match) != 4 {
+		return 0, NoIndex, 0, false
+	}
+
+	base, ok := lookup[strings.ToLower(match[1])]
+	if !ok {
+		return 0, NoIndex, 0, false
+	}
+
+	var typ IndexType
+	for t, suffix := range indexSuffix {
+		if strings.EqualFold(suffix, match[2]) {
+			typ = t
+		}
+	}
+
+	index, err := strconv.Atoi(match[3])
+	if err != nil || index < 1 || index > maxIndex {
+		return 0, NoIndex, 0, false
+	}
+
+	return base, typ, index, true
+}
+
+// Indexed returns the measurement for the given base measurement and index.
+// If a predefined measurement like DCPowerS1 or ImportT2 exists it is returned,
+// otherwise a dynamic measurement is created.
+func Indexed(base Measurement, typ IndexType, index int) Measurement {
+	if typ == NoIndex {
+		return base
+	}
+
+	if index < 1 || index > maxIndex {
+		panic(fmt.Sprintf("invalid index %d for measurement %s", index, base.String()))
+	}
+
+	if b, t, _ := base.Index(); t != NoIndex {
+		panic(fmt.Sprintf("cannot index already indexed measurement %s", b.String()))
+	}
+
+	if m, ok := predefine[indexKey{base, typ, index}]; ok {
+		return m
+	}
+
+	return Measurement(indexedFlag | int(base)<<indexedShift | int(typ)<<8 | index)
+}
+
+// Index returns the measurement's base measurement, index type and index.
+// For measurements without index the measurement itself and NoIndex are returned.
+func (m Measurement) Index() (Measurement, IndexType, int) {
+	if key, ok := indexes[m]; ok {
+		return key.base, key.typ, key.index
+	}
+
+	if m&indexedFlag != 0 {
+		v := int(m &^ indexedFlag)
+		return Measurement(v >> indexedShift), IndexType(v >> 8 & 0x0F), v & maxIndex
+	}
+
+	return m, NoIndex, 0
+}
+
+// String returns the measurement's canonical name
+func (m Measurement) String() string {
+	if name, ok := names[m]; ok {
+		return name
+	}
+
+	if base, typ, index := m.Index(); typ != NoIndex {
+		if _, ok := names[base]; ok {
+			return fmt.Sprintf("%s%s%d", base.String(), indexSuffix[typ], index)
+		}
+	}
+
+	if o, ok := m.OBIS(); ok {
+		return fmt.Sprintf("OBIS_%d_%d_%d", o[2], o[3], o[4])
+	}
+
+	return fmt.Sprintf("Measurement(%d)", int(m))
+}
+
+// IsAMeasurement returns true if the value is a predefined, valid indexed or OBIS measurement
+func (m Measurement) IsAMeasurement() bool {
+	if _, ok := names[m]; ok {
+		return true
+	}
+
+	if _, ok := m.OBIS(); ok {
+		return true
+	}
+
+	base, typ, _ := m.Index()
+	_, ok := names[base]
+	return ok && typ > NoIndex && typ <= BatteryIndex
+}
+
+// MeasurementString retrieves a measurement from its name, ignoring case.
+// Names of indexed measurements like DCPowerS7 or OBIS codes like OBIS_130_7_0
+// are resolved to their dynamic measurement.
+func MeasurementString(s string) (Measurement, error) {
+	if m, ok := lookup[strings.ToLower(s)]; ok {
+		return m, nil
+	}
+
+	if base, typ, index, ok := parseIndexed(s); ok {
+		return Indexed(base, typ, index), nil
+	}
+
+	if m, ok := parseOBISName(s); ok {
+		return m, nil
+	}
+
+	return 0, fmt.Errorf("%s does not belong to Measurement values", s)
+}
+
+// MeasurementValues returns all predefined measurements
+func MeasurementValues() []Measurement {
+	res := make([]Measurement, 0, len(names))
+	for m := range names {
+		res = append(res, m)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	return res
+}
+
+// MeasurementStrings returns the names of all predefined measurements
+func MeasurementStrings() []string {
+	values := MeasurementValues()
+
+	res := make([]string, len(values))
+	for i, m := range values {
+		res[i] = m.String()
+	}
+
+	return res
+}
@@ -0,0 +1,131 @@
+package meters
+
+import "testing"
+
+func TestIndexedPredefined(t *testing.T) {
+	tc := []struct {
+		base  Measurement
+		typ   IndexType
+		index int
+		m     Measurement
+	}{
+		{DCPower, StringIndex, 1, DCPowerS1},
+		{DCEnergy, StringIndex, 4, DCEnergyS4},
+		{Import, TariffIndex, 2, ImportT2},
+		{Power, PhaseIndex, 3, PowerL3},
+		{THD, PhaseIndex, 1, THDL1},
+	}
+
+	for _, c := range tc {
+		if m := Indexed(c.base, c.typ, c.index); m != c.m {
+			t.Errorf("expected %s, got %s", c.m, m)
+		}
+
+		if base, typ, index := c.m.Index(); base != c.base || typ != c.typ || index != c.index {
+			t.Errorf("%s: unexpected index %s %d %d", c.m, base, typ, index)
+		}
+	}
+}
+
+func TestIndexedDynamic(t *testing.T) {
+	tc := []struct {
+		base        Measurement
+		typ         IndexType
+		index       int
+		name        string
+		description string
+	}{
+		{DCPower, StringIndex, 12, "DCPowerS12", "String 12 Power (W)"},
+		{Import, TariffIndex, 4, "ImportT4", "Tariff 4 Import (kWh)"},
+		{ChargeState, BatteryIndex, 2, "ChargeStateB2", "Battery 2 Charge State (%)"},
+		{BatteryVoltage, BatteryIndex, 1, "BatteryVoltageB1", "Battery 1 Voltage (V)"},
+	}
+
+	for _, c := range tc {
+		m := Indexed(c.base, c.typ, c.index)
+		if _, ok := names[m]; ok {
+			t.Errorf("%s: expected dynamic measurement", c.name)
+		}
+
+		if m.String() != c.name {
+			t.Errorf("expected %s, got %s", c.name, m.String())
+		}
+
+		if d := m.Description(); d != c.description {
+			t.Errorf("expected %s, got %s", c.description, d)
+		}
+
+		if !m.IsAMeasurement() {
+			t.Errorf("%s: not a measurement", c.name)
+		}
+
+		if base, typ, index := m.Index(); base != c.base || typ != c.typ || index != c.index {
+			t.Errorf("%s: unexpected index %s %d %d", c.name, base, typ, index)
+		}
+
+		parsed, err := MeasurementString(c.name)
+		if err != nil || parsed != m {
+			t.Errorf("%s: parsing failed: %v", c.name, err)
+		}
+	}
+}
+
+func TestMeasurementNames(t *testing.T) {
+	// names are maintained by hand, every predefined constant needs an entry
+	for m := Frequency; m < endOfMeasurements; m++ {
+		if _, ok := names[m]; !ok {
+			t.Errorf("Measurement(%d): missing name", int(m))
+			continue
+		}
+
+		if _, ok := iec[m]; !ok {
+			t.Errorf("%s: missing description", m)
+		}
+
+		if parsed, err := MeasurementString(m.String()); err != nil || parsed != m {
+			t.Errorf("%s: parsing failed: %v", m, err)
+		}
+	}
+
+	if len(names) != int(endOfMeasurements-Frequency) {
+		t.Errorf("expected %d names, got %d", endOfMeasurements-Frequency, len(names))
+	}
+}
+
+func TestMeasurementString(t *testing.T) {
+	for _, m := range MeasurementValues() {
+		parsed, err := MeasurementString(m.String())
+		if err != nil || parsed != m {
+			t.Errorf("%s: parsing failed: %v", m, err)
+		}
+	}
+
+	if m, err := MeasurementString("importt2"); err != nil || m != ImportT2 {
+		t.Errorf("case insensitive parsing failed: %v", err)
+	}
+
+	if m, err := MeasurementString("dcpowers7"); err != nil || m != Indexed(DCPower, StringIndex, 7) {
+		t.Errorf("case insensitive parsing of dynamic indexed measurement failed: %v", err)
+	}
+
+	if _, err := MeasurementString("FooS1"); err == nil {
+		t.Error("expected error for unknown measurement")
+	}
+}
+
+func TestMeasurementValuesStable(t *testing.T) {
+	for m, expected := range map[Measurement]int{
+		Frequency:             1,
+		DCPower:               85,
+		HeatSinkTemp:          86,
+		PhaseAngle:            105,
+		Volume:                106,
+		TemperatureDifference: 112,
+		VirtualSum:            115,
+		DCEnergy:              116,
+	} {
+		if int(m) != expected {
+			t.Errorf("%s: expected value %d, got %d", m, expected, int(m))
+		}
+	}
+}
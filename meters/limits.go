@@ -0,0 +1,64 @@
+package meters
+
+import "math"
+
+// Limits describes a measurement's plausible value range and rate of change
+type Limits struct {
+	Min, Max float64
+	Rate     float64 // maximum change per second, zero if unlimited
+	Counter  bool    // counters must never decrease
+}
+
+// default limits by unit. Rates allow for load steps and supply outages
+// within a second while catching decoding glitches.
+var unitLimits = map[string]Limits{
+	"Hz":    {Min: 0, Max: 100, Rate: 10},
+	"A":     {Min: -1e6, Max: 1e6, Rate: 1e4},
+	"V":     {Min: -1e6, Max: 1e6, Rate: 1e5},
+	"W":     {Min: -1e9, Max: 1e9, Rate: 1e7},
+	"var":   {Min: -1e9, Max: 1e9, Rate: 1e7},
+	"VA":    {Min: -1e9, Max: 1e9, Rate: 1e7},
+	"%":     {Min: 0, Max: 1000},
+	"°C":    {Min: -100, Max: 250},
+	"°":     {Min: -360, Max: 360},
+	"K":     {Min: -300, Max: 300},
+	"m³/h":  {Min: -1e6, Max: 1e6},
+	"kWh":   {Min: -1e12, Max: 1e12},
+	"kvarh": {Min: -1e12, Max: 1e12},
+	"":      {Min: -1e12, Max: 1e12},
+}
+
+// measurement-specific limits, applying to all phases, strings, tariffs and batteries
+var measurementLimits = map[Measurement]Limits{
+	Cosphi:         {Min: -1, Max: 1},
+	ChargeState:    {Min: 0, Max: 100},
+	Import:         {Min: 0, Max: 1e12, Counter: true},
+	Export:         {Min: 0, Max: 1e12, Counter: true},
+	ReactiveImport: {Min: 0, Max: 1e12, Counter: true},
+	ReactiveExport: {Min: 0, Max: 1e12, Counter: true},
+	DCEnergy:       {Min: 0, Max: 1e12, Counter: true},
+	HeatEnergy:     {Min: 0, Max: 1e12, Counter: true},
+	Volume:         {Min: 0, Max: 1e12, Counter: true},
+	VirtualImport:  {Min: 0, Max: 1e12, Counter: true},
+	VirtualExport:  {Min: 0, Max: 1e12, Counter: true},
+}
+
+// Limits returns the measurement's default plausibility limits
+func (m Measurement) Limits() Limits {
+	base, _, _ := m.Index()
+	if l, ok := measurementLimits[base]; ok {
+		return l
+	}
+
+	_, unit := m.DescriptionAndUnit()
+	if l, ok := unitLimits[unit]; ok {
+		return l
+	}
+
+	return Limits{Min: math.Inf(-1), Max: math.Inf(1)}
+}
+
+// IsCounter returns true if the measurement is an energy counter
+func (m Measurement) IsCounter() bool {
+	return m.Limits().Counter
+}
@@ -0,0 +1,273 @@
+package meters
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/grid-x/modbus"
+)
+
+const (
+	linkMinBackoff = time.Second
+	linkMaxBackoff = time.Minute
+
+	// tcpKeepAlive is the period without any response after which a gateway is considered dead
+	// if all of its devices fail
+	tcpKeepAlive = 30 * time.Second
+)
+
+// ErrLinkDown indicates a request not sent as the adapter is disconnected and waiting to reconnect
+var ErrLinkDown = errors.New("adapter disconnected")
+
+// ErrGatewayDead indicates a gateway not responding to any request within the keepalive period
+var ErrGatewayDead = errors.New("gateway not responding")
+
+// LinkState represents an adapter's physical connection state
+type LinkState struct {
+	Connected  bool
+	Error      string    `json:",omitempty"` // last connection error
+	Since      time.Time // time of the last state change
+	Reconnects uint64
+	Retry      float64 `json:",omitempty"` // seconds until the next reconnect attempt
+}
+
+// Linked is implemented by connections supervising their physical link
+type Linked interface {
+	LinkState() LinkState
+}
+
+// link supervises a connection's serial port or socket. Failing links are reopened with
+// exponential backoff, requests fail fast with ErrLinkDown in the meantime.
+type link struct {
+	mu         sync.Mutex
+	connected  bool
+	err        error
+	since      time.Time
+	reconnects uint64
+	backoff    time.Duration
+	retry      time.Time
+	keepAlive  time.Duration // reconnect if no response received within keepalive, zero to disable
+	response   time.Time     // last response
+	failing    map[byte]bool // devices whose last request failed without response
+	open       func() error
+	close      func() error
+}
+
+func newLink(open, close func() error, keepAlive time.Duration) *link {
+	return &link{
+		open:      open,
+		close:     close,
+		keepAlive: keepAlive,
+		failing:   make(map[byte]bool),
+	}
+}
+
+// state returns the link's state
+func (l *link) state() LinkState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := LinkState{
+		Connected:  l.connected,
+		Since:      l.since,
+		Reconnects: l.reconnects,
+	}
+
+	if !l.connected {
+		if l.err != nil {
+			res.Error = l.err.Error()
+		}
+		if wait := time.Until(l.retry); wait > 0 {
+			res.Retry = wait.Seconds()
+		}
+	}
+
+	return res
+}
+
+// ensure opens the link if disconnected and the backoff has expired
+func (l *link) ensure(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.connected {
+		return nil
+	}
+
+	if now.Before(l.retry) {
+		return fmt.Errorf("%w: %v", ErrLinkDown, l.err)
+	}
+
+	if err := l.open(); err != nil {
+		l.down(now, err, true)
+		return err
+	}
+
+	if !l.since.IsZero() {
+		l.reconnects++
+	}
+
+	l.connected = true
+	l.since = now
+	l.response = now
+	l.backoff = 0
+	l.err = nil
+
+	return nil
+}
+
+// down closes the link. Reopening is delayed with increasing backoff unless immediate.
+// It must be called with the lock held.
+func (l *link) down(now time.Time, err error, backoff bool) {
+	_ = l.close()
+
+	if l.connected || l.since.IsZero() {
+		l.since = now
+	}
+
+	l.connected = false
+	l.err = err
+	l.retry = now
+
+	if backoff {
+		l.backoff = min(max(2*l.backoff, linkMinBackoff), linkMaxBackoff)
+		l.retry = now.Add(l.backoff)
+	}
+}
+
+// observe updates the link's state from a request's result. Timeouts of single devices are
+// expected behind gateways, the link is only considered dead if all devices fail.
+func (l *link) observe(now time.Time, slave byte, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var mbErr *modbus.Error
+	if err == nil || errors.As(err, &mbErr) {
+		l.response = now
+		l.failing[slave] = false
+		return
+	}
+
+	l.failing[slave] = true
+
+	switch {
+	case isLinkError(err):
+		l.down(now, err, true)
+	case l.keepAlive > 0 && now.Sub(l.response) > l.keepAlive && l.allFailing():
+		// reconnect immediately, the gateway may only have dropped the session
+		l.down(now, ErrGatewayDead, false)
+	}
+}
+
+// allFailing returns true if the last request of every device failed. It must be called with the lock held.
+func (l *link) allFailing() bool {
+	for _, failing := range l.failing {
+		if !failing {
+			return false
+		}
+	}
+	return true
+}
+
+// do executes the request of the given device if the link is connected
+func (l *link) do(slave byte, f func() ([]byte, error)) ([]byte, error) {
+	if err := l.ensure(time.Now()); err != nil {
+		return nil, err
+	}
+
+	b, err := f()
+	l.observe(time.Now(), slave, err)
+
+	return b, err
+}
+
+// isLinkError returns true if the error indicates a failed serial port or socket
+func isLinkError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	for _, target := range []error{
+		io.EOF, io.ErrUnexpectedEOF, os.ErrNotExist, os.ErrClosed,
+		syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE,
+		syscall.EHOSTUNREACH, syscall.ENETUNREACH, syscall.ENODEV, syscall.ENXIO, syscall.EIO, syscall.EBADF,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	// serial errors are not always wrapped
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "could not open") || strings.Contains(msg, "no such device") || strings.Contains(msg, "input/output error")
+}
+
+// linkClient sends requests using a supervised link
+type linkClient struct {
+	modbus.Client
+	link  *link
+	slave func() byte // current device, nil if not distinguished
+}
+
+// do executes the request using the link
+func (c *linkClient) do(f func() ([]byte, error)) ([]byte, error) {
+	var slave byte
+	if c.slave != nil {
+		slave = c.slave()
+	}
+	return c.link.do(slave, f)
+}
+
+func (c *linkClient) ReadCoils(address, quantity uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.ReadCoils(address, quantity) })
+}
+
+func (c *linkClient) ReadDiscreteInputs(address, quantity uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.ReadDiscreteInputs(address, quantity) })
+}
+
+func (c *linkClient) WriteSingleCoil(address, value uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.WriteSingleCoil(address, value) })
+}
+
+func (c *linkClient) WriteMultipleCoils(address, quantity uint16, value []byte) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.WriteMultipleCoils(address, quantity, value) })
+}
+
+func (c *linkClient) ReadInputRegisters(address, quantity uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.ReadInputRegisters(address, quantity) })
+}
+
+func (c *linkClient) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.ReadHoldingRegisters(address, quantity) })
+}
+
+func (c *linkClient) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.WriteSingleRegister(address, value) })
+}
+
+func (c *linkClient) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.WriteMultipleRegisters(address, quantity, value) })
+}
+
+func (c *linkClient) ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) ([]byte, error) {
+	return c.do(func() ([]byte, error) {
+		return c.Client.ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity, value)
+	})
+}
+
+func (c *linkClient) MaskWriteRegister(address, andMask, orMask uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.MaskWriteRegister(address, andMask, orMask) })
+}
+
+func (c *linkClient) ReadFIFOQueue(address uint16) ([]byte, error) {
+	return c.do(func() ([]byte, error) { return c.Client.ReadFIFOQueue(address) })
+}
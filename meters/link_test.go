@@ -0,0 +1,89 @@
+package meters
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/grid-x/modbus"
+)
+
+func TestLinkReconnect(t *testing.T) {
+	var opens, closes int
+	openErr := os.ErrNotExist
+
+	l := newLink(
+		func() error { opens++; return openErr },
+		func() error { closes++; return nil },
+		0,
+	)
+	now := time.Now()
+
+	// missing device
+	if err := l.ensure(now); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// fail fast during backoff
+	if err := l.ensure(now.Add(500 * time.Millisecond)); !errors.Is(err, ErrLinkDown) || opens != 1 {
+		t.Errorf("unexpected error %v", err)
+	}
+	if s := l.state(); s.Connected || s.Error == "" || s.Retry == 0 {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	// device plugged in
+	openErr = nil
+	if err := l.ensure(now.Add(time.Second)); err != nil || opens != 2 {
+		t.Errorf("unexpected error %v", err)
+	}
+	if s := l.state(); !s.Connected || s.Reconnects != 1 {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	// exceptions and timeouts keep the link
+	l.observe(now, 1, &modbus.Error{ExceptionCode: modbus.ExceptionCodeIllegalDataAddress})
+	l.observe(now, 1, errors.New("serial: timeout"))
+	if s := l.state(); !s.Connected {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	// device removed
+	l.observe(now.Add(2*time.Second), 1, io.EOF)
+	if s := l.state(); s.Connected || closes != 2 {
+		t.Errorf("unexpected state %+v", s)
+	}
+}
+
+func TestLinkKeepAlive(t *testing.T) {
+	l := newLink(func() error { return nil }, func() error { return nil }, time.Minute)
+	now := time.Now()
+
+	if err := l.ensure(now); err != nil {
+		t.Fatal(err)
+	}
+
+	l.observe(now, 1, nil)
+	l.observe(now.Add(30*time.Second), 2, errors.New("i/o timeout"))
+	if s := l.state(); !s.Connected {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	// single offline device behind a responding gateway
+	l.observe(now.Add(2*time.Minute), 2, errors.New("i/o timeout"))
+	if s := l.state(); !s.Connected {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	// gateway not responding to any device is reconnected without backoff
+	l.observe(now.Add(2*time.Minute), 1, errors.New("i/o timeout"))
+	if s := l.state(); s.Connected || s.Error != ErrGatewayDead.Error() {
+		t.Errorf("unexpected state %+v", s)
+	}
+
+	if err := l.ensure(now.Add(2 * time.Minute)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -7,8 +7,9 @@ type device struct {
 
 // Manager handles devices attached to a connection
 type Manager struct {
-	devices []device
-	Conn    Connection
+	devices     []device
+	Conn        Connection
+	Concurrency int // maximum number of devices queried concurrently, TCP connections only
 }
 
 // NewManager creates a new connection manager instance. connection managers operate devices on a connection instance
@@ -0,0 +1,192 @@
+// Package mbus implements a wired M-Bus (EN 13757-2/3) master for heat, water,
+// gas and electricity meters attached to serial level converters or TCP gateways.
+package mbus
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Type is the device type of M-Bus meters
+const Type = "MBUS"
+
+// Device is a M-Bus meter, addressed either by primary or secondary address
+type Device struct {
+	stream    *meters.Stream
+	address   byte   // primary address
+	secondary string // secondary address (identification number)
+	fcb       bool   // frame count bit of the next request
+
+	medium     byte
+	descriptor meters.DeviceDescriptor
+}
+
+// NewDevice creates a M-Bus device. If secondary is non-zero the device is
+// selected by its identification number instead of the primary address.
+func NewDevice(stream *meters.Stream, address uint8, secondary int) *Device {
+	d := &Device{
+		stream:  stream,
+		address: address,
+		descriptor: meters.DeviceDescriptor{
+			Type:      Type,
+			SubDevice: secondary,
+		},
+	}
+
+	if secondary > 0 {
+		d.address = addressSecondary
+		d.secondary = fmt.Sprintf("%08d", secondary)
+	}
+
+	return d
+}
+
+// selectDevice selects the device by secondary address if required
+func (d *Device) selectDevice() error {
+	if d.secondary == "" {
+		return nil
+	}
+	return Select(d.stream, d.secondary)
+}
+
+// read requests and decodes the device's user data
+func (d *Device) read() (*Response, error) {
+	if err := d.selectDevice(); err != nil {
+		return nil, err
+	}
+
+	f, err := ReadData(d.stream, d.address, d.fcb)
+	if err != nil {
+		return nil, err
+	}
+	d.fcb = !d.fcb
+
+	return Parse(f)
+}
+
+// Initialize resets the device's link layer and prepares the device descriptor
+func (d *Device) Initialize(client modbus.Client) error {
+	if err := d.selectDevice(); err != nil {
+		return err
+	}
+
+	if err := Reset(d.stream, d.address); err != nil && !errors.Is(err, ErrTimeout) {
+		// some devices don't acknowledge SND_NKE
+		return err
+	}
+	d.fcb = true
+
+	res, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	d.medium = res.Medium
+	d.descriptor.Manufacturer = res.Manufacturer
+	d.descriptor.Model = MediumName(res.Medium)
+	d.descriptor.Version = strconv.Itoa(int(res.Version))
+	d.descriptor.Serial = res.ID
+
+	return nil
+}
+
+// Descriptor returns the device descriptor
+func (d *Device) Descriptor() meters.DeviceDescriptor {
+	return d.descriptor
+}
+
+// measurement maps current values of known quantities to measurements.
+// Energy and power of electricity meters are electric, otherwise thermal.
+func measurement(r Record, medium byte) (meters.Measurement, bool) {
+	if r.Function != FunctionInstantaneous || r.Storage != 0 || r.Subunit != 0 || r.Extended {
+		return 0, false
+	}
+
+	var m meters.Measurement
+	switch r.Quantity {
+	case QuantityEnergy:
+		m = meters.HeatEnergy
+		if medium == 0x02 {
+			m = meters.Import
+		}
+	case QuantityPower:
+		m = meters.HeatPower
+		if medium == 0x02 {
+			m = meters.Power
+		}
+	case QuantityVolume:
+		m = meters.Volume
+	case QuantityVolumeFlow:
+		m = meters.VolumeFlow
+	case QuantityFlowTemperature:
+		m = meters.FlowTemperature
+	case QuantityReturnTemperature:
+		m = meters.ReturnTemperature
+	case QuantityTemperatureDifference:
+		m = meters.TemperatureDifference
+	default:
+		return 0, false
+	}
+
+	if r.Tariff > 0 {
+		if _, typ, _ := m.Index(); typ != meters.NoIndex || m == meters.Power || m == meters.HeatPower {
+			return 0, false
+		}
+		m = meters.Indexed(m, meters.TariffIndex, r.Tariff)
+	}
+
+	return m, true
+}
+
+// results converts records to measurements, using the first record per measurement
+func results(res *Response, medium byte) []meters.MeasurementResult {
+	ts := time.Now()
+	seen := make(map[meters.Measurement]bool)
+
+	var mr []meters.MeasurementResult
+	for _, r := range res.Records {
+		m, ok := measurement(r, medium)
+		if !ok || seen[m] {
+			continue
+		}
+		seen[m] = true
+
+		mr = append(mr, meters.MeasurementResult{
+			Measurement: m,
+			Value:       r.Value,
+			Timestamp:   ts,
+		})
+	}
+
+	return mr
+}
+
+// Probe reads the device and returns its first reading
+func (d *Device) Probe(client modbus.Client) (res meters.MeasurementResult, err error) {
+	r, err := d.read()
+	if err != nil {
+		return res, err
+	}
+
+	mr := results(r, r.Medium)
+	if len(mr) == 0 {
+		return res, errors.New("mbus: no known measurements")
+	}
+
+	return mr[0], nil
+}
+
+// Query reads the device's current values
+func (d *Device) Query(client modbus.Client) ([]meters.MeasurementResult, error) {
+	r, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return results(r, d.medium), nil
+}
@@ -0,0 +1,230 @@
+package mbus
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// frame delimiters
+const (
+	ack        = 0xe5
+	shortStart = 0x10
+	longStart  = 0x68
+	stop       = 0x16
+)
+
+// control fields
+const (
+	sndNke  = 0x40
+	sndUd   = 0x53
+	reqUd2  = 0x5b
+	fcbFlag = 0x20
+)
+
+// addresses and control information
+const (
+	addressSecondary = 0xfd
+	ciSelect         = 0x52
+)
+
+// responseTimeout is the maximum time to wait for a response
+const responseTimeout = time.Second
+
+var (
+	// ErrTimeout is returned if the device did not respond
+	ErrTimeout = errors.New("mbus: timeout")
+	// ErrCollision is returned for garbled responses, e.g. from multiple devices answering
+	ErrCollision = errors.New("mbus: invalid response")
+)
+
+func checksum(b []byte) byte {
+	var cs byte
+	for _, c := range b {
+		cs += c
+	}
+	return cs
+}
+
+// shortFrame creates a short frame
+func shortFrame(control, address byte) []byte {
+	return []byte{shortStart, control, address, control + address, stop}
+}
+
+// longFrame creates a long frame
+func longFrame(control, address, ci byte, data []byte) []byte {
+	l := byte(len(data) + 3)
+	res := []byte{longStart, l, l, longStart, control, address, ci}
+	res = append(res, data...)
+	return append(res, checksum(res[4:]), stop)
+}
+
+// Frame is a received long frame
+type Frame struct {
+	Control byte
+	Address byte
+	CI      byte
+	Data    []byte
+}
+
+// request sends a frame and reads the response, which is either a single character
+// acknowledgement (nil frame) or a long frame.
+func request(stream *meters.Stream, frame []byte) (*Frame, error) {
+	if _, err := stream.Write(frame); err != nil {
+		return nil, err
+	}
+
+	f, err := response(stream)
+	if errors.Is(err, ErrCollision) {
+		drain(stream)
+	}
+
+	return f, err
+}
+
+// drain discards input until the bus is idle
+func drain(stream *meters.Stream) {
+	b := make([]byte, 256)
+	for {
+		if n, err := stream.Read(b); n == 0 || err != nil && !meters.IsTimeout(err) {
+			return
+		}
+	}
+}
+
+// readFull reads len(b) bytes from the stream
+func readFull(stream *meters.Stream, b []byte, deadline time.Time) error {
+	for n := 0; n < len(b); {
+		m, err := stream.Read(b[n:])
+		n += m
+
+		if err != nil && !meters.IsTimeout(err) {
+			return err
+		}
+		if n < len(b) && time.Now().After(deadline) {
+			if n == 0 {
+				return ErrTimeout
+			}
+			return ErrCollision
+		}
+	}
+	return nil
+}
+
+// response reads a single character or long frame response
+func response(stream *meters.Stream) (*Frame, error) {
+	deadline := time.Now().Add(responseTimeout)
+
+	b := make([]byte, 1)
+	if err := readFull(stream, b, deadline); err != nil {
+		return nil, err
+	}
+
+	switch b[0] {
+	case ack:
+		return nil, nil
+	case longStart:
+	default:
+		return nil, ErrCollision
+	}
+
+	header := make([]byte, 3)
+	if err := readFull(stream, header, deadline); err != nil {
+		return nil, err
+	}
+
+	l := int(header[0])
+	if header[1] != header[0] || header[2] != longStart || l < 3 {
+		return nil, ErrCollision
+	}
+
+	body := make([]byte, l+2)
+	if err := readFull(stream, body, deadline); err != nil {
+		return nil, err
+	}
+
+	if body[l+1] != stop || checksum(body[:l]) != body[l] {
+		return nil, ErrCollision
+	}
+
+	return &Frame{
+		Control: body[0],
+		Address: body[1],
+		CI:      body[2],
+		Data:    body[3:l],
+	}, nil
+}
+
+// Reset sends SND_NKE to initialize the device's link layer
+func Reset(stream *meters.Stream, address byte) error {
+	_, err := request(stream, shortFrame(sndNke, address))
+	return err
+}
+
+// secondaryAddress encodes the identification number (up to 8 BCD digits, F as wildcard digit)
+// with wildcard manufacturer, version and medium
+func secondaryAddress(id string) ([]byte, error) {
+	if len(id) > 8 {
+		return nil, fmt.Errorf("mbus: invalid secondary address %s", id)
+	}
+
+	// pad with wildcards
+	for len(id) < 8 {
+		id += "F"
+	}
+
+	res := make([]byte, 8)
+	for i := 0; i < 4; i++ {
+		hi, lo := id[2*i], id[2*i+1]
+		if !isDigit(hi) || !isDigit(lo) {
+			return nil, fmt.Errorf("mbus: invalid secondary address %s", id)
+		}
+		// least significant byte first
+		res[3-i] = nibble(hi)<<4 | nibble(lo)
+	}
+
+	for i := 4; i < 8; i++ {
+		res[i] = 0xff
+	}
+
+	return res, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c == 'F' || c == 'f'
+}
+
+func nibble(c byte) byte {
+	if c >= '0' && c <= '9' {
+		return c - '0'
+	}
+	return 0x0f
+}
+
+// Select selects a device by its secondary address
+func Select(stream *meters.Stream, id string) error {
+	addr, err := secondaryAddress(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = request(stream, longFrame(sndUd, addressSecondary, ciSelect, addr))
+	return err
+}
+
+// ReadData requests user data class 2 using the frame count bit
+func ReadData(stream *meters.Stream, address byte, fcb bool) (*Frame, error) {
+	control := byte(reqUd2)
+	if fcb {
+		control |= fcbFlag
+	}
+
+	f, err := request(stream, shortFrame(control, address))
+	if err == nil && f == nil {
+		err = ErrCollision // acknowledgement instead of data
+	}
+
+	return f, err
+}
@@ -0,0 +1,145 @@
+package mbus
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// heat meter response data with long header
+var heatData = []byte{
+	0x78, 0x56, 0x34, 0x12, // id 12345678
+	0x2d, 0x2c, // manufacturer KAM
+	0x08, 0x04, 0x01, 0x00, 0x00, 0x00, // version, medium heat, access number, status, signature
+	0x04, 0x06, 0xd2, 0x04, 0x00, 0x00, // energy 1234 kWh
+	0x04, 0x13, 0xd5, 0xdd, 0x00, 0x00, // volume 56.789 m³
+	0x02, 0x2b, 0xdc, 0x05, // power 1500 W
+	0x02, 0x3b, 0xfa, 0x00, // volume flow 0.25 m³/h
+	0x02, 0x59, 0x70, 0x19, // flow temperature 65.12 °C
+	0x02, 0x5d, 0xab, 0x11, // return temperature 45.23 °C
+	0x02, 0x61, 0xc5, 0x07, // temperature difference 19.89 K
+	0x44, 0x06, 0xe8, 0x03, 0x00, 0x00, // historical energy
+	0x84, 0x10, 0x06, 0x64, 0x00, 0x00, 0x00, // tariff 1 energy 100 kWh
+	0x0c, 0x78, 0x78, 0x56, 0x34, 0x12, // fabrication number
+	0x0f, 0x01, 0x02, 0x03, // manufacturer specific
+}
+
+var heatResults = map[meters.Measurement]float64{
+	meters.HeatEnergy:            1234,
+	meters.Volume:                56.789,
+	meters.HeatPower:             1500,
+	meters.VolumeFlow:            0.25,
+	meters.FlowTemperature:       65.12,
+	meters.ReturnTemperature:     45.23,
+	meters.TemperatureDifference: 19.89,
+	meters.Indexed(meters.HeatEnergy, meters.TariffIndex, 1): 100,
+}
+
+func checkResults(t *testing.T, mr []meters.MeasurementResult) {
+	t.Helper()
+
+	if len(mr) != len(heatResults) {
+		t.Errorf("unexpected results %v", mr)
+	}
+
+	for _, r := range mr {
+		if v, ok := heatResults[r.Measurement]; !ok || math.Abs(v-r.Value) > 1e-9 {
+			t.Errorf("unexpected result %s: %f", r.Measurement, r.Value)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	res, err := Parse(&Frame{CI: ciLongHeader, Data: heatData})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.ID != "12345678" || res.Manufacturer != "KAM" || res.Medium != 0x04 || len(res.Records) != 10 {
+		t.Fatalf("unexpected response %+v", res)
+	}
+
+	if r := res.Records[9]; r.Quantity != QuantityFabricationNumber || r.Text != "12345678" {
+		t.Errorf("unexpected fabrication number %+v", r)
+	}
+
+	checkResults(t, results(res, res.Medium))
+}
+
+func TestSecondaryAddress(t *testing.T) {
+	addr, err := secondaryAddress("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []byte{0xff, 0x56, 0x34, 0x12, 0xff, 0xff, 0xff, 0xff}; !bytes.Equal(addr, expected) {
+		t.Errorf("unexpected address % x", addr)
+	}
+
+	if _, err := secondaryAddress("1234567A"); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
+
+func TestDevice(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// simulated meter at primary address 5
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		expected := [][]byte{
+			shortFrame(sndNke, 5),
+			shortFrame(reqUd2|fcbFlag, 5),
+			shortFrame(reqUd2, 5),
+		}
+
+		for _, req := range expected {
+			b := make([]byte, len(req))
+			if _, err := io.ReadFull(conn, b); err != nil || !bytes.Equal(b, req) {
+				t.Errorf("unexpected request % x", b)
+				return
+			}
+
+			resp := []byte{ack}
+			if req[1] != sndNke {
+				resp = longFrame(0x08, 5, ciLongHeader, heatData)
+			}
+			_, _ = conn.Write(resp)
+		}
+	}()
+
+	stream, err := meters.NewStream(l.Addr().String(), 2400, "8E1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	dev := NewDevice(stream, 5, 0)
+	if err := dev.Initialize(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if desc := dev.Descriptor(); desc.Manufacturer != "KAM" || desc.Model != "Heat" || desc.Serial != "12345678" {
+		t.Errorf("unexpected descriptor %+v", desc)
+	}
+
+	mr, err := dev.Query(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkResults(t, mr)
+}
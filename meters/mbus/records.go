@@ -0,0 +1,392 @@
+package mbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// control information of variable data responses
+const (
+	ciLongHeader  = 0x72
+	ciNoHeader    = 0x78
+	ciShortHeader = 0x7a
+)
+
+// functions
+const (
+	FunctionInstantaneous = iota
+	FunctionMaximum
+	FunctionMinimum
+	FunctionError
+)
+
+// Quantity is the physical quantity of a record as described by its VIF
+type Quantity int
+
+const (
+	QuantityUnknown Quantity = iota
+
+	QuantityEnergy                // kWh
+	QuantityVolume                // m³
+	QuantityMass                  // kg
+	QuantityPower                 // W
+	QuantityVolumeFlow            // m³/h
+	QuantityFlowTemperature       // °C
+	QuantityReturnTemperature     // °C
+	QuantityTemperatureDifference // K
+	QuantityExternalTemperature   // °C
+	QuantityFabricationNumber
+)
+
+// Header is the fixed data header of a variable data response
+type Header struct {
+	ID           string // identification number
+	Manufacturer string
+	Version      byte
+	Medium       byte
+	AccessNumber byte
+	Status       byte
+}
+
+// Record is a variable data record
+type Record struct {
+	Function int
+	Storage  int
+	Tariff   int
+	Subunit  int
+	Quantity Quantity
+	Extended bool    // record has VIF extensions modifying its meaning
+	Value    float64 // value scaled to the quantity's unit
+	Text     string  // string or identification values
+}
+
+// Response is a decoded variable data response
+type Response struct {
+	Header
+	Records []Record
+}
+
+// media names by medium code
+var media = map[byte]string{
+	0x00: "Other",
+	0x01: "Oil",
+	0x02: "Electricity",
+	0x03: "Gas",
+	0x04: "Heat",
+	0x05: "Steam",
+	0x06: "Warm water",
+	0x07: "Water",
+	0x08: "Heat cost allocator",
+	0x09: "Compressed air",
+	0x0a: "Cooling load meter (outlet)",
+	0x0b: "Cooling load meter (inlet)",
+	0x0c: "Heat (inlet)",
+	0x0d: "Heat / Cooling load meter",
+	0x0e: "Bus / System",
+	0x15: "Hot water",
+	0x16: "Cold water",
+	0x17: "Dual register water meter",
+	0x18: "Pressure",
+	0x19: "A/D converter",
+}
+
+// MediumName returns the medium's description
+func MediumName(medium byte) string {
+	if name, ok := media[medium]; ok {
+		return name
+	}
+	return fmt.Sprintf("Medium %02X", medium)
+}
+
+// manufacturer decodes the 3-letter manufacturer id
+func manufacturer(m uint16) string {
+	return string([]byte{
+		byte(m>>10&0x1f) + 64,
+		byte(m>>5&0x1f) + 64,
+		byte(m&0x1f) + 64,
+	})
+}
+
+// bcd decodes a little-endian BCD number. A leading F nibble denotes negative values.
+func bcd(b []byte) (int64, error) {
+	var res int64
+	negative := false
+
+	for i := len(b) - 1; i >= 0; i-- {
+		hi, lo := b[i]>>4, b[i]&0x0f
+		if i == len(b)-1 && hi == 0x0f {
+			negative = true
+			hi = 0
+		}
+		if hi > 9 || lo > 9 {
+			return 0, fmt.Errorf("mbus: invalid BCD % x", b)
+		}
+		res = res*100 + int64(hi)*10 + int64(lo)
+	}
+
+	if negative {
+		res = -res
+	}
+
+	return res, nil
+}
+
+// integer decodes a little-endian signed integer
+func integer(b []byte) int64 {
+	buf := make([]byte, 8)
+	if len(b) > 0 && b[len(b)-1]&0x80 != 0 {
+		for i := range buf {
+			buf[i] = 0xff
+		}
+	}
+	copy(buf, b)
+	return int64(binary.LittleEndian.Uint64(buf))
+}
+
+// Parse decodes a RSP_UD variable data response
+func Parse(f *Frame) (*Response, error) {
+	res := new(Response)
+	data := f.Data
+
+	switch f.CI {
+	case ciLongHeader:
+		if len(data) < 12 {
+			return nil, fmt.Errorf("mbus: short header")
+		}
+
+		id, err := bcd(data[:4])
+		if err != nil {
+			return nil, err
+		}
+
+		res.Header = Header{
+			ID:           fmt.Sprintf("%08d", id),
+			Manufacturer: manufacturer(binary.LittleEndian.Uint16(data[4:6])),
+			Version:      data[6],
+			Medium:       data[7],
+			AccessNumber: data[8],
+			Status:       data[9],
+		}
+		data = data[12:]
+
+	case ciShortHeader:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("mbus: short header")
+		}
+		res.AccessNumber = data[0]
+		res.Status = data[1]
+		data = data[4:]
+
+	case ciNoHeader:
+
+	default:
+		return nil, fmt.Errorf("mbus: unsupported control information %02x", f.CI)
+	}
+
+	var err error
+	res.Records, err = records(data)
+
+	return res, err
+}
+
+// records decodes data records until the end of data or manufacturer specific data
+func records(data []byte) ([]Record, error) {
+	var res []Record
+
+	for pos := 0; pos < len(data); {
+		dif := data[pos]
+		pos++
+
+		switch dif {
+		case 0x2f:
+			continue // idle filler
+		case 0x0f, 0x1f:
+			return res, nil // manufacturer specific data
+		}
+
+		r := Record{
+			Function: int(dif>>4) & 0x03,
+			Storage:  int(dif>>6) & 0x01,
+		}
+
+		// data information field extensions
+		for n, ext := 0, dif&0x80 != 0; ext; n++ {
+			if pos >= len(data) || n >= 10 {
+				return res, fmt.Errorf("mbus: invalid DIFE")
+			}
+			dife := data[pos]
+			pos++
+
+			r.Storage |= int(dife&0x0f) << (1 + 4*n)
+			r.Tariff |= int(dife>>4&0x03) << (2 * n)
+			r.Subunit |= int(dife>>6&0x01) << n
+			ext = dife&0x80 != 0
+		}
+
+		// value information field
+		if pos >= len(data) {
+			return res, fmt.Errorf("mbus: missing VIF")
+		}
+		vif := data[pos]
+		pos++
+
+		var plain bool
+		switch vif & 0x7f {
+		case 0x7c:
+			plain = true
+		case 0x7d, 0x7b:
+			// extension tables are not mapped
+			r.Extended = true
+		}
+
+		ext := vif&0x80 != 0
+		if ext && vif&0x7f != 0x7d && vif&0x7f != 0x7b {
+			r.Extended = true
+		}
+
+		for n := 0; ext; n++ {
+			if pos >= len(data) || n >= 10 {
+				return res, fmt.Errorf("mbus: invalid VIFE")
+			}
+			ext = data[pos]&0x80 != 0
+			pos++
+		}
+
+		if plain {
+			// plain text unit is not interpreted
+			if pos >= len(data) || pos+1+int(data[pos]) > len(data) {
+				return res, fmt.Errorf("mbus: invalid plain text VIF")
+			}
+			pos += 1 + int(data[pos])
+			r.Extended = true
+		}
+
+		// data field
+		value, text, n, err := decode(dif&0x0f, data[pos:])
+		if err != nil {
+			return res, err
+		}
+		pos += n
+
+		if !r.Extended {
+			r.Quantity, r.Value = quantity(vif&0x7f, value)
+		} else {
+			r.Value = value
+		}
+		r.Text = text
+
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+// decode decodes the data field and returns its numeric or text value and length
+func decode(coding byte, b []byte) (float64, string, int, error) {
+	lengths := []int{0, 1, 2, 3, 4, 4, 6, 8, 0, 1, 2, 3, 4, -1, 6, 0}
+	n := lengths[coding]
+
+	if n < 0 {
+		// variable length
+		if len(b) < 1 {
+			return 0, "", 0, fmt.Errorf("mbus: missing LVAR")
+		}
+
+		lvar := int(b[0])
+		switch {
+		case lvar <= 0xbf:
+			if len(b) < 1+lvar {
+				return 0, "", 0, fmt.Errorf("mbus: short data")
+			}
+			// characters are transmitted in reverse order
+			s := make([]byte, lvar)
+			for i := range s {
+				s[i] = b[lvar-i]
+			}
+			return math.NaN(), strings.TrimSpace(string(s)), 1 + lvar, nil
+
+		case lvar >= 0xc0 && lvar <= 0xd9:
+			l := lvar & 0x0f
+			if len(b) < 1+l {
+				return 0, "", 0, fmt.Errorf("mbus: short data")
+			}
+			v, err := bcd(b[1 : 1+l])
+			if lvar >= 0xd0 {
+				v = -v
+			}
+			return float64(v), "", 1 + l, err
+
+		case lvar >= 0xe0 && lvar <= 0xef:
+			l := lvar - 0xe0
+			if len(b) < 1+l || l > 8 {
+				return 0, "", 0, fmt.Errorf("mbus: short data")
+			}
+			return float64(integer(b[1 : 1+l])), "", 1 + l, nil
+
+		default:
+			return 0, "", 0, fmt.Errorf("mbus: unsupported LVAR %02x", lvar)
+		}
+	}
+
+	if len(b) < n {
+		return 0, "", 0, fmt.Errorf("mbus: short data")
+	}
+	b = b[:n]
+
+	switch coding {
+	case 0x00, 0x08:
+		return math.NaN(), "", 0, nil
+
+	case 0x05:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), "", n, nil
+
+	case 0x09, 0x0a, 0x0b, 0x0c, 0x0e:
+		v, err := bcd(b)
+		return float64(v), strconv.FormatInt(v, 10), n, err
+
+	default:
+		v := integer(b)
+		return float64(v), strconv.FormatInt(v, 10), n, nil
+	}
+}
+
+// quantity decodes the primary VIF and scales the value
+func quantity(vif byte, v float64) (Quantity, float64) {
+	pow := func(exp int) float64 { return v * math.Pow10(exp) }
+
+	switch {
+	case vif <= 0x07: // Wh
+		return QuantityEnergy, pow(int(vif&0x07) - 3 - 3)
+	case vif <= 0x0f: // J
+		return QuantityEnergy, pow(int(vif&0x07)) / 3.6e6
+	case vif <= 0x17: // m³
+		return QuantityVolume, pow(int(vif&0x07) - 6)
+	case vif <= 0x1f: // kg
+		return QuantityMass, pow(int(vif&0x07) - 3)
+	case vif >= 0x28 && vif <= 0x2f: // W
+		return QuantityPower, pow(int(vif&0x07) - 3)
+	case vif >= 0x30 && vif <= 0x37: // J/h
+		return QuantityPower, pow(int(vif&0x07)) / 3600
+	case vif >= 0x38 && vif <= 0x3f: // m³/h
+		return QuantityVolumeFlow, pow(int(vif&0x07) - 6)
+	case vif >= 0x40 && vif <= 0x47: // m³/min
+		return QuantityVolumeFlow, pow(int(vif&0x07)-7) * 60
+	case vif >= 0x48 && vif <= 0x4f: // m³/s
+		return QuantityVolumeFlow, pow(int(vif&0x07)-9) * 3600
+	case vif >= 0x58 && vif <= 0x5b: // °C
+		return QuantityFlowTemperature, pow(int(vif&0x03) - 3)
+	case vif >= 0x5c && vif <= 0x5f: // °C
+		return QuantityReturnTemperature, pow(int(vif&0x03) - 3)
+	case vif >= 0x60 && vif <= 0x63: // K
+		return QuantityTemperatureDifference, pow(int(vif&0x03) - 3)
+	case vif >= 0x64 && vif <= 0x67: // °C
+		return QuantityExternalTemperature, pow(int(vif&0x03) - 3)
+	case vif == 0x78:
+		return QuantityFabricationNumber, v
+	default:
+		return QuantityUnknown, v
+	}
+}
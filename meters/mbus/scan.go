@@ -0,0 +1,62 @@
+package mbus
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// maxPrimaryAddress is the highest primary address of slaves
+const maxPrimaryAddress = 250
+
+// ScanPrimary reads all primary addresses and calls found for each responding device
+func ScanPrimary(stream *meters.Stream, found func(address byte, res *Response)) {
+	for address := 0; address <= maxPrimaryAddress; address++ {
+		if err := Reset(stream, byte(address)); errors.Is(err, ErrTimeout) {
+			continue
+		}
+
+		f, err := ReadData(stream, byte(address), true)
+		if err != nil {
+			continue
+		}
+
+		if res, err := Parse(f); err == nil {
+			found(byte(address), res)
+		}
+	}
+}
+
+// ScanSecondary searches secondary addresses by narrowing wildcard selections
+// digit by digit and calls found for each identified device
+func ScanSecondary(stream *meters.Stream, found func(res *Response)) {
+	// deselect all devices
+	_ = Reset(stream, addressSecondary)
+	scanSecondary(stream, "", found)
+}
+
+func scanSecondary(stream *meters.Stream, prefix string, found func(res *Response)) {
+	err := Select(stream, prefix)
+	if errors.Is(err, ErrTimeout) {
+		return // no matching device
+	}
+
+	if err == nil {
+		// single acknowledgement, but multiple devices may have answered simultaneously
+		if f, err := ReadData(stream, addressSecondary, true); err == nil {
+			if res, err := Parse(f); err == nil {
+				found(res)
+				return
+			}
+		}
+	}
+
+	if len(prefix) == 8 {
+		return
+	}
+
+	for digit := 0; digit <= 9; digit++ {
+		scanSecondary(stream, prefix+strconv.Itoa(digit), found)
+	}
+}
@@ -0,0 +1,121 @@
+package meters
+
+// names are the canonical string representations of all predefined measurements
+var names = map[Measurement]string{
+	Frequency:             "Frequency",
+	FrequencyL1:           "FrequencyL1",
+	FrequencyL2:           "FrequencyL2",
+	FrequencyL3:           "FrequencyL3",
+	Current:               "Current",
+	CurrentL1:             "CurrentL1",
+	CurrentL2:             "CurrentL2",
+	CurrentL3:             "CurrentL3",
+	Voltage:               "Voltage",
+	VoltageL1:             "VoltageL1",
+	VoltageL2:             "VoltageL2",
+	VoltageL3:             "VoltageL3",
+	VoltageL1_L2:          "VoltageL1_L2",
+	VoltageL2_L3:          "VoltageL2_L3",
+	VoltageL3_L1:          "VoltageL3_L1",
+	VoltageL_N_avg:        "VoltageL_N_avg",
+	VoltageL_L_avg:        "VoltageL_L_avg",
+	Power:                 "Power",
+	PowerL1:               "PowerL1",
+	PowerL2:               "PowerL2",
+	PowerL3:               "PowerL3",
+	ImportPower:           "ImportPower",
+	ImportPowerL1:         "ImportPowerL1",
+	ImportPowerL2:         "ImportPowerL2",
+	ImportPowerL3:         "ImportPowerL3",
+	ExportPower:           "ExportPower",
+	ExportPowerL1:         "ExportPowerL1",
+	ExportPowerL2:         "ExportPowerL2",
+	ExportPowerL3:         "ExportPowerL3",
+	ReactivePower:         "ReactivePower",
+	ReactivePowerL1:       "ReactivePowerL1",
+	ReactivePowerL2:       "ReactivePowerL2",
+	ReactivePowerL3:       "ReactivePowerL3",
+	ApparentPower:         "ApparentPower",
+	ApparentPowerL1:       "ApparentPowerL1",
+	ApparentPowerL2:       "ApparentPowerL2",
+	ApparentPowerL3:       "ApparentPowerL3",
+	Cosphi:                "Cosphi",
+	CosphiL1:              "CosphiL1",
+	CosphiL2:              "CosphiL2",
+	CosphiL3:              "CosphiL3",
+	THD:                   "THD",
+	THDL1:                 "THDL1",
+	THDL2:                 "THDL2",
+	THDL3:                 "THDL3",
+	ThreePhase_Vec_A:      "ThreePhase_Vec_A",
+	Sum:                   "Sum",
+	SumT1:                 "SumT1",
+	SumT2:                 "SumT2",
+	SumL1:                 "SumL1",
+	SumL2:                 "SumL2",
+	SumL3:                 "SumL3",
+	Import:                "Import",
+	ImportT1:              "ImportT1",
+	ImportT2:              "ImportT2",
+	ImportL1:              "ImportL1",
+	ImportL2:              "ImportL2",
+	ImportL3:              "ImportL3",
+	Export:                "Export",
+	ExportT1:              "ExportT1",
+	ExportT2:              "ExportT2",
+	ExportL1:              "ExportL1",
+	ExportL2:              "ExportL2",
+	ExportL3:              "ExportL3",
+	ReactiveSum:           "ReactiveSum",
+	ReactiveSumT1:         "ReactiveSumT1",
+	ReactiveSumT2:         "ReactiveSumT2",
+	ReactiveSumL1:         "ReactiveSumL1",
+	ReactiveSumL2:         "ReactiveSumL2",
+	ReactiveSumL3:         "ReactiveSumL3",
+	ReactiveImport:        "ReactiveImport",
+	ReactiveImportT1:      "ReactiveImportT1",
+	ReactiveImportT2:      "ReactiveImportT2",
+	ReactiveImportL1:      "ReactiveImportL1",
+	ReactiveImportL2:      "ReactiveImportL2",
+	ReactiveImportL3:      "ReactiveImportL3",
+	ReactiveExport:        "ReactiveExport",
+	ReactiveExportT1:      "ReactiveExportT1",
+	ReactiveExportT2:      "ReactiveExportT2",
+	ReactiveExportL1:      "ReactiveExportL1",
+	ReactiveExportL2:      "ReactiveExportL2",
+	ReactiveExportL3:      "ReactiveExportL3",
+	DCCurrent:             "DCCurrent",
+	DCVoltage:             "DCVoltage",
+	DCPower:               "DCPower",
+	DCEnergy:              "DCEnergy",
+	HeatSinkTemp:          "HeatSinkTemp",
+	DCCurrentS1:           "DCCurrentS1",
+	DCVoltageS1:           "DCVoltageS1",
+	DCPowerS1:             "DCPowerS1",
+	DCEnergyS1:            "DCEnergyS1",
+	DCCurrentS2:           "DCCurrentS2",
+	DCVoltageS2:           "DCVoltageS2",
+	DCPowerS2:             "DCPowerS2",
+	DCEnergyS2:            "DCEnergyS2",
+	DCCurrentS3:           "DCCurrentS3",
+	DCVoltageS3:           "DCVoltageS3",
+	DCPowerS3:             "DCPowerS3",
+	DCEnergyS3:            "DCEnergyS3",
+	DCCurrentS4:           "DCCurrentS4",
+	DCVoltageS4:           "DCVoltageS4",
+	DCPowerS4:             "DCPowerS4",
+	DCEnergyS4:            "DCEnergyS4",
+	ChargeState:           "ChargeState",
+	BatteryVoltage:        "BatteryVoltage",
+	PhaseAngle:            "PhaseAngle",
+	Volume:                "Volume",
+	VolumeFlow:            "VolumeFlow",
+	HeatEnergy:            "HeatEnergy",
+	HeatPower:             "HeatPower",
+	FlowTemperature:       "FlowTemperature",
+	ReturnTemperature:     "ReturnTemperature",
+	TemperatureDifference: "TemperatureDifference",
+	VirtualImport:         "VirtualImport",
+	VirtualExport:         "VirtualExport",
+	VirtualSum:            "VirtualSum",
+}
@@ -2,6 +2,7 @@ package meters
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -17,10 +18,13 @@ func (r MeasurementResult) String() string {
 	return fmt.Sprintf("%s: %.2f%s", r.Measurement.String(), r.Value, unit)
 }
 
-// Measurement is the type of measurement, i.e. the physical property being measued in common notation
+// Measurement is the type of measurement, i.e. the physical property being measued in common notation.
+// Besides the predefined constants, indexed measurements for an arbitrary number of
+// phases, strings, tariffs or batteries can be created using Indexed, and measurements
+// for unmapped OBIS codes using OBIS.Dynamic.
 type Measurement int
 
-//go:generate enumer -type=Measurement
+// New measurements must be appended, values are part of the indexed and OBIS encodings.
 const (
 	_ Measurement = iota
 
@@ -154,114 +158,145 @@ const (
 	BatteryVoltage
 
 	PhaseAngle
+
+	// Heat, water and gas meters
+	Volume
+	VolumeFlow
+	HeatEnergy
+	HeatPower
+	FlowTemperature
+	ReturnTemperature
+	TemperatureDifference
+
+	// Energy counters continued across resets and meter replacement
+	VirtualImport
+	VirtualExport
+	VirtualSum
+
+	// DC generation of all strings
+	DCEnergy
+
+	// end of predefined measurements, must remain last
+	endOfMeasurements
 )
 
 var iec = map[Measurement][]string{
-	Frequency:        {"Frequency", "Hz"},
-	FrequencyL1:      {"L1 Frequency", "Hz"},
-	FrequencyL2:      {"L2 Frequency", "Hz"},
-	FrequencyL3:      {"L3 Frequency", "Hz"},
-	Current:          {"Current", "A"},
-	CurrentL1:        {"L1 Current", "A"},
-	CurrentL2:        {"L2 Current", "A"},
-	CurrentL3:        {"L3 Current", "A"},
-	Voltage:          {"Voltage", "V"},
-	VoltageL1:        {"L1 Voltage", "V"},
-	VoltageL2:        {"L2 Voltage", "V"},
-	VoltageL3:        {"L3 Voltage", "V"},
-	VoltageL1_L2:     {"L1 to L2 Voltage", "V"},
-	VoltageL2_L3:     {"L2 to L3 Voltage", "V"},
-	VoltageL3_L1:     {"L3 to L1 Voltage", "V"},
-	VoltageL_N_avg:   {"L to N average Voltage", "V"},
-	VoltageL_L_avg:   {"L to L average Voltage", "V"},
-	Power:            {"Power", "W"},
-	PowerL1:          {"L1 Power", "W"},
-	PowerL2:          {"L2 Power", "W"},
-	PowerL3:          {"L3 Power", "W"},
-	ImportPower:      {"Import Power", "W"},
-	ImportPowerL1:    {"L1 Import Power", "W"},
-	ImportPowerL2:    {"L2 Import Power", "W"},
-	ImportPowerL3:    {"L3 Import Power", "W"},
-	ExportPower:      {"Export Power", "W"},
-	ExportPowerL1:    {"L1 Export Power", "W"},
-	ExportPowerL2:    {"L2 Export Power", "W"},
-	ExportPowerL3:    {"L3 Export Power", "W"},
-	ReactivePower:    {"Reactive Power", "var"},
-	ReactivePowerL1:  {"L1 Reactive Power", "var"},
-	ReactivePowerL2:  {"L2 Reactive Power", "var"},
-	ReactivePowerL3:  {"L3 Reactive Power", "var"},
-	ApparentPower:    {"Apparent Power", "VA"},
-	ApparentPowerL1:  {"L1 Apparent Power", "VA"},
-	ApparentPowerL2:  {"L2 Apparent Power", "VA"},
-	ApparentPowerL3:  {"L3 Apparent Power", "VA"},
-	Cosphi:           {"Cosphi"},
-	CosphiL1:         {"L1 Cosphi"},
-	CosphiL2:         {"L2 Cosphi"},
-	CosphiL3:         {"L3 Cosphi"},
-	THD:              {"Average voltage to neutral THD", "%"},
-	THDL1:            {"L1 Voltage to neutral THD", "%"},
-	THDL2:            {"L2 Voltage to neutral THD", "%"},
-	THDL3:            {"L3 Voltage to neutral THD", "%"},
-	ThreePhase_Vec_A: {"Three Phase Vector Current", "%"},
-	Sum:              {"Total Sum", "kWh"},
-	SumT1:            {"Tariff 1 Sum", "kWh"},
-	SumT2:            {"Tariff 2 Sum", "kWh"},
-	SumL1:            {"L1 Sum", "kWh"},
-	SumL2:            {"L2 Sum", "kWh"},
-	SumL3:            {"L3 Sum", "kWh"},
-	Import:           {"Total Import", "kWh"},
-	ImportT1:         {"Tariff 1 Import", "kWh"},
-	ImportT2:         {"Tariff 2 Import", "kWh"},
-	ImportL1:         {"L1 Import", "kWh"},
-	ImportL2:         {"L2 Import", "kWh"},
-	ImportL3:         {"L3 Import", "kWh"},
-	Export:           {"Total Export", "kWh"},
-	ExportT1:         {"Tariff 1 Export", "kWh"},
-	ExportT2:         {"Tariff 2 Export", "kWh"},
-	ExportL1:         {"L1 Export", "kWh"},
-	ExportL2:         {"L2 Export", "kWh"},
-	ExportL3:         {"L3 Export", "kWh"},
-	ReactiveSum:      {"Total Reactive", "kvarh"},
-	ReactiveSumT1:    {"Tariff 1 Reactive", "kvarh"},
-	ReactiveSumT2:    {"Tariff 2 Reactive", "kvarh"},
-	ReactiveSumL1:    {"L1 Reactive", "kvarh"},
-	ReactiveSumL2:    {"L2 Reactive", "kvarh"},
-	ReactiveSumL3:    {"L3 Reactive", "kvarh"},
-	ReactiveImport:   {"Reactive Import", "kvarh"},
-	ReactiveImportT1: {"Tariff 1 Reactive Import", "kvarh"},
-	ReactiveImportT2: {"Tariff 2 Reactive Import", "kvarh"},
-	ReactiveImportL1: {"L1 Reactive Import", "kvarh"},
-	ReactiveImportL2: {"L2 Reactive Import", "kvarh"},
-	ReactiveImportL3: {"L3 Reactive Import", "kvarh"},
-	ReactiveExport:   {"Reactive Export", "kvarh"},
-	ReactiveExportT1: {"Tariff 1 Reactive Export", "kvarh"},
-	ReactiveExportT2: {"Tariff 2 Reactive Export", "kvarh"},
-	ReactiveExportL1: {"L1 Reactive Export", "kvarh"},
-	ReactiveExportL2: {"L2 Reactive Export", "kvarh"},
-	ReactiveExportL3: {"L3 Reactive Export", "kvarh"},
-	DCCurrent:        {"DC Current", "A"},
-	DCVoltage:        {"DC Voltage", "V"},
-	DCPower:          {"DC Power", "W"},
-	HeatSinkTemp:     {"Heat Sink Temperature", "°C"},
-	DCCurrentS1:      {"String 1 Current", "A"},
-	DCVoltageS1:      {"String 1 Voltage", "V"},
-	DCPowerS1:        {"String 1 Power", "W"},
-	DCEnergyS1:       {"String 1 Generation", "kWh"},
-	DCCurrentS2:      {"String 2 Current", "A"},
-	DCVoltageS2:      {"String 2 Voltage", "V"},
-	DCPowerS2:        {"String 2 Power", "W"},
-	DCEnergyS2:       {"String 2 Generation", "kWh"},
-	DCCurrentS3:      {"String 3 Current", "A"},
-	DCVoltageS3:      {"String 3 Voltage", "V"},
-	DCPowerS3:        {"String 3 Power", "W"},
-	DCEnergyS3:       {"String 3 Generation", "kWh"},
-	DCCurrentS4:      {"String 4 Current", "A"},
-	DCVoltageS4:      {"String 4 Voltage", "V"},
-	DCPowerS4:        {"String 4 Power", "W"},
-	DCEnergyS4:       {"String 4 Generation", "kWh"},
-	ChargeState:      {"Charge State", "%"},
-	BatteryVoltage:   {"Battery Voltage", "V"},
-	PhaseAngle:       {"Phase Angle", "°"},
+	Frequency:             {"Frequency", "Hz"},
+	FrequencyL1:           {"L1 Frequency", "Hz"},
+	FrequencyL2:           {"L2 Frequency", "Hz"},
+	FrequencyL3:           {"L3 Frequency", "Hz"},
+	Current:               {"Current", "A"},
+	CurrentL1:             {"L1 Current", "A"},
+	CurrentL2:             {"L2 Current", "A"},
+	CurrentL3:             {"L3 Current", "A"},
+	Voltage:               {"Voltage", "V"},
+	VoltageL1:             {"L1 Voltage", "V"},
+	VoltageL2:             {"L2 Voltage", "V"},
+	VoltageL3:             {"L3 Voltage", "V"},
+	VoltageL1_L2:          {"L1 to L2 Voltage", "V"},
+	VoltageL2_L3:          {"L2 to L3 Voltage", "V"},
+	VoltageL3_L1:          {"L3 to L1 Voltage", "V"},
+	VoltageL_N_avg:        {"L to N average Voltage", "V"},
+	VoltageL_L_avg:        {"L to L average Voltage", "V"},
+	Power:                 {"Power", "W"},
+	PowerL1:               {"L1 Power", "W"},
+	PowerL2:               {"L2 Power", "W"},
+	PowerL3:               {"L3 Power", "W"},
+	ImportPower:           {"Import Power", "W"},
+	ImportPowerL1:         {"L1 Import Power", "W"},
+	ImportPowerL2:         {"L2 Import Power", "W"},
+	ImportPowerL3:         {"L3 Import Power", "W"},
+	ExportPower:           {"Export Power", "W"},
+	ExportPowerL1:         {"L1 Export Power", "W"},
+	ExportPowerL2:         {"L2 Export Power", "W"},
+	ExportPowerL3:         {"L3 Export Power", "W"},
+	ReactivePower:         {"Reactive Power", "var"},
+	ReactivePowerL1:       {"L1 Reactive Power", "var"},
+	ReactivePowerL2:       {"L2 Reactive Power", "var"},
+	ReactivePowerL3:       {"L3 Reactive Power", "var"},
+	ApparentPower:         {"Apparent Power", "VA"},
+	ApparentPowerL1:       {"L1 Apparent Power", "VA"},
+	ApparentPowerL2:       {"L2 Apparent Power", "VA"},
+	ApparentPowerL3:       {"L3 Apparent Power", "VA"},
+	Cosphi:                {"Cosphi"},
+	CosphiL1:              {"L1 Cosphi"},
+	CosphiL2:              {"L2 Cosphi"},
+	CosphiL3:              {"L3 Cosphi"},
+	THD:                   {"Average voltage to neutral THD", "%"},
+	THDL1:                 {"L1 Voltage to neutral THD", "%"},
+	THDL2:                 {"L2 Voltage to neutral THD", "%"},
+	THDL3:                 {"L3 Voltage to neutral THD", "%"},
+	ThreePhase_Vec_A:      {"Three Phase Vector Current", "%"},
+	Sum:                   {"Total Sum", "kWh"},
+	SumT1:                 {"Tariff 1 Sum", "kWh"},
+	SumT2:                 {"Tariff 2 Sum", "kWh"},
+	SumL1:                 {"L1 Sum", "kWh"},
+	SumL2:                 {"L2 Sum", "kWh"},
+	SumL3:                 {"L3 Sum", "kWh"},
+	Import:                {"Total Import", "kWh"},
+	ImportT1:              {"Tariff 1 Import", "kWh"},
+	ImportT2:              {"Tariff 2 Import", "kWh"},
+	ImportL1:              {"L1 Import", "kWh"},
+	ImportL2:              {"L2 Import", "kWh"},
+	ImportL3:              {"L3 Import", "kWh"},
+	Export:                {"Total Export", "kWh"},
+	ExportT1:              {"Tariff 1 Export", "kWh"},
+	ExportT2:              {"Tariff 2 Export", "kWh"},
+	ExportL1:              {"L1 Export", "kWh"},
+	ExportL2:              {"L2 Export", "kWh"},
+	ExportL3:              {"L3 Export", "kWh"},
+	ReactiveSum:           {"Total Reactive", "kvarh"},
+	ReactiveSumT1:         {"Tariff 1 Reactive", "kvarh"},
+	ReactiveSumT2:         {"Tariff 2 Reactive", "kvarh"},
+	ReactiveSumL1:         {"L1 Reactive", "kvarh"},
+	ReactiveSumL2:         {"L2 Reactive", "kvarh"},
+	ReactiveSumL3:         {"L3 Reactive", "kvarh"},
+	ReactiveImport:        {"Reactive Import", "kvarh"},
+	ReactiveImportT1:      {"Tariff 1 Reactive Import", "kvarh"},
+	ReactiveImportT2:      {"Tariff 2 Reactive Import", "kvarh"},
+	ReactiveImportL1:      {"L1 Reactive Import", "kvarh"},
+	ReactiveImportL2:      {"L2 Reactive Import", "kvarh"},
+	ReactiveImportL3:      {"L3 Reactive Import", "kvarh"},
+	ReactiveExport:        {"Reactive Export", "kvarh"},
+	ReactiveExportT1:      {"Tariff 1 Reactive Export", "kvarh"},
+	ReactiveExportT2:      {"Tariff 2 Reactive Export", "kvarh"},
+	ReactiveExportL1:      {"L1 Reactive Export", "kvarh"},
+	ReactiveExportL2:      {"L2 Reactive Export", "kvarh"},
+	ReactiveExportL3:      {"L3 Reactive Export", "kvarh"},
+	DCCurrent:             {"DC Current", "A"},
+	DCVoltage:             {"DC Voltage", "V"},
+	DCPower:               {"DC Power", "W"},
+	DCEnergy:              {"DC Generation", "kWh"},
+	HeatSinkTemp:          {"Heat Sink Temperature", "°C"},
+	DCCurrentS1:           {"String 1 Current", "A"},
+	DCVoltageS1:           {"String 1 Voltage", "V"},
+	DCPowerS1:             {"String 1 Power", "W"},
+	DCEnergyS1:            {"String 1 Generation", "kWh"},
+	DCCurrentS2:           {"String 2 Current", "A"},
+	DCVoltageS2:           {"String 2 Voltage", "V"},
+	DCPowerS2:             {"String 2 Power", "W"},
+	DCEnergyS2:            {"String 2 Generation", "kWh"},
+	DCCurrentS3:           {"String 3 Current", "A"},
+	DCVoltageS3:           {"String 3 Voltage", "V"},
+	DCPowerS3:             {"String 3 Power", "W"},
+	DCEnergyS3:            {"String 3 Generation", "kWh"},
+	DCCurrentS4:           {"String 4 Current", "A"},
+	DCVoltageS4:           {"String 4 Voltage", "V"},
+	DCPowerS4:             {"String 4 Power", "W"},
+	DCEnergyS4:            {"String 4 Generation", "kWh"},
+	ChargeState:           {"Charge State", "%"},
+	BatteryVoltage:        {"Battery Voltage", "V"},
+	PhaseAngle:            {"Phase Angle", "°"},
+	Volume:                {"Volume", "m³"},
+	VolumeFlow:            {"Volume Flow", "m³/h"},
+	HeatEnergy:            {"Heat Energy", "kWh"},
+	HeatPower:             {"Heat Power", "W"},
+	FlowTemperature:       {"Flow Temperature", "°C"},
+	ReturnTemperature:     {"Return Temperature", "°C"},
+	TemperatureDifference: {"Temperature Difference", "K"},
+	VirtualImport:         {"Virtual Total Import", "kWh"},
+	VirtualExport:         {"Virtual Total Export", "kWh"},
+	VirtualSum:            {"Virtual Total Sum", "kWh"},
 }
 
 // MarshalText implements encoding.TextMarshaler
@@ -279,6 +314,21 @@ func (m *Measurement) DescriptionAndUnit() (string, string) {
 		}
 		return description, unit
 	}
+
+	// dynamic indexed measurement
+	if base, typ, index := m.Index(); typ != NoIndex {
+		description, unit := base.DescriptionAndUnit()
+		for _, prefix := range []string{"Total ", "DC ", "Battery "} {
+			description = strings.TrimPrefix(description, prefix)
+		}
+		return fmt.Sprintf(indexLabel[typ], index) + " " + description, unit
+	}
+
+	// dynamic OBIS measurement, unit depends on the device
+	if o, ok := m.OBIS(); ok {
+		return "OBIS " + o.String(), ""
+	}
+
 	return m.String(), ""
 }
 
@@ -0,0 +1,149 @@
+package meters
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// OBIS is an object identification code as defined by IEC 62056-61, e.g. 1-0:1.8.0*255
+type OBIS [6]byte
+
+var (
+	obisRegex = regexp.MustCompile(`^(?:(\d+)-(\d+):)?(\d+)\.(\d+)\.(\d+)(?:[*&](\d+))?$`)
+
+	// obisNameRegex matches names of dynamic OBIS measurements like OBIS_130_7_0
+	obisNameRegex = regexp.MustCompile(`(?i)^OBIS_(\d+)_(\d+)_(\d+)$`)
+)
+
+// dynamic measurements of electricity OBIS codes without predefined measurement
+// are encoded as flag | C << 16 | D << 8 | E
+const obisFlag = 1 << 28
+
+// ParseOBIS parses an OBIS code in reduced or full notation. Missing groups
+// default to electricity (1-0) and 255.
+func ParseOBIS(s string) (OBIS, error) {
+	match := obisRegex.FindStringSubmatch(s)
+	if match == nil {
+		return OBIS{}, fmt.Errorf("invalid OBIS code: %s", s)
+	}
+
+	defaults := []string{"1", "0", "", "", "", "255"}
+
+	var res OBIS
+	for i, group := range match[1:] {
+		if group == "" {
+			group = defaults[i]
+		}
+
+		v, err := strconv.ParseUint(group, 10, 8)
+		if err != nil {
+			return OBIS{}, fmt.Errorf("invalid OBIS code: %s", s)
+		}
+		res[i] = byte(v)
+	}
+
+	return res, nil
+}
+
+func (o OBIS) String() string {
+	return fmt.Sprintf("%d-%d:%d.%d.%d*%d", o[0], o[1], o[2], o[3], o[4], o[5])
+}
+
+// obisMeasurements maps electricity OBIS value groups C.D.E to measurements
+var obisMeasurements = map[[3]byte]Measurement{
+	{1, 8, 0}:  Import,
+	{2, 8, 0}:  Export,
+	{21, 8, 0}: ImportL1,
+	{41, 8, 0}: ImportL2,
+	{61, 8, 0}: ImportL3,
+	{22, 8, 0}: ExportL1,
+	{42, 8, 0}: ExportL2,
+	{62, 8, 0}: ExportL3,
+	{3, 8, 0}:  ReactiveImport,
+	{4, 8, 0}:  ReactiveExport,
+	{1, 7, 0}:  ImportPower,
+	{2, 7, 0}:  ExportPower,
+	{16, 7, 0}: Power,
+	{36, 7, 0}: PowerL1,
+	{56, 7, 0}: PowerL2,
+	{76, 7, 0}: PowerL3,
+	{21, 7, 0}: ImportPowerL1,
+	{41, 7, 0}: ImportPowerL2,
+	{61, 7, 0}: ImportPowerL3,
+	{22, 7, 0}: ExportPowerL1,
+	{42, 7, 0}: ExportPowerL2,
+	{62, 7, 0}: ExportPowerL3,
+	{32, 7, 0}: VoltageL1,
+	{52, 7, 0}: VoltageL2,
+	{72, 7, 0}: VoltageL3,
+	{31, 7, 0}: CurrentL1,
+	{51, 7, 0}: CurrentL2,
+	{71, 7, 0}: CurrentL3,
+	{14, 7, 0}: Frequency,
+	{13, 7, 0}: Cosphi,
+	{33, 7, 0}: CosphiL1,
+	{53, 7, 0}: CosphiL2,
+	{73, 7, 0}: CosphiL3,
+}
+
+// obisTariffs are the total energy registers C.8 that are available per tariff E
+var obisTariffs = map[byte]Measurement{
+	1: Import,
+	2: Export,
+	3: ReactiveImport,
+	4: ReactiveExport,
+}
+
+// Measurement returns the measurement for current values of electricity OBIS codes.
+// Tariff registers map to indexed measurements. The channel group (B) is ignored.
+func (o OBIS) Measurement() (Measurement, bool) {
+	if o[0] != 1 || o[5] != 255 {
+		return 0, false
+	}
+
+	if base, ok := obisTariffs[o[2]]; ok && o[3] == 8 && o[4] > 0 {
+		return Indexed(base, TariffIndex, int(o[4])), true
+	}
+
+	m, ok := obisMeasurements[[3]byte{o[2], o[3], o[4]}]
+	return m, ok
+}
+
+// Dynamic returns a dynamic measurement for current values of electricity OBIS codes, e.g.
+// manufacturer-specific registers. General purpose, service and error codes are excluded.
+func (o OBIS) Dynamic() (Measurement, bool) {
+	if o[0] != 1 || o[5] != 255 || o[2] == 0 || o[2] >= 96 && o[2] <= 99 {
+		return 0, false
+	}
+
+	return Measurement(obisFlag | int(o[2])<<16 | int(o[3])<<8 | int(o[4])), true
+}
+
+// OBIS returns the OBIS code of dynamic OBIS measurements
+func (m Measurement) OBIS() (OBIS, bool) {
+	if int(m)&^0xFFFFFF != obisFlag {
+		return OBIS{}, false
+	}
+
+	return OBIS{1, 0, byte(m >> 16), byte(m >> 8), byte(m), 255}, true
+}
+
+// parseOBISName parses the name of a dynamic OBIS measurement
+func parseOBISName(name string) (Measurement, bool) {
+	match := obisNameRegex.FindStringSubmatch(name)
+	if match == nil {
+		return 0, false
+	}
+
+	o := OBIS{1, 0, 0, 0, 0, 255}
+	for i, group := range match[1:] {
+		v, err := strconv.ParseUint(group, 10, 8)
+		if err != nil {
+			return 0, false
+		}
+		o[i+2] = byte(v)
+	}
+
+	return o.Dynamic()
+}
@@ -0,0 +1,90 @@
+package meters
+
+import "testing"
+
+func TestParseOBIS(t *testing.T) {
+	tc := []struct {
+		code string
+		obis OBIS
+		m    Measurement
+		ok   bool
+	}{
+		{"1-0:1.8.0*255", OBIS{1, 0, 1, 8, 0, 255}, Import, true},
+		{"16.7.0", OBIS{1, 0, 16, 7, 0, 255}, Power, true},
+		{"1.8.2", OBIS{1, 0, 1, 8, 2, 255}, ImportT2, true},
+		{"2.8.3", OBIS{1, 0, 2, 8, 3, 255}, Indexed(Export, TariffIndex, 3), true},
+		{"1-1:76.7.0", OBIS{1, 1, 76, 7, 0, 255}, PowerL3, true},
+		{"1.8.0*01", OBIS{1, 0, 1, 8, 0, 1}, 0, false},      // historical value
+		{"0-0:96.1.0", OBIS{0, 0, 96, 1, 0, 255}, 0, false}, // serial number
+	}
+
+	for _, c := range tc {
+		obis, err := ParseOBIS(c.code)
+		if err != nil || obis != c.obis {
+			t.Errorf("%s: unexpected %v %v", c.code, obis, err)
+		}
+
+		if m, ok := obis.Measurement(); m != c.m || ok != c.ok {
+			t.Errorf("%s: unexpected measurement %v %v", c.code, m, ok)
+		}
+	}
+
+	if _, err := ParseOBIS("1.8"); err == nil {
+		t.Error("expected error for invalid code")
+	}
+}
+
+func TestOBISDynamic(t *testing.T) {
+	tc := []struct {
+		code string
+		name string
+		ok   bool
+	}{
+		{"130.7.0", "OBIS_130_7_0", true},
+		{"1-0:31.25.0", "OBIS_31_25_0", true},
+		{"0.0.0", "", false},      // general purpose
+		{"96.50.1", "", false},    // service entry
+		{"130.7.0*01", "", false}, // historical value
+		{"0-0:13.7.0", "", false}, // not electricity
+	}
+
+	for _, c := range tc {
+		obis, err := ParseOBIS(c.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, ok := obis.Dynamic()
+		if ok != c.ok {
+			t.Errorf("%s: unexpected dynamic measurement %v", c.code, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if m.String() != c.name || !m.IsAMeasurement() {
+			t.Errorf("%s: expected %s, got %s", c.code, c.name, m)
+		}
+
+		if o, ok := m.OBIS(); !ok || o != obis {
+			t.Errorf("%s: unexpected OBIS code %v", c.code, o)
+		}
+
+		if base, typ, _ := m.Index(); base != m || typ != NoIndex {
+			t.Errorf("%s: unexpected index", c.code)
+		}
+
+		if parsed, err := MeasurementString(c.name); err != nil || parsed != m {
+			t.Errorf("%s: parsing failed: %v", c.name, err)
+		}
+
+		if d := m.Description(); d != "OBIS "+obis.String() {
+			t.Errorf("%s: unexpected description %s", c.code, d)
+		}
+	}
+
+	if _, ok := Power.OBIS(); ok {
+		t.Error("unexpected OBIS code of predefined measurement")
+	}
+}
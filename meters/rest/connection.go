@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// defaultTimeout is the default http request timeout
+const defaultTimeout = 5 * time.Second
+
+// Connection is a http endpoint returning JSON. It implements meters.Connection
+// for the device polling the endpoint.
+type Connection struct {
+	uri      string
+	user     string
+	password string
+	token    string
+	headers  map[string]string
+	client   *http.Client
+
+	mu     sync.Mutex
+	logger meters.Logger
+}
+
+var _ meters.Connection = (*Connection)(nil)
+
+// NewConnection creates a connection for the given URL. Requests are authenticated
+// using basic auth if user is given or bearer token if token is given.
+func NewConnection(uri, user, password, token string, headers map[string]string) *Connection {
+	return &Connection{
+		uri:      uri,
+		user:     user,
+		password: password,
+		token:    token,
+		headers:  headers,
+		client:   &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Get requests the endpoint and decodes the JSON response
+func (c *Connection) Get() (any, error) {
+	req, err := http.NewRequest(http.MethodGet, c.uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.logger != nil {
+		c.logger.Printf("http: recv %s %s", resp.Status, b)
+	}
+	c.mu.Unlock()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected response %s from %s", resp.Status, c)
+	}
+
+	var res any
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %w", c, err)
+	}
+
+	return res, nil
+}
+
+// String returns the endpoint's URL without credentials
+func (c *Connection) String() string {
+	u, err := url.Parse(c.uri)
+	if err != nil {
+		return c.uri
+	}
+	return u.Redacted()
+}
+
+// ModbusClient returns nil as http endpoints don't speak modbus
+func (c *Connection) ModbusClient() modbus.Client {
+	return nil
+}
+
+// Logger sets a logging instance for received responses
+func (c *Connection) Logger(l meters.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger = l
+}
+
+// Slave is a nop for http connections
+func (c *Connection) Slave(_ uint8) {
+}
+
+// Timeout sets the request timeout and returns the previous value
+func (c *Connection) Timeout(timeout time.Duration) time.Duration {
+	t := c.client.Timeout
+	c.client.Timeout = timeout
+	return t
+}
+
+// ConnectDelay is a nop for http connections
+func (c *Connection) ConnectDelay(_ time.Duration) {
+}
+
+// Clone returns the connection itself
+func (c *Connection) Clone(_ byte) meters.Connection {
+	return c
+}
+
+// Close closes idle keep-alive connections
+func (c *Connection) Close() {
+	c.client.CloseIdleConnections()
+}
@@ -0,0 +1,135 @@
+// Package rest implements devices polled via http returning JSON, like the Fronius
+// Solar API, Shelly energy meters or Tasmota.
+package rest
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Type is the device type of http devices
+const Type = "HTTP"
+
+// Value maps the JSON value at Path to a measurement
+type Value struct {
+	Path        string
+	Measurement meters.Measurement
+	Scale       float64
+}
+
+// URL returns the preset's endpoint for the device's base URL. URLs containing a path are used as is.
+func (p Preset) URL(base string) string {
+	u, err := url.Parse(base)
+	if err != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + p.Path
+}
+
+// Device is a http endpoint polled for JSON readings
+type Device struct {
+	conn     *Connection
+	values   []Value
+	interval time.Duration // minimum interval between requests
+	last     time.Time
+
+	descriptor meters.DeviceDescriptor
+}
+
+// NewDevice creates a http device mapping the preset's and additional values
+func NewDevice(conn *Connection, preset Preset, values []Value, interval time.Duration) *Device {
+	manufacturer := preset.Manufacturer
+	if manufacturer == "" {
+		manufacturer = Type
+	}
+
+	return &Device{
+		conn:     conn,
+		values:   append(append([]Value{}, preset.Values...), values...),
+		interval: interval,
+		descriptor: meters.DeviceDescriptor{
+			Type:         Type,
+			Manufacturer: manufacturer,
+			Model:        preset.Model,
+		},
+	}
+}
+
+// Initialize verifies the endpoint is reachable
+func (d *Device) Initialize(client modbus.Client) error {
+	if len(d.values) == 0 {
+		return errors.New("http: no values configured")
+	}
+
+	_, err := d.conn.Get()
+	return err
+}
+
+// Descriptor returns the device descriptor
+func (d *Device) Descriptor() meters.DeviceDescriptor {
+	return d.descriptor
+}
+
+// read requests the endpoint and maps its values
+func (d *Device) read() ([]meters.MeasurementResult, error) {
+	doc, err := d.conn.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	d.last = time.Now()
+	res := make([]meters.MeasurementResult, 0, len(d.values))
+
+	for _, v := range d.values {
+		val, ok := Get(doc, v.Path)
+		if !ok {
+			continue
+		}
+
+		f, ok := Float(val)
+		if !ok {
+			continue
+		}
+
+		scale := v.Scale
+		if scale == 0 {
+			scale = 1
+		}
+
+		res = append(res, meters.MeasurementResult{
+			Measurement: v.Measurement,
+			Value:       f * scale,
+			Timestamp:   d.last,
+		})
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New("http: no values found in response")
+	}
+
+	return res, nil
+}
+
+// Probe returns the device's first reading
+func (d *Device) Probe(client modbus.Client) (res meters.MeasurementResult, err error) {
+	results, err := d.read()
+	if err != nil {
+		return res, err
+	}
+	return results[0], nil
+}
+
+// Query requests the endpoint and returns its readings. Queries before the
+// poll interval has elapsed return no readings without blocking the bus.
+func (d *Device) Query(client modbus.Client) ([]meters.MeasurementResult, error) {
+	if time.Since(d.last) < d.interval {
+		return nil, nil
+	}
+
+	return d.read()
+}
@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// split splits a gjson-style path into its components. Dots within keys are escaped by backslash.
+func split(path string) []string {
+	var (
+		res []string
+		key strings.Builder
+	)
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			key.WriteByte(path[i])
+		case c == '.':
+			res = append(res, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(c)
+		}
+	}
+
+	return append(res, key.String())
+}
+
+// Get returns the value at the gjson-style path, e.g. Body.Data.PAC.Value or emeters.0.power.
+// Object members are selected by key, array elements by index.
+func Get(v any, path string) (any, bool) {
+	for _, key := range split(path) {
+		switch t := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = t[key]; !ok {
+				return nil, false
+			}
+
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// Float converts a JSON value to float. Booleans and numeric strings are accepted.
+func Float(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"fmt"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Preset describes the endpoint and value mapping of a device family
+type Preset struct {
+	Manufacturer string
+	Model        string
+	Path         string // endpoint path appended to the device's base URL
+	Values       []Value
+}
+
+// Presets are the built-in device families by name
+var Presets = map[string]Preset{
+	"fronius-inverter": {
+		Manufacturer: "Fronius",
+		Model:        "Solar API inverter",
+		Path:         "/solar_api/v1/GetInverterRealtimeData.cgi?Scope=Device&DeviceId=1&DataCollection=CommonInverterData",
+		Values: []Value{
+			{"Body.Data.PAC.Value", meters.Power, 1},
+			{"Body.Data.UAC.Value", meters.Voltage, 1},
+			{"Body.Data.IAC.Value", meters.Current, 1},
+			{"Body.Data.FAC.Value", meters.Frequency, 1},
+			{"Body.Data.UDC.Value", meters.DCVoltage, 1},
+			{"Body.Data.IDC.Value", meters.DCCurrent, 1},
+			{"Body.Data.TOTAL_ENERGY.Value", meters.Export, 1e-3}, // Wh
+		},
+	},
+	"fronius-meter": {
+		Manufacturer: "Fronius",
+		Model:        "Solar API smart meter",
+		Path:         "/solar_api/v1/GetMeterRealtimeData.cgi?Scope=Device&DeviceId=0",
+		Values: []Value{
+			{"Body.Data.PowerReal_P_Sum", meters.Power, 1},
+			{"Body.Data.PowerReal_P_Phase_1", meters.PowerL1, 1},
+			{"Body.Data.PowerReal_P_Phase_2", meters.PowerL2, 1},
+			{"Body.Data.PowerReal_P_Phase_3", meters.PowerL3, 1},
+			{"Body.Data.Voltage_AC_Phase_1", meters.VoltageL1, 1},
+			{"Body.Data.Voltage_AC_Phase_2", meters.VoltageL2, 1},
+			{"Body.Data.Voltage_AC_Phase_3", meters.VoltageL3, 1},
+			{"Body.Data.Current_AC_Phase_1", meters.CurrentL1, 1},
+			{"Body.Data.Current_AC_Phase_2", meters.CurrentL2, 1},
+			{"Body.Data.Current_AC_Phase_3", meters.CurrentL3, 1},
+			{"Body.Data.Frequency_Phase_Average", meters.Frequency, 1},
+			{"Body.Data.PowerFactor_Sum", meters.Cosphi, 1},
+			{"Body.Data.EnergyReal_WAC_Sum_Consumed", meters.Import, 1e-3}, // Wh
+			{"Body.Data.EnergyReal_WAC_Sum_Produced", meters.Export, 1e-3}, // Wh
+		},
+	},
+	"shelly-em": {
+		Manufacturer: "Shelly",
+		Model:        "EM",
+		Path:         "/status",
+		Values: []Value{
+			{"emeters.0.power", meters.Power, 1},
+			{"emeters.0.reactive", meters.ReactivePower, 1},
+			{"emeters.0.voltage", meters.Voltage, 1},
+			{"emeters.0.pf", meters.Cosphi, 1},
+			{"emeters.0.total", meters.Import, 1e-3},          // Wh
+			{"emeters.0.total_returned", meters.Export, 1e-3}, // Wh
+		},
+	},
+	"shelly-3em": {
+		Manufacturer: "Shelly",
+		Model:        "3EM",
+		Path:         "/status",
+		Values: []Value{
+			{"total_power", meters.Power, 1},
+			{"emeters.0.power", meters.PowerL1, 1},
+			{"emeters.1.power", meters.PowerL2, 1},
+			{"emeters.2.power", meters.PowerL3, 1},
+			{"emeters.0.voltage", meters.VoltageL1, 1},
+			{"emeters.1.voltage", meters.VoltageL2, 1},
+			{"emeters.2.voltage", meters.VoltageL3, 1},
+			{"emeters.0.current", meters.CurrentL1, 1},
+			{"emeters.1.current", meters.CurrentL2, 1},
+			{"emeters.2.current", meters.CurrentL3, 1},
+			{"emeters.0.pf", meters.CosphiL1, 1},
+			{"emeters.1.pf", meters.CosphiL2, 1},
+			{"emeters.2.pf", meters.CosphiL3, 1},
+			{"emeters.0.total", meters.ImportL1, 1e-3}, // Wh
+			{"emeters.1.total", meters.ImportL2, 1e-3},
+			{"emeters.2.total", meters.ImportL3, 1e-3},
+			{"emeters.0.total_returned", meters.ExportL1, 1e-3},
+			{"emeters.1.total_returned", meters.ExportL2, 1e-3},
+			{"emeters.2.total_returned", meters.ExportL3, 1e-3},
+		},
+	},
+	"tasmota": {
+		Manufacturer: "Tasmota",
+		Path:         "/cm?cmnd=Status%208",
+		Values: []Value{
+			{"StatusSNS.ENERGY.Power", meters.Power, 1},
+			{"StatusSNS.ENERGY.ApparentPower", meters.ApparentPower, 1},
+			{"StatusSNS.ENERGY.ReactivePower", meters.ReactivePower, 1},
+			{"StatusSNS.ENERGY.Factor", meters.Cosphi, 1},
+			{"StatusSNS.ENERGY.Voltage", meters.Voltage, 1},
+			{"StatusSNS.ENERGY.Current", meters.Current, 1},
+			{"StatusSNS.ENERGY.Frequency", meters.Frequency, 1},
+			{"StatusSNS.ENERGY.Total", meters.Import, 1}, // kWh
+		},
+	},
+}
+
+// LookupPreset returns the named preset
+func LookupPreset(name string) (Preset, error) {
+	p, ok := Presets[name]
+	if !ok {
+		return p, fmt.Errorf("invalid preset: %s", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestGet(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"a":{"b.c":[1,"2.5",true]}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]float64{
+		`a.b\.c.0`: 1,
+		`a.b\.c.1`: 2.5,
+		`a.b\.c.2`: 1,
+	} {
+		v, ok := Get(doc, path)
+		if f, isFloat := Float(v); !ok || !isFloat || f != expected {
+			t.Errorf("%s: unexpected value %v", path, v)
+		}
+	}
+
+	for _, path := range []string{"a.b", `a.b\.c.3`, `a.b\.c.x`, "a.x.y"} {
+		if v, ok := Get(doc, path); ok {
+			if _, isFloat := Float(v); isFloat {
+				t.Errorf("%s: unexpected value %v", path, v)
+			}
+		}
+	}
+}
+
+func TestPresetURL(t *testing.T) {
+	p := Presets["shelly-em"]
+
+	for base, expected := range map[string]string{
+		"http://192.168.0.30":        "http://192.168.0.30/status",
+		"http://192.168.0.30/":       "http://192.168.0.30/status",
+		"http://192.168.0.30/custom": "http://192.168.0.30/custom",
+	} {
+		if u := p.URL(base); u != expected {
+			t.Errorf("%s: unexpected url %s", base, u)
+		}
+	}
+}
+
+func TestDevice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); r.URL.Path != "/status" || !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{
+			"total_power": 1500.5,
+			"emeters": [
+				{"power": 1000, "voltage": 230.1, "total": 12345},
+				{"power": 500.5, "voltage": 231.2, "total": 678},
+				{"power": 0, "voltage": 229.3, "total": 0, "is_valid": false}
+			],
+			"temperature": 45.5
+		}`))
+	}))
+	defer srv.Close()
+
+	preset := Presets["shelly-3em"]
+	conn := NewConnection(preset.URL(srv.URL), "admin", "secret", "", nil)
+	dev := NewDevice(conn, preset, []Value{{"temperature", meters.HeatSinkTemp, 0}}, 0)
+
+	if err := dev.Initialize(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if desc := dev.Descriptor(); desc.Manufacturer != "Shelly" || desc.Model != "3EM" {
+		t.Errorf("unexpected descriptor %+v", desc)
+	}
+
+	mr, err := dev.Query(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[meters.Measurement]float64{
+		meters.Power:        1500.5,
+		meters.PowerL1:      1000,
+		meters.PowerL2:      500.5,
+		meters.PowerL3:      0,
+		meters.VoltageL1:    230.1,
+		meters.VoltageL2:    231.2,
+		meters.VoltageL3:    229.3,
+		meters.ImportL1:     12.345,
+		meters.ImportL2:     0.678,
+		meters.ImportL3:     0,
+		meters.HeatSinkTemp: 45.5,
+	}
+
+	if len(mr) != len(expected) {
+		t.Errorf("unexpected results %v", mr)
+	}
+
+	for _, r := range mr {
+		if v, ok := expected[r.Measurement]; !ok || math.Abs(v-r.Value) > 1e-9 {
+			t.Errorf("unexpected result %s: %f", r.Measurement, r.Value)
+		}
+	}
+
+	// no requests within the poll interval
+	dev.interval = time.Hour
+	if mr, err := dev.Query(nil); err != nil || len(mr) != 0 {
+		t.Errorf("unexpected results within interval %v %v", mr, err)
+	}
+
+	// invalid credentials
+	dev = NewDevice(NewConnection(preset.URL(srv.URL), "", "", "token", nil), preset, nil, 0)
+	if _, err := dev.Query(nil); err == nil {
+		t.Error("expected error for unauthorized request")
+	}
+}
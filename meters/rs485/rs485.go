@@ -1,6 +1,7 @@
 package rs485
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -14,12 +15,23 @@ const (
 	ReadInputReg   = 4
 )
 
+// ErrNoSupportedOperations indicates that the device rejected all of its operations
+var ErrNoSupportedOperations = errors.New("no supported operations")
+
+// register identifies an operation's registers
+type register struct {
+	funcCode uint8
+	opCode   uint16
+	readLen  uint16
+}
+
 // RS485 implements meters.Device
 type RS485 struct {
-	typ      string
-	producer Producer
-	ops      chan Operation
-	inflight Operation
+	typ         string
+	producer    Producer
+	ops         chan Operation
+	inflight    Operation
+	unsupported map[register]bool // operations rejected with illegal data address
 }
 
 // NewDevice creates a device who's type must exist in the producer registry
@@ -27,8 +39,9 @@ func NewDevice(typ string) (*RS485, error) {
 	for t, factory := range Producers {
 		if strings.EqualFold(t, typ) {
 			device := &RS485{
-				typ:      typ,
-				producer: factory(),
+				typ:         typ,
+				producer:    factory(),
+				unsupported: make(map[register]bool),
 			}
 			return device, nil
 		}
@@ -96,7 +109,7 @@ func (d *RS485) QueryOp(client modbus.Client, op Operation) (res meters.Measurem
 	}
 
 	if err != nil {
-		return res, fmt.Errorf("read failed: %v", err)
+		return res, fmt.Errorf("read failed: %w", err)
 	}
 
 	res = meters.MeasurementResult{
@@ -126,20 +139,43 @@ func (d *RS485) Query(client modbus.Client) (res []meters.MeasurementResult, err
 	}
 
 	// Query loop will try to read all operations in a single run. It will
-	// always start with the current inflight operation. If an error is encountered,
-	// the partial results are returned. The loop is terminated after as many
-	// operations have been executed as the producer provides in a single run.
-	// In case of a flakey connection this guarantees that all registers are
-	// read at an equal rate.
+	// always start with the current inflight operation. If a transport error
+	// is encountered, the partial results are returned. Operations rejected
+	// by the device are skipped and reported after the run, operations
+	// rejected with illegal data address are disabled permanently.
+	// The loop is terminated after as many operations have been executed as
+	// the producer provides in a single run. In case of a flakey connection
+	// this guarantees that all registers are read at an equal rate.
+	var errs []error
 	for range d.producer.Produce() {
 		// get next inflight
 		if d.inflight.FuncCode == 0 {
 			d.inflight = <-d.ops
 		}
 
-		m, err := d.QueryOp(client, d.inflight)
+		op := d.inflight
+		reg := register{op.FuncCode, op.OpCode, op.ReadLen}
+		if d.unsupported[reg] {
+			d.inflight.FuncCode = 0
+			continue
+		}
+
+		m, err := d.QueryOp(client, op)
 		if err != nil {
-			return res, err
+			if meters.IsTransportError(err) {
+				return res, errors.Join(append(errs, err)...)
+			}
+
+			if meters.IsIllegalAddress(err) {
+				d.unsupported[reg] = true
+				err = &meters.UnsupportedError{Measurement: op.IEC61850, Err: err}
+			} else {
+				err = fmt.Errorf("%s: %w", op.IEC61850, err)
+			}
+
+			errs = append(errs, err)
+			d.inflight.FuncCode = 0
+			continue
 		}
 
 		// mark inflight operation as completed
@@ -148,5 +184,10 @@ func (d *RS485) Query(client modbus.Client) (res []meters.MeasurementResult, err
 		res = append(res, m)
 	}
 
-	return res, nil
+	// all operations have been disabled
+	if len(res) == 0 && len(errs) == 0 {
+		return res, ErrNoSupportedOperations
+	}
+
+	return res, errors.Join(errs...)
 }
@@ -0,0 +1,99 @@
+package rs485
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// client returns register values or errors by register address
+type client struct {
+	modbus.Client
+	errors   map[uint16]error
+	requests map[uint16]int
+}
+
+func (c *client) read(address, quantity uint16) ([]byte, error) {
+	c.requests[address]++
+	if err, ok := c.errors[address]; ok {
+		return nil, err
+	}
+	return make([]byte, 2*quantity), nil
+}
+
+func (c *client) ReadInputRegisters(address, quantity uint16) ([]byte, error) {
+	return c.read(address, quantity)
+}
+
+func (c *client) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return c.read(address, quantity)
+}
+
+func TestQueryUnsupported(t *testing.T) {
+	dev, err := NewDevice("SDM")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := dev.Producer().Produce()
+	unsupported, busy := ops[1], ops[2]
+	if unsupported.OpCode == busy.OpCode {
+		t.Fatal("invalid test operations")
+	}
+
+	c := &client{
+		errors: map[uint16]error{
+			unsupported.OpCode: &modbus.Error{ExceptionCode: modbus.ExceptionCodeIllegalDataAddress},
+			busy.OpCode:        &modbus.Error{ExceptionCode: modbus.ExceptionCodeServerDeviceBusy},
+		},
+		requests: make(map[uint16]int),
+	}
+
+	res, err := dev.Query(c)
+	if meters.IsTransportError(err) || len(res) == 0 {
+		t.Fatalf("unexpected result %d %v", len(res), err)
+	}
+
+	if m := meters.Unsupported(err); len(m) != 1 || m[0] != unsupported.IEC61850 {
+		t.Errorf("unexpected unsupported measurements %v", m)
+	}
+
+	// unsupported operation is skipped
+	requests := c.requests[unsupported.OpCode]
+	res, err = dev.Query(c)
+	if meters.IsTransportError(err) || len(meters.Unsupported(err)) != 0 || len(res) == 0 {
+		t.Errorf("unexpected result %d %v", len(res), err)
+	}
+	if c.requests[unsupported.OpCode] != requests {
+		t.Errorf("unexpected requests %v", c.requests)
+	}
+
+	// transport errors abort the query with partial results
+	c.errors[ops[5].OpCode] = errors.New("timeout")
+	res, err = dev.Query(c)
+	if !meters.IsTransportError(err) || len(res) == 0 {
+		t.Errorf("unexpected result %d %v", len(res), err)
+	}
+
+	// devices without supported operations fail
+	delete(c.errors, ops[5].OpCode)
+	for _, op := range ops {
+		c.errors[op.OpCode] = &modbus.Error{ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+	}
+	if _, err := dev.Query(c); len(meters.Unsupported(err)) == 0 {
+		t.Errorf("expected unsupported measurements, got %v", err)
+	}
+	for range 3 {
+		res, err = dev.Query(c)
+	}
+	if !errors.Is(err, ErrNoSupportedOperations) || !meters.IsTransportError(err) || len(res) != 0 {
+		t.Errorf("unexpected result %d %v", len(res), err)
+	}
+
+	// gateway exceptions are transport errors
+	if !meters.IsTransportError(&modbus.Error{ExceptionCode: modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond}) {
+		t.Error("expected transport error")
+	}
+}
@@ -13,6 +13,8 @@ type RTU struct {
 	Client  modbus.Client
 	Handler *modbus.RTUClientHandler
 	prevID  uint8
+	spec    string // usb: adapter specification resolved on each reconnect
+	link    *link
 }
 
 // NewClientHandler creates a serial line RTU modbus handler
@@ -31,6 +33,9 @@ func NewClientHandler(device string, baudrate int, comset string) *modbus.RTUCli
 		handler.StopBits = 2
 	case "8E1":
 		handler.Parity = "E"
+	case "7E1":
+		handler.Parity = "E"
+		handler.DataBits = 7
 	default:
 		log.Fatalf("Invalid communication set specified: %s. See -h for help.", comset)
 	}
@@ -40,24 +45,51 @@ func NewClientHandler(device string, baudrate int, comset string) *modbus.RTUCli
 
 var _ Connection = (*RTU)(nil)
 
-// NewRTU creates a RTU modbus client
+// NewRTU creates a RTU modbus client. The device is either a path or an usb: specification.
+// Missing or removed devices are reopened with backoff.
 func NewRTU(device string, baudrate int, comset string) *RTU {
 	handler := NewClientHandler(device, baudrate, comset)
-	client := modbus.NewClient(handler)
 
 	b := &RTU{
-		Client:  client,
 		Handler: handler,
 	}
 
+	if strings.HasPrefix(device, USBPrefix) {
+		b.spec = device
+	}
+
+	b.link = newLink(b.open, handler.Close, 0)
+	b.Client = &linkClient{Client: modbus.NewClient(handler), link: b.link}
+
 	return b
 }
 
+// open resolves the adapter's device path and opens the serial port
+func (b *RTU) open() error {
+	if b.spec != "" {
+		device, err := ResolveUSB(b.spec)
+		if err != nil {
+			return err
+		}
+		b.Handler.Address = device
+	}
+
+	return b.Handler.Connect()
+}
+
 // String returns the bus device
 func (b *RTU) String() string {
+	if b.spec != "" {
+		return b.spec
+	}
 	return b.Handler.Address
 }
 
+// LinkState implements the Linked interface
+func (b *RTU) LinkState() LinkState {
+	return b.link.state()
+}
+
 // ModbusClient returns the RTU modbus client
 func (b *RTU) ModbusClient() modbus.Client {
 	return b.Client
@@ -102,7 +134,9 @@ func (b *RTU) Clone(deviceID byte) Connection {
 	handler.SetSlave(deviceID)
 
 	return &RTU{
-		Client:  modbus.NewClient(handler),
+		Client:  &linkClient{Client: modbus.NewClient(handler), link: b.link},
 		Handler: handler,
+		spec:    b.spec,
+		link:    b.link,
 	}
 }
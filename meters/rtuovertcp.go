@@ -11,6 +11,7 @@ type RTUOverTCP struct {
 	Client  modbus.Client
 	Handler *modbus.RTUOverTCPClientHandler
 	prevID  uint8
+	link    *link
 }
 
 // NewRTUOverTCPClientHandler creates a RTU over TCP modbus handler
@@ -29,16 +30,22 @@ var _ Connection = (*RTUOverTCP)(nil)
 // NewRTUOverTCP creates a TCP modbus client
 func NewRTUOverTCP(address string) *RTUOverTCP {
 	handler := NewRTUOverTCPClientHandler(address)
-	client := modbus.NewClient(handler)
+	link := newLink(handler.Connect, handler.Close, tcpKeepAlive)
 
 	b := &RTUOverTCP{
-		Client:  client,
+		Client:  &linkClient{Client: modbus.NewClient(handler), link: link, slave: func() byte { return handler.SlaveID }},
 		Handler: handler,
+		link:    link,
 	}
 
 	return b
 }
 
+// LinkState implements the Linked interface
+func (b *RTUOverTCP) LinkState() LinkState {
+	return b.link.state()
+}
+
 // String returns the bus connection address (TCP)
 func (b *RTUOverTCP) String() string {
 	return b.Handler.Address
@@ -89,7 +96,8 @@ func (b *RTUOverTCP) Clone(deviceID byte) Connection {
 	handler.SetSlave(deviceID)
 
 	return &RTUOverTCP{
-		Client:  modbus.NewClient(handler),
+		Client:  &linkClient{Client: modbus.NewClient(handler), link: b.link, slave: func() byte { return handler.SlaveID }},
 		Handler: handler,
+		link:    b.link,
 	}
 }
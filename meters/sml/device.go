@@ -0,0 +1,239 @@
+// Package sml implements smart meters pushing Smart Message Language (SML)
+// telegrams via optical heads, either serial or TCP-connected.
+package sml
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Type is the device type of SML meters
+const Type = "SML"
+
+const (
+	// telegramTimeout is the maximum time to wait for a new telegram. Meters push every 1-4s.
+	telegramTimeout = 10 * time.Second
+	// reopenDelay is the delay before reading after stream errors
+	reopenDelay = time.Second
+)
+
+var (
+	obisSerial       = meters.OBIS{1, 0, 96, 1, 0, 255}
+	obisManufacturer = meters.OBIS{129, 129, 199, 130, 3, 255}
+)
+
+type telegram struct {
+	list      List
+	timestamp time.Time
+	seq       uint64
+}
+
+// Device is a SML meter attached to a byte stream
+type Device struct {
+	stream *meters.Stream
+	once   sync.Once
+
+	mu       sync.Mutex
+	latest   telegram
+	returned uint64        // sequence number of the last queried telegram
+	updated  chan struct{} // closed on reception of a new telegram
+	err      error         // last reception error
+
+	descriptor meters.DeviceDescriptor
+}
+
+// NewDevice creates a SML device reading from the given stream
+func NewDevice(stream *meters.Stream) *Device {
+	return &Device{
+		stream:  stream,
+		updated: make(chan struct{}),
+		descriptor: meters.DeviceDescriptor{
+			Type: Type,
+		},
+	}
+}
+
+// receive reads telegrams from the stream
+func (d *Device) receive() {
+	scanner := NewScanner(d.stream)
+
+	for {
+		data, err := scanner.Next()
+
+		var lists []List
+		if err == nil {
+			lists, err = Parse(data)
+		}
+
+		if err == nil && len(lists) == 0 {
+			err = errors.New("sml: telegram without value list")
+		}
+
+		if err != nil {
+			d.mu.Lock()
+			d.err = err
+			d.mu.Unlock()
+
+			if !meters.IsTimeout(err) && !errors.Is(err, ErrChecksum) {
+				time.Sleep(reopenDelay)
+				scanner = NewScanner(d.stream)
+			}
+			continue
+		}
+
+		d.mu.Lock()
+		d.err = nil
+		d.latest = telegram{
+			list:      lists[len(lists)-1],
+			timestamp: time.Now(),
+			seq:       d.latest.seq + 1,
+		}
+		close(d.updated)
+		d.updated = make(chan struct{})
+		d.mu.Unlock()
+	}
+}
+
+// next returns the next telegram not yet returned
+func (d *Device) next() (telegram, error) {
+	d.once.Do(func() {
+		go d.receive()
+	})
+
+	timer := time.NewTimer(telegramTimeout)
+	defer timer.Stop()
+
+	for {
+		d.mu.Lock()
+		if d.latest.seq > d.returned {
+			d.returned = d.latest.seq
+			t := d.latest
+			d.mu.Unlock()
+			return t, nil
+		}
+		updated, err := d.updated, d.err
+		d.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-timer.C:
+			if err == nil {
+				err = errors.New("timeout")
+			}
+			return telegram{}, fmt.Errorf("no telegram received from %s: %w", d.stream, err)
+		}
+	}
+}
+
+// Initialize waits for the first telegram and prepares the device descriptor
+func (d *Device) Initialize(client modbus.Client) error {
+	t, err := d.next()
+	if err != nil {
+		return err
+	}
+
+	// server id according to DIN 43863-5 contains the manufacturer's FLAG id
+	id := t.list.ServerID
+	if len(id) == 10 && isPrintable(id[2:5]) {
+		d.descriptor.Manufacturer = string(id[2:5])
+	}
+	d.descriptor.Serial = hex.EncodeToString(id)
+
+	for _, e := range t.list.Entries {
+		b, ok := e.Value.([]byte)
+		if !ok || !isPrintable(b) {
+			continue
+		}
+
+		switch e.OBIS {
+		case obisSerial:
+			d.descriptor.Serial = string(b)
+		case obisManufacturer:
+			d.descriptor.Manufacturer = string(b)
+		}
+	}
+
+	// keep the telegram for the first query
+	d.mu.Lock()
+	d.returned--
+	d.mu.Unlock()
+
+	return nil
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return len(b) > 0 && strings.TrimSpace(string(b)) != ""
+}
+
+// Descriptor returns the device descriptor
+func (d *Device) Descriptor() meters.DeviceDescriptor {
+	return d.descriptor
+}
+
+// results converts the telegram's values to measurements
+func (t telegram) results() []meters.MeasurementResult {
+	res := make([]meters.MeasurementResult, 0, len(t.list.Entries))
+
+	for _, e := range t.list.Entries {
+		m, ok := e.OBIS.Measurement()
+		if !ok {
+			continue
+		}
+
+		v, ok := e.Float()
+		if !ok {
+			continue
+		}
+
+		res = append(res, meters.MeasurementResult{
+			Measurement: m,
+			Value:       v,
+			Timestamp:   t.timestamp,
+		})
+	}
+
+	return res
+}
+
+// Probe waits for a telegram and returns its power or first reading
+func (d *Device) Probe(client modbus.Client) (res meters.MeasurementResult, err error) {
+	t, err := d.next()
+	if err != nil {
+		return res, err
+	}
+
+	results := t.results()
+	if len(results) == 0 {
+		return res, errors.New("sml: no known measurements")
+	}
+
+	for _, r := range results {
+		if r.Measurement == meters.Power {
+			return r, nil
+		}
+	}
+
+	return results[0], nil
+}
+
+// Query waits for a new telegram and returns its readings
+func (d *Device) Query(client modbus.Client) ([]meters.MeasurementResult, error) {
+	t, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.results(), nil
+}
@@ -0,0 +1,358 @@
+package sml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+var (
+	escape = []byte{0x1b, 0x1b, 0x1b, 0x1b}
+	start  = []byte{0x01, 0x01, 0x01, 0x01}
+)
+
+// ErrChecksum is returned for telegrams with invalid CRC
+var ErrChecksum = errors.New("sml: checksum mismatch")
+
+// message body tags
+const (
+	getListResponse = 0x0701
+)
+
+// DLMS units of energy counters
+const (
+	unitWattHour = 30
+	unitVarHour  = 32
+)
+
+// Entry is a single value list entry of a GetList response
+type Entry struct {
+	OBIS   meters.OBIS
+	Unit   uint8
+	Scaler int8
+	Value  any // int64, uint64, bool or []byte
+}
+
+// Float returns the scaled numeric value. Energies are converted from Wh to kWh.
+func (e Entry) Float() (float64, bool) {
+	var v float64
+	switch val := e.Value.(type) {
+	case int64:
+		v = float64(val)
+	case uint64:
+		v = float64(val)
+	default:
+		return 0, false
+	}
+
+	v *= math.Pow10(int(e.Scaler))
+
+	if e.Unit == unitWattHour || e.Unit == unitVarHour {
+		v /= 1e3
+	}
+
+	return v, true
+}
+
+// List is a GetList response
+type List struct {
+	ServerID []byte
+	Entries  []Entry
+}
+
+// crc16 calculates the X.25 checksum used by the SML transport layer
+func crc16(b []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, c := range b {
+		crc ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc ^ 0xffff
+}
+
+// Scanner reads SML transport layer telegrams from a byte stream
+type Scanner struct {
+	r *bufio.Reader
+}
+
+// NewScanner creates a telegram scanner
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReader(r)}
+}
+
+// sync skips input until the start sequence has been read
+func (s *Scanner) sync() error {
+	seq := append(append([]byte{}, escape...), start...)
+	window := make([]byte, len(seq))
+
+	for !bytes.Equal(window, seq) {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		copy(window, window[1:])
+		window[len(window)-1] = b
+	}
+
+	return nil
+}
+
+// Next returns the message data of the next telegram with valid checksum
+func (s *Scanner) Next() ([]byte, error) {
+	if err := s.sync(); err != nil {
+		return nil, err
+	}
+
+	raw := append(append([]byte{}, escape...), start...)
+	var data []byte
+
+	block := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(s.r, block); err != nil {
+			return nil, err
+		}
+		raw = append(raw, block...)
+
+		if !bytes.Equal(block, escape) {
+			data = append(data, block...)
+			continue
+		}
+
+		if _, err := io.ReadFull(s.r, block); err != nil {
+			return nil, err
+		}
+		raw = append(raw, block...)
+
+		switch {
+		case bytes.Equal(block, escape):
+			// escaped escape sequence
+			data = append(data, escape...)
+
+		case block[0] == 0x1a:
+			padding := int(block[1])
+			if padding > 3 || padding > len(data) {
+				return nil, fmt.Errorf("sml: invalid padding %d", padding)
+			}
+
+			crc := uint16(block[2]) | uint16(block[3])<<8
+			if crc16(raw[:len(raw)-2]) != crc {
+				return nil, ErrChecksum
+			}
+
+			return data[:len(data)-padding], nil
+
+		default:
+			return nil, fmt.Errorf("sml: unexpected escape sequence % x", block)
+		}
+	}
+}
+
+// endOfMessage marks the end of a message
+type endOfMessage struct{}
+
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := d.b[d.pos]
+	d.pos++
+	return b, nil
+}
+
+// value decodes a single element. Absent optional elements are returned as nil.
+func (d *decoder) value() (any, error) {
+	tl, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tl {
+	case 0x00:
+		return endOfMessage{}, nil
+	case 0x01:
+		return nil, nil
+	}
+
+	typ := tl >> 4 & 0x07
+	length := int(tl & 0x0f)
+	tlLen := 1
+
+	for b := tl; b&0x80 != 0; tlLen++ {
+		if b, err = d.byte(); err != nil {
+			return nil, err
+		}
+		length = length<<4 | int(b&0x0f)
+	}
+
+	if typ == 7 {
+		list := make([]any, length)
+		for i := range list {
+			if list[i], err = d.value(); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	length -= tlLen
+	if length < 0 || d.pos+length > len(d.b) {
+		return nil, fmt.Errorf("sml: invalid length at offset %d", d.pos)
+	}
+
+	b := d.b[d.pos : d.pos+length]
+	d.pos += length
+
+	switch typ {
+	case 0:
+		return b, nil
+
+	case 4:
+		if length != 1 {
+			return nil, fmt.Errorf("sml: invalid boolean length %d", length)
+		}
+		return b[0] != 0, nil
+
+	case 5, 6:
+		if length == 0 || length > 8 {
+			return nil, fmt.Errorf("sml: invalid integer length %d", length)
+		}
+
+		buf := make([]byte, 8)
+		if typ == 5 && b[0]&0x80 != 0 {
+			// sign extension
+			for i := range buf {
+				buf[i] = 0xff
+			}
+		}
+		copy(buf[8-length:], b)
+
+		u := binary.BigEndian.Uint64(buf)
+		if typ == 5 {
+			return int64(u), nil
+		}
+		return u, nil
+
+	default:
+		return nil, fmt.Errorf("sml: invalid type %d at offset %d", typ, d.pos)
+	}
+}
+
+func list(v any, n int) ([]any, error) {
+	l, ok := v.([]any)
+	if !ok || len(l) != n {
+		return nil, fmt.Errorf("sml: expected list of %d elements, got %T", n, v)
+	}
+	return l, nil
+}
+
+func integer(v any) (int64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return val, true
+	case uint64:
+		return int64(val), true
+	default:
+		return 0, false
+	}
+}
+
+// Parse decodes the GetList responses of a telegram's message data
+func Parse(data []byte) ([]List, error) {
+	var res []List
+
+	d := &decoder{b: data}
+	for d.pos < len(d.b) {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := v.(endOfMessage); ok {
+			continue // trailing padding
+		}
+
+		msg, err := list(v, 6)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := list(msg[3], 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if tag, _ := integer(body[0]); tag != getListResponse {
+			continue
+		}
+
+		l, err := parseList(body[1])
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, l)
+	}
+
+	return res, nil
+}
+
+// parseList decodes a GetList response
+func parseList(v any) (List, error) {
+	var res List
+
+	resp, err := list(v, 7)
+	if err != nil {
+		return res, err
+	}
+
+	res.ServerID, _ = resp[1].([]byte)
+
+	values, ok := resp[4].([]any)
+	if !ok {
+		return res, fmt.Errorf("sml: invalid value list %T", resp[4])
+	}
+
+	for _, v := range values {
+		entry, err := list(v, 7)
+		if err != nil {
+			return res, err
+		}
+
+		name, ok := entry[0].([]byte)
+		if !ok || len(name) != 6 {
+			return res, fmt.Errorf("sml: invalid object name %v", entry[0])
+		}
+
+		e := Entry{Value: entry[5]}
+		copy(e.OBIS[:], name)
+
+		if unit, ok := integer(entry[3]); ok {
+			e.Unit = uint8(unit)
+		}
+		if scaler, ok := integer(entry[4]); ok {
+			e.Scaler = int8(scaler)
+		}
+
+		res.Entries = append(res.Entries, e)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,143 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// encoding helpers for building telegrams
+func octet(b ...byte) []byte { return append([]byte{byte(len(b) + 1)}, b...) }
+func u8(v uint8) []byte      { return []byte{0x62, v} }
+func i8(v int8) []byte       { return []byte{0x52, byte(v)} }
+func u16(v uint16) []byte    { return []byte{0x63, byte(v >> 8), byte(v)} }
+
+func i32(v int32) []byte {
+	b := []byte{0x55, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(v))
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := []byte{0x69, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], v)
+	return b
+}
+
+func seq(elements ...[]byte) []byte {
+	return append([]byte{0x70 | byte(len(elements))}, bytes.Join(elements, nil)...)
+}
+
+var absent = []byte{0x01}
+
+func entry(obis meters.OBIS, unit uint8, scaler int8, value []byte) []byte {
+	return seq(octet(obis[:]...), absent, absent, u8(unit), i8(scaler), value, absent)
+}
+
+func message(tag uint16, body []byte) []byte {
+	return seq(octet(1), u8(0), u8(0), seq(u16(tag), body), u16(0), []byte{0x00})
+}
+
+// frame wraps message data into a transport layer telegram
+func frame(data []byte) []byte {
+	padding := (4 - len(data)%4) % 4
+	data = append(data, make([]byte, padding)...)
+
+	var body []byte
+	for i := 0; i < len(data); i += 4 {
+		if bytes.Equal(data[i:i+4], escape) {
+			body = append(body, escape...)
+		}
+		body = append(body, data[i:i+4]...)
+	}
+
+	res := append(append(append([]byte{}, escape...), start...), body...)
+	res = append(res, append(escape, 0x1a, byte(padding))...)
+	crc := crc16(res)
+
+	return append(res, byte(crc), byte(crc>>8))
+}
+
+func telegramData() []byte {
+	serverID := []byte{0x0a, 0x01, 'E', 'M', 'H', 0x00, 0x00, 0x12, 0x34, 0x56}
+
+	return bytes.Join([][]byte{
+		message(0x0101, seq(absent, octet(1), octet(1), octet(serverID...), absent, absent)),
+		message(getListResponse, seq(
+			absent,
+			octet(serverID...),
+			absent,
+			absent,
+			seq(
+				entry(meters.OBIS{129, 129, 199, 130, 3, 255}, 0, 0, octet('E', 'M', 'H')),
+				entry(meters.OBIS{1, 0, 1, 8, 0, 255}, 30, -1, u64(123456789)),
+				entry(meters.OBIS{1, 0, 2, 8, 0, 255}, 30, 0, u64(1000)),
+				entry(meters.OBIS{1, 0, 16, 7, 0, 255}, 27, 0, i32(-512)),
+				entry(meters.OBIS{1, 0, 36, 7, 0, 255}, 27, -2, i32(12345)),
+				entry(meters.OBIS{1, 0, 96, 5, 0, 255}, 0, 0, u8(4)),
+				// escape sequence within the message data
+				entry(meters.OBIS{1, 0, 56, 7, 0, 255}, 27, 0, []byte{0x55, 0x1b, 0x1b, 0x1b, 0x1b}),
+			),
+			absent,
+			absent,
+		)),
+		message(0x0201, seq(absent)),
+	}, nil)
+}
+
+func TestParseTelegram(t *testing.T) {
+	raw := append([]byte{0x00, 0x1b, 0x1b}, frame(telegramData())...) // garbage before start sequence
+
+	data, err := NewScanner(bytes.NewReader(raw)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lists, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lists) != 1 || len(lists[0].Entries) != 7 {
+		t.Fatalf("unexpected lists %+v", lists)
+	}
+
+	tel := telegram{list: lists[0]}
+	expected := map[meters.Measurement]float64{
+		meters.Import:  12345.6789,
+		meters.Export:  1,
+		meters.Power:   -512,
+		meters.PowerL1: 123.45,
+		meters.PowerL2: 0x1b1b1b1b,
+	}
+
+	results := tel.results()
+	if len(results) != len(expected) {
+		t.Errorf("unexpected results %v", results)
+	}
+
+	for _, r := range results {
+		if v, ok := expected[r.Measurement]; !ok || v != r.Value {
+			t.Errorf("unexpected result %v", r)
+		}
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	raw := frame(telegramData())
+	raw[len(raw)-1] ^= 0xff
+
+	if _, err := NewScanner(bytes.NewReader(raw)).Next(); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	// X.25 check value
+	if crc := crc16([]byte("123456789")); crc != 0x906e {
+		t.Errorf("unexpected crc %04x", crc)
+	}
+}
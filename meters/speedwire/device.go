@@ -0,0 +1,169 @@
+// Package speedwire implements SMA Energy Meters and Sunny Home Manager devices
+// pushing their readings as Speedwire multicast telegrams.
+package speedwire
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Type is the device type of SMA energy meters
+const Type = "SMAEM"
+
+// telegramTimeout is the maximum time to wait for a new telegram. Meters push every second.
+const telegramTimeout = 5 * time.Second
+
+// models by SUSy id
+var models = map[uint16]string{
+	270: "Energy Meter",
+	349: "Energy Meter 2.0",
+	372: "Sunny Home Manager 2.0",
+}
+
+// phases of derived power measurements
+var phases = []struct {
+	power, imp, exp meters.Measurement
+}{
+	{meters.Power, meters.ImportPower, meters.ExportPower},
+	{meters.PowerL1, meters.ImportPowerL1, meters.ExportPowerL1},
+	{meters.PowerL2, meters.ImportPowerL2, meters.ExportPowerL2},
+	{meters.PowerL3, meters.ImportPowerL3, meters.ExportPowerL3},
+}
+
+// Device is a SMA energy meter identified by its serial number
+type Device struct {
+	receiver *Receiver
+	serial   uint32 // zero until the first telegram if any meter is accepted
+
+	mu       sync.Mutex
+	returned uint64   // sequence number of the last queried telegram
+	pending  received // telegram received during initialization
+
+	descriptor meters.DeviceDescriptor
+}
+
+// NewDevice creates an energy meter device. If serial is zero the first meter received is used.
+func NewDevice(receiver *Receiver, serial int) *Device {
+	return &Device{
+		receiver: receiver,
+		serial:   uint32(serial),
+		descriptor: meters.DeviceDescriptor{
+			Type:         Type,
+			Manufacturer: "SMA",
+			SubDevice:    serial,
+		},
+	}
+}
+
+// next returns the meter's next telegram not yet returned
+func (d *Device) next() (received, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t := d.pending; t.Telegram != nil {
+		d.pending = received{}
+		return t, nil
+	}
+
+	t, err := d.receiver.next(d.serial, d.returned, telegramTimeout)
+	if err != nil {
+		return t, err
+	}
+
+	d.returned = t.seq
+	d.serial = t.Serial
+
+	return t, nil
+}
+
+// Initialize waits for the first telegram and prepares the device descriptor
+func (d *Device) Initialize(client modbus.Client) error {
+	t, err := d.next()
+	if err != nil {
+		return err
+	}
+
+	d.descriptor.Serial = strconv.FormatUint(uint64(t.Serial), 10)
+	d.descriptor.Version = t.Version
+	d.descriptor.Model = models[t.SusyID]
+
+	// keep the telegram for the first query
+	d.mu.Lock()
+	d.pending = t
+	d.mu.Unlock()
+
+	return nil
+}
+
+// Descriptor returns the device descriptor
+func (d *Device) Descriptor() meters.DeviceDescriptor {
+	return d.descriptor
+}
+
+// results converts the telegram's values to measurements
+func (t received) results() []meters.MeasurementResult {
+	res := make([]meters.MeasurementResult, 0, len(t.Values)+len(phases))
+	values := make(map[meters.Measurement]float64, len(t.Values))
+
+	for obis, v := range t.Values {
+		m, ok := obis.Measurement()
+		if !ok {
+			continue
+		}
+
+		values[m] = v
+		res = append(res, meters.MeasurementResult{
+			Measurement: m,
+			Value:       v,
+			Timestamp:   t.timestamp,
+		})
+	}
+
+	// meters report import and export power separately
+	for _, p := range phases {
+		imp, okImp := values[p.imp]
+		exp, okExp := values[p.exp]
+		if _, ok := values[p.power]; ok || !okImp || !okExp {
+			continue
+		}
+
+		res = append(res, meters.MeasurementResult{
+			Measurement: p.power,
+			Value:       imp - exp,
+			Timestamp:   t.timestamp,
+		})
+	}
+
+	return res
+}
+
+// Probe waits for a telegram and returns its power reading
+func (d *Device) Probe(client modbus.Client) (res meters.MeasurementResult, err error) {
+	t, err := d.next()
+	if err != nil {
+		return res, err
+	}
+
+	for _, r := range t.results() {
+		if r.Measurement == meters.Power {
+			return r, nil
+		}
+	}
+
+	return res, errors.New("speedwire: no power reading")
+}
+
+// Query waits for a new telegram and returns its readings
+func (d *Device) Query(client modbus.Client) ([]meters.MeasurementResult, error) {
+	t, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.results(), nil
+}
@@ -0,0 +1,113 @@
+package speedwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+const (
+	tagData        = 0x0010
+	protocolEmeter = 0x6069
+)
+
+var signature = []byte("SMA\x00")
+
+// errNoEmeter is returned for valid packets from other devices like inverters
+var errNoEmeter = errors.New("speedwire: no energy meter data")
+
+// Telegram is an energy meter telegram
+type Telegram struct {
+	SusyID  uint16
+	Serial  uint32
+	Ticker  uint32 // milliseconds
+	Version string
+	Values  map[meters.OBIS]float64 // scaled to measurement units
+}
+
+// channel value types
+const (
+	typeActual  = 4
+	typeCounter = 8
+)
+
+// scale converts raw actual values to measurement units by OBIS channel
+func scale(channel byte) float64 {
+	switch channel {
+	case 31, 51, 71, 32, 52, 72: // current (mA), voltage (mV)
+		return 1e-3
+	case 13, 33, 53, 73, 14: // cosphi, frequency (mHz)
+		return 1e-3
+	default: // power (0.1W)
+		return 0.1
+	}
+}
+
+// Parse decodes a Speedwire packet
+func Parse(b []byte) (*Telegram, error) {
+	if len(b) < 28 || !bytes.Equal(b[:4], signature) {
+		return nil, fmt.Errorf("speedwire: invalid packet")
+	}
+
+	// tag 0x02a0 group, followed by data tag with length
+	length := int(binary.BigEndian.Uint16(b[12:14]))
+	if binary.BigEndian.Uint16(b[14:16]) != tagData || 16+length > len(b) {
+		return nil, fmt.Errorf("speedwire: invalid data tag")
+	}
+
+	if binary.BigEndian.Uint16(b[16:18]) != protocolEmeter {
+		return nil, errNoEmeter
+	}
+
+	t := &Telegram{
+		SusyID: binary.BigEndian.Uint16(b[18:20]),
+		Serial: binary.BigEndian.Uint32(b[20:24]),
+		Ticker: binary.BigEndian.Uint32(b[24:28]),
+		Values: make(map[meters.OBIS]float64),
+	}
+
+	data := b[28 : 16+length]
+	for pos := 0; pos+4 <= len(data); {
+		// channel header B.C.D.E with D the value type
+		group, channel, typ, tariff := data[pos], data[pos+1], data[pos+2], data[pos+3]
+		pos += 4
+
+		switch {
+		case group == 144 && channel == 0:
+			// software version
+			if pos+4 > len(data) {
+				return t, nil
+			}
+			v := data[pos : pos+4]
+			t.Version = fmt.Sprintf("%d.%d.%d.%c", v[0], v[1], v[2], v[3])
+			pos += 4
+
+		case typ == typeActual:
+			if pos+4 > len(data) {
+				return t, nil
+			}
+			v := float64(binary.BigEndian.Uint32(data[pos:]))
+			t.Values[meters.OBIS{1, 0, channel, 7, tariff, 255}] = v * scale(channel)
+			pos += 4
+
+		case typ == typeCounter:
+			if pos+8 > len(data) {
+				return t, nil
+			}
+			v := float64(binary.BigEndian.Uint64(data[pos:]))
+			t.Values[meters.OBIS{1, 0, channel, 8, tariff, 255}] = v / 3.6e6 // Ws to kWh
+			pos += 8
+
+		case group == 0 && channel == 0 && typ == 0 && tariff == 0:
+			return t, nil // end of data
+
+		default:
+			return t, fmt.Errorf("speedwire: unknown channel %d.%d.%d", channel, typ, tariff)
+		}
+	}
+
+	return t, nil
+}
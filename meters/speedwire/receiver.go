@@ -0,0 +1,210 @@
+package speedwire
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// multicast group of SMA energy meters
+const multicastAddress = "239.12.255.254:9522"
+
+// reopenDelay is the delay before rejoining the multicast group after errors
+const reopenDelay = time.Second
+
+type received struct {
+	*Telegram
+	timestamp time.Time
+	seq       uint64
+}
+
+// Receiver listens for energy meter telegrams on a network interface. It implements
+// meters.Connection for the devices it receives telegrams for.
+type Receiver struct {
+	iface string
+
+	mu      sync.Mutex
+	running bool
+	seq     uint64
+	latest  map[uint32]received // by serial
+	updated chan struct{}       // closed on reception of a new telegram
+	err     error               // last reception error
+	logger  meters.Logger
+}
+
+var _ meters.Connection = (*Receiver)(nil)
+
+// NewReceiver creates a receiver for the given network interface name.
+// An empty name selects the system's default multicast interface.
+func NewReceiver(iface string) *Receiver {
+	return &Receiver{
+		iface:   iface,
+		latest:  make(map[uint32]received),
+		updated: make(chan struct{}),
+	}
+}
+
+// open joins the multicast group and starts receiving. Must be called with lock held.
+func (r *Receiver) open() error {
+	if r.running {
+		return nil
+	}
+
+	var ifi *net.Interface
+	if r.iface != "" {
+		var err error
+		if ifi, err = net.InterfaceByName(r.iface); err != nil {
+			return err
+		}
+	}
+
+	addr, err := net.ResolveUDPAddr("udp4", multicastAddress)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", ifi, addr)
+	if err != nil {
+		return err
+	}
+
+	r.running = true
+	go r.receive(conn)
+
+	return nil
+}
+
+// receive reads telegrams until a read error occurs. The multicast group is
+// rejoined on the next query.
+func (r *Receiver) receive(conn *net.UDPConn) {
+	defer conn.Close()
+	b := make([]byte, 2048)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(b)
+		if err != nil {
+			r.mu.Lock()
+			r.err = err
+			r.running = false
+			r.mu.Unlock()
+			return
+		}
+
+		r.handle(b[:n], addr)
+	}
+}
+
+// handle decodes a received packet and stores the telegram
+func (r *Receiver) handle(b []byte, addr net.Addr) {
+	t, err := Parse(b)
+	if errors.Is(err, errNoEmeter) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.logger != nil {
+		r.logger.Printf("speedwire: recv %v % x", addr, b)
+	}
+
+	if err != nil {
+		r.err = err
+	}
+
+	if t != nil && len(t.Values) > 0 {
+		r.seq++
+		r.latest[t.Serial] = received{Telegram: t, timestamp: time.Now(), seq: r.seq}
+		close(r.updated)
+		r.updated = make(chan struct{})
+	}
+}
+
+// next returns the latest telegram of the serial (or any serial if zero) newer than seq.
+// Telegrams older than timeout are considered stale.
+func (r *Receiver) next(serial uint32, seq uint64, timeout time.Duration) (received, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		r.mu.Lock()
+		if err := r.open(); err != nil {
+			r.mu.Unlock()
+			time.Sleep(reopenDelay)
+			return received{}, err
+		}
+
+		var res received
+		for s, t := range r.latest {
+			if (serial == 0 || s == serial) && t.seq > seq && t.seq > res.seq && time.Since(t.timestamp) < timeout {
+				res = t
+			}
+		}
+
+		updated, err := r.updated, r.err
+		r.mu.Unlock()
+
+		if res.Telegram != nil {
+			return res, nil
+		}
+
+		select {
+		case <-updated:
+		case <-timer.C:
+			if err == nil {
+				err = errors.New("timeout")
+			}
+			if serial != 0 {
+				return res, fmt.Errorf("no telegram received from %d on %s: %w", serial, r, err)
+			}
+			return res, fmt.Errorf("no telegram received on %s: %w", r, err)
+		}
+	}
+}
+
+// String returns the network interface
+func (r *Receiver) String() string {
+	if r.iface == "" {
+		return multicastAddress
+	}
+	return r.iface
+}
+
+// ModbusClient returns nil as energy meters don't speak modbus
+func (r *Receiver) ModbusClient() modbus.Client {
+	return nil
+}
+
+// Logger sets a logging instance for received telegrams
+func (r *Receiver) Logger(l meters.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = l
+}
+
+// Slave is a nop for receivers
+func (r *Receiver) Slave(_ uint8) {
+}
+
+// Timeout is a nop for receivers
+func (r *Receiver) Timeout(timeout time.Duration) time.Duration {
+	return timeout
+}
+
+// ConnectDelay is a nop for receivers
+func (r *Receiver) ConnectDelay(_ time.Duration) {
+}
+
+// Clone returns the receiver itself
+func (r *Receiver) Clone(_ byte) meters.Connection {
+	return r
+}
+
+// Close is a nop for receivers as other meters may still be received
+func (r *Receiver) Close() {
+}
@@ -0,0 +1,119 @@
+package speedwire
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// packet builds an energy meter telegram from channel data
+func packet(serial uint32, channels ...[]byte) []byte {
+	var data []byte
+	data = binary.BigEndian.AppendUint16(data, protocolEmeter)
+	data = binary.BigEndian.AppendUint16(data, 349) // susy id
+	data = binary.BigEndian.AppendUint32(data, serial)
+	data = binary.BigEndian.AppendUint32(data, 1000) // ticker
+	for _, c := range channels {
+		data = append(data, c...)
+	}
+
+	b := append([]byte("SMA\x00"), 0x00, 0x04, 0x02, 0xa0, 0x00, 0x00, 0x00, 0x01)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	b = binary.BigEndian.AppendUint16(b, tagData)
+	b = append(b, data...)
+
+	return append(b, 0, 0, 0, 0) // end of data
+}
+
+func actual(channel byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{0, channel, typeActual, 0}, v)
+}
+
+func counter(channel byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{0, channel, typeCounter, 0}, v)
+}
+
+var channels = [][]byte{
+	actual(1, 12345),             // import power 1234.5 W
+	actual(2, 0),                 // export power
+	counter(1, 36e6*1234),        // import 12340 kWh
+	actual(21, 5000),             // import power L1 500 W
+	actual(22, 1000),             // export power L1 100 W
+	actual(32, 230123),           // voltage L1 230.123 V
+	actual(31, 2170),             // current L1 2.17 A
+	actual(33, 998),              // cosphi L1 0.998
+	actual(14, 50010),            // frequency 50.01 Hz
+	{144, 0, 0, 0, 2, 0, 5, 'R'}, // software version
+}
+
+var results = map[meters.Measurement]float64{
+	meters.ImportPower:   1234.5,
+	meters.ExportPower:   0,
+	meters.Power:         1234.5,
+	meters.Import:        12340,
+	meters.ImportPowerL1: 500,
+	meters.ExportPowerL1: 100,
+	meters.PowerL1:       400,
+	meters.VoltageL1:     230.123,
+	meters.CurrentL1:     2.17,
+	meters.CosphiL1:      0.998,
+	meters.Frequency:     50.01,
+}
+
+func TestParse(t *testing.T) {
+	tel, err := Parse(packet(1900123456, channels...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tel.Serial != 1900123456 || tel.SusyID != 349 || tel.Version != "2.0.5.R" || len(tel.Values) != 9 {
+		t.Errorf("unexpected telegram %+v", tel)
+	}
+
+	if _, err := Parse([]byte("SMA\x00 invalid packet data")); err == nil {
+		t.Error("expected error for invalid packet")
+	}
+}
+
+func TestDevice(t *testing.T) {
+	r := NewReceiver("")
+	r.running = true // don't join multicast group
+
+	dev := NewDevice(r, 1900123456)
+
+	r.handle(packet(1900000001, actual(1, 1)), nil)
+	r.handle(packet(1900123456, channels...), nil)
+
+	if err := dev.Initialize(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if desc := dev.Descriptor(); desc.Serial != "1900123456" || desc.Model != "Energy Meter 2.0" || desc.Version != "2.0.5.R" {
+		t.Errorf("unexpected descriptor %+v", desc)
+	}
+
+	mr, err := dev.Query(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mr) != len(results) {
+		t.Errorf("unexpected results %v", mr)
+	}
+
+	for _, r := range mr {
+		if v, ok := results[r.Measurement]; !ok || math.Abs(v-r.Value) > 1e-9 {
+			t.Errorf("unexpected result %s: %f", r.Measurement, r.Value)
+		}
+	}
+
+	// other meter's telegrams don't update the device
+	r.handle(packet(1900000001, actual(1, 1)), nil)
+
+	go r.handle(packet(1900123456, channels...), nil)
+	if _, err := dev.Query(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,258 @@
+package meters
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/grid-x/serial"
+)
+
+const streamTimeout = time.Second
+
+// Stream is a raw byte stream connection for non-modbus devices like smart meters
+// with optical heads. It is either a serial device or a TCP connection (e.g. an IR
+// head attached to a ser2net server) if the address has a :port suffix.
+type Stream struct {
+	address  string
+	baudrate int
+	comset   string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   io.ReadWriteCloser
+	logger Logger
+}
+
+var _ Connection = (*Stream)(nil)
+
+// IsTCPAddress returns true if the address has a TCP :port suffix
+func IsTCPAddress(address string) bool {
+	tcp, _ := regexp.MatchString(":[0-9]+$", address)
+	return tcp
+}
+
+// NewStream creates a byte stream connection. Baudrate and comset are ignored for TCP addresses.
+func NewStream(address string, baudrate int, comset string) (*Stream, error) {
+	if !IsTCPAddress(address) {
+		if _, _, _, err := parseComset(comset); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &Stream{
+		address:  address,
+		baudrate: baudrate,
+		comset:   comset,
+		timeout:  streamTimeout,
+	}
+
+	return b, nil
+}
+
+// parseComset splits a communication set like 8N1 into data bits, parity and stop bits
+func parseComset(comset string) (dataBits int, parity string, stopBits int, err error) {
+	switch strings.ToUpper(comset) {
+	case "8N1":
+		return 8, "N", 1, nil
+	case "8N2":
+		return 8, "N", 2, nil
+	case "8E1":
+		return 8, "E", 1, nil
+	case "7E1":
+		return 7, "E", 1, nil
+	default:
+		return 0, "", 0, fmt.Errorf("invalid communication set: %s", comset)
+	}
+}
+
+// String returns the serial device or TCP address
+func (b *Stream) String() string {
+	return b.address
+}
+
+// ModbusClient returns nil as streams don't speak modbus
+func (b *Stream) ModbusClient() modbus.Client {
+	return nil
+}
+
+// Logger sets a logging instance for physical bus operations
+func (b *Stream) Logger(l Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logger = l
+}
+
+// Printf logs to the bus logger if set
+func (b *Stream) Printf(format string, v ...interface{}) {
+	b.mu.Lock()
+	logger := b.logger
+	b.mu.Unlock()
+
+	if logger != nil {
+		logger.Printf(format, v...)
+	}
+}
+
+// Baudrate returns the current serial baudrate
+func (b *Stream) Baudrate() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.baudrate
+}
+
+// Slave is a nop for streams
+func (b *Stream) Slave(_ uint8) {
+}
+
+// Timeout sets the read timeout
+func (b *Stream) Timeout(timeout time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.timeout
+	b.timeout = timeout
+	return t
+}
+
+// ConnectDelay is a nop for streams
+func (b *Stream) ConnectDelay(_ time.Duration) {
+}
+
+// Clone returns the stream itself as the transport can't be shared
+func (b *Stream) Clone(_ byte) Connection {
+	return b
+}
+
+// Close closes the stream. It is reopened on the next read or write.
+func (b *Stream) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.close()
+}
+
+func (b *Stream) close() {
+	if b.conn != nil {
+		_ = b.conn.Close()
+		b.conn = nil
+	}
+}
+
+// SetBaudrate changes the serial baudrate, reopening the port if necessary.
+// It is a nop for TCP connections.
+func (b *Stream) SetBaudrate(baudrate int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if baudrate != b.baudrate && !IsTCPAddress(b.address) {
+		b.baudrate = baudrate
+		b.close()
+	}
+}
+
+// open returns the current connection, opening it if necessary. Must be called with lock held.
+func (b *Stream) open() (io.ReadWriteCloser, error) {
+	if b.conn != nil {
+		return b.conn, nil
+	}
+
+	if IsTCPAddress(b.address) {
+		conn, err := net.DialTimeout("tcp", b.address, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		b.conn = conn
+	} else {
+		dataBits, parity, stopBits, err := parseComset(b.comset)
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := serial.Open(&serial.Config{
+			Address:  b.address,
+			BaudRate: b.baudrate,
+			DataBits: dataBits,
+			StopBits: stopBits,
+			Parity:   parity,
+			Timeout:  b.timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.conn = port
+	}
+
+	if b.logger != nil {
+		b.logger.Printf("stream: opened %s", b.address)
+	}
+
+	return b.conn, nil
+}
+
+// IsTimeout returns true if the error is a read timeout. The stream remains open after timeouts.
+func IsTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, serial.ErrTimeout) || errors.As(err, &ne) && ne.Timeout()
+}
+
+// Read reads from the stream, opening it if necessary. On errors other than timeouts the stream is closed.
+func (b *Stream) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	conn, err := b.open()
+	timeout := b.timeout
+	logger := b.logger
+	b.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if nc, ok := conn.(net.Conn); ok {
+		_ = nc.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	n, err := conn.Read(p)
+	if n > 0 && logger != nil {
+		logger.Printf("stream: recv % x", p[:n])
+	}
+
+	if err != nil && !IsTimeout(err) {
+		b.mu.Lock()
+		if b.conn == conn {
+			b.close()
+		}
+		b.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// Write writes to the stream, opening it if necessary. On errors the stream is closed.
+func (b *Stream) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	conn, err := b.open()
+	if err != nil {
+		return 0, err
+	}
+
+	if b.logger != nil {
+		b.logger.Printf("stream: send % x", p)
+	}
+
+	if nc, ok := conn.(net.Conn); ok {
+		_ = nc.SetWriteDeadline(time.Now().Add(b.timeout))
+	}
+
+	n, err := conn.Write(p)
+	if err != nil {
+		b.close()
+	}
+
+	return n, err
+}
@@ -98,32 +98,8 @@ var modelMap = map[sunspec.ModelId]map[int]map[string]meters.Measurement{
 			model113.TmpCab: meters.HeatSinkTemp,
 		},
 	},
-	model160.ModelID: {
-		1: {
-			model160.DCA:  meters.DCCurrentS1,
-			model160.DCV:  meters.DCVoltageS1,
-			model160.DCW:  meters.DCPowerS1,
-			model160.DCWH: meters.DCEnergyS1,
-		},
-		2: {
-			model160.DCA:  meters.DCCurrentS2,
-			model160.DCV:  meters.DCVoltageS2,
-			model160.DCW:  meters.DCPowerS2,
-			model160.DCWH: meters.DCEnergyS2,
-		},
-		3: {
-			model160.DCA:  meters.DCCurrentS3,
-			model160.DCV:  meters.DCVoltageS3,
-			model160.DCW:  meters.DCPowerS3,
-			model160.DCWH: meters.DCEnergyS3,
-		},
-		4: {
-			model160.DCA:  meters.DCCurrentS4,
-			model160.DCV:  meters.DCVoltageS4,
-			model160.DCW:  meters.DCPowerS4,
-			model160.DCWH: meters.DCEnergyS4,
-		},
-	},
+	// multiple MPPT inverter extension
+	model160.ModelID: mpptModules(maxModules),
 	// single phase (AN or AB) meter
 	model201.ModelID: {
 		0: {
@@ -237,16 +213,26 @@ var modelMap = map[sunspec.ModelId]map[int]map[string]meters.Measurement{
 	},
 }
 
+// maxModules is the maximum number of MPPT modules (strings) that are mapped
+const maxModules = 16
+
+// mpptModules creates the block mapping of the repeating MPPT module blocks
+func mpptModules(count int) map[int]map[string]meters.Measurement {
+	res := make(map[int]map[string]meters.Measurement, count)
+	for i := 1; i <= count; i++ {
+		res[i] = map[string]meters.Measurement{
+			model160.DCA:  meters.Indexed(meters.DCCurrent, meters.StringIndex, i),
+			model160.DCV:  meters.Indexed(meters.DCVoltage, meters.StringIndex, i),
+			model160.DCW:  meters.Indexed(meters.DCPower, meters.StringIndex, i),
+			model160.DCWH: meters.Indexed(meters.DCEnergy, meters.StringIndex, i),
+		}
+	}
+	return res
+}
+
+// dividerMap defines scale factors per base measurement, applying to all phases and strings
 var dividerMap = map[meters.Measurement]float64{
-	meters.Export:     1000,
-	meters.ExportL1:   1000,
-	meters.ExportL2:   1000,
-	meters.ExportL3:   1000,
-	meters.Import:     1000,
-	meters.ImportL1:   1000,
-	meters.ImportL2:   1000,
-	meters.ImportL3:   1000,
-	meters.DCEnergyS1: 1000,
-	meters.DCEnergyS2: 1000,
-	meters.DCEnergyS3: 1000,
+	meters.Export:   1000,
+	meters.Import:   1000,
+	meters.DCEnergy: 1000,
 }
@@ -274,7 +274,8 @@ func (d *SunSpec) QueryPoint(client modbus.Client, modelID, blockID int, pointID
 
 func makeResult(v float64, m meters.Measurement) meters.MeasurementResult {
 	// apply scale factor for energy
-	if div, ok := dividerMap[m]; ok {
+	base, _, _ := m.Index()
+	if div, ok := dividerMap[base]; ok {
 		v /= div
 	}
 
@@ -0,0 +1,23 @@
+package sunspec
+
+import (
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestMakeResultScaling(t *testing.T) {
+	for m, expected := range map[meters.Measurement]float64{
+		meters.Import:     1,
+		meters.ExportL2:   1,
+		meters.DCEnergyS1: 1,
+		meters.DCEnergyS4: 1, // published in Wh before all strings were scaled
+		meters.Indexed(meters.DCEnergy, meters.StringIndex, 7): 1,
+		meters.DCPowerS4: 1000,
+		meters.Power:     1000,
+	} {
+		if r := makeResult(1000, m); r.Value != expected || r.Measurement != m {
+			t.Errorf("%s: expected %v, got %v", m, expected, r.Value)
+		}
+	}
+}
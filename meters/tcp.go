@@ -10,6 +10,7 @@ import (
 type TCP struct {
 	Client  modbus.Client
 	Handler *modbus.TCPClientHandler
+	link    *link
 }
 
 // NewTCPClientHandler creates a TCP modbus handler
@@ -25,19 +26,26 @@ func NewTCPClientHandler(device string) *modbus.TCPClientHandler {
 
 var _ Connection = (*TCP)(nil)
 
-// NewTCP creates a TCP modbus client
+// NewTCP creates a TCP modbus client. Dead gateways are detected by the absence of any response
+// within the keepalive period while all devices fail and reconnected.
 func NewTCP(address string) *TCP {
 	handler := NewTCPClientHandler(address)
-	client := modbus.NewClient(handler)
+	link := newLink(handler.Connect, handler.Close, tcpKeepAlive)
 
 	b := &TCP{
-		Client:  client,
+		Client:  &linkClient{Client: modbus.NewClient(handler), link: link, slave: func() byte { return handler.SlaveID }},
 		Handler: handler,
+		link:    link,
 	}
 
 	return b
 }
 
+// LinkState implements the Linked interface
+func (b *TCP) LinkState() LinkState {
+	return b.link.state()
+}
+
 // String returns the bus connection address (TCP)
 func (b *TCP) String() string {
 	return b.Handler.Address
@@ -82,7 +90,26 @@ func (b *TCP) Clone(deviceID byte) Connection {
 	handler.SetSlave(deviceID)
 
 	return &TCP{
-		Client:  modbus.NewClient(handler),
+		Client:  &linkClient{Client: modbus.NewClient(handler), link: b.link, slave: func() byte { return handler.SlaveID }},
+		Handler: handler,
+		link:    b.link,
+	}
+}
+
+// Dial creates a connection to the same address using its own socket, allowing requests
+// to be sent in parallel. Timeouts, connect delay and logger are copied.
+func (b *TCP) Dial() *TCP {
+	handler := NewTCPClientHandler(b.Handler.Address)
+	handler.Timeout = b.Handler.Timeout
+	handler.IdleTimeout = b.Handler.IdleTimeout
+	handler.ConnectDelay = b.Handler.ConnectDelay
+	handler.Logger = b.Handler.Logger
+
+	link := newLink(handler.Connect, handler.Close, b.link.keepAlive)
+
+	return &TCP{
+		Client:  &linkClient{Client: modbus.NewClient(handler), link: link, slave: func() byte { return handler.SlaveID }},
 		Handler: handler,
+		link:    link,
 	}
 }
@@ -0,0 +1,132 @@
+package meters
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// USBPrefix identifies serial adapters selected by their USB attributes instead of the device path,
+// e.g. usb:vid=0403,pid=6001,serial=A10KZ1XY
+const USBPrefix = "usb:"
+
+// roots of the sysfs and device file systems
+var (
+	sysfsRoot = "/sys"
+	devRoot   = "/dev"
+)
+
+// usbAttributes are the attributes identifying an USB serial adapter
+type usbAttributes struct {
+	Vendor, Product, Serial string
+}
+
+// parseUSB parses an usb:key=value,... adapter specification
+func parseUSB(spec string) (usbAttributes, error) {
+	var res usbAttributes
+
+	for _, kv := range strings.Split(strings.TrimPrefix(spec, USBPrefix), ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || val == "" {
+			return res, fmt.Errorf("invalid usb attribute: %s", kv)
+		}
+
+		switch strings.ToLower(key) {
+		case "vid", "vendor":
+			res.Vendor = strings.ToLower(val)
+		case "pid", "product":
+			res.Product = strings.ToLower(val)
+		case "serial":
+			res.Serial = val
+		default:
+			return res, fmt.Errorf("invalid usb attribute: %s", kv)
+		}
+	}
+
+	if res == (usbAttributes{}) {
+		return res, fmt.Errorf("missing usb attributes: %s", spec)
+	}
+
+	return res, nil
+}
+
+// matches compares the attributes of the given sysfs usb device directory
+func (a usbAttributes) matches(dir string) bool {
+	for file, expected := range map[string]string{
+		"idVendor":  a.Vendor,
+		"idProduct": a.Product,
+		"serial":    a.Serial,
+	} {
+		if expected == "" {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil || !strings.EqualFold(strings.TrimSpace(string(b)), expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// usbDevice returns the sysfs usb device directory a tty belongs to
+func usbDevice(tty string) (string, bool) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysfsRoot, "class/tty", tty, "device"))
+	if err != nil {
+		return "", false
+	}
+
+	// walk up from the interface to the device
+	for range 4 {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir, true
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return "", false
+}
+
+// ValidateUSB checks the syntax of an usb: adapter specification
+func ValidateUSB(spec string) error {
+	_, err := parseUSB(spec)
+	return err
+}
+
+// ResolveUSB returns the device path of the serial adapter identified by the usb: specification.
+// Adapters are looked up by sysfs attributes, /dev/serial/by-id is used for serial numbers if sysfs is unavailable.
+func ResolveUSB(spec string) (string, error) {
+	attrs, err := parseUSB(spec)
+	if err != nil {
+		return "", err
+	}
+
+	var res []string
+
+	ttys, _ := filepath.Glob(filepath.Join(sysfsRoot, "class/tty", "tty*"))
+	for _, tty := range ttys {
+		if dir, ok := usbDevice(filepath.Base(tty)); ok && attrs.matches(dir) {
+			res = append(res, filepath.Join(devRoot, filepath.Base(tty)))
+		}
+	}
+
+	if len(res) == 0 && attrs.Serial != "" && attrs.Vendor == "" && attrs.Product == "" {
+		links, _ := filepath.Glob(filepath.Join(devRoot, "serial/by-id", "*"))
+		for _, link := range links {
+			if strings.Contains(filepath.Base(link), "_"+attrs.Serial+"-") {
+				res = append(res, link)
+			}
+		}
+	}
+
+	switch len(res) {
+	case 0:
+		return "", fmt.Errorf("%s: %w", spec, os.ErrNotExist)
+	case 1:
+		return res[0], nil
+	default:
+		return "", fmt.Errorf("%s: ambiguous adapters %s", spec, strings.Join(res, ", "))
+	}
+}
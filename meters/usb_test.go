@@ -0,0 +1,67 @@
+package meters
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveUSB(t *testing.T) {
+	root := t.TempDir()
+	sysfsRoot, devRoot = filepath.Join(root, "sys"), filepath.Join(root, "dev")
+	defer func() { sysfsRoot, devRoot = "/sys", "/dev" }()
+
+	// usb device with ttyUSB0 below its interface
+	for tty, attrs := range map[string][3]string{
+		"ttyUSB0": {"0403", "6001", "A10KZ1XY"},
+		"ttyUSB1": {"0403", "6001", "B20"},
+	} {
+		dev := filepath.Join(sysfsRoot, "devices/usb1", attrs[2])
+		for file, val := range map[string]string{"idVendor": attrs[0], "idProduct": attrs[1], "serial": attrs[2]} {
+			if err := os.MkdirAll(filepath.Join(dev, "1-1:1.0", tty), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dev, file), []byte(val+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		class := filepath.Join(sysfsRoot, "class/tty", tty)
+		if err := os.MkdirAll(class, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(dev, "1-1:1.0", tty), filepath.Join(class, "device")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		spec, device string
+		ok           bool
+	}{
+		{"usb:serial=A10KZ1XY", "ttyUSB0", true},
+		{"usb:vid=0403,pid=6001,serial=B20", "ttyUSB1", true},
+		{"usb:vid=0403", "", false}, // ambiguous
+		{"usb:serial=C30", "", false},
+		{"usb:foo=bar", "", false},
+	} {
+		device, err := ResolveUSB(tc.spec)
+		if (err == nil) != tc.ok || tc.ok && device != filepath.Join(devRoot, tc.device) {
+			t.Errorf("%s: unexpected result %s %v", tc.spec, device, err)
+		}
+	}
+}
+
+func TestValidateUSB(t *testing.T) {
+	for spec, ok := range map[string]bool{
+		"usb:serial=C30":        true, // missing adapters are waited for
+		"usb:vid=0403,pid=6001": true,
+		"usb:":                  false,
+		"usb:foo=bar":           false,
+		"usb:serial":            false,
+	} {
+		if err := ValidateUSB(spec); (err == nil) != ok {
+			t.Errorf("%s: unexpected result %v", spec, err)
+		}
+	}
+}
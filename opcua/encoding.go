@@ -0,0 +1,549 @@
+// Package opcua implements a minimal OPC UA server using the UA-TCP binary
+// protocol without message security. It provides an in-memory address space
+// with browse, read and subscription services.
+package opcua
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+var errShort = errors.New("opcua: short buffer")
+
+// Variant type ids
+const (
+	TypeBoolean       byte = 1
+	TypeByte          byte = 3
+	TypeInt32         byte = 6
+	TypeUInt32        byte = 7
+	TypeDouble        byte = 11
+	TypeString        byte = 12
+	TypeDateTime      byte = 13
+	TypeNodeID        byte = 17
+	TypeStatusCode    byte = 19
+	TypeQualifiedName byte = 20
+	TypeLocalizedText byte = 21
+	TypeExtension     byte = 22
+)
+
+// NodeID identifies a node. Either the numeric or the string identifier is used.
+type NodeID struct {
+	Namespace uint16
+	ID        uint32
+	Name      string
+}
+
+// NewNumericNodeID creates a numeric node id
+func NewNumericNodeID(ns uint16, id uint32) NodeID {
+	return NodeID{Namespace: ns, ID: id}
+}
+
+// NewStringNodeID creates a string node id
+func NewStringNodeID(ns uint16, name string) NodeID {
+	return NodeID{Namespace: ns, Name: name}
+}
+
+// QualifiedName is a namespace qualified name
+type QualifiedName struct {
+	Namespace uint16
+	Name      string
+}
+
+// LocalizedText is a text without locale
+type LocalizedText string
+
+// ExtensionObject is a binary encoded structure
+type ExtensionObject struct {
+	TypeID NodeID // binary encoding id
+	Body   []byte
+}
+
+// DataValue is a value with status and timestamps
+type DataValue struct {
+	Value           any
+	Status          StatusCode
+	SourceTimestamp time.Time
+	ServerTimestamp time.Time
+}
+
+// Buffer encodes binary values
+type Buffer struct {
+	b []byte
+}
+
+// Bytes returns the encoded bytes
+func (w *Buffer) Bytes() []byte {
+	return w.b
+}
+
+func (w *Buffer) Byte(v byte) {
+	w.b = append(w.b, v)
+}
+
+func (w *Buffer) Bool(v bool) {
+	if v {
+		w.Byte(1)
+	} else {
+		w.Byte(0)
+	}
+}
+
+func (w *Buffer) Uint16(v uint16) {
+	w.b = binary.LittleEndian.AppendUint16(w.b, v)
+}
+
+func (w *Buffer) Uint32(v uint32) {
+	w.b = binary.LittleEndian.AppendUint32(w.b, v)
+}
+
+func (w *Buffer) Int32(v int32) {
+	w.Uint32(uint32(v))
+}
+
+func (w *Buffer) Int64(v int64) {
+	w.b = binary.LittleEndian.AppendUint64(w.b, uint64(v))
+}
+
+func (w *Buffer) Double(v float64) {
+	w.b = binary.LittleEndian.AppendUint64(w.b, math.Float64bits(v))
+}
+
+// ByteString encodes nil as null
+func (w *Buffer) ByteString(v []byte) {
+	if v == nil {
+		w.Int32(-1)
+		return
+	}
+	w.Int32(int32(len(v)))
+	w.b = append(w.b, v...)
+}
+
+// String encodes the empty string as null
+func (w *Buffer) String(v string) {
+	if v == "" {
+		w.Int32(-1)
+		return
+	}
+	w.ByteString([]byte(v))
+}
+
+// epoch is the OPC UA DateTime epoch 1601-01-01 in unix seconds
+const epoch = -11644473600
+
+// DateTime encodes time as 100ns intervals since epoch
+func (w *Buffer) DateTime(v time.Time) {
+	if v.IsZero() {
+		w.Int64(0)
+		return
+	}
+	w.Int64((v.Unix()-epoch)*1e7 + int64(v.Nanosecond()/100))
+}
+
+func (w *Buffer) NodeID(v NodeID) {
+	switch {
+	case v.Name != "":
+		w.Byte(0x03)
+		w.Uint16(v.Namespace)
+		w.String(v.Name)
+	case v.Namespace == 0 && v.ID < 256:
+		w.Byte(0x00)
+		w.Byte(byte(v.ID))
+	case v.Namespace < 256 && v.ID < 65536:
+		w.Byte(0x01)
+		w.Byte(byte(v.Namespace))
+		w.Uint16(uint16(v.ID))
+	default:
+		w.Byte(0x02)
+		w.Uint16(v.Namespace)
+		w.Uint32(v.ID)
+	}
+}
+
+// ExpandedNodeID encodes a local node id as expanded node id
+func (w *Buffer) ExpandedNodeID(v NodeID) {
+	w.NodeID(v)
+}
+
+func (w *Buffer) QualifiedName(v QualifiedName) {
+	w.Uint16(v.Namespace)
+	w.String(v.Name)
+}
+
+func (w *Buffer) LocalizedText(v LocalizedText) {
+	if v == "" {
+		w.Byte(0)
+		return
+	}
+	w.Byte(0x02)
+	w.String(string(v))
+}
+
+func (w *Buffer) ExtensionObject(v ExtensionObject) {
+	w.NodeID(v.TypeID)
+	if v.Body == nil {
+		w.Byte(0)
+		return
+	}
+	w.Byte(1)
+	w.ByteString(v.Body)
+}
+
+// Variant encodes scalar values and string arrays
+func (w *Buffer) Variant(v any) {
+	switch v := v.(type) {
+	case nil:
+		w.Byte(0)
+	case bool:
+		w.Byte(TypeBoolean)
+		w.Bool(v)
+	case uint8:
+		w.Byte(TypeByte)
+		w.Byte(v)
+	case int32:
+		w.Byte(TypeInt32)
+		w.Int32(v)
+	case uint32:
+		w.Byte(TypeUInt32)
+		w.Uint32(v)
+	case float64:
+		w.Byte(TypeDouble)
+		w.Double(v)
+	case string:
+		w.Byte(TypeString)
+		w.String(v)
+	case []string:
+		w.Byte(TypeString | 0x80)
+		w.Int32(int32(len(v)))
+		for _, s := range v {
+			w.String(s)
+		}
+	case time.Time:
+		w.Byte(TypeDateTime)
+		w.DateTime(v)
+	case NodeID:
+		w.Byte(TypeNodeID)
+		w.NodeID(v)
+	case StatusCode:
+		w.Byte(TypeStatusCode)
+		w.Uint32(uint32(v))
+	case QualifiedName:
+		w.Byte(TypeQualifiedName)
+		w.QualifiedName(v)
+	case LocalizedText:
+		w.Byte(TypeLocalizedText)
+		w.LocalizedText(v)
+	case ExtensionObject:
+		w.Byte(TypeExtension)
+		w.ExtensionObject(v)
+	default:
+		panic("opcua: unsupported variant type")
+	}
+}
+
+func (w *Buffer) DataValue(v DataValue) {
+	var mask byte
+	if v.Value != nil {
+		mask |= 0x01
+	}
+	if v.Status != StatusGood {
+		mask |= 0x02
+	}
+	if !v.SourceTimestamp.IsZero() {
+		mask |= 0x04
+	}
+	if !v.ServerTimestamp.IsZero() {
+		mask |= 0x08
+	}
+
+	w.Byte(mask)
+	if mask&0x01 != 0 {
+		w.Variant(v.Value)
+	}
+	if mask&0x02 != 0 {
+		w.Uint32(uint32(v.Status))
+	}
+	if mask&0x04 != 0 {
+		w.DateTime(v.SourceTimestamp)
+	}
+	if mask&0x08 != 0 {
+		w.DateTime(v.ServerTimestamp)
+	}
+}
+
+// Array encodes the array length followed by its elements
+func Array[T any](w *Buffer, v []T, enc func(T)) {
+	if v == nil {
+		w.Int32(-1)
+		return
+	}
+	w.Int32(int32(len(v)))
+	for _, e := range v {
+		enc(e)
+	}
+}
+
+// Reader decodes binary values. Decoding errors are sticky and reported by Err.
+type Reader struct {
+	b   []byte
+	err error
+}
+
+// NewReader creates a reader for the buffer
+func NewReader(b []byte) *Reader {
+	return &Reader{b: b}
+}
+
+// Err returns the first decoding error
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Len returns the number of remaining bytes
+func (r *Reader) Len() int {
+	return len(r.b)
+}
+
+// next returns the next n bytes. After errors, zero bytes are returned for fixed size values.
+func (r *Reader) next(n int) []byte {
+	if r.err == nil && (n < 0 || len(r.b) < n) {
+		r.err = errShort
+		r.b = nil
+	}
+	if r.err != nil {
+		return make([]byte, min(max(n, 0), 16))
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *Reader) Byte() byte {
+	return r.next(1)[0]
+}
+
+func (r *Reader) Bool() bool {
+	return r.Byte() != 0
+}
+
+func (r *Reader) Uint16() uint16 {
+	return binary.LittleEndian.Uint16(r.next(2))
+}
+
+func (r *Reader) Uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.next(4))
+}
+
+func (r *Reader) Int32() int32 {
+	return int32(r.Uint32())
+}
+
+func (r *Reader) Int64() int64 {
+	return int64(binary.LittleEndian.Uint64(r.next(8)))
+}
+
+func (r *Reader) Double() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(r.next(8)))
+}
+
+func (r *Reader) ByteString() []byte {
+	n := r.Int32()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// Str decodes a string. It is not named String to avoid confusion with fmt.Stringer.
+func (r *Reader) Str() string {
+	return string(r.ByteString())
+}
+
+func (r *Reader) DateTime() time.Time {
+	v := r.Int64()
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(v/1e7+epoch, (v%1e7)*100).UTC()
+}
+
+func (r *Reader) NodeID() NodeID {
+	switch enc := r.Byte() & 0x3f; enc {
+	case 0x00:
+		return NodeID{ID: uint32(r.Byte())}
+	case 0x01:
+		ns := uint16(r.Byte())
+		return NodeID{Namespace: ns, ID: uint32(r.Uint16())}
+	case 0x02:
+		ns := r.Uint16()
+		return NodeID{Namespace: ns, ID: r.Uint32()}
+	case 0x03:
+		ns := r.Uint16()
+		return NodeID{Namespace: ns, Name: r.Str()}
+	case 0x04:
+		ns := r.Uint16()
+		return NodeID{Namespace: ns, Name: string(r.next(16))}
+	case 0x05:
+		ns := r.Uint16()
+		return NodeID{Namespace: ns, Name: string(r.ByteString())}
+	default:
+		if r.err == nil {
+			r.err = errors.New("opcua: invalid node id encoding")
+		}
+		return NodeID{}
+	}
+}
+
+func (r *Reader) ExpandedNodeID() NodeID {
+	flags := r.b
+	id := r.NodeID()
+	if len(flags) > 0 {
+		if flags[0]&0x80 != 0 {
+			r.Str() // namespace uri
+		}
+		if flags[0]&0x40 != 0 {
+			r.Uint32() // server index
+		}
+	}
+	return id
+}
+
+func (r *Reader) QualifiedName() QualifiedName {
+	ns := r.Uint16()
+	return QualifiedName{Namespace: ns, Name: r.Str()}
+}
+
+func (r *Reader) LocalizedText() LocalizedText {
+	mask := r.Byte()
+	if mask&0x01 != 0 {
+		r.Str() // locale
+	}
+	if mask&0x02 != 0 {
+		return LocalizedText(r.Str())
+	}
+	return ""
+}
+
+func (r *Reader) ExtensionObject() ExtensionObject {
+	v := ExtensionObject{TypeID: r.NodeID()}
+	switch r.Byte() {
+	case 0:
+	case 1, 2:
+		v.Body = r.ByteString()
+	default:
+		if r.err == nil {
+			r.err = errors.New("opcua: invalid extension object encoding")
+		}
+	}
+	return v
+}
+
+// Variant decodes scalar variants of the supported types
+func (r *Reader) Variant() any {
+	mask := r.Byte()
+	if mask&0x80 != 0 {
+		if mask&0x3f == TypeString {
+			n := r.Int32()
+			res := make([]string, 0, max(n, 0))
+			for i := int32(0); i < n && r.err == nil; i++ {
+				res = append(res, r.Str())
+			}
+			return res
+		}
+		if r.err == nil {
+			r.err = errors.New("opcua: unsupported array variant")
+		}
+		return nil
+	}
+
+	switch mask & 0x3f {
+	case 0:
+		return nil
+	case TypeBoolean:
+		return r.Bool()
+	case TypeByte:
+		return r.Byte()
+	case TypeInt32:
+		return r.Int32()
+	case TypeUInt32:
+		return r.Uint32()
+	case TypeDouble:
+		return r.Double()
+	case TypeString:
+		return r.Str()
+	case TypeDateTime:
+		return r.DateTime()
+	case TypeNodeID:
+		return r.NodeID()
+	case TypeStatusCode:
+		return StatusCode(r.Uint32())
+	case TypeQualifiedName:
+		return r.QualifiedName()
+	case TypeLocalizedText:
+		return r.LocalizedText()
+	case TypeExtension:
+		return r.ExtensionObject()
+	default:
+		if r.err == nil {
+			r.err = errors.New("opcua: unsupported variant type")
+		}
+		return nil
+	}
+}
+
+func (r *Reader) DataValue() DataValue {
+	var v DataValue
+	mask := r.Byte()
+	if mask&0x01 != 0 {
+		v.Value = r.Variant()
+	}
+	if mask&0x02 != 0 {
+		v.Status = StatusCode(r.Uint32())
+	}
+	if mask&0x04 != 0 {
+		v.SourceTimestamp = r.DateTime()
+	}
+	if mask&0x10 != 0 {
+		r.Uint16()
+	}
+	if mask&0x08 != 0 {
+		v.ServerTimestamp = r.DateTime()
+	}
+	if mask&0x20 != 0 {
+		r.Uint16()
+	}
+	return v
+}
+
+// DiagnosticInfo skips a diagnostic info
+func (r *Reader) DiagnosticInfo() {
+	mask := r.Byte()
+	for _, bit := range []byte{0x01, 0x02, 0x04, 0x08} {
+		if mask&bit != 0 {
+			r.Int32()
+		}
+	}
+	if mask&0x10 != 0 {
+		r.Str()
+	}
+	if mask&0x20 != 0 {
+		r.Uint32()
+	}
+	if mask&0x40 != 0 {
+		r.DiagnosticInfo()
+	}
+}
+
+// ReadArray decodes an array using the element decoder
+func ReadArray[T any](r *Reader, dec func() T) []T {
+	n := r.Int32()
+	if n < 0 {
+		return nil
+	}
+	res := make([]T, 0, min(int(n), 1024))
+	for i := int32(0); i < n && r.err == nil; i++ {
+		res = append(res, dec())
+	}
+	return res
+}
@@ -0,0 +1,180 @@
+package opcua
+
+import "fmt"
+
+// StatusCode is an OPC UA status code
+type StatusCode uint32
+
+// Status codes used by the server
+const (
+	StatusGood                         StatusCode = 0
+	StatusUncertain                    StatusCode = 0x40000000
+	StatusUncertainLastUsableValue     StatusCode = 0x40900000
+	StatusBadUnexpectedError           StatusCode = 0x80010000
+	StatusBadDecodingError             StatusCode = 0x80070000
+	StatusBadServiceUnsupported        StatusCode = 0x800B0000
+	StatusBadNothingToDo               StatusCode = 0x800F0000
+	StatusBadUserAccessDenied          StatusCode = 0x801F0000
+	StatusBadIdentityTokenInvalid      StatusCode = 0x80200000
+	StatusBadIdentityTokenRejected     StatusCode = 0x80210000
+	StatusBadSecureChannelIDInvalid    StatusCode = 0x80220000
+	StatusBadSessionIDInvalid          StatusCode = 0x80250000
+	StatusBadSessionNotActivated       StatusCode = 0x80270000
+	StatusBadSubscriptionIDInvalid     StatusCode = 0x80280000
+	StatusBadTimestampsToReturnInvalid StatusCode = 0x802B0000
+	StatusBadWaitingForInitialData     StatusCode = 0x80320000
+	StatusBadNodeIDUnknown             StatusCode = 0x80340000
+	StatusBadAttributeIDInvalid        StatusCode = 0x80350000
+	StatusBadOutOfRange                StatusCode = 0x803C0000
+	StatusBadMonitoredItemIDInvalid    StatusCode = 0x80420000
+	StatusBadContinuationPointInvalid  StatusCode = 0x804A0000
+	StatusBadNoMatch                   StatusCode = 0x806F0000
+	StatusBadSecurityPolicyRejected    StatusCode = 0x80550000
+	StatusBadSecurityModeRejected      StatusCode = 0x80540000
+	StatusBadTooManyPublishRequests    StatusCode = 0x80780000
+	StatusBadNoSubscription            StatusCode = 0x80790000
+	StatusBadTCPMessageTypeInvalid     StatusCode = 0x807E0000
+	StatusBadTCPMessageTooLarge        StatusCode = 0x80800000
+)
+
+func (s StatusCode) Error() string {
+	return fmt.Sprintf("opcua: status 0x%08X", uint32(s))
+}
+
+// NodeClass is the class of a node
+type NodeClass uint32
+
+// Node classes
+const (
+	NodeClassObject        NodeClass = 1
+	NodeClassVariable      NodeClass = 2
+	NodeClassObjectType    NodeClass = 8
+	NodeClassVariableType  NodeClass = 16
+	NodeClassReferenceType NodeClass = 32
+	NodeClassDataType      NodeClass = 64
+)
+
+// Standard namespace 0 node ids
+var (
+	// folders and server object
+	RootFolder           = NewNumericNodeID(0, 84)
+	ObjectsFolder        = NewNumericNodeID(0, 85)
+	TypesFolder          = NewNumericNodeID(0, 86)
+	ViewsFolder          = NewNumericNodeID(0, 87)
+	ServerObject         = NewNumericNodeID(0, 2253)
+	ServerServerArray    = NewNumericNodeID(0, 2254)
+	ServerNamespaceArray = NewNumericNodeID(0, 2255)
+	ServerStatus         = NewNumericNodeID(0, 2256)
+	ServerStartTime      = NewNumericNodeID(0, 2257)
+	ServerCurrentTime    = NewNumericNodeID(0, 2258)
+	ServerState          = NewNumericNodeID(0, 2259)
+
+	// reference types
+	References             = NewNumericNodeID(0, 31)
+	NonHierarchical        = NewNumericNodeID(0, 32)
+	HierarchicalReferences = NewNumericNodeID(0, 33)
+	HasChild               = NewNumericNodeID(0, 34)
+	Organizes              = NewNumericNodeID(0, 35)
+	HasTypeDefinition      = NewNumericNodeID(0, 40)
+	Aggregates             = NewNumericNodeID(0, 44)
+	HasSubtype             = NewNumericNodeID(0, 45)
+	HasProperty            = NewNumericNodeID(0, 46)
+	HasComponent           = NewNumericNodeID(0, 47)
+
+	// object and variable types
+	BaseObjectType       = NewNumericNodeID(0, 58)
+	FolderType           = NewNumericNodeID(0, 61)
+	BaseVariableType     = NewNumericNodeID(0, 62)
+	BaseDataVariableType = NewNumericNodeID(0, 63)
+	PropertyType         = NewNumericNodeID(0, 68)
+	ServerType           = NewNumericNodeID(0, 2004)
+	ServerStatusType     = NewNumericNodeID(0, 2138)
+
+	// data types
+	BooleanType          = NewNumericNodeID(0, 1)
+	Int32Type            = NewNumericNodeID(0, 6)
+	UInt32Type           = NewNumericNodeID(0, 7)
+	DoubleType           = NewNumericNodeID(0, 11)
+	StringType           = NewNumericNodeID(0, 12)
+	DateTimeType         = NewNumericNodeID(0, 13)
+	LocalizedTextType    = NewNumericNodeID(0, 21)
+	ServerStateType      = NewNumericNodeID(0, 852)
+	ServerStatusDataType = NewNumericNodeID(0, 862)
+	EUInformationType    = NewNumericNodeID(0, 887)
+)
+
+// binary encoding ids of structures
+const (
+	idAnonymousIdentityToken = 321
+	idUserNameIdentityToken  = 324
+	idServerStatusEncoding   = 864
+	idEUInformationEncoding  = 889
+	idDataChangeNotification = 811
+)
+
+// binary encoding ids of service requests and responses
+const (
+	idServiceFault                 = 397
+	idFindServersRequest           = 422
+	idFindServersResponse          = 425
+	idGetEndpointsRequest          = 428
+	idGetEndpointsResponse         = 431
+	idOpenSecureChannelRequest     = 446
+	idOpenSecureChannelResponse    = 449
+	idCloseSecureChannelRequest    = 452
+	idCreateSessionRequest         = 461
+	idCreateSessionResponse        = 464
+	idActivateSessionRequest       = 467
+	idActivateSessionResponse      = 470
+	idCloseSessionRequest          = 473
+	idCloseSessionResponse         = 476
+	idBrowseRequest                = 527
+	idBrowseResponse               = 530
+	idBrowseNextRequest            = 533
+	idBrowseNextResponse           = 536
+	idTranslateBrowsePathsRequest  = 554
+	idTranslateBrowsePathsResponse = 557
+	idReadRequest                  = 631
+	idReadResponse                 = 634
+	idCreateMonitoredItemsRequest  = 751
+	idCreateMonitoredItemsResponse = 754
+	idDeleteMonitoredItemsRequest  = 781
+	idDeleteMonitoredItemsResponse = 784
+	idCreateSubscriptionRequest    = 787
+	idCreateSubscriptionResponse   = 790
+	idPublishRequest               = 826
+	idPublishResponse              = 829
+	idDeleteSubscriptionsRequest   = 847
+	idDeleteSubscriptionsResponse  = 850
+)
+
+// attribute ids
+const (
+	AttrNodeID                  = 1
+	AttrNodeClass               = 2
+	AttrBrowseName              = 3
+	AttrDisplayName             = 4
+	AttrDescription             = 5
+	AttrWriteMask               = 6
+	AttrUserWriteMask           = 7
+	AttrIsAbstract              = 8
+	AttrSymmetric               = 9
+	AttrInverseName             = 10
+	AttrEventNotifier           = 12
+	AttrValue                   = 13
+	AttrDataType                = 14
+	AttrValueRank               = 15
+	AttrArrayDimensions         = 16
+	AttrAccessLevel             = 17
+	AttrUserAccessLevel         = 18
+	AttrMinimumSamplingInterval = 19
+	AttrHistorizing             = 20
+)
+
+// security policy and profile uris
+const (
+	SecurityPolicyNone = "http://opcfoundation.org/UA/SecurityPolicy#None"
+	transportProfile   = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
+	namespaceUA        = "http://opcfoundation.org/UA/"
+	unitsNamespace     = "http://www.opcfoundation.org/UA/units/un/cefact"
+)
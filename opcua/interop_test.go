@@ -0,0 +1,133 @@
+package opcua
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gopcua "github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// TestInteropGopcua exercises the server with an independent client implementation
+func TestInteropGopcua(t *testing.T) {
+	srv, addr := startServer(t, Options{Anonymous: true, NamespaceURI: "urn:test", ApplicationURI: "urn:test:server"})
+
+	device := NewStringNodeID(1, "SDM1.1")
+	power := NewStringNodeID(1, "SDM1.1.Power")
+	if err := srv.AddObject(ObjectsFolder, device, "SDM1.1", Organizes); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddVariable(device, power, "Power", DoubleType, "Power"); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetValue(power, DataValue{Value: 1234.5, SourceTimestamp: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	endpoint := "opc.tcp://" + addr
+	endpoints, err := gopcua.GetEndpoints(ctx, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].SecurityPolicyURI != ua.SecurityPolicyURINone {
+		t.Fatalf("unexpected endpoints %+v", endpoints)
+	}
+	for _, p := range endpoints[0].UserIdentityTokens {
+		if p.TokenType != ua.UserTokenTypeAnonymous {
+			t.Errorf("unexpected token policy %+v", p)
+		}
+	}
+
+	c, err := gopcua.NewClient(endpoint,
+		gopcua.SecurityPolicy(ua.SecurityPolicyURINone),
+		gopcua.SecurityMode(ua.MessageSecurityModeNone),
+		gopcua.AuthAnonymous(),
+		gopcua.SecurityFromEndpoint(endpoints[0], ua.UserTokenTypeAnonymous),
+		gopcua.AutoReconnect(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(context.Background())
+
+	if ns, err := c.NamespaceArray(ctx); err != nil || len(ns) != 2 || ns[1] != "urn:test" {
+		t.Errorf("unexpected namespaces %v: %v", ns, err)
+	}
+
+	children, err := c.Node(ua.NewNumericNodeID(0, ObjectsFolder.ID)).Children(ctx, Organizes.ID, ua.NodeClassObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[1].ID.StringID() != "SDM1.1" {
+		t.Errorf("unexpected objects %v", children)
+	}
+
+	id := ua.NewStringNodeID(1, "SDM1.1.Power")
+	if v, err := c.Node(id).Value(ctx); err != nil || v.Float() != 1234.5 {
+		t.Errorf("unexpected value %v: %v", v, err)
+	}
+	if name, err := c.Node(id).BrowseName(ctx); err != nil || name.Name != "Power" {
+		t.Errorf("unexpected browse name %v: %v", name, err)
+	}
+
+	notify := make(chan *gopcua.PublishNotificationData, 10)
+	sub, err := c.Subscribe(ctx, &gopcua.SubscriptionParameters{Interval: 50 * time.Millisecond}, notify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Cancel(context.Background())
+
+	if res, err := sub.Monitor(ctx, ua.TimestampsToReturnBoth, gopcua.NewMonitoredItemCreateRequestWithDefaults(id, ua.AttributeIDValue, 1)); err != nil || res.Results[0].StatusCode != ua.StatusOK {
+		t.Fatalf("monitor failed: %v", err)
+	}
+
+	srv.SetValue(power, DataValue{Value: 2345.5, SourceTimestamp: time.Now()})
+
+	for {
+		select {
+		case n := <-notify:
+			if n.Error != nil {
+				t.Fatal(n.Error)
+			}
+			changes, ok := n.Value.(*ua.DataChangeNotification)
+			if !ok {
+				continue
+			}
+			for _, item := range changes.MonitoredItems {
+				if item.Value.Value.Float() == 2345.5 {
+					return
+				}
+			}
+		case <-ctx.Done():
+			t.Fatal("no data change received")
+		}
+	}
+}
+
+// TestInteropGopcuaUsername verifies that passwords are refused without a secure policy
+func TestInteropGopcuaUsername(t *testing.T) {
+	_, addr := startServer(t, Options{Anonymous: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := gopcua.NewClient("opc.tcp://"+addr,
+		gopcua.SecurityPolicy(ua.SecurityPolicyURINone),
+		gopcua.SecurityMode(ua.MessageSecurityModeNone),
+		gopcua.AuthUsername("admin", "secret"),
+		gopcua.AutoReconnect(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Connect(ctx); err == nil {
+		_ = c.Close(context.Background())
+		t.Fatal("expected username session to be refused")
+	}
+}
@@ -0,0 +1,466 @@
+package opcua
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reference is a directed reference between nodes
+type Reference struct {
+	Type    NodeID
+	Target  NodeID
+	Forward bool
+}
+
+// Node is an address space node
+type Node struct {
+	ID             NodeID
+	Class          NodeClass
+	BrowseName     QualifiedName
+	DisplayName    LocalizedText
+	Description    LocalizedText
+	TypeDefinition NodeID
+	DataType       NodeID // variables only
+	ValueRank      int32  // variables only
+
+	value DataValue
+	read  func() DataValue // dynamic values
+	refs  []Reference
+}
+
+// AddressSpace is a thread-safe in-memory address space
+type AddressSpace struct {
+	mu      sync.RWMutex
+	nodes   map[NodeID]*Node
+	changed chan struct{} // closed and replaced on value changes
+}
+
+// referenceSupertypes maps the reference types used by the address space to their supertype
+var referenceSupertypes = map[NodeID]NodeID{
+	NonHierarchical:        References,
+	HierarchicalReferences: References,
+	HasChild:               HierarchicalReferences,
+	Organizes:              HierarchicalReferences,
+	Aggregates:             HasChild,
+	HasSubtype:             HasChild,
+	HasComponent:           Aggregates,
+	HasProperty:            Aggregates,
+	HasTypeDefinition:      NonHierarchical,
+}
+
+// isSubtype checks if the reference type is the base type or one of its subtypes
+func isSubtype(typ, base NodeID) bool {
+	for {
+		if typ == base {
+			return true
+		}
+		var ok bool
+		if typ, ok = referenceSupertypes[typ]; !ok {
+			return false
+		}
+	}
+}
+
+// NewAddressSpace creates an address space containing the standard folders,
+// the server object and the type nodes referenced by it
+func NewAddressSpace() *AddressSpace {
+	as := &AddressSpace{
+		nodes:   make(map[NodeID]*Node),
+		changed: make(chan struct{}),
+	}
+
+	as.add(&Node{ID: RootFolder, Class: NodeClassObject, BrowseName: QualifiedName{Name: "Root"}, TypeDefinition: FolderType})
+	for _, f := range []struct {
+		id   NodeID
+		name string
+	}{
+		{ObjectsFolder, "Objects"},
+		{TypesFolder, "Types"},
+		{ViewsFolder, "Views"},
+	} {
+		as.add(&Node{ID: f.id, Class: NodeClassObject, BrowseName: QualifiedName{Name: f.name}, TypeDefinition: FolderType})
+		as.reference(RootFolder, Organizes, f.id)
+	}
+
+	// type nodes for clients resolving names
+	types := []struct {
+		id    NodeID
+		class NodeClass
+		name  string
+	}{
+		{References, NodeClassReferenceType, "References"},
+		{NonHierarchical, NodeClassReferenceType, "NonHierarchicalReferences"},
+		{HierarchicalReferences, NodeClassReferenceType, "HierarchicalReferences"},
+		{HasChild, NodeClassReferenceType, "HasChild"},
+		{Organizes, NodeClassReferenceType, "Organizes"},
+		{HasTypeDefinition, NodeClassReferenceType, "HasTypeDefinition"},
+		{Aggregates, NodeClassReferenceType, "Aggregates"},
+		{HasSubtype, NodeClassReferenceType, "HasSubtype"},
+		{HasProperty, NodeClassReferenceType, "HasProperty"},
+		{HasComponent, NodeClassReferenceType, "HasComponent"},
+		{BaseObjectType, NodeClassObjectType, "BaseObjectType"},
+		{FolderType, NodeClassObjectType, "FolderType"},
+		{ServerType, NodeClassObjectType, "ServerType"},
+		{BaseVariableType, NodeClassVariableType, "BaseVariableType"},
+		{BaseDataVariableType, NodeClassVariableType, "BaseDataVariableType"},
+		{PropertyType, NodeClassVariableType, "PropertyType"},
+		{ServerStatusType, NodeClassVariableType, "ServerStatusType"},
+		{BooleanType, NodeClassDataType, "Boolean"},
+		{Int32Type, NodeClassDataType, "Int32"},
+		{UInt32Type, NodeClassDataType, "UInt32"},
+		{DoubleType, NodeClassDataType, "Double"},
+		{StringType, NodeClassDataType, "String"},
+		{DateTimeType, NodeClassDataType, "DateTime"},
+		{LocalizedTextType, NodeClassDataType, "LocalizedText"},
+		{ServerStateType, NodeClassDataType, "ServerState"},
+		{ServerStatusDataType, NodeClassDataType, "ServerStatusDataType"},
+		{EUInformationType, NodeClassDataType, "EUInformation"},
+	}
+	for _, t := range types {
+		as.add(&Node{ID: t.id, Class: t.class, BrowseName: QualifiedName{Name: t.name}})
+	}
+	for sub, super := range referenceSupertypes {
+		as.reference(super, HasSubtype, sub)
+	}
+	as.reference(TypesFolder, Organizes, References)
+	as.reference(BaseObjectType, HasSubtype, FolderType)
+	as.reference(BaseObjectType, HasSubtype, ServerType)
+	as.reference(TypesFolder, Organizes, BaseObjectType)
+	as.reference(BaseVariableType, HasSubtype, BaseDataVariableType)
+	as.reference(BaseVariableType, HasSubtype, PropertyType)
+	as.reference(BaseDataVariableType, HasSubtype, ServerStatusType)
+	as.reference(TypesFolder, Organizes, BaseVariableType)
+
+	return as
+}
+
+// add adds the node and its type definition reference
+func (as *AddressSpace) add(n *Node) {
+	if n.DisplayName == "" {
+		n.DisplayName = LocalizedText(n.BrowseName.Name)
+	}
+	as.nodes[n.ID] = n
+	if n.TypeDefinition != (NodeID{}) {
+		n.refs = append(n.refs, Reference{Type: HasTypeDefinition, Target: n.TypeDefinition, Forward: true})
+	}
+}
+
+// reference adds forward and inverse references
+func (as *AddressSpace) reference(source, typ, target NodeID) {
+	if n, ok := as.nodes[source]; ok {
+		n.refs = append(n.refs, Reference{Type: typ, Target: target, Forward: true})
+	}
+	if n, ok := as.nodes[target]; ok {
+		n.refs = append(n.refs, Reference{Type: typ, Target: source, Forward: false})
+	}
+}
+
+// AddObject adds an object below the parent
+func (as *AddressSpace) AddObject(parent, id NodeID, name string, refType NodeID) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if err := as.checkNew(parent, id); err != nil {
+		return err
+	}
+
+	as.add(&Node{
+		ID:             id,
+		Class:          NodeClassObject,
+		BrowseName:     QualifiedName{Namespace: id.Namespace, Name: name},
+		TypeDefinition: BaseObjectType,
+	})
+	as.reference(parent, refType, id)
+
+	return nil
+}
+
+// AddVariable adds a data variable component below the parent
+func (as *AddressSpace) AddVariable(parent, id NodeID, name string, dataType NodeID, description string) error {
+	return as.addVariable(parent, id, name, dataType, description, HasComponent, BaseDataVariableType)
+}
+
+// AddProperty adds a property below the parent. Properties use the parent's namespace for their browse name.
+func (as *AddressSpace) AddProperty(parent, id NodeID, name string, dataType NodeID, value any) error {
+	if err := as.addVariable(parent, id, name, dataType, "", HasProperty, PropertyType); err != nil {
+		return err
+	}
+	as.SetValue(id, DataValue{Value: value})
+	return nil
+}
+
+func (as *AddressSpace) addVariable(parent, id NodeID, name string, dataType NodeID, description string, refType, typeDefinition NodeID) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if err := as.checkNew(parent, id); err != nil {
+		return err
+	}
+
+	browseNamespace := id.Namespace
+	if refType == HasProperty && name == "EngineeringUnits" {
+		// standard property
+		browseNamespace = 0
+	}
+
+	as.add(&Node{
+		ID:             id,
+		Class:          NodeClassVariable,
+		BrowseName:     QualifiedName{Namespace: browseNamespace, Name: name},
+		Description:    LocalizedText(description),
+		TypeDefinition: typeDefinition,
+		DataType:       dataType,
+		ValueRank:      -1,
+		value:          DataValue{Status: StatusBadWaitingForInitialData},
+	})
+	as.reference(parent, refType, id)
+
+	return nil
+}
+
+func (as *AddressSpace) checkNew(parent, id NodeID) error {
+	if _, ok := as.nodes[parent]; !ok {
+		return fmt.Errorf("opcua: unknown parent node %v", parent)
+	}
+	if _, ok := as.nodes[id]; ok {
+		return fmt.Errorf("opcua: duplicate node %v", id)
+	}
+	return nil
+}
+
+// Exists checks if the node exists
+func (as *AddressSpace) Exists(id NodeID) bool {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	_, ok := as.nodes[id]
+	return ok
+}
+
+// SetValue updates a variable's value and notifies subscriptions
+func (as *AddressSpace) SetValue(id NodeID, v DataValue) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if n, ok := as.nodes[id]; ok && n.Class == NodeClassVariable {
+		n.value = v
+		close(as.changed)
+		as.changed = make(chan struct{})
+	}
+}
+
+// SetStatus updates a variable's status keeping its value
+func (as *AddressSpace) SetStatus(id NodeID, status StatusCode) {
+	as.mu.Lock()
+	n, ok := as.nodes[id]
+	if !ok || n.value.Value == nil || n.value.Status == status {
+		as.mu.Unlock()
+		return
+	}
+	v := n.value
+	as.mu.Unlock()
+
+	v.Status = status
+	v.ServerTimestamp = time.Time{}
+	as.SetValue(id, v)
+}
+
+// setDynamic installs a value callback for a variable
+func (as *AddressSpace) setDynamic(id NodeID, read func() DataValue) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if n, ok := as.nodes[id]; ok {
+		n.read = read
+	}
+}
+
+// Changed returns a channel that is closed on the next value change
+func (as *AddressSpace) Changed() <-chan struct{} {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.changed
+}
+
+// Value returns a variable's value
+func (as *AddressSpace) Value(id NodeID) (DataValue, StatusCode) {
+	as.mu.RLock()
+	n, ok := as.nodes[id]
+	as.mu.RUnlock()
+
+	switch {
+	case !ok:
+		return DataValue{}, StatusBadNodeIDUnknown
+	case n.Class != NodeClassVariable:
+		return DataValue{}, StatusBadAttributeIDInvalid
+	case n.read != nil:
+		return n.read(), StatusGood
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return n.value, StatusGood
+}
+
+// Attribute reads a node attribute
+func (as *AddressSpace) Attribute(id NodeID, attr uint32) DataValue {
+	if attr == AttrValue {
+		v, status := as.Value(id)
+		if status != StatusGood {
+			return DataValue{Status: status}
+		}
+		return v
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	n, ok := as.nodes[id]
+	if !ok {
+		return DataValue{Status: StatusBadNodeIDUnknown}
+	}
+
+	variable := n.Class == NodeClassVariable
+	var v any
+
+	switch attr {
+	case AttrNodeID:
+		v = n.ID
+	case AttrNodeClass:
+		v = int32(n.Class)
+	case AttrBrowseName:
+		v = n.BrowseName
+	case AttrDisplayName:
+		v = n.DisplayName
+	case AttrDescription:
+		v = n.Description
+	case AttrWriteMask, AttrUserWriteMask:
+		v = uint32(0)
+	case AttrIsAbstract:
+		if n.Class < NodeClassObjectType {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = false
+	case AttrSymmetric:
+		if n.Class != NodeClassReferenceType {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = false
+	case AttrEventNotifier:
+		if n.Class != NodeClassObject {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = uint8(0)
+	case AttrDataType:
+		if !variable {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = n.DataType
+	case AttrValueRank:
+		if !variable {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = n.ValueRank
+	case AttrArrayDimensions:
+		if !variable {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		// null for scalars
+	case AttrAccessLevel, AttrUserAccessLevel:
+		if !variable {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = uint8(1) // CurrentRead
+	case AttrMinimumSamplingInterval:
+		if !variable {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = float64(-1)
+	case AttrHistorizing:
+		if !variable {
+			return DataValue{Status: StatusBadAttributeIDInvalid}
+		}
+		v = false
+	default:
+		return DataValue{Status: StatusBadAttributeIDInvalid}
+	}
+
+	return DataValue{Value: v}
+}
+
+// ReferenceDescription describes a browse result
+type ReferenceDescription struct {
+	Reference
+	BrowseName     QualifiedName
+	DisplayName    LocalizedText
+	Class          NodeClass
+	TypeDefinition NodeID
+}
+
+// Browse direction
+const (
+	BrowseForward = 0
+	BrowseInverse = 1
+	BrowseBoth    = 2
+)
+
+// Browse returns the node's references matching the filter
+func (as *AddressSpace) Browse(id NodeID, direction uint32, refType NodeID, subtypes bool, classMask uint32) ([]ReferenceDescription, StatusCode) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	n, ok := as.nodes[id]
+	if !ok {
+		return nil, StatusBadNodeIDUnknown
+	}
+
+	res := []ReferenceDescription{}
+	for _, ref := range n.refs {
+		if direction == BrowseForward && !ref.Forward || direction == BrowseInverse && ref.Forward {
+			continue
+		}
+		if refType != (NodeID{}) && ref.Type != refType && !(subtypes && isSubtype(ref.Type, refType)) {
+			continue
+		}
+
+		target, ok := as.nodes[ref.Target]
+		if !ok {
+			continue
+		}
+		if classMask != 0 && classMask&uint32(target.Class) == 0 {
+			continue
+		}
+
+		res = append(res, ReferenceDescription{
+			Reference:      ref,
+			BrowseName:     target.BrowseName,
+			DisplayName:    target.DisplayName,
+			Class:          target.Class,
+			TypeDefinition: target.TypeDefinition,
+		})
+	}
+
+	return res, StatusGood
+}
+
+// UnitID converts a UNECE common code to the numeric EUInformation unit id. Missing units are -1.
+func UnitID(code string) int32 {
+	if code == "" {
+		return -1
+	}
+	var id int32
+	for i := 0; i < len(code) && i < 3; i++ {
+		id = id<<8 | int32(code[i])
+	}
+	return id
+}
+
+// EUInformation encodes the engineering units structure for the UNECE unit code
+func EUInformation(code, displayName, description string) ExtensionObject {
+	var w Buffer
+	w.String(unitsNamespace)
+	w.Int32(UnitID(code))
+	w.LocalizedText(LocalizedText(displayName))
+	w.LocalizedText(LocalizedText(description))
+
+	return ExtensionObject{TypeID: NewNumericNodeID(0, idEUInformationEncoding), Body: w.Bytes()}
+}
@@ -0,0 +1,601 @@
+package opcua
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/volkszaehler/mbmd/logger"
+)
+
+const (
+	bufferSize     = 65536    // receive and send buffer size
+	maxMessageSize = 16 << 20 // maximum size of assembled request messages
+	minBufferSize  = 8192
+)
+
+var log = logger.Get(logger.OPCUA)
+
+// Options configures the server
+type Options struct {
+	ApplicationURI  string
+	ApplicationName string
+	ProductURI      string
+	SoftwareVersion string
+	NamespaceURI    string // namespace 1
+	Anonymous       bool   // allow anonymous sessions
+}
+
+// Server is an OPC UA server
+type Server struct {
+	Options
+	*AddressSpace
+	started time.Time
+
+	mu        sync.Mutex
+	listener  net.Listener
+	conns     map[*conn]struct{}
+	sessions  map[NodeID]*session // by authentication token
+	lastID    uint32              // channel, token, session and subscription ids
+	closed    bool
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewServer creates a server with the standard server object
+func NewServer(opts Options) *Server {
+	srv := &Server{
+		Options:      opts,
+		AddressSpace: NewAddressSpace(),
+		started:      time.Now(),
+		conns:        make(map[*conn]struct{}),
+		sessions:     make(map[NodeID]*session),
+		done:         make(chan struct{}),
+	}
+
+	srv.addServerObject()
+
+	return srv
+}
+
+// addServerObject creates the mandatory server object
+func (srv *Server) addServerObject() {
+	as := srv.AddressSpace
+	as.add(&Node{ID: ServerObject, Class: NodeClassObject, BrowseName: QualifiedName{Name: "Server"}, TypeDefinition: ServerType})
+	as.reference(ObjectsFolder, Organizes, ServerObject)
+
+	variables := []struct {
+		parent, id NodeID
+		name       string
+		dataType   NodeID
+		typeDef    NodeID
+		rank       int32
+		read       func() DataValue
+	}{
+		{ServerObject, ServerServerArray, "ServerArray", StringType, PropertyType, 1, func() DataValue {
+			return DataValue{Value: []string{srv.ApplicationURI}}
+		}},
+		{ServerObject, ServerNamespaceArray, "NamespaceArray", StringType, PropertyType, 1, func() DataValue {
+			return DataValue{Value: []string{namespaceUA, srv.NamespaceURI}}
+		}},
+		{ServerObject, ServerStatus, "ServerStatus", ServerStatusDataType, ServerStatusType, -1, func() DataValue {
+			return DataValue{Value: srv.serverStatus(), SourceTimestamp: time.Now()}
+		}},
+		{ServerStatus, ServerStartTime, "StartTime", DateTimeType, BaseDataVariableType, -1, func() DataValue {
+			return DataValue{Value: srv.started}
+		}},
+		{ServerStatus, ServerCurrentTime, "CurrentTime", DateTimeType, BaseDataVariableType, -1, func() DataValue {
+			now := time.Now()
+			return DataValue{Value: now, SourceTimestamp: now}
+		}},
+		{ServerStatus, ServerState, "State", ServerStateType, BaseDataVariableType, -1, func() DataValue {
+			return DataValue{Value: int32(0)} // running
+		}},
+	}
+
+	for _, v := range variables {
+		refType := HasComponent
+		if v.typeDef == PropertyType {
+			refType = HasProperty
+		}
+		as.add(&Node{
+			ID:             v.id,
+			Class:          NodeClassVariable,
+			BrowseName:     QualifiedName{Name: v.name},
+			TypeDefinition: v.typeDef,
+			DataType:       v.dataType,
+			ValueRank:      v.rank,
+			read:           v.read,
+		})
+		as.reference(v.parent, refType, v.id)
+	}
+}
+
+// serverStatus encodes the ServerStatusDataType structure
+func (srv *Server) serverStatus() ExtensionObject {
+	var w Buffer
+	w.DateTime(srv.started)
+	w.DateTime(time.Now())
+	w.Uint32(0) // running
+
+	// build info
+	w.String(srv.ProductURI)
+	w.String(srv.ApplicationName)
+	w.String(srv.ApplicationName)
+	w.String(srv.SoftwareVersion)
+	w.String("")
+	w.DateTime(srv.started)
+
+	w.Uint32(0) // seconds till shutdown
+	w.LocalizedText("")
+
+	return ExtensionObject{TypeID: NewNumericNodeID(0, idServerStatusEncoding), Body: w.Bytes()}
+}
+
+// nextID returns a server-wide unique id. Must be called with lock held.
+func (srv *Server) nextID() uint32 {
+	srv.lastID++
+	return srv.lastID
+}
+
+// ListenAndServe listens on the TCP address and serves connections
+func (srv *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// Serve serves connections from the listener until the server is closed
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		_ = l.Close()
+		return net.ErrClosed
+	}
+	srv.listener = l
+	srv.mu.Unlock()
+
+	go srv.expireSessions()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			select {
+			case <-srv.done:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		cn := &conn{srv: srv, c: c}
+
+		srv.mu.Lock()
+		srv.conns[cn] = struct{}{}
+		srv.mu.Unlock()
+
+		go cn.serve()
+	}
+}
+
+// Close stops the listener and closes all connections and sessions
+func (srv *Server) Close() error {
+	srv.closeOnce.Do(func() {
+		close(srv.done)
+	})
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closed = true
+
+	var err error
+	if srv.listener != nil {
+		err = srv.listener.Close()
+	}
+	for c := range srv.conns {
+		_ = c.c.Close()
+	}
+	for token, s := range srv.sessions {
+		s.close()
+		delete(srv.sessions, token)
+	}
+
+	return err
+}
+
+// expireSessions removes sessions that have not been used within their timeout
+func (srv *Server) expireSessions() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.done:
+			return
+		case now := <-ticker.C:
+			srv.mu.Lock()
+			for token, s := range srv.sessions {
+				if now.Sub(s.lastSeen) > s.timeout {
+					log.Debug("session expired", "session", s.name)
+					s.close()
+					delete(srv.sessions, token)
+				}
+			}
+			srv.mu.Unlock()
+		}
+	}
+}
+
+// conn is a client connection carrying a single secure channel
+type conn struct {
+	srv *Server
+	c   net.Conn
+
+	recvSize  uint32 // maximum chunk size received
+	sendSize  uint32 // maximum chunk size sent
+	endpoint  string // endpoint url from hello
+	channelID uint32
+	tokenID   uint32
+	partial   []byte // body of incomplete chunked message
+
+	wmu sync.Mutex // serializes chunks of a message
+	seq uint32     // sequence number of last sent chunk
+}
+
+// request is a decoded service request
+type request struct {
+	typeID    uint32
+	requestID uint32
+	handle    uint32
+	token     NodeID // authentication token
+	r         *Reader
+}
+
+var errProtocol = errors.New("opcua: protocol error")
+
+func (c *conn) serve() {
+	defer func() {
+		_ = c.c.Close()
+
+		c.srv.mu.Lock()
+		delete(c.srv.conns, c)
+		for _, s := range c.srv.sessions {
+			s.detach(c)
+		}
+		c.srv.mu.Unlock()
+	}()
+
+	if err := c.hello(); err != nil {
+		log.Debug("handshake failed", "remote", c.c.RemoteAddr(), "error", err)
+		return
+	}
+
+	for {
+		typ, body, err := c.readChunk()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debug("connection closed", "remote", c.c.RemoteAddr(), "error", err)
+			}
+			return
+		}
+
+		if err := c.handle(typ, body); err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			var status StatusCode
+			if !errors.As(err, &status) {
+				status = StatusBadDecodingError
+			}
+			log.Debug("protocol error", "remote", c.c.RemoteAddr(), "error", err)
+			c.sendError(status, err.Error())
+			return
+		}
+	}
+}
+
+// readChunk reads the next message chunk returning the message and chunk type and the body
+func (c *conn) readChunk() (string, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.c, header); err != nil {
+		return "", nil, err
+	}
+
+	r := NewReader(header[4:])
+	size := r.Uint32()
+	if size < 8 || c.recvSize > 0 && size > c.recvSize || size > bufferSize {
+		return "", nil, StatusBadTCPMessageTooLarge
+	}
+
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(c.c, body); err != nil {
+		return "", nil, err
+	}
+
+	return string(header[:4]), body, nil
+}
+
+// hello performs the HEL/ACK handshake
+func (c *conn) hello() error {
+	_ = c.c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	typ, body, err := c.readChunk()
+	if err != nil {
+		return err
+	}
+	_ = c.c.SetReadDeadline(time.Time{})
+
+	if typ != "HELF" {
+		c.sendError(StatusBadTCPMessageTypeInvalid, "expected hello")
+		return StatusBadTCPMessageTypeInvalid
+	}
+
+	r := NewReader(body)
+	r.Uint32() // protocol version
+	clientRecv := r.Uint32()
+	clientSend := r.Uint32()
+	r.Uint32() // max message size
+	r.Uint32() // max chunk count
+	c.endpoint = r.Str()
+
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if clientRecv < minBufferSize || clientSend < minBufferSize {
+		c.sendError(StatusBadTCPMessageTooLarge, "buffer size too small")
+		return errProtocol
+	}
+
+	c.recvSize = min(bufferSize, clientSend)
+	c.sendSize = min(bufferSize, clientRecv)
+
+	var w Buffer
+	w.Uint32(0)
+	w.Uint32(c.recvSize)
+	w.Uint32(c.sendSize)
+	w.Uint32(maxMessageSize)
+	w.Uint32(0) // chunk count not limited
+
+	return c.write("ACKF", w.Bytes())
+}
+
+// write writes a single chunk
+func (c *conn) write(typ string, body []byte) error {
+	var w Buffer
+	w.b = append(w.b, typ...)
+	w.Uint32(uint32(8 + len(body)))
+	w.b = append(w.b, body...)
+
+	_, err := c.c.Write(w.Bytes())
+	return err
+}
+
+func (c *conn) sendError(status StatusCode, reason string) {
+	var w Buffer
+	w.Uint32(uint32(status))
+	w.String(reason)
+	_ = c.write("ERRF", w.Bytes())
+}
+
+// handle processes a chunk
+func (c *conn) handle(typ string, body []byte) error {
+	r := NewReader(body)
+	channelID := r.Uint32()
+
+	switch typ[:3] {
+	case "OPN":
+		if typ[3] != 'F' {
+			return errProtocol
+		}
+		policy := r.Str()
+		r.ByteString() // sender certificate
+		r.ByteString() // receiver thumbprint
+		if err := r.Err(); err != nil {
+			return err
+		}
+		if policy != SecurityPolicyNone {
+			return StatusBadSecurityPolicyRejected
+		}
+		if c.channelID != 0 && channelID != c.channelID {
+			return StatusBadSecureChannelIDInvalid
+		}
+		return c.message(r, true)
+
+	case "MSG", "CLO":
+		if channelID != c.channelID || c.channelID == 0 {
+			return StatusBadSecureChannelIDInvalid
+		}
+		r.Uint32() // token id
+
+		switch typ[3] {
+		case 'A':
+			c.partial = nil
+			return nil
+		case 'C':
+			seqHeader := r.next(8)
+			if len(c.partial) == 0 {
+				c.partial = append(c.partial, seqHeader...)
+			}
+			c.partial = append(c.partial, r.next(r.Len())...)
+			if len(c.partial) > maxMessageSize {
+				return StatusBadTCPMessageTooLarge
+			}
+			return r.Err()
+		case 'F':
+			if len(c.partial) > 0 {
+				r.next(8)
+				msg := append(c.partial, r.next(r.Len())...)
+				c.partial = nil
+				r = NewReader(msg)
+			}
+			if typ[:3] == "CLO" {
+				return io.EOF
+			}
+			return c.message(r, false)
+		}
+	}
+
+	return StatusBadTCPMessageTypeInvalid
+}
+
+// message decodes and dispatches a complete message
+func (c *conn) message(r *Reader, open bool) error {
+	r.Uint32() // sequence number
+	req := &request{requestID: r.Uint32()}
+
+	typeID := r.NodeID()
+	req.typeID = typeID.ID
+
+	// request header
+	req.token = r.NodeID()
+	r.DateTime()
+	req.handle = r.Uint32()
+	r.Uint32() // diagnostics
+	r.Str()    // audit entry
+	r.Uint32() // timeout hint
+	r.ExtensionObject()
+	req.r = r
+
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	if open != (req.typeID == idOpenSecureChannelRequest) {
+		return errProtocol
+	}
+
+	if req.typeID == idCloseSecureChannelRequest {
+		return io.EOF
+	}
+
+	c.srv.dispatch(c, req)
+	return nil
+}
+
+// responseHeader encodes a response header
+func responseHeader(w *Buffer, typeID uint32, handle uint32, status StatusCode) {
+	w.NodeID(NewNumericNodeID(0, typeID))
+	w.DateTime(time.Now())
+	w.Uint32(handle)
+	w.Uint32(uint32(status))
+	w.Byte(0)   // diagnostic info
+	w.Int32(-1) // string table
+	w.ExtensionObject(ExtensionObject{})
+}
+
+// respond sends a response message in chunks not exceeding the send buffer size
+func (c *conn) respond(req *request, typeID uint32, encode func(*Buffer)) {
+	var w Buffer
+	responseHeader(&w, typeID, req.handle, StatusGood)
+	if encode != nil {
+		encode(&w)
+	}
+	c.send(req, w.Bytes())
+}
+
+// fault sends a service fault
+func (c *conn) fault(req *request, status StatusCode) {
+	var w Buffer
+	responseHeader(&w, idServiceFault, req.handle, status)
+	c.send(req, w.Bytes())
+}
+
+func (c *conn) send(req *request, msg []byte) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if req.typeID == idOpenSecureChannelRequest {
+		var w Buffer
+		w.Uint32(c.channelID)
+		w.String(SecurityPolicyNone)
+		w.ByteString(nil)
+		w.ByteString(nil)
+		c.seq++
+		w.Uint32(c.seq)
+		w.Uint32(req.requestID)
+		w.b = append(w.b, msg...)
+
+		if err := c.write("OPNF", w.Bytes()); err != nil {
+			log.Debug("write failed", "error", err)
+		}
+		return
+	}
+
+	const overhead = 8 + 16 // message header, channel, token and sequence header
+	size := int(c.sendSize) - overhead
+
+	for len(msg) > 0 {
+		n := min(size, len(msg))
+		chunk := "MSGC"
+		if n == len(msg) {
+			chunk = "MSGF"
+		}
+
+		var w Buffer
+		w.Uint32(c.channelID)
+		w.Uint32(c.tokenID)
+		c.seq++
+		w.Uint32(c.seq)
+		w.Uint32(req.requestID)
+		w.b = append(w.b, msg[:n]...)
+		msg = msg[n:]
+
+		if err := c.write(chunk, w.Bytes()); err != nil {
+			log.Debug("write failed", "error", err)
+			return
+		}
+	}
+}
+
+// openSecureChannel issues or renews the channel's security token
+func (c *conn) openSecureChannel(req *request) {
+	r := req.r
+	r.Uint32() // client protocol version
+	requestType := r.Uint32()
+	mode := r.Uint32()
+	r.ByteString() // client nonce
+	lifetime := r.Uint32()
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+	if mode != 1 {
+		c.fault(req, StatusBadSecurityModeRejected)
+		return
+	}
+
+	c.srv.mu.Lock()
+	channelID, tokenID := c.channelID, c.srv.nextID()
+	if requestType == 0 && channelID == 0 {
+		channelID = c.srv.nextID()
+	}
+	c.srv.mu.Unlock()
+
+	// ids are read by concurrent publish responses
+	c.wmu.Lock()
+	c.channelID, c.tokenID = channelID, tokenID
+	c.wmu.Unlock()
+
+	lifetime = min(max(lifetime, 60000), 3600000)
+
+	c.respond(req, idOpenSecureChannelResponse, func(w *Buffer) {
+		w.Uint32(0) // protocol version
+		w.Uint32(c.channelID)
+		w.Uint32(c.tokenID)
+		w.DateTime(time.Now())
+		w.Uint32(lifetime)
+		w.ByteString(nil) // server nonce
+	})
+}
+
+func (c *conn) String() string {
+	return fmt.Sprintf("%v#%d", c.c.RemoteAddr(), c.channelID)
+}
@@ -0,0 +1,521 @@
+package opcua
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testClient is a minimal UA-TCP client
+type testClient struct {
+	t       *testing.T
+	c       net.Conn
+	channel uint32
+	token   uint32
+	seq     uint32
+	reqID   uint32
+	auth    NodeID
+}
+
+func (tc *testClient) write(typ string, body []byte) {
+	var w Buffer
+	w.b = append(w.b, typ...)
+	w.Uint32(uint32(8 + len(body)))
+	w.b = append(w.b, body...)
+	if _, err := tc.c.Write(w.Bytes()); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+func (tc *testClient) readChunk() (string, []byte) {
+	_ = tc.c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(tc.c, header); err != nil {
+		tc.t.Fatal(err)
+	}
+	body := make([]byte, NewReader(header[4:]).Uint32()-8)
+	if _, err := io.ReadFull(tc.c, body); err != nil {
+		tc.t.Fatal(err)
+	}
+	return string(header[:4]), body
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	tc := &testClient{t: t, c: c}
+
+	var w Buffer
+	w.Uint32(0)
+	w.Uint32(8192) // small buffers to force chunking
+	w.Uint32(8192)
+	w.Uint32(0)
+	w.Uint32(0)
+	w.String("opc.tcp://" + addr)
+	tc.write("HELF", w.Bytes())
+
+	if typ, _ := tc.readChunk(); typ != "ACKF" {
+		t.Fatalf("expected ACK, got %s", typ)
+	}
+
+	w = Buffer{}
+	w.Uint32(0)
+	w.String(SecurityPolicyNone)
+	w.ByteString(nil)
+	w.ByteString(nil)
+	w.Uint32(1)
+	w.Uint32(1)
+	tc.requestHeader(&w, idOpenSecureChannelRequest)
+	w.Uint32(0)
+	w.Uint32(0) // issue
+	w.Uint32(1) // none
+	w.ByteString(nil)
+	w.Uint32(600000)
+	tc.write("OPNF", w.Bytes())
+
+	typ, body := tc.readChunk()
+	if typ != "OPNF" {
+		t.Fatalf("expected OPN, got %s", typ)
+	}
+
+	r := NewReader(body)
+	r.Uint32()
+	r.Str()
+	r.ByteString()
+	r.ByteString()
+	r.Uint32()
+	r.Uint32()
+	if status := responseStatus(r, idOpenSecureChannelResponse); status != StatusGood {
+		t.Fatalf("open failed: %v", status)
+	}
+	r.Uint32()
+	tc.channel = r.Uint32()
+	tc.token = r.Uint32()
+
+	return tc
+}
+
+func (tc *testClient) requestHeader(w *Buffer, typeID uint32) {
+	tc.reqID++
+	w.NodeID(NewNumericNodeID(0, typeID))
+	w.NodeID(tc.auth)
+	w.DateTime(time.Now())
+	w.Uint32(tc.reqID)
+	w.Uint32(0)
+	w.String("")
+	w.Uint32(0)
+	w.ExtensionObject(ExtensionObject{})
+}
+
+// responseStatus decodes the response header
+func responseStatus(r *Reader, typeID uint32) StatusCode {
+	id := r.NodeID()
+	r.DateTime()
+	r.Uint32()
+	status := StatusCode(r.Uint32())
+	r.DiagnosticInfo()
+	ReadArray(r, r.Str)
+	r.ExtensionObject()
+
+	if id.ID != typeID && status == StatusGood {
+		return StatusBadUnexpectedError
+	}
+	return status
+}
+
+// call sends a request and returns the response reader positioned after the response header
+func (tc *testClient) call(typeID uint32, encode func(*Buffer)) *Reader {
+	var w Buffer
+	w.Uint32(tc.channel)
+	w.Uint32(tc.token)
+	tc.seq++
+	w.Uint32(tc.seq)
+	w.Uint32(tc.reqID + 1)
+	tc.requestHeader(&w, typeID)
+	if encode != nil {
+		encode(&w)
+	}
+	tc.write("MSGF", w.Bytes())
+
+	var msg []byte
+	for {
+		typ, body := tc.readChunk()
+		msg = append(msg, body[16:]...)
+		if typ == "MSGF" {
+			break
+		}
+		if typ != "MSGC" {
+			tc.t.Fatalf("unexpected message %s", typ)
+		}
+	}
+
+	r := NewReader(msg)
+	if status := responseStatus(r, typeID+3); status != StatusGood {
+		r.err = status
+	}
+	return r
+}
+
+func (tc *testClient) createSession() {
+	r := tc.call(idCreateSessionRequest, func(w *Buffer) {
+		w.String("urn:test")
+		w.String("")
+		w.LocalizedText("test")
+		w.Uint32(1)
+		w.String("")
+		w.String("")
+		w.Int32(-1)
+		w.String("")
+		w.String("")
+		w.String("test session")
+		w.ByteString(nil)
+		w.ByteString(nil)
+		w.Double(60000)
+		w.Uint32(0)
+	})
+	r.NodeID()
+	tc.auth = r.NodeID()
+	if r.Err() != nil {
+		tc.t.Fatal(r.Err())
+	}
+}
+
+func (tc *testClient) activate(token ExtensionObject) error {
+	r := tc.call(idActivateSessionRequest, func(w *Buffer) {
+		w.String("")
+		w.ByteString(nil)
+		w.Int32(0)
+		w.Int32(0)
+		w.ExtensionObject(token)
+		w.String("")
+		w.ByteString(nil)
+	})
+	return r.Err()
+}
+
+func userToken(user, password string) ExtensionObject {
+	var w Buffer
+	w.String("username")
+	w.String(user)
+	w.ByteString([]byte(password))
+	w.String("")
+	return ExtensionObject{TypeID: NewNumericNodeID(0, idUserNameIdentityToken), Body: w.Bytes()}
+}
+
+func (tc *testClient) read(id NodeID, attr uint32) DataValue {
+	r := tc.call(idReadRequest, func(w *Buffer) {
+		w.Double(0)
+		w.Uint32(0)
+		w.Int32(1)
+		w.NodeID(id)
+		w.Uint32(attr)
+		w.String("")
+		w.QualifiedName(QualifiedName{})
+	})
+	res := ReadArray(r, r.DataValue)
+	if r.Err() != nil || len(res) != 1 {
+		tc.t.Fatalf("read failed: %v", r.Err())
+	}
+	return res[0]
+}
+
+func (tc *testClient) browse(id NodeID) []QualifiedName {
+	r := tc.call(idBrowseRequest, func(w *Buffer) {
+		w.NodeID(NodeID{})
+		w.DateTime(time.Time{})
+		w.Uint32(0)
+		w.Uint32(0)
+		w.Int32(1)
+		w.NodeID(id)
+		w.Uint32(BrowseForward)
+		w.NodeID(HierarchicalReferences)
+		w.Bool(true)
+		w.Uint32(0)
+		w.Uint32(0x3f)
+	})
+
+	var names []QualifiedName
+	ReadArray(r, func() any {
+		if status := StatusCode(r.Uint32()); status != StatusGood {
+			tc.t.Fatalf("browse failed: %v", status)
+		}
+		r.ByteString()
+		ReadArray(r, func() any {
+			r.NodeID()
+			r.Bool()
+			r.ExpandedNodeID()
+			names = append(names, r.QualifiedName())
+			r.LocalizedText()
+			r.Uint32()
+			r.ExpandedNodeID()
+			return nil
+		})
+		return nil
+	})
+	if r.Err() != nil {
+		tc.t.Fatal(r.Err())
+	}
+	return names
+}
+
+func startServer(t *testing.T, opts Options) (*Server, string) {
+	srv := NewServer(opts)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv, l.Addr().String()
+}
+
+func TestEncoding(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+
+	var w Buffer
+	w.NodeID(NewNumericNodeID(0, 85))
+	w.NodeID(NewNumericNodeID(1, 4711))
+	w.NodeID(NewNumericNodeID(2, 1<<20))
+	w.NodeID(NewStringNodeID(1, "SDM1.1.Power"))
+	w.DataValue(DataValue{Value: 230.5, Status: StatusUncertainLastUsableValue, SourceTimestamp: ts})
+	w.Variant([]string{"a", "b"})
+
+	r := NewReader(w.Bytes())
+	for _, expected := range []NodeID{NewNumericNodeID(0, 85), NewNumericNodeID(1, 4711), NewNumericNodeID(2, 1<<20), NewStringNodeID(1, "SDM1.1.Power")} {
+		if id := r.NodeID(); id != expected {
+			t.Errorf("expected %v, got %v", expected, id)
+		}
+	}
+	if v := r.DataValue(); v.Value != 230.5 || v.Status != StatusUncertainLastUsableValue || !v.SourceTimestamp.Equal(ts.Truncate(100)) {
+		t.Errorf("unexpected data value %+v", v)
+	}
+	if v, ok := r.Variant().([]string); !ok || len(v) != 2 || v[1] != "b" {
+		t.Errorf("unexpected array %v", v)
+	}
+	if r.Err() != nil || r.Len() != 0 {
+		t.Errorf("unexpected state: %v, %d bytes left", r.Err(), r.Len())
+	}
+
+	if r.ByteString(); r.Err() == nil {
+		t.Error("expected error reading past end")
+	}
+
+	if id := UnitID("KWH"); id != 4937544 {
+		t.Errorf("unexpected unit id %d", id)
+	}
+}
+
+func TestServerBrowseRead(t *testing.T) {
+	srv, addr := startServer(t, Options{Anonymous: true, NamespaceURI: "urn:test"})
+
+	device := NewStringNodeID(1, "SDM1.1")
+	power := NewStringNodeID(1, "SDM1.1.Power")
+	if err := srv.AddObject(ObjectsFolder, device, "SDM1.1", Organizes); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddVariable(device, power, "Power", DoubleType, "Power"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddProperty(power, NewStringNodeID(1, "SDM1.1.Power.EngineeringUnits"), "EngineeringUnits", EUInformationType, EUInformation("WTT", "W", "watt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddObject(ObjectsFolder, device, "SDM1.1", Organizes); err == nil {
+		t.Error("expected duplicate node error")
+	}
+
+	// large enough for chunked responses
+	for i := range 300 {
+		name := fmt.Sprintf("Counter%d", i)
+		if err := srv.AddVariable(device, NewStringNodeID(1, "SDM1.1."+name), name, DoubleType, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tc := dial(t, addr)
+
+	// services require a session
+	if r := tc.call(idReadRequest, nil); r.Err() != StatusBadSessionIDInvalid {
+		t.Errorf("expected session error, got %v", r.Err())
+	}
+
+	tc.createSession()
+	if err := tc.activate(ExtensionObject{TypeID: NewNumericNodeID(0, idAnonymousIdentityToken)}); err != nil {
+		t.Fatal(err)
+	}
+
+	names := tc.browse(ObjectsFolder)
+	if len(names) != 2 || names[0].Name != "Server" || names[1].Name != "SDM1.1" {
+		t.Errorf("unexpected objects %v", names)
+	}
+	if names := tc.browse(device); len(names) != 301 || names[300].Name != "Counter299" {
+		t.Errorf("unexpected variables %d", len(names))
+	}
+	if names := tc.browse(power); len(names) != 1 || names[0] != (QualifiedName{Name: "EngineeringUnits"}) {
+		t.Errorf("unexpected properties %v", names)
+	}
+
+	if v := tc.read(power, AttrValue); v.Status != StatusBadWaitingForInitialData {
+		t.Errorf("expected waiting for initial data, got %+v", v)
+	}
+
+	ts := time.Now()
+	srv.SetValue(power, DataValue{Value: 1234.5, SourceTimestamp: ts})
+	if v := tc.read(power, AttrValue); v.Value != 1234.5 || v.Status != StatusGood || v.SourceTimestamp.IsZero() {
+		t.Errorf("unexpected value %+v", v)
+	}
+	if v := tc.read(power, AttrDataType); v.Value != DoubleType {
+		t.Errorf("unexpected data type %+v", v)
+	}
+	if v := tc.read(device, AttrDataType); v.Status != StatusBadAttributeIDInvalid {
+		t.Errorf("expected invalid attribute, got %+v", v)
+	}
+	if v := tc.read(NewStringNodeID(1, "unknown"), AttrValue); v.Status != StatusBadNodeIDUnknown {
+		t.Errorf("expected unknown node, got %+v", v)
+	}
+	if v := tc.read(ServerNamespaceArray, AttrValue); len(v.Value.([]string)) != 2 {
+		t.Errorf("unexpected namespaces %+v", v)
+	}
+	if v := tc.read(ServerStatus, AttrValue); v.Value.(ExtensionObject).TypeID.ID != idServerStatusEncoding {
+		t.Errorf("unexpected server status %+v", v)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	_, addr := startServer(t, Options{Anonymous: true})
+
+	for _, tc := range []struct {
+		token ExtensionObject
+		err   error
+	}{
+		{userToken("admin", "secret"), StatusBadIdentityTokenRejected},
+		{ExtensionObject{TypeID: NewNumericNodeID(0, 999)}, StatusBadIdentityTokenInvalid},
+		{ExtensionObject{TypeID: NewNumericNodeID(0, idAnonymousIdentityToken)}, nil},
+	} {
+		c := dial(t, addr)
+		c.createSession()
+		if err := c.activate(tc.token); err != tc.err {
+			t.Errorf("expected %v, got %v", tc.err, err)
+		}
+
+		// session is usable only when activated
+		r := c.call(idBrowseRequest, func(w *Buffer) {
+			w.NodeID(NodeID{})
+			w.DateTime(time.Time{})
+			w.Uint32(0)
+			w.Uint32(0)
+			w.Int32(0)
+		})
+		if tc.err == nil && r.Err() != StatusBadNothingToDo || tc.err != nil && r.Err() != StatusBadSessionNotActivated {
+			t.Errorf("unexpected browse result %v", r.Err())
+		}
+	}
+}
+
+func TestServerSubscription(t *testing.T) {
+	srv, addr := startServer(t, Options{Anonymous: true})
+
+	power := NewStringNodeID(1, "Power")
+	if err := srv.AddVariable(ObjectsFolder, power, "Power", DoubleType, ""); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetValue(power, DataValue{Value: 1.0})
+
+	tc := dial(t, addr)
+	tc.createSession()
+	if err := tc.activate(ExtensionObject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := tc.call(idCreateSubscriptionRequest, func(w *Buffer) {
+		w.Double(100)
+		w.Uint32(100)
+		w.Uint32(10)
+		w.Uint32(0)
+		w.Bool(true)
+		w.Byte(0)
+	})
+	sub := r.Uint32()
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+
+	r = tc.call(idCreateMonitoredItemsRequest, func(w *Buffer) {
+		w.Uint32(sub)
+		w.Uint32(0)
+		w.Int32(2)
+		for _, id := range []NodeID{power, NewStringNodeID(1, "unknown")} {
+			w.NodeID(id)
+			w.Uint32(AttrValue)
+			w.String("")
+			w.QualifiedName(QualifiedName{})
+			w.Uint32(monitoringReporting)
+			w.Uint32(42) // client handle
+			w.Double(100)
+			w.ExtensionObject(ExtensionObject{})
+			w.Uint32(1)
+			w.Bool(true)
+		}
+	})
+	results := ReadArray(r, func() StatusCode {
+		status := StatusCode(r.Uint32())
+		r.Uint32()
+		r.Double()
+		r.Uint32()
+		r.ExtensionObject()
+		return status
+	})
+	if r.Err() != nil || len(results) != 2 || results[0] != StatusGood || results[1] != StatusBadNodeIDUnknown {
+		t.Fatalf("unexpected monitored items %v: %v", results, r.Err())
+	}
+
+	// publish returns notification messages and keep-alives
+	publish := func() (uint32, []float64) {
+		r := tc.call(idPublishRequest, func(w *Buffer) { w.Int32(0) })
+		if id := r.Uint32(); id != sub {
+			t.Fatalf("unexpected subscription %d", id)
+		}
+		ReadArray(r, r.Uint32)
+		r.Bool()
+		seq := r.Uint32()
+		r.DateTime()
+
+		var values []float64
+		ReadArray(r, func() any {
+			n := NewReader(r.ExtensionObject().Body)
+			ReadArray(n, func() any {
+				if handle := n.Uint32(); handle != 42 {
+					t.Errorf("unexpected handle %d", handle)
+				}
+				values = append(values, n.DataValue().Value.(float64))
+				return nil
+			})
+			return nil
+		})
+		if r.Err() != nil {
+			t.Fatal(r.Err())
+		}
+		return seq, values
+	}
+
+	if seq, values := publish(); seq != 1 || len(values) != 1 || values[0] != 1.0 {
+		t.Errorf("unexpected initial notification %d %v", seq, values)
+	}
+
+	srv.SetValue(power, DataValue{Value: 2.0})
+	if seq, values := publish(); seq != 2 || len(values) != 1 || values[0] != 2.0 {
+		t.Errorf("unexpected change notification %d %v", seq, values)
+	}
+
+	// unchanged value results in keep-alive
+	if seq, values := publish(); seq != 3 || len(values) != 0 {
+		t.Errorf("unexpected keep-alive %d %v", seq, values)
+	}
+}
@@ -0,0 +1,580 @@
+package opcua
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	maxPublishRequests = 10
+	maxContinuations   = 10
+)
+
+// session is a client session. Sessions survive their secure channel until they time out.
+type session struct {
+	id, token NodeID
+	name      string
+	timeout   time.Duration
+	lastSeen  time.Time
+	activated bool
+	conn      *conn
+
+	subs          map[uint32]*subscription
+	publish       []pendingPublish
+	continuations map[string]continuation
+}
+
+// continuation holds the remaining references of a browse result
+type continuation struct {
+	refs    []ReferenceDescription
+	maxRefs uint32
+}
+
+// pendingPublish is a queued publish request
+type pendingPublish struct {
+	conn *conn
+	req  *request
+	acks []StatusCode // subscription acknowledgement results
+}
+
+// detach drops the session's channel and its queued publish requests. Must be called with server lock held.
+func (s *session) detach(c *conn) {
+	if s.conn == c {
+		s.conn = nil
+	}
+	publish := s.publish[:0]
+	for _, p := range s.publish {
+		if p.conn != c {
+			publish = append(publish, p)
+		}
+	}
+	s.publish = publish
+}
+
+// close stops the session's subscriptions. Must be called with server lock held.
+func (s *session) close() {
+	for id, sub := range s.subs {
+		sub.stop()
+		delete(s.subs, id)
+	}
+	s.publish = nil
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// dispatch handles a service request
+func (srv *Server) dispatch(c *conn, req *request) {
+	switch req.typeID {
+	case idOpenSecureChannelRequest:
+		c.openSecureChannel(req)
+		return
+	case idGetEndpointsRequest:
+		srv.getEndpoints(c, req)
+		return
+	case idFindServersRequest:
+		srv.findServers(c, req)
+		return
+	case idCreateSessionRequest:
+		srv.createSession(c, req)
+		return
+	}
+
+	srv.mu.Lock()
+	s, ok := srv.sessions[req.token]
+	var activated bool
+	if ok {
+		s.lastSeen = time.Now()
+		activated = s.activated
+	}
+	srv.mu.Unlock()
+
+	switch {
+	case !ok:
+		c.fault(req, StatusBadSessionIDInvalid)
+		return
+	case req.typeID == idActivateSessionRequest:
+		srv.activateSession(c, req, s)
+		return
+	case req.typeID == idCloseSessionRequest:
+		srv.closeSession(c, req, s)
+		return
+	case !activated:
+		c.fault(req, StatusBadSessionNotActivated)
+		return
+	}
+
+	switch req.typeID {
+	case idBrowseRequest:
+		srv.browse(c, req, s)
+	case idBrowseNextRequest:
+		srv.browseNext(c, req, s)
+	case idTranslateBrowsePathsRequest:
+		srv.translateBrowsePaths(c, req)
+	case idReadRequest:
+		srv.read(c, req)
+	case idCreateSubscriptionRequest:
+		srv.createSubscription(c, req, s)
+	case idDeleteSubscriptionsRequest:
+		srv.deleteSubscriptions(c, req, s)
+	case idCreateMonitoredItemsRequest:
+		srv.createMonitoredItems(c, req, s)
+	case idDeleteMonitoredItemsRequest:
+		srv.deleteMonitoredItems(c, req, s)
+	case idPublishRequest:
+		srv.publish(c, req, s)
+	default:
+		log.Debug("unsupported service", "type", req.typeID)
+		c.fault(req, StatusBadServiceUnsupported)
+	}
+}
+
+// applicationDescription encodes the server's application description
+func (srv *Server) applicationDescription(w *Buffer, endpoint string) {
+	w.String(srv.ApplicationURI)
+	w.String(srv.ProductURI)
+	w.LocalizedText(LocalizedText(srv.ApplicationName))
+	w.Uint32(0) // server
+	w.String("")
+	w.String("")
+	Array(w, []string{endpoint}, w.String)
+}
+
+// skipApplicationDescription skips a client's application description
+func skipApplicationDescription(r *Reader) {
+	r.Str()
+	r.Str()
+	r.LocalizedText()
+	r.Uint32()
+	r.Str()
+	r.Str()
+	ReadArray(r, r.Str)
+}
+
+// endpoints encodes the single unsecured endpoint
+func (srv *Server) endpoints(w *Buffer, endpoint string) {
+	w.Int32(1)
+	w.String(endpoint)
+	srv.applicationDescription(w, endpoint)
+	w.ByteString(nil) // certificate
+	w.Uint32(1)       // security mode none
+	w.String(SecurityPolicyNone)
+
+	// username tokens are not offered as they would travel in cleartext
+	var policies []string
+	if srv.Anonymous {
+		policies = append(policies, "anonymous")
+	}
+	Array(w, policies, func(id string) {
+		w.String(id)
+		w.Uint32(0) // anonymous token type
+		w.String("")
+		w.String("")
+		w.String(SecurityPolicyNone)
+	})
+
+	w.String(transportProfile)
+	w.Byte(0) // security level
+}
+
+// endpointURL returns the requested endpoint url or the url from the hello message
+func (c *conn) endpointURL(requested string) string {
+	if requested != "" {
+		return requested
+	}
+	return c.endpoint
+}
+
+func (srv *Server) getEndpoints(c *conn, req *request) {
+	endpoint := c.endpointURL(req.r.Str())
+	c.respond(req, idGetEndpointsResponse, func(w *Buffer) {
+		srv.endpoints(w, endpoint)
+	})
+}
+
+func (srv *Server) findServers(c *conn, req *request) {
+	endpoint := c.endpointURL(req.r.Str())
+	c.respond(req, idFindServersResponse, func(w *Buffer) {
+		w.Int32(1)
+		srv.applicationDescription(w, endpoint)
+	})
+}
+
+func (srv *Server) createSession(c *conn, req *request) {
+	r := req.r
+	skipApplicationDescription(r)
+	r.Str() // server uri
+	endpoint := c.endpointURL(r.Str())
+	name := r.Str()
+	r.ByteString() // client nonce
+	r.ByteString() // client certificate
+	timeout := r.Double()
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	timeout = min(max(timeout, 10000), 3600000)
+
+	srv.mu.Lock()
+	s := &session{
+		id:            NewNumericNodeID(1, srv.nextID()),
+		token:         NewStringNodeID(1, hex.EncodeToString(randomBytes(16))),
+		name:          name,
+		timeout:       time.Duration(timeout) * time.Millisecond,
+		lastSeen:      time.Now(),
+		subs:          make(map[uint32]*subscription),
+		continuations: make(map[string]continuation),
+	}
+	srv.sessions[s.token] = s
+	srv.mu.Unlock()
+
+	log.Debug("session created", "session", name, "remote", c)
+
+	c.respond(req, idCreateSessionResponse, func(w *Buffer) {
+		w.NodeID(s.id)
+		w.NodeID(s.token)
+		w.Double(timeout)
+		w.ByteString(randomBytes(32))
+		w.ByteString(nil) // certificate
+		srv.endpoints(w, endpoint)
+		w.Int32(0) // software certificates
+		w.String("")
+		w.ByteString(nil) // signature
+		w.Uint32(maxMessageSize)
+	})
+}
+
+func (srv *Server) activateSession(c *conn, req *request, s *session) {
+	r := req.r
+	r.Str()        // signature algorithm
+	r.ByteString() // signature
+	ReadArray(r, func() []byte {
+		r.ByteString()
+		return r.ByteString()
+	})
+	ReadArray(r, r.Str) // locales
+	token := r.ExtensionObject()
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	if status := srv.authenticate(token); status != StatusGood {
+		log.Info("session rejected", "session", s.name, "token", token.TypeID.ID, "remote", c)
+		c.fault(req, status)
+		return
+	}
+
+	srv.mu.Lock()
+	s.activated = true
+	s.conn = c
+	srv.mu.Unlock()
+
+	log.Debug("session activated", "session", s.name, "remote", c)
+
+	c.respond(req, idActivateSessionResponse, func(w *Buffer) {
+		w.ByteString(randomBytes(32))
+		w.Int32(0) // results
+		w.Int32(0) // diagnostics
+	})
+}
+
+// authenticate validates the user identity token
+func (srv *Server) authenticate(token ExtensionObject) StatusCode {
+	switch token.TypeID {
+	case NodeID{}, NewNumericNodeID(0, idAnonymousIdentityToken):
+		if !srv.Anonymous {
+			return StatusBadIdentityTokenRejected
+		}
+		return StatusGood
+
+	case NewNumericNodeID(0, idUserNameIdentityToken):
+		// passwords would travel in cleartext without a secure policy
+		return StatusBadIdentityTokenRejected
+	}
+
+	return StatusBadIdentityTokenInvalid
+}
+
+func (srv *Server) closeSession(c *conn, req *request, s *session) {
+	srv.mu.Lock()
+	s.close()
+	delete(srv.sessions, s.token)
+	srv.mu.Unlock()
+
+	log.Debug("session closed", "session", s.name, "remote", c)
+
+	c.respond(req, idCloseSessionResponse, nil)
+}
+
+// browseResult encodes a browse result
+func browseResult(w *Buffer, status StatusCode, continuation []byte, refs []ReferenceDescription) {
+	w.Uint32(uint32(status))
+	w.ByteString(continuation)
+	Array(w, refs, func(ref ReferenceDescription) {
+		w.NodeID(ref.Type)
+		w.Bool(ref.Forward)
+		w.ExpandedNodeID(ref.Target)
+		w.QualifiedName(ref.BrowseName)
+		w.LocalizedText(ref.DisplayName)
+		w.Uint32(uint32(ref.Class))
+		w.ExpandedNodeID(ref.TypeDefinition)
+	})
+}
+
+// browseRes is a pending browse result
+type browseRes struct {
+	status       StatusCode
+	continuation []byte
+	refs         []ReferenceDescription
+}
+
+// limit splits references exceeding the maximum into a continuation point. Must be called with server lock held.
+func (s *session) limit(refs []ReferenceDescription, maxRefs uint32) browseRes {
+	if maxRefs == 0 || uint32(len(refs)) <= maxRefs {
+		return browseRes{refs: refs}
+	}
+	if len(s.continuations) >= maxContinuations {
+		return browseRes{status: StatusBadContinuationPointInvalid}
+	}
+
+	cp := randomBytes(8)
+	s.continuations[string(cp)] = continuation{refs: refs[maxRefs:], maxRefs: maxRefs}
+
+	return browseRes{continuation: cp, refs: refs[:maxRefs]}
+}
+
+func (srv *Server) browse(c *conn, req *request, s *session) {
+	r := req.r
+	r.NodeID()   // view
+	r.DateTime() // view timestamp
+	r.Uint32()   // view version
+	maxRefs := r.Uint32()
+
+	type description struct {
+		id        NodeID
+		direction uint32
+		refType   NodeID
+		subtypes  bool
+		classMask uint32
+	}
+	nodes := ReadArray(r, func() description {
+		d := description{
+			id:        r.NodeID(),
+			direction: r.Uint32(),
+			refType:   r.NodeID(),
+			subtypes:  r.Bool(),
+			classMask: r.Uint32(),
+		}
+		r.Uint32() // result mask
+		return d
+	})
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+	if len(nodes) == 0 {
+		c.fault(req, StatusBadNothingToDo)
+		return
+	}
+
+	results := make([]browseRes, 0, len(nodes))
+	for _, d := range nodes {
+		refs, status := srv.Browse(d.id, d.direction, d.refType, d.subtypes, d.classMask)
+		if status != StatusGood {
+			results = append(results, browseRes{status: status})
+			continue
+		}
+
+		srv.mu.Lock()
+		results = append(results, s.limit(refs, maxRefs))
+		srv.mu.Unlock()
+	}
+
+	c.respond(req, idBrowseResponse, func(w *Buffer) {
+		Array(w, results, func(res browseRes) {
+			browseResult(w, res.status, res.continuation, res.refs)
+		})
+		w.Int32(0) // diagnostics
+	})
+}
+
+func (srv *Server) browseNext(c *conn, req *request, s *session) {
+	r := req.r
+	release := r.Bool()
+	points := ReadArray(r, r.ByteString)
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	results := make([]browseRes, 0, len(points))
+
+	srv.mu.Lock()
+	for _, cp := range points {
+		cont, ok := s.continuations[string(cp)]
+		delete(s.continuations, string(cp))
+
+		switch {
+		case !ok:
+			results = append(results, browseRes{status: StatusBadContinuationPointInvalid})
+		case release:
+			results = append(results, browseRes{})
+		default:
+			results = append(results, s.limit(cont.refs, cont.maxRefs))
+		}
+	}
+	srv.mu.Unlock()
+
+	c.respond(req, idBrowseNextResponse, func(w *Buffer) {
+		Array(w, results, func(res browseRes) {
+			browseResult(w, res.status, res.continuation, res.refs)
+		})
+		w.Int32(0) // diagnostics
+	})
+}
+
+func (srv *Server) translateBrowsePaths(c *conn, req *request) {
+	r := req.r
+
+	type element struct {
+		refType  NodeID
+		inverse  bool
+		subtypes bool
+		name     QualifiedName
+	}
+	type path struct {
+		start    NodeID
+		elements []element
+	}
+
+	paths := ReadArray(r, func() path {
+		return path{
+			start: r.NodeID(),
+			elements: ReadArray(r, func() element {
+				return element{r.NodeID(), r.Bool(), r.Bool(), r.QualifiedName()}
+			}),
+		}
+	})
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	type result struct {
+		status  StatusCode
+		targets []NodeID
+	}
+	results := make([]result, 0, len(paths))
+
+	for _, p := range paths {
+		if !srv.Exists(p.start) {
+			results = append(results, result{status: StatusBadNodeIDUnknown})
+			continue
+		}
+
+		current := []NodeID{p.start}
+		for _, e := range p.elements {
+			direction := uint32(BrowseForward)
+			if e.inverse {
+				direction = BrowseInverse
+			}
+
+			var next []NodeID
+			for _, id := range current {
+				refs, _ := srv.Browse(id, direction, e.refType, e.subtypes, 0)
+				for _, ref := range refs {
+					if ref.BrowseName == e.name {
+						next = append(next, ref.Target)
+					}
+				}
+			}
+			current = next
+		}
+
+		if len(current) == 0 || len(p.elements) == 0 {
+			results = append(results, result{status: StatusBadNoMatch})
+			continue
+		}
+		results = append(results, result{targets: current})
+	}
+
+	c.respond(req, idTranslateBrowsePathsResponse, func(w *Buffer) {
+		Array(w, results, func(res result) {
+			w.Uint32(uint32(res.status))
+			Array(w, res.targets, func(id NodeID) {
+				w.ExpandedNodeID(id)
+				w.Uint32(0xffffffff) // remaining path index
+			})
+		})
+		w.Int32(0) // diagnostics
+	})
+}
+
+// readValueID identifies a node attribute
+type readValueID struct {
+	node NodeID
+	attr uint32
+}
+
+func decodeReadValueID(r *Reader) readValueID {
+	v := readValueID{node: r.NodeID(), attr: r.Uint32()}
+	r.Str()           // index range
+	r.QualifiedName() // data encoding
+	return v
+}
+
+// timestamps applies the requested timestamps to a value
+func timestamps(v DataValue, attr uint32, ts uint32) DataValue {
+	if attr != AttrValue {
+		return v
+	}
+	if ts == 1 || ts == 3 {
+		v.SourceTimestamp = time.Time{}
+	}
+	if ts == 1 || ts == 2 {
+		v.ServerTimestamp = time.Now()
+	} else {
+		v.ServerTimestamp = time.Time{}
+	}
+	return v
+}
+
+func (srv *Server) read(c *conn, req *request) {
+	r := req.r
+	r.Double() // max age
+	ts := r.Uint32()
+	nodes := ReadArray(r, func() readValueID { return decodeReadValueID(r) })
+
+	switch {
+	case r.Err() != nil:
+		c.fault(req, StatusBadDecodingError)
+		return
+	case ts > 3:
+		c.fault(req, StatusBadTimestampsToReturnInvalid)
+		return
+	case len(nodes) == 0:
+		c.fault(req, StatusBadNothingToDo)
+		return
+	}
+
+	results := make([]DataValue, 0, len(nodes))
+	for _, n := range nodes {
+		results = append(results, timestamps(srv.Attribute(n.node, n.attr), n.attr, ts))
+	}
+
+	c.respond(req, idReadResponse, func(w *Buffer) {
+		Array(w, results, w.DataValue)
+		w.Int32(0) // diagnostics
+	})
+}
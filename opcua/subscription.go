@@ -0,0 +1,418 @@
+package opcua
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	minPublishingInterval = 100 * time.Millisecond
+	maxPublishingInterval = time.Hour
+	monitoringReporting   = 2
+)
+
+// subscription periodically reports changed values of its monitored items
+type subscription struct {
+	id               uint32
+	interval         time.Duration
+	keepAlive        uint32 // publishing intervals without notifications before sending a keep-alive
+	lifetime         uint32 // publishing intervals without publish requests before deletion
+	maxNotifications uint32
+	enabled          bool
+
+	items      map[uint32]*monitoredItem
+	seq        uint32 // sequence number of the last notification message
+	keepAlives uint32 // intervals since last message
+	lifetimes  uint32 // intervals without publish request
+
+	once sync.Once
+	done chan struct{}
+}
+
+// monitoredItem monitors a node attribute
+type monitoredItem struct {
+	id, handle uint32
+	node       NodeID
+	attr       uint32
+	ts         uint32 // timestamps to return
+	mode       uint32
+	last       *DataValue
+}
+
+// notification is a monitored item's changed value
+type notification struct {
+	handle uint32
+	value  DataValue
+}
+
+func (sub *subscription) stop() {
+	sub.once.Do(func() { close(sub.done) })
+}
+
+// changed compares value and status as for the default StatusValue data change trigger
+func changed(a, b DataValue) bool {
+	if a.Status != b.Status {
+		return true
+	}
+	if av, ok := a.Value.([]string); ok {
+		bv, ok := b.Value.([]string)
+		return !ok || !slices.Equal(av, bv)
+	}
+	if av, ok := a.Value.(ExtensionObject); ok {
+		bv, ok := b.Value.(ExtensionObject)
+		return !ok || av.TypeID != bv.TypeID || string(av.Body) != string(bv.Body)
+	}
+	if _, ok := b.Value.([]string); ok {
+		return true
+	}
+	if _, ok := b.Value.(ExtensionObject); ok {
+		return true
+	}
+	return a.Value != b.Value
+}
+
+// run publishes notifications in each publishing interval until stopped
+func (sub *subscription) run(srv *Server, s *session) {
+	ticker := time.NewTicker(sub.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sub.done:
+			return
+		case <-ticker.C:
+			srv.mu.Lock()
+			p, send := sub.tick(srv, s)
+			srv.mu.Unlock()
+
+			if send != nil {
+				p.conn.respond(p.req, idPublishResponse, send)
+			}
+		}
+	}
+}
+
+// tick evaluates a publishing interval returning the publish response if a message is due.
+// Must be called with server lock held.
+func (sub *subscription) tick(srv *Server, s *session) (pendingPublish, func(*Buffer)) {
+	select {
+	case <-sub.done:
+		return pendingPublish{}, nil
+	default:
+	}
+
+	if len(s.publish) == 0 {
+		// notifications are kept until a publish request is available
+		if sub.lifetimes++; sub.lifetimes >= sub.lifetime {
+			log.Debug("subscription expired", "subscription", sub.id)
+			sub.stop()
+			delete(s.subs, sub.id)
+		}
+		return pendingPublish{}, nil
+	}
+	sub.lifetimes = 0
+
+	var notifications []notification
+	more := false
+
+	if sub.enabled {
+		for _, id := range sortedKeys(sub.items) {
+			item := sub.items[id]
+			if item.mode != monitoringReporting {
+				continue
+			}
+
+			v := timestamps(srv.Attribute(item.node, item.attr), item.attr, item.ts)
+			if item.last != nil && !changed(v, *item.last) {
+				continue
+			}
+
+			if sub.maxNotifications > 0 && uint32(len(notifications)) >= sub.maxNotifications {
+				more = true
+				break
+			}
+
+			item.last = &v
+			notifications = append(notifications, notification{item.handle, v})
+		}
+	}
+
+	sub.keepAlives++
+	if len(notifications) == 0 && sub.keepAlives < sub.keepAlive {
+		return pendingPublish{}, nil
+	}
+	sub.keepAlives = 0
+
+	// keep-alive messages carry the next sequence number without consuming it
+	seq := sub.seq + 1
+	if len(notifications) > 0 {
+		sub.seq = seq
+	}
+
+	p := s.publish[0]
+	s.publish = s.publish[1:]
+
+	return p, func(w *Buffer) {
+		w.Uint32(sub.id)
+		w.Int32(0) // available sequence numbers, republishing is not supported
+		w.Bool(more)
+
+		w.Uint32(seq)
+		w.DateTime(time.Now())
+		if len(notifications) == 0 {
+			w.Int32(0)
+		} else {
+			var b Buffer
+			Array(&b, notifications, func(n notification) {
+				b.Uint32(n.handle)
+				b.DataValue(n.value)
+			})
+			b.Int32(0) // diagnostics
+
+			w.Int32(1)
+			w.ExtensionObject(ExtensionObject{TypeID: NewNumericNodeID(0, idDataChangeNotification), Body: b.Bytes()})
+		}
+
+		Array(w, p.acks, func(status StatusCode) {
+			w.Uint32(uint32(status))
+		})
+		w.Int32(0) // diagnostics
+	}
+}
+
+func sortedKeys[T any](m map[uint32]T) []uint32 {
+	keys := make([]uint32, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (srv *Server) createSubscription(c *conn, req *request, s *session) {
+	r := req.r
+	interval := time.Duration(r.Double() * float64(time.Millisecond))
+	lifetime := r.Uint32()
+	keepAlive := r.Uint32()
+	maxNotifications := r.Uint32()
+	enabled := r.Bool()
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+	interval = min(max(interval, minPublishingInterval), maxPublishingInterval)
+	keepAlive = min(max(keepAlive, 1), 1000)
+	lifetime = max(lifetime, 3*keepAlive)
+
+	sub := &subscription{
+		interval:         interval,
+		keepAlive:        keepAlive,
+		lifetime:         lifetime,
+		maxNotifications: maxNotifications,
+		enabled:          enabled,
+		items:            make(map[uint32]*monitoredItem),
+		keepAlives:       keepAlive, // first interval sends a keep-alive
+		done:             make(chan struct{}),
+	}
+
+	srv.mu.Lock()
+	sub.id = srv.nextID()
+	s.subs[sub.id] = sub
+	srv.mu.Unlock()
+
+	go sub.run(srv, s)
+
+	c.respond(req, idCreateSubscriptionResponse, func(w *Buffer) {
+		w.Uint32(sub.id)
+		w.Double(float64(interval) / float64(time.Millisecond))
+		w.Uint32(lifetime)
+		w.Uint32(keepAlive)
+	})
+}
+
+func (srv *Server) deleteSubscriptions(c *conn, req *request, s *session) {
+	ids := ReadArray(req.r, req.r.Uint32)
+	if req.r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	results := make([]StatusCode, 0, len(ids))
+
+	srv.mu.Lock()
+	for _, id := range ids {
+		sub, ok := s.subs[id]
+		if !ok {
+			results = append(results, StatusBadSubscriptionIDInvalid)
+			continue
+		}
+		sub.stop()
+		delete(s.subs, id)
+		results = append(results, StatusGood)
+	}
+	srv.mu.Unlock()
+
+	c.respond(req, idDeleteSubscriptionsResponse, func(w *Buffer) {
+		Array(w, results, func(status StatusCode) {
+			w.Uint32(uint32(status))
+		})
+		w.Int32(0) // diagnostics
+	})
+}
+
+func (srv *Server) createMonitoredItems(c *conn, req *request, s *session) {
+	r := req.r
+	subID := r.Uint32()
+	ts := r.Uint32()
+
+	items := ReadArray(r, func() *monitoredItem {
+		rv := decodeReadValueID(r)
+		item := &monitoredItem{node: rv.node, attr: rv.attr, ts: ts, mode: r.Uint32()}
+		item.handle = r.Uint32()
+		r.Double()          // sampling interval
+		r.ExtensionObject() // filter
+		r.Uint32()          // queue size
+		r.Bool()            // discard oldest
+		return item
+	})
+
+	switch {
+	case r.Err() != nil:
+		c.fault(req, StatusBadDecodingError)
+		return
+	case ts > 3:
+		c.fault(req, StatusBadTimestampsToReturnInvalid)
+		return
+	case len(items) == 0:
+		c.fault(req, StatusBadNothingToDo)
+		return
+	}
+
+	type result struct {
+		status   StatusCode
+		id       uint32
+		interval float64
+	}
+	results := make([]result, 0, len(items))
+
+	srv.mu.Lock()
+	sub, ok := s.subs[subID]
+	if ok {
+		for _, item := range items {
+			if status := srv.Attribute(item.node, item.attr).Status; status == StatusBadNodeIDUnknown || status == StatusBadAttributeIDInvalid {
+				results = append(results, result{status: status})
+				continue
+			}
+
+			item.id = srv.nextID()
+			sub.items[item.id] = item
+			results = append(results, result{id: item.id, interval: float64(sub.interval) / float64(time.Millisecond)})
+		}
+	}
+	srv.mu.Unlock()
+
+	if !ok {
+		c.fault(req, StatusBadSubscriptionIDInvalid)
+		return
+	}
+
+	c.respond(req, idCreateMonitoredItemsResponse, func(w *Buffer) {
+		Array(w, results, func(res result) {
+			w.Uint32(uint32(res.status))
+			w.Uint32(res.id)
+			w.Double(res.interval)
+			w.Uint32(1) // queue size
+			w.ExtensionObject(ExtensionObject{})
+		})
+		w.Int32(0) // diagnostics
+	})
+}
+
+func (srv *Server) deleteMonitoredItems(c *conn, req *request, s *session) {
+	r := req.r
+	subID := r.Uint32()
+	ids := ReadArray(r, r.Uint32)
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	results := make([]StatusCode, 0, len(ids))
+
+	srv.mu.Lock()
+	sub, ok := s.subs[subID]
+	if ok {
+		for _, id := range ids {
+			if _, ok := sub.items[id]; !ok {
+				results = append(results, StatusBadMonitoredItemIDInvalid)
+				continue
+			}
+			delete(sub.items, id)
+			results = append(results, StatusGood)
+		}
+	}
+	srv.mu.Unlock()
+
+	if !ok {
+		c.fault(req, StatusBadSubscriptionIDInvalid)
+		return
+	}
+
+	c.respond(req, idDeleteMonitoredItemsResponse, func(w *Buffer) {
+		Array(w, results, func(status StatusCode) {
+			w.Uint32(uint32(status))
+		})
+		w.Int32(0) // diagnostics
+	})
+}
+
+// publish queues the publish request for the session's subscriptions
+func (srv *Server) publish(c *conn, req *request, s *session) {
+	r := req.r
+	acks := ReadArray(r, func() uint32 {
+		id := r.Uint32()
+		r.Uint32() // sequence number
+		return id
+	})
+
+	if r.Err() != nil {
+		c.fault(req, StatusBadDecodingError)
+		return
+	}
+
+	srv.mu.Lock()
+	if len(s.subs) == 0 {
+		srv.mu.Unlock()
+		c.fault(req, StatusBadNoSubscription)
+		return
+	}
+
+	// messages are not retained for republishing
+	results := make([]StatusCode, 0, len(acks))
+	for _, id := range acks {
+		if _, ok := s.subs[id]; ok {
+			results = append(results, StatusGood)
+		} else {
+			results = append(results, StatusBadSubscriptionIDInvalid)
+		}
+	}
+
+	var dropped *pendingPublish
+	if len(s.publish) >= maxPublishRequests {
+		dropped = &s.publish[0]
+		s.publish = s.publish[1:]
+	}
+	s.publish = append(s.publish, pendingPublish{conn: c, req: req, acks: results})
+	srv.mu.Unlock()
+
+	if dropped != nil {
+		dropped.conn.fault(dropped.req, StatusBadTooManyPublishRequests)
+	}
+}
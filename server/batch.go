@@ -0,0 +1,143 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// batchWindow is the time for collecting a device's readings into a single batch
+const batchWindow = 250 * time.Millisecond
+
+// DeviceBatch holds a device's readings of a single query cycle
+type DeviceBatch struct {
+	Device    string
+	Timestamp time.Time // latest reading's timestamp
+	Values    map[meters.Measurement]float64
+	Quality   map[meters.Measurement]Quality // implausible values
+	started   time.Time
+}
+
+// batcher collects readings per device. A batch is completed once the batch
+// window has elapsed or a measurement repeats, indicating the next query cycle.
+type batcher struct {
+	window  time.Duration
+	publish func(*DeviceBatch)
+	batches map[string]*DeviceBatch
+}
+
+func newBatcher(window time.Duration, publish func(*DeviceBatch)) *batcher {
+	return &batcher{
+		window:  window,
+		publish: publish,
+		batches: make(map[string]*DeviceBatch),
+	}
+}
+
+// add adds a reading to the device's batch
+func (b *batcher) add(snip QuerySnip) {
+	batch, ok := b.batches[snip.Device]
+	if ok {
+		if _, ok := batch.Values[snip.Measurement]; ok {
+			b.flush(snip.Device)
+			batch = nil
+		}
+	}
+
+	if batch == nil {
+		batch = &DeviceBatch{
+			Device:  snip.Device,
+			Values:  make(map[meters.Measurement]float64),
+			started: time.Now(),
+		}
+		b.batches[snip.Device] = batch
+	}
+
+	batch.Values[snip.Measurement] = snip.Value
+	if snip.Quality != QualityGood {
+		if batch.Quality == nil {
+			batch.Quality = make(map[meters.Measurement]Quality)
+		}
+		batch.Quality[snip.Measurement] = snip.Quality
+	}
+
+	if snip.Timestamp.After(batch.Timestamp) {
+		batch.Timestamp = snip.Timestamp
+	}
+}
+
+func (b *batcher) flush(device string) {
+	b.publish(b.batches[device])
+	delete(b.batches, device)
+}
+
+// flushExpired publishes all batches older than the batch window
+func (b *batcher) flushExpired() {
+	for device, batch := range b.batches {
+		if time.Since(batch.started) >= b.window {
+			b.flush(device)
+		}
+	}
+}
+
+// flushAll publishes all pending batches
+func (b *batcher) flushAll() {
+	for device := range b.batches {
+		b.flush(device)
+	}
+}
+
+// run batches the input until the channel is closed. Readings are batched if the optional filter returns true.
+func (b *batcher) run(in <-chan QuerySnip, filter func(QuerySnip) bool) {
+	ticker := time.NewTicker(b.window / 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case snip, ok := <-in:
+			if !ok {
+				b.flushAll()
+				return
+			}
+
+			if filter == nil || filter(snip) {
+				b.add(snip)
+			}
+
+		case <-ticker.C:
+			b.flushExpired()
+		}
+	}
+}
+
+// groupBatches groups readings into batches of a single device and query cycle each
+func groupBatches(snips []QuerySnip) []*DeviceBatch {
+	var res []*DeviceBatch
+
+	b := newBatcher(0, func(batch *DeviceBatch) {
+		res = append(res, batch)
+	})
+
+	for _, snip := range snips {
+		b.add(snip)
+	}
+	b.flushAll()
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Timestamp.Before(res[j].Timestamp)
+	})
+
+	return res
+}
+
+// goodSnips returns the readings of good quality
+func goodSnips(snips []QuerySnip) []QuerySnip {
+	res := make([]QuerySnip, 0, len(snips))
+	for _, snip := range snips {
+		if snip.Quality == QualityGood {
+			res = append(res, snip)
+		}
+	}
+	return res
+}
@@ -1,15 +1,249 @@
 package server
 
 import (
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
-// Broadcaster acts as hub for broadcating snips to multiple recipients
+// DefaultQueueSize is the default number of messages queued per recipient
+const DefaultQueueSize = 1000
+
+// OverflowPolicy describes how a recipient's queue handles overflow
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait for the recipient, back-pressuring the sender
+	OverflowDropOldest                       // discard the oldest queued message
+	OverflowDropNewest                       // discard the incoming message
+	OverflowCoalesce                         // replace queued message of same device and measurement, else discard oldest
+)
+
+// OverflowPolicyString parses overflow policy names dropoldest, dropnewest, coalesce and block
+func OverflowPolicyString(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "dropoldest":
+		return OverflowDropOldest, nil
+	case "dropnewest":
+		return OverflowDropNewest, nil
+	case "coalesce":
+		return OverflowCoalesce, nil
+	default:
+		return 0, fmt.Errorf("invalid overflow policy: %s", s)
+	}
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "dropoldest"
+	case OverflowDropNewest:
+		return "dropnewest"
+	case OverflowCoalesce:
+		return "coalesce"
+	default:
+		return "block"
+	}
+}
+
+// QueueOptions describes a recipient's queue
+type QueueOptions struct {
+	Size   int            // maximum number of queued messages
+	Policy OverflowPolicy // lossless blocking unless dropping is opted into
+}
+
+// QueueStatus represents a recipient's queue status
+type QueueStatus struct {
+	Recipient string
+	Policy    string
+	Size      int
+	Queued    int     // pending messages
+	MaxQueued int     // highest number of pending messages
+	Lag       float64 // age of oldest pending message in seconds
+	Delivered uint64
+	Dropped   uint64
+	Coalesced uint64 // messages replaced by newer readings
+}
+
+// QueueInfo provides the queue status of a broadcaster's recipients
+type QueueInfo interface {
+	QueueStatus() []QueueStatus
+}
+
+type queueItem struct {
+	value    interface{}
+	key      string
+	seq      uint64
+	enqueued time.Time
+}
+
+// recipient decouples a consumer from the broadcaster using a bounded queue
+type recipient struct {
+	QueueOptions
+	name string
+	out  chan interface{}
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	items    []queueItem
+	keys     map[string]uint64 // sequence number of queued message per coalescing key
+	seq      uint64
+	closed   bool
+	maxQueue int
+
+	delivered, dropped, coalesced uint64
+}
+
+func newRecipient(name string, opts QueueOptions) *recipient {
+	if opts.Size < 1 {
+		opts.Size = 1
+	}
+
+	r := &recipient{
+		QueueOptions: opts,
+		name:         name,
+		out:          make(chan interface{}),
+		keys:         make(map[string]uint64),
+	}
+	r.cond = sync.NewCond(&r.mu)
+
+	return r
+}
+
+// coalesceKey identifies messages superseding each other
+func coalesceKey(v interface{}) string {
+	switch s := v.(type) {
+	case QuerySnip:
+		return s.Device + "/" + s.Measurement.String()
+	case ControlSnip:
+		return s.Device
+	default:
+		return ""
+	}
+}
+
+// pop removes the oldest message. Must be called with lock held.
+func (r *recipient) pop() queueItem {
+	item := r.items[0]
+	r.items[0] = queueItem{}
+	r.items = r.items[1:]
+
+	if item.key != "" && r.keys[item.key] == item.seq {
+		delete(r.keys, item.key)
+	}
+
+	return item
+}
+
+// push queues a message applying the overflow policy
+func (r *recipient) push(v interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var key string
+	if r.Policy == OverflowCoalesce {
+		key = coalesceKey(v)
+
+		if seq, ok := r.keys[key]; ok && key != "" {
+			// replace in place to retain order of devices and measurements
+			first := r.items[0].seq
+			r.items[seq-first].value = v
+			r.coalesced++
+			return
+		}
+	}
+
+	for len(r.items) >= r.Size {
+		switch r.Policy {
+		case OverflowBlock:
+			r.cond.Wait()
+			continue
+		case OverflowDropNewest:
+			r.dropped++
+			return
+		default:
+			r.pop()
+			r.dropped++
+		}
+	}
+
+	r.seq++
+	r.items = append(r.items, queueItem{value: v, key: key, seq: r.seq, enqueued: time.Now()})
+	if key != "" {
+		r.keys[key] = r.seq
+	}
+
+	r.maxQueue = max(r.maxQueue, len(r.items))
+	r.cond.Broadcast()
+}
+
+// close stops the recipient once all queued messages are delivered
+func (r *recipient) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+}
+
+// run delivers queued messages to the consumer
+func (r *recipient) run() {
+	for {
+		r.mu.Lock()
+		for len(r.items) == 0 && !r.closed {
+			r.cond.Wait()
+		}
+
+		if len(r.items) == 0 {
+			r.mu.Unlock()
+			close(r.out)
+			return
+		}
+
+		item := r.pop()
+		r.cond.Broadcast()
+		r.mu.Unlock()
+
+		r.out <- item.value
+
+		r.mu.Lock()
+		r.delivered++
+		r.mu.Unlock()
+	}
+}
+
+func (r *recipient) status() QueueStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lag float64
+	if len(r.items) > 0 {
+		lag = time.Since(r.items[0].enqueued).Seconds()
+	}
+
+	return QueueStatus{
+		Recipient: r.name,
+		Policy:    r.Policy.String(),
+		Size:      r.Size,
+		Queued:    len(r.items),
+		MaxQueued: r.maxQueue,
+		Lag:       lag,
+		Delivered: r.delivered,
+		Dropped:   r.dropped,
+		Coalesced: r.coalesced,
+	}
+}
+
+// Broadcaster acts as hub for broadcating snips to multiple recipients.
+// Each recipient is decoupled by a bounded queue, so slow recipients
+// do not delay the sender unless using the block overflow policy.
 type Broadcaster struct {
 	sync.Mutex // guard recipients
 	wg         sync.WaitGroup
 	in         <-chan interface{}
-	recipients []chan<- interface{}
+	recipients []*recipient
 	done       chan struct{}
 }
 
@@ -18,7 +252,7 @@ type Broadcaster struct {
 func NewBroadcaster(in <-chan interface{}) *Broadcaster {
 	return &Broadcaster{
 		in:         in,
-		recipients: make([]chan<- interface{}, 0),
+		recipients: make([]*recipient, 0),
 		done:       make(chan struct{}),
 	}
 }
@@ -27,10 +261,12 @@ func NewBroadcaster(in <-chan interface{}) *Broadcaster {
 func (b *Broadcaster) Run() {
 	for s := range b.in {
 		b.Lock()
-		for _, recipient := range b.recipients {
-			recipient <- s
-		}
+		recipients := b.recipients
 		b.Unlock()
+
+		for _, recipient := range recipients {
+			recipient.push(s)
+		}
 	}
 	b.stop()
 }
@@ -45,29 +281,55 @@ func (b *Broadcaster) stop() {
 	b.Lock()
 	defer b.Unlock()
 	for _, recipient := range b.recipients {
-		close(recipient)
+		recipient.close()
 	}
 	b.wg.Wait()
 	close(b.done)
 }
 
-// Attach creates and attaches a channel to the broadcaster
+// QueueStatus implements QueueInfo interface
+func (b *Broadcaster) QueueStatus() []QueueStatus {
+	b.Lock()
+	recipients := b.recipients
+	b.Unlock()
+
+	res := make([]QueueStatus, 0, len(recipients))
+	for _, r := range recipients {
+		res = append(res, r.status())
+	}
+
+	return res
+}
+
+// Attach creates and attaches a channel to the broadcaster using the default queue options
 func (b *Broadcaster) Attach() <-chan interface{} {
-	channel := make(chan interface{})
+	return b.AttachQueue("", QueueOptions{Size: DefaultQueueSize})
+}
+
+// AttachQueue creates and attaches a named channel to the broadcaster
+func (b *Broadcaster) AttachQueue(name string, opts QueueOptions) <-chan interface{} {
+	r := newRecipient(name, opts)
+	go r.run()
 
 	b.Lock()
-	b.recipients = append(b.recipients, channel)
+	b.recipients = append(b.recipients, r)
 	b.Unlock()
 
-	return channel
+	return r.out
 }
 
 // AttachRunner attaches a Run method as broadcast receiver and adds it
 // to the waitgroup
 func (b *Broadcaster) AttachRunner(runner func(<-chan interface{})) {
+	b.AttachQueuedRunner("", QueueOptions{Size: DefaultQueueSize}, runner)
+}
+
+// AttachQueuedRunner attaches a Run method as named broadcast receiver
+// using the given queue options and adds it to the waitgroup
+func (b *Broadcaster) AttachQueuedRunner(name string, opts QueueOptions, runner func(<-chan interface{})) {
 	b.wg.Add(1)
+	ch := b.AttachQueue(name, opts)
 	go func() {
-		ch := b.Attach()
 		runner(ch)
 		b.wg.Done()
 	}()
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func snip(device string, m meters.Measurement, v float64) QuerySnip {
+	return QuerySnip{
+		Device:            device,
+		MeasurementResult: result(m, v, time.Now()),
+	}
+}
+
+func values(r *recipient) []float64 {
+	var res []float64
+	for len(r.items) > 0 {
+		res = append(res, r.pop().value.(QuerySnip).Value)
+	}
+	return res
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	tc := []struct {
+		policy  OverflowPolicy
+		values  []float64
+		dropped uint64
+	}{
+		{OverflowDropOldest, []float64{3, 4, 5}, 2},
+		{OverflowDropNewest, []float64{1, 2, 3}, 2},
+		{OverflowCoalesce, []float64{5}, 0},
+	}
+
+	for _, tc := range tc {
+		r := newRecipient("test", QueueOptions{Size: 3, Policy: tc.policy})
+		for i := 1; i <= 5; i++ {
+			r.push(snip("dev", meters.Power, float64(i)))
+		}
+
+		if s := r.status(); s.Dropped != tc.dropped || s.Policy != tc.policy.String() {
+			t.Errorf("%s: unexpected status %+v", tc.policy, s)
+		}
+
+		if v := values(r); len(v) != len(tc.values) || v[0] != tc.values[0] || v[len(v)-1] != tc.values[len(tc.values)-1] {
+			t.Errorf("%s: expected %v, got %v", tc.policy, tc.values, v)
+		}
+	}
+}
+
+func TestOverflowCoalesceOrder(t *testing.T) {
+	r := newRecipient("test", QueueOptions{Size: 2, Policy: OverflowCoalesce})
+
+	r.push(snip("a", meters.Power, 1))
+	r.push(snip("b", meters.Power, 2))
+	r.push(snip("a", meters.Power, 3))
+
+	// replaced in place
+	if v := values(r); len(v) != 2 || v[0] != 3 || v[1] != 2 {
+		t.Errorf("unexpected values %v", v)
+	}
+
+	r.push(snip("a", meters.Power, 1))
+	r.push(snip("b", meters.Power, 2))
+	r.push(snip("c", meters.Power, 3))
+
+	// new key drops oldest
+	if v := values(r); len(v) != 2 || v[0] != 2 || v[1] != 3 {
+		t.Errorf("unexpected values %v", v)
+	}
+
+	if s := r.status(); s.Dropped != 1 || s.Coalesced != 1 || s.MaxQueued != 2 {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
+
+func TestBroadcasterSlowRecipient(t *testing.T) {
+	in := make(chan interface{})
+	b := NewBroadcaster(in)
+
+	// stalled recipient
+	stall := make(chan struct{})
+	b.AttachQueuedRunner("slow", QueueOptions{Size: 2, Policy: OverflowDropOldest}, func(c <-chan interface{}) {
+		<-stall
+		for range c {
+		}
+	})
+
+	var received int
+	b.AttachQueuedRunner("fast", QueueOptions{Size: 2, Policy: OverflowBlock}, func(c <-chan interface{}) {
+		for range c {
+			received++
+		}
+	})
+
+	go b.Run()
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			in <- snip("dev", meters.Power, float64(i))
+		}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("sender blocked by stalled recipient")
+	}
+
+	status := b.QueueStatus()
+	if s := status[0]; s.Recipient != "slow" || s.Dropped < 95 || s.Queued != 2 || s.Lag <= 0 {
+		t.Errorf("unexpected status %+v", s)
+	}
+
+	close(stall)
+	close(in)
+	<-b.Done()
+
+	if received != 100 {
+		t.Errorf("expected 100 readings, got %d", received)
+	}
+}
+
+func TestOverflowPolicyDefault(t *testing.T) {
+	var opt QueueOptions
+	if opt.Policy != OverflowBlock {
+		t.Errorf("expected default policy block, got %s", opt.Policy)
+	}
+
+	if p, err := OverflowPolicyString(""); err != nil || p != OverflowBlock {
+		t.Errorf("expected empty policy to parse as block, got %s: %v", p, err)
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// latencyBuckets are the upper bounds of the request latency histogram
+var latencyBuckets = [...]time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Histogram counts request latencies by bucket. It is a value type and safe to copy.
+type Histogram struct {
+	Count   uint64
+	Sum     time.Duration
+	Max     time.Duration
+	buckets [len(latencyBuckets) + 1]uint64
+}
+
+// Observe adds a latency sample
+func (h *Histogram) Observe(d time.Duration) {
+	h.Count++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.buckets[i]++
+}
+
+// Mean returns the average latency
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// MarshalJSON exports latencies in milliseconds and non-cumulative bucket counts
+func (h Histogram) MarshalJSON() ([]byte, error) {
+	buckets := make(kvslice, 0, len(h.buckets))
+	for i, count := range h.buckets {
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = latencyBuckets[i].String()
+		}
+		buckets = append(buckets, kv{le, count})
+	}
+
+	return json.Marshal(kvslice{
+		{"Count", h.Count},
+		{"MeanMs", float64(h.Mean()) / float64(time.Millisecond)},
+		{"MaxMs", float64(h.Max) / float64(time.Millisecond)},
+		{"Buckets", buckets},
+	})
+}
+
+// ErrorClass classifies bus errors
+type ErrorClass int
+
+const (
+	ErrorNone      ErrorClass = iota
+	ErrorTimeout              // no response within timeout
+	ErrorException            // device responded with modbus exception
+	ErrorCRC                  // corrupted frame, e.g. crc or lrc mismatch
+	ErrorOther                // connection or protocol errors
+)
+
+// classifyError determines the error's class
+func classifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorNone
+	}
+
+	var mbErr *modbus.Error
+	if errors.As(err, &mbErr) {
+		return ErrorException
+	}
+
+	var netErr net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorTimeout
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out"):
+		return ErrorTimeout
+	case strings.Contains(msg, " crc ") || strings.Contains(msg, " lrc "):
+		return ErrorCRC
+	}
+
+	return ErrorOther
+}
+
+// BusStatus represents bus request latency and classified errors
+type BusStatus struct {
+	Requests   uint64
+	Timeouts   uint64
+	Exceptions uint64
+	CRCErrors  uint64
+	Other      uint64
+	Latency    Histogram
+}
+
+// Observe records a single bus request
+func (b *BusStatus) Observe(d time.Duration, err error) {
+	b.Requests++
+	b.Latency.Observe(d)
+
+	switch classifyError(err) {
+	case ErrorTimeout:
+		b.Timeouts++
+	case ErrorException:
+		b.Exceptions++
+	case ErrorCRC:
+		b.CRCErrors++
+	case ErrorOther:
+		b.Other++
+	}
+}
+
+// AdapterStatus represents a single adapter's bus status
+type AdapterStatus struct {
+	Adapter string
+	BusStatus
+	Scheduler SchedulerStatus
+	Links     []meters.LinkState `json:",omitempty"` // connection state of serial and TCP adapters, one per connection
+}
+
+// AdapterInfo returns the bus status of all adapters
+type AdapterInfo interface {
+	AdapterStatus() []AdapterStatus
+}
+
+// busMetrics collects adapter bus status, shared between handler and status api
+type busMetrics struct {
+	mu sync.Mutex
+	BusStatus
+}
+
+func (m *busMetrics) observe(d time.Duration, err error) {
+	m.mu.Lock()
+	m.Observe(d, err)
+	m.mu.Unlock()
+}
+
+func (m *busMetrics) status() BusStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.BusStatus
+}
+
+// meteredClient measures each request's latency and error class
+type meteredClient struct {
+	modbus.Client
+	observe func(time.Duration, error)
+}
+
+func (c *meteredClient) measure(f func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	b, err := f()
+	c.observe(time.Since(start), err)
+	return b, err
+}
+
+func (c *meteredClient) ReadCoils(address, quantity uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.ReadCoils(address, quantity) })
+}
+
+func (c *meteredClient) ReadDiscreteInputs(address, quantity uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.ReadDiscreteInputs(address, quantity) })
+}
+
+func (c *meteredClient) WriteSingleCoil(address, value uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.WriteSingleCoil(address, value) })
+}
+
+func (c *meteredClient) WriteMultipleCoils(address, quantity uint16, value []byte) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.WriteMultipleCoils(address, quantity, value) })
+}
+
+func (c *meteredClient) ReadInputRegisters(address, quantity uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.ReadInputRegisters(address, quantity) })
+}
+
+func (c *meteredClient) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.ReadHoldingRegisters(address, quantity) })
+}
+
+func (c *meteredClient) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.WriteSingleRegister(address, value) })
+}
+
+func (c *meteredClient) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.WriteMultipleRegisters(address, quantity, value) })
+}
+
+func (c *meteredClient) ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) ([]byte, error) {
+	return c.measure(func() ([]byte, error) {
+		return c.Client.ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity, value)
+	})
+}
+
+func (c *meteredClient) MaskWriteRegister(address, andMask, orMask uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.MaskWriteRegister(address, andMask, orMask) })
+}
+
+func (c *meteredClient) ReadFIFOQueue(address uint16) ([]byte, error) {
+	return c.measure(func() ([]byte, error) { return c.Client.ReadFIFOQueue(address) })
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/grid-x/modbus"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		class ErrorClass
+	}{
+		{nil, ErrorNone},
+		{&modbus.Error{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}, ErrorException},
+		{fmt.Errorf("read: %w", os.ErrDeadlineExceeded), ErrorTimeout},
+		{errors.New("serial: timeout"), ErrorTimeout},
+		{errors.New("modbus: response crc '1234' does not match expected '4321'"), ErrorCRC},
+		{errors.New("connection refused"), ErrorOther},
+	} {
+		if class := classifyError(tc.err); class != tc.class {
+			t.Errorf("%v: expected class %d, got %d", tc.err, tc.class, class)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	h.Observe(3 * time.Millisecond)
+	h.Observe(30 * time.Millisecond)
+	h.Observe(time.Minute)
+
+	if h.Count != 3 || h.Max != time.Minute {
+		t.Errorf("unexpected histogram %+v", h)
+	}
+	if h.buckets[0] != 1 || h.buckets[3] != 1 || h.buckets[len(latencyBuckets)] != 1 {
+		t.Errorf("unexpected buckets %v", h.buckets)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &RuntimeInfo{Online: true, maxBackoff: 3 * time.Second}
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		r.Available(false)
+		if r.Backoff() != expected {
+			t.Errorf("expected backoff %v, got %v", expected, r.Backoff())
+		}
+	}
+
+	if queryable, _ := r.IsQueryable(); queryable {
+		t.Error("expected device not to be queryable during backoff")
+	}
+
+	r.Available(true)
+	if r.Backoff() != 0 {
+		t.Errorf("expected backoff reset, got %v", r.Backoff())
+	}
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"sync"
 	"time"
@@ -45,6 +44,11 @@ func NewCache(maxAge time.Duration, status *Status, verbose bool) *Cache {
 // Run consumes meter readings into snip cache
 func (mc *Cache) Run(in <-chan QuerySnip) {
 	for snip := range in {
+		// readings carry no quality flag, only plausible readings are cached
+		if snip.Quality != QualityGood {
+			continue
+		}
+
 		uniqueID := snip.Device
 
 		// Search corresponding meter
@@ -60,7 +64,7 @@ func (mc *Cache) Run(in <-chan QuerySnip) {
 		if mc.verbose {
 			for _, m := range verboseLoggable {
 				if snip.Measurement == m {
-					log.Printf("device %s %s", uniqueID, readings.Current.String())
+					handlerLog.Info(readings.Current.String(), "device", uniqueID)
 					break
 				}
 			}
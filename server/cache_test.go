@@ -2,6 +2,7 @@ package server
 
 import (
 	"testing"
+	"time"
 
 	"github.com/volkszaehler/mbmd/meters"
 )
@@ -30,3 +31,25 @@ func TestAddDivide(t *testing.T) {
 		t.Error("could not add reading")
 	}
 }
+
+func TestCacheQuality(t *testing.T) {
+	mc := NewCache(time.Minute, nil, false)
+
+	ts := time.Now()
+	in := make(chan QuerySnip, 3)
+	in <- QuerySnip{Device: "SDM1.1", MeasurementResult: meters.MeasurementResult{Measurement: meters.Power, Value: 100, Timestamp: ts}}
+	in <- QuerySnip{Device: "SDM1.1", MeasurementResult: meters.MeasurementResult{Measurement: meters.Power, Value: 3.4e38, Timestamp: ts}, Quality: QualityInvalid}
+	in <- QuerySnip{Device: "SDM1.1", MeasurementResult: meters.MeasurementResult{Measurement: meters.Power, Value: 200, Timestamp: ts}, Quality: QualitySuspicious}
+	close(in)
+
+	mc.Run(in)
+
+	// implausible readings are neither current nor averaged
+	readings := mc.readings["SDM1.1"]
+	if v := readings.Current.Values[meters.Power]; v != 100 {
+		t.Errorf("unexpected current value %v", v)
+	}
+	if v := readings.Average(ts.Add(-time.Minute)).Values[meters.Power]; v != 100 {
+		t.Errorf("unexpected average value %v", v)
+	}
+}
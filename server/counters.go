@@ -0,0 +1,299 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+const (
+	counterSaveInterval = time.Minute // maximum delay of persisting counter values
+	maxCounterEvents    = 1000        // number of discontinuities kept in the audit log
+)
+
+// virtualCounters are the energy counters tracked for continuity and their virtual totals
+var virtualCounters = map[meters.Measurement]meters.Measurement{
+	meters.Import: meters.VirtualImport,
+	meters.Export: meters.VirtualExport,
+	meters.Sum:    meters.VirtualSum,
+}
+
+// CounterEventKind classifies energy counter discontinuities
+type CounterEventKind string
+
+const (
+	CounterReset       CounterEventKind = "reset"       // counter restarted from zero
+	CounterWrap        CounterEventKind = "wrap"        // counter overflowed its register or display range
+	CounterReplacement CounterEventKind = "replacement" // device serial number changed
+	CounterDecrease    CounterEventKind = "decrease"    // counter set to a lower value, e.g. by a replaced device without serial number
+)
+
+// CounterEvent is a detected energy counter discontinuity
+type CounterEvent struct {
+	Time        time.Time
+	Device      string
+	Measurement string
+	Kind        CounterEventKind
+	Previous    float64 // last raw value
+	Value       float64 // raw value after the discontinuity
+	Offset      float64 // offset of the virtual total to the raw value
+	Serial      string  `json:",omitempty"` // new serial number of replaced devices
+}
+
+// CounterState is an energy counter's last raw value and the offset of its virtual total
+type CounterState struct {
+	Device      string
+	Measurement string
+	Value       float64
+	Offset      float64
+	Serial      string `json:",omitempty"`
+	Updated     time.Time
+	violations  int // consecutive decreases considered glitches
+}
+
+// Virtual returns the counter's virtual total
+func (s *CounterState) Virtual() float64 {
+	return s.Value + s.Offset
+}
+
+// counterFile is the persisted counter state
+type counterFile struct {
+	Counters map[string]*CounterState
+	Events   []CounterEvent
+}
+
+// Counters tracks energy counters across resets, wraps and device replacement. Each counter's
+// virtual total continues from its last value. The state is persisted to file if configured.
+type Counters struct {
+	mu       sync.Mutex
+	file     string
+	state    counterFile
+	lastSave time.Time
+}
+
+// NewCounters creates energy counter tracking, restoring the state from file if it exists
+func NewCounters(file string) (*Counters, error) {
+	c := &Counters{
+		file: file,
+		state: counterFile{
+			Counters: make(map[string]*CounterState),
+		},
+	}
+
+	if file == "" {
+		return c, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &c.state)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("counters: %w", err)
+	}
+
+	if c.state.Counters == nil {
+		c.state.Counters = make(map[string]*CounterState)
+	}
+
+	return c, nil
+}
+
+// wrapLimit returns the range a counter decreasing from prev to value has overflowed, if any
+func wrapLimit(prev, value float64) (float64, bool) {
+	if prev <= 0 {
+		return 0, false
+	}
+
+	candidates := []float64{math.Pow(10, math.Ceil(math.Log10(prev)))}
+	for _, scale := range []float64{1, 10, 100, 1000} {
+		candidates = append(candidates, math.Pow(2, 16)/scale, math.Pow(2, 32)/scale)
+	}
+
+	sort.Float64s(candidates)
+
+	for _, limit := range candidates {
+		if limit >= prev && prev >= 0.9*limit && value < 0.1*limit {
+			return limit, true
+		}
+	}
+
+	return 0, false
+}
+
+// Update tracks the device's energy counter reading and returns its virtual total. The device
+// must be identified independently of the adapter configuration's order. Decreases are considered
+// glitches and return false unless they persist. Persistent decreases by more than half of the
+// counter are resets or wraps.
+func (c *Counters) Update(device, serial string, r meters.MeasurementResult) (meters.MeasurementResult, bool) {
+	virtual, ok := virtualCounters[r.Measurement]
+	if !ok || math.IsNaN(r.Value) {
+		return meters.MeasurementResult{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := device + "." + r.Measurement.String()
+	st, ok := c.state.Counters[key]
+
+	if !ok {
+		st = &CounterState{
+			Device:      device,
+			Measurement: r.Measurement.String(),
+			Value:       r.Value,
+			Serial:      serial,
+		}
+		c.state.Counters[key] = st
+	}
+
+	var kind CounterEventKind
+	prev, prevVirtual := st.Value, st.Virtual()
+
+	switch {
+	case serial != "" && st.Serial != "" && serial != st.Serial:
+		// replaced devices continue from the previous total
+		kind = CounterReplacement
+		st.Offset = prevVirtual - r.Value
+	case r.Value >= st.Value:
+	case st.violations+1 < maxViolations:
+		// decreases are considered glitches unless they persist
+		st.violations++
+		return meters.MeasurementResult{}, false
+	case r.Value >= st.Value/2:
+		// persistent decreases continue from the previous total
+		kind = CounterDecrease
+		st.Offset = prevVirtual - r.Value
+	default:
+		if limit, ok := wrapLimit(st.Value, r.Value); ok {
+			kind = CounterWrap
+			st.Offset += limit
+		} else {
+			// energy since the reset is added to the previous total
+			kind = CounterReset
+			st.Offset = prevVirtual
+		}
+	}
+
+	st.Value = r.Value
+	st.Updated = r.Timestamp
+	st.violations = 0
+	if serial != "" {
+		st.Serial = serial
+	}
+
+	if kind != "" {
+		handlerLog.Warn("energy counter discontinuity", "device", device, "measurement", st.Measurement, "kind", kind, "previous", prev, "value", r.Value)
+
+		event := CounterEvent{
+			Time:        r.Timestamp,
+			Device:      device,
+			Measurement: st.Measurement,
+			Kind:        kind,
+			Previous:    prev,
+			Value:       r.Value,
+			Offset:      st.Offset,
+		}
+		if kind == CounterReplacement {
+			event.Serial = serial
+		}
+
+		c.state.Events = append(c.state.Events, event)
+		if len(c.state.Events) > maxCounterEvents {
+			c.state.Events = c.state.Events[len(c.state.Events)-maxCounterEvents:]
+		}
+	}
+
+	if kind != "" || time.Since(c.lastSave) > counterSaveInterval {
+		if err := c.save(); err != nil {
+			handlerLog.Error("saving counters failed", "error", err)
+		}
+	}
+
+	return meters.MeasurementResult{
+		Measurement: virtual,
+		Value:       st.Virtual(),
+		Timestamp:   r.Timestamp,
+	}, true
+}
+
+// Save persists the counters' state
+func (c *Counters) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.save()
+}
+
+// save writes the state atomically. It must be called with the lock held.
+func (c *Counters) save() error {
+	c.lastSave = time.Now()
+
+	if c.file == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.file)
+}
+
+// CounterStatus represents the tracked energy counters and the audit log of their discontinuities
+type CounterStatus struct {
+	Counters []CounterState
+	Events   []CounterEvent
+}
+
+// Status returns the tracked energy counters and detected discontinuities
+func (c *Counters) Status() CounterStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := CounterStatus{
+		Counters: make([]CounterState, 0, len(c.state.Counters)),
+		Events:   append([]CounterEvent{}, c.state.Events...),
+	}
+
+	for _, st := range c.state.Counters {
+		res.Counters = append(res.Counters, *st)
+	}
+
+	sort.Slice(res.Counters, func(i, j int) bool {
+		if res.Counters[i].Device != res.Counters[j].Device {
+			return res.Counters[i].Device < res.Counters[j].Device
+		}
+		return res.Counters[i].Measurement < res.Counters[j].Measurement
+	})
+
+	return res
+}
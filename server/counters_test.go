@@ -0,0 +1,89 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestCounters(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counters.json")
+
+	c, err := NewCounters(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Now()
+	update := func(serial string, m meters.Measurement, value float64) (float64, bool) {
+		ts = ts.Add(time.Second)
+		r, ok := c.Update("garage", serial, meters.MeasurementResult{Measurement: m, Value: value, Timestamp: ts})
+		return r.Value, ok
+	}
+
+	for _, tc := range []struct {
+		serial  string
+		value   float64
+		virtual float64
+		ok      bool
+	}{
+		{"A", 100, 100, true},
+		{"A", 110, 110, true},
+		{"A", 0, 110, false},  // glitch
+		{"A", 111, 111, true}, // continued
+		{"A", 5, 111, false},  // reset pending
+		{"A", 6, 111, false},  // reset pending
+		{"A", 7, 118, true},   // reset
+		{"A", 80, 191, true},
+		{"A", 90, 201, true},
+		{"B", 1000, 201, true},  // replacement
+		{"B", 1010, 211, true},  // replaced device
+		{"B", 999, 211, false},  // glitch
+		{"B", 998, 211, false},  // glitch
+		{"B", 997, 211, true},   // persistent decrease
+		{"B", 1002, 216, true},  // continued
+		{"B", 9995, 9209, true}, // approaching display range
+		{"B", 3, 9209, false},   // wrap pending
+		{"B", 5, 9209, false},   // wrap pending
+		{"B", 8, 9222, true},    // wrap at 10000
+		{"", 9, 9223, true},     // unknown serial
+	} {
+		virtual, ok := update(tc.serial, meters.Import, tc.value)
+		if ok != tc.ok || ok && virtual != tc.virtual {
+			t.Errorf("%s %.0f: expected %.0f %v, got %.0f %v", tc.serial, tc.value, tc.virtual, tc.ok, virtual, ok)
+		}
+	}
+
+	if _, ok := update("B", meters.Power, 1); ok {
+		t.Error("unexpected virtual power")
+	}
+
+	status := c.Status()
+	if len(status.Counters) != 1 || len(status.Events) != 4 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	for i, kind := range []CounterEventKind{CounterReset, CounterReplacement, CounterDecrease, CounterWrap} {
+		if status.Events[i].Kind != kind {
+			t.Errorf("%d: expected %s, got %s", i, kind, status.Events[i].Kind)
+		}
+	}
+
+	// state is restored from file
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err = NewCounters(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if virtual, ok := update("B", meters.Import, 10); !ok || virtual != 9224 {
+		t.Errorf("unexpected virtual total %.0f %v", virtual, ok)
+	}
+	if status := c.Status(); len(status.Events) != 4 {
+		t.Errorf("unexpected events %+v", status.Events)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"math"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/logger"
 	"github.com/volkszaehler/mbmd/meters"
 )
 
@@ -17,25 +20,125 @@ const (
 	initDelay  = 3 * time.Second
 )
 
+var handlerLog = logger.Get(logger.Handler)
+
+// DeviceOptions are per-device settings applied by the handler
+type DeviceOptions struct {
+	// Name is the device's configured name used by publishers
+	Name string
+	// Plausibility validates the device's readings, defaults are used if nil
+	Plausibility *Plausibility
+	// PublishInvalid forwards implausible readings tagged with their quality
+	PublishInvalid bool
+	// Transforms correct the device's readings before validation
+	Transforms Transforms
+}
+
 // Handler is responsible for querying a single connection
 type Handler struct {
-	ID      int
-	Manager *meters.Manager
-	status  map[string]*RuntimeInfo
+	ID         int
+	Manager    *meters.Manager
+	MaxBackoff time.Duration // retry interval ceiling for offline devices
+	Counters   *Counters     // energy counter continuity, disabled if nil
+	mu         sync.Mutex    // guards status and options of concurrently queried devices
+	status     map[string]*RuntimeInfo
+	options    map[meters.Device]*DeviceOptions
+	bus        busMetrics
+	conns      []meters.Connection
+	scheduler  *Scheduler
 }
 
 // NewHandler creates a connection handler. The handler is responsible
 // for querying all devices attached to the connection.
 func NewHandler(id int, m *meters.Manager) *Handler {
 	handler := &Handler{
-		ID:      id,
-		Manager: m,
-		status:  make(map[string]*RuntimeInfo),
+		ID:        id,
+		Manager:   m,
+		status:    make(map[string]*RuntimeInfo),
+		options:   make(map[meters.Device]*DeviceOptions),
+		scheduler: NewScheduler(),
 	}
 
 	return handler
 }
 
+// deviceOptions returns the device's options, creating defaults if not configured
+func (h *Handler) deviceOptions(dev meters.Device) *DeviceOptions {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	opts, ok := h.options[dev]
+	if !ok {
+		opts = &DeviceOptions{}
+		h.options[dev] = opts
+	}
+
+	if opts.Plausibility == nil {
+		opts.Plausibility = NewPlausibility(0, nil)
+	}
+
+	return opts
+}
+
+// validate checks the plausibility of a measurement result and returns its snip and if it is to be published
+func (opts *DeviceOptions) validate(deviceID string, r meters.MeasurementResult, status *RuntimeInfo, log *logger.Logger) (QuerySnip, bool) {
+	if math.IsNaN(r.Value) {
+		log.Debug("skipping NaN", "measurement", r.Measurement.String())
+		return QuerySnip{}, false
+	}
+
+	snip := QuerySnip{
+		Device:            deviceID,
+		MeasurementResult: r,
+		Quality:           opts.Plausibility.Check(r),
+	}
+
+	switch snip.Quality {
+	case QualitySuspicious:
+		status.Suspicious++
+	case QualityInvalid:
+		status.Invalid++
+	}
+
+	if snip.Quality != QualityGood {
+		log.Warn("implausible value", "quality", snip.Quality.String(), "measurement", r.Measurement.String(), "value", r.Value)
+		return snip, opts.PublishInvalid
+	}
+
+	return snip, true
+}
+
+// validate checks the plausibility of the device's measurement results and returns the snips to publish
+func (h *Handler) validate(id uint8, dev meters.Device, measurements []meters.MeasurementResult, status *RuntimeInfo, log *logger.Logger) []QuerySnip {
+	deviceID := h.deviceID(id, dev)
+	opts := h.deviceOptions(dev)
+	measurements = opts.Transforms.Apply(measurements)
+
+	snips := make([]QuerySnip, 0, len(measurements))
+	for _, r := range measurements {
+		decrease := opts.Plausibility.decreases(r)
+
+		snip, ok := opts.validate(deviceID, r, status, log)
+		if ok {
+			snips = append(snips, snip)
+		}
+
+		// virtual totals are published next to the raw counters. Implausible readings are not tracked
+		// except for counter decreases which are debounced by the counters to detect resets and wraps.
+		if h.Counters == nil || snip.Quality != QualityGood && !decrease {
+			continue
+		}
+
+		if v, ok := h.Counters.Update(h.counterID(id, dev), dev.Descriptor().Serial, r); ok {
+			if snip, ok := opts.validate(deviceID, v, status, log); ok {
+				snips = append(snips, snip)
+			}
+		}
+	}
+
+	return snips
+}
+
 // deviceID creates a unique id per device
 func (h *Handler) deviceID(id uint8, dev meters.Device) string {
 	desc := dev.Descriptor()
@@ -46,56 +149,226 @@ func (h *Handler) deviceID(id uint8, dev meters.Device) string {
 	return devID
 }
 
-// Run initializes and queries every device attached to the handler's connection
+// counterID identifies the device's energy counters by its configured name or its adapter and
+// slave id, which unlike the device id do not change when adapters are added or removed
+func (h *Handler) counterID(id uint8, dev meters.Device) string {
+	if name := h.deviceOptions(dev).Name; name != "" {
+		return name
+	}
+
+	desc := dev.Descriptor()
+	counterID := fmt.Sprintf("%s@%s.%d", desc.Type, h.Manager.Conn.String(), id)
+	if desc.SubDevice > 0 {
+		counterID = fmt.Sprintf("%s.%d", counterID, desc.SubDevice)
+	}
+	return counterID
+}
+
+// client returns the connection's modbus client, recording bus metrics per adapter and device
+func (h *Handler) client(conn meters.Connection, status *RuntimeInfo) modbus.Client {
+	return &meteredClient{
+		Client: conn.ModbusClient(),
+		observe: func(d time.Duration, err error) {
+			h.bus.observe(d, err)
+			if status != nil {
+				status.Bus.Observe(d, err)
+			}
+		},
+	}
+}
+
+// log returns a logger annotated with the device's id, adapter and slave id
+func (h *Handler) log(id uint8, dev meters.Device) *logger.Logger {
+	return handlerLog.With("device", h.deviceID(id, dev), "adapter", h.Manager.Conn.String(), "slave", id)
+}
+
+// connections returns the connections used for querying devices. TCP adapters configured for
+// concurrency use additional connections with their own sockets, up to one per device.
+func (h *Handler) connections() []meters.Connection {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns == nil {
+		h.conns = []meters.Connection{h.Manager.Conn}
+
+		if tcp, ok := h.Manager.Conn.(*meters.TCP); ok {
+			for len(h.conns) < min(h.Manager.Concurrency, h.Manager.Count()) {
+				h.conns = append(h.conns, tcp.Dial())
+			}
+		}
+	}
+
+	return h.conns
+}
+
+// links returns the link state of each connection supervising its physical link
+func (h *Handler) links() []meters.LinkState {
+	h.mu.Lock()
+	conns := h.conns
+	h.mu.Unlock()
+
+	if conns == nil {
+		conns = []meters.Connection{h.Manager.Conn}
+	}
+
+	var res []meters.LinkState
+	for _, conn := range conns {
+		if conn, ok := conn.(meters.Linked); ok {
+			res = append(res, conn.LinkState())
+		}
+	}
+
+	return res
+}
+
+// Run queries the devices attached to the handler's connection at the given rate until the
+// context is cancelled. Bus access is executed by the handler's scheduler, using one worker per connection.
 func (h *Handler) Run(
 	ctx context.Context,
+	rate time.Duration,
 	control chan<- ControlSnip,
 	results chan<- QuerySnip,
 ) {
-	h.Manager.All(func(id uint8, dev meters.Device) {
-		// abort if context is cancelled
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		h.scheduler.Run(ctx, h.connections())
+		wg.Done()
+	}()
+
+	ticker := time.NewTicker(rate)
+	defer ticker.Stop()
+
+	for {
+		h.schedulePolls(control, results, time.Now().Add(rate))
+
 		select {
 		case <-ctx.Done():
+			wg.Wait()
 			return
-		default:
+		case <-ticker.C:
 		}
+	}
+}
+
+// schedulePolls queues a periodic query of each device. Queries not started until the
+// deadline are skipped as they are superseded by the next round.
+func (h *Handler) schedulePolls(control chan<- ControlSnip, results chan<- QuerySnip, deadline time.Time) {
+	h.Manager.All(func(id uint8, dev meters.Device) {
+		h.scheduler.Submit(&Job{
+			Device:   h.deviceID(id, dev),
+			Priority: PriorityPoll,
+			Deadline: deadline,
+			Periodic: true,
+			Run: func(ctx context.Context, conn meters.Connection) error {
+				h.poll(ctx, control, results, conn, id, dev)
+				return nil
+			},
+		})
+	})
+}
 
-		// select device
-		h.Manager.Conn.Slave(id)
+// Execute queues a one-off request of the device and waits for its result. The request
+// fails with ErrDeadlineMissed if it could not be started before the deadline and is
+// dropped if the context is cancelled before it is started.
+func (h *Handler) Execute(
+	ctx context.Context,
+	id uint8,
+	dev meters.Device,
+	priority Priority,
+	deadline time.Time,
+	fn func(modbus.Client) error,
+) error {
+	deviceID := h.deviceID(id, dev)
+	result := make(chan error, 1)
 
-		// initialize device
-		deviceID := h.deviceID(id, dev)
-		status, ok := h.status[deviceID]
-		if !ok {
-			var err error
-			if status, err = h.initializeDevice(ctx, control, id, dev); err != nil {
-				return
+	h.scheduler.Submit(&Job{
+		Device:   deviceID,
+		Priority: priority,
+		Deadline: deadline,
+		Context:  ctx,
+		result:   result,
+		Run: func(_ context.Context, conn meters.Connection) error {
+			// requests must not reach the device once the requester has given up
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-			h.status[deviceID] = status
-		}
 
-		if queryable, wakeup := status.IsQueryable(); wakeup {
-			log.Printf("device %s is offline - reactivating", deviceID)
-		} else if !queryable {
+			conn.Slave(id)
+
+			h.mu.Lock()
+			status := h.status[deviceID]
+			h.mu.Unlock()
+
+			return fn(h.client(conn, status))
+		},
+	})
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll initializes and queries the device using the given connection
+func (h *Handler) poll(
+	ctx context.Context,
+	control chan<- ControlSnip,
+	results chan<- QuerySnip,
+	conn meters.Connection,
+	id uint8,
+	dev meters.Device,
+) {
+	// select device
+	conn.Slave(id)
+
+	// initialize device
+	deviceID := h.deviceID(id, dev)
+
+	h.mu.Lock()
+	status, ok := h.status[deviceID]
+	h.mu.Unlock()
+
+	if !ok {
+		var err error
+		if status, err = h.initializeDevice(ctx, control, conn, id, dev); err != nil {
 			return
 		}
 
-		// query device
-		h.queryDevice(ctx, control, results, id, dev)
-	})
+		h.mu.Lock()
+		h.status[deviceID] = status
+		h.mu.Unlock()
+	}
+
+	// offline devices get a single attempt to avoid stalling the bus with timeouts
+	attempts := maxRetry
+	if queryable, wakeup := status.IsQueryable(); wakeup {
+		h.log(id, dev).Info("device is offline - reactivating", "backoff", status.Backoff())
+		attempts = 1
+	} else if !queryable {
+		return
+	}
+
+	// query device
+	h.queryDevice(ctx, control, results, conn, id, dev, status, attempts)
 }
 
 func (h *Handler) initializeDevice(
 	ctx context.Context,
 	control chan<- ControlSnip,
+	conn meters.Connection,
 	id uint8,
 	dev meters.Device,
 ) (*RuntimeInfo, error) {
 	deviceID := h.deviceID(id, dev)
+	log := h.log(id, dev)
 
-	if err := dev.Initialize(h.Manager.Conn.ModbusClient()); err != nil {
+	if err := dev.Initialize(h.client(conn, nil)); err != nil {
 		if !errors.Is(err, meters.ErrPartiallyOpened) {
-			log.Printf("initializing device %s failed: %v", deviceID, err)
+			log.Error("initializing device failed", "error", err)
 
 			// wait for error to settle
 			ctx, cancel := context.WithTimeout(ctx, initDelay)
@@ -104,13 +377,14 @@ func (h *Handler) initializeDevice(
 
 			return nil, err
 		}
-		log.Println(err) // log error but continue
+		log.Warn("initializing device", "error", err) // log error but continue
 	}
 
-	log.Printf("initialized device %s: %v", deviceID, dev.Descriptor())
+	desc := dev.Descriptor()
+	log.Info("initialized device", "manufacturer", desc.Manufacturer, "model", desc.Model, "serial", desc.Serial)
 
 	// create status
-	status := &RuntimeInfo{Online: true}
+	status := &RuntimeInfo{Online: true, maxBackoff: h.MaxBackoff}
 
 	// signal device online
 	control <- ControlSnip{
@@ -125,17 +399,43 @@ func (h *Handler) queryDevice(
 	ctx context.Context,
 	control chan<- ControlSnip,
 	results chan<- QuerySnip,
+	conn meters.Connection,
 	id uint8,
 	dev meters.Device,
+	status *RuntimeInfo,
+	attempts int,
 ) {
 	deviceID := h.deviceID(id, dev)
-	status := h.status[deviceID]
+	log := h.log(id, dev)
 
-	for retry := 0; retry < maxRetry; retry++ {
+	// partial results of failed attempts, forwarded once if all attempts fail
+	var partial []meters.MeasurementResult
+
+	for retry := 0; retry < attempts; retry++ {
 		status.Requests++
-		measurements, err := dev.Query(h.Manager.Conn.ModbusClient())
+		measurements, err := dev.Query(h.client(conn, status))
+
+		// unsupported measurements are skipped by the device from now on
+		for _, m := range meters.Unsupported(err) {
+			log.Warn("measurement not supported by device - disabled", "measurement", m.String())
+			status.Unsupported = append(status.Unsupported, m.String())
+		}
+
+		// device responded, possibly with exceptions for some measurements
+		if !meters.IsTransportError(err) {
+			if err != nil {
+				log.Debug("partial query result", "error", err)
+			}
+
+			// devices may have been replaced while offline, refresh their descriptor
+			if !status.Online {
+				if err := dev.Initialize(h.client(conn, status)); err != nil && !errors.Is(err, meters.ErrPartiallyOpened) {
+					log.Warn("reinitializing device", "error", err)
+				}
+			}
+
+			snips := h.validate(id, dev, measurements, status, log)
 
-		if err == nil {
 			// send ok status
 			status.Available(true)
 			control <- ControlSnip{
@@ -144,24 +444,22 @@ func (h *Handler) queryDevice(
 			}
 
 			// send measurements
-			for _, r := range measurements {
-				if math.IsNaN(r.Value) {
-					log.Printf("device %s skipping NaN for %s", deviceID, r.Measurement.String())
-					continue
-				}
-
-				snip := QuerySnip{
-					Device:            deviceID,
-					MeasurementResult: r,
-				}
+			for _, snip := range snips {
 				results <- snip
 			}
 
 			return
 		}
 
+		// retries resume at the failed operation and may repeat earlier measurements
+		partial = mergeResults(partial, measurements)
+
 		status.Errors++
-		log.Printf("device %s did not respond (%d/%d): %v", deviceID, retry+1, maxRetry, err)
+		log.Warn("device did not respond", "retry", retry+1, "max", attempts, "error", err)
+
+		if retry+1 == attempts {
+			break
+		}
 
 		// wait for device to settle after error
 		select {
@@ -171,15 +469,36 @@ func (h *Handler) queryDevice(
 		}
 	}
 
-	log.Printf("device %s is offline", deviceID)
+	// send partial results of failed queries
+	for _, snip := range h.validate(id, dev, partial, status, log) {
+		results <- snip
+	}
 
 	// close connection to force modbus client to reopen
-	h.Manager.Conn.Close()
+	conn.Close()
 
 	// send error status
 	status.Available(false)
+	log.Error("device is offline", "backoff", status.Backoff())
 	control <- ControlSnip{
 		Device: deviceID,
 		Status: *status,
 	}
 }
+
+// mergeResults adds the results to res, replacing earlier results of the same measurement
+func mergeResults(res, results []meters.MeasurementResult) []meters.MeasurementResult {
+	for _, r := range results {
+		i := slices.IndexFunc(res, func(prev meters.MeasurementResult) bool {
+			return prev.Measurement == r.Measurement
+		})
+
+		if i >= 0 {
+			res[i] = r
+		} else {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
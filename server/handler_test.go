@@ -0,0 +1,367 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grid-x/modbus"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// slowDevice is a device whose queries take some time, recording the maximum number of concurrent queries
+type slowDevice struct {
+	mu                *sync.Mutex
+	active, maxActive *int
+}
+
+func (d *slowDevice) Initialize(modbus.Client) error { return nil }
+
+func (d *slowDevice) Descriptor() meters.DeviceDescriptor {
+	return meters.DeviceDescriptor{Type: "SLOW"}
+}
+
+func (d *slowDevice) Probe(modbus.Client) (meters.MeasurementResult, error) {
+	return meters.MeasurementResult{}, nil
+}
+
+func (d *slowDevice) Query(modbus.Client) ([]meters.MeasurementResult, error) {
+	d.mu.Lock()
+	*d.active++
+	*d.maxActive = max(*d.maxActive, *d.active)
+	d.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	d.mu.Lock()
+	*d.active--
+	d.mu.Unlock()
+
+	return []meters.MeasurementResult{{Measurement: meters.Power, Value: 1, Timestamp: time.Now()}}, nil
+}
+
+func TestHandlerConcurrency(t *testing.T) {
+	for _, tc := range []struct {
+		conn        meters.Connection
+		concurrency int
+		expected    int
+	}{
+		{meters.NewTCP("localhost:502"), 0, 1},
+		{meters.NewTCP("localhost:502"), 2, 2},
+		{meters.NewTCP("localhost:502"), 10, 4},
+		{meters.NewRTUOverTCP("localhost:502"), 2, 1},
+	} {
+		var (
+			mu                sync.Mutex
+			active, maxActive int
+		)
+
+		m := meters.NewManager(tc.conn)
+		m.Concurrency = tc.concurrency
+		for id := uint8(1); id <= 4; id++ {
+			if err := m.Add(id, &slowDevice{mu: &mu, active: &active, maxActive: &maxActive}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		h := NewHandler(1, m)
+		if links := h.links(); len(links) != 1 {
+			t.Errorf("%s: expected primary link before connecting, got %d", tc.conn, len(links))
+		}
+		if conns := h.connections(); len(conns) != tc.expected {
+			t.Errorf("%s: expected %d connections, got %d", tc.conn, tc.expected, len(conns))
+		}
+		if links := h.links(); len(links) != tc.expected {
+			t.Errorf("%s: expected %d links, got %d", tc.conn, tc.expected, len(links))
+		}
+
+		control := make(chan ControlSnip, 10)
+		results := make(chan QuerySnip, 10)
+
+		// single round of queries
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			h.Run(ctx, time.Hour, control, results)
+			close(done)
+		}()
+
+		for start := time.Now(); len(results) < 4 && time.Since(start) < 5*time.Second; {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		cancel()
+		<-done
+
+		if len(results) != 4 || len(h.status) != 4 {
+			t.Errorf("%s: unexpected results %d", tc.conn, len(results))
+		}
+		if st := h.scheduler.status(); st.Workers != tc.expected || st.Executed != 4 || st.QueueDepth != 0 {
+			t.Errorf("%s: unexpected scheduler status %+v", tc.conn, st)
+		}
+		if maxActive != tc.expected {
+			t.Errorf("%s: expected %d concurrent queries, got %d", tc.conn, tc.expected, maxActive)
+		}
+	}
+}
+
+// flakyDevice returns partial results with a transport error, resuming at the failed measurement
+type flakyDevice struct {
+	slowDevice
+	queries int
+}
+
+func (d *flakyDevice) Query(modbus.Client) ([]meters.MeasurementResult, error) {
+	d.queries++
+	ts := time.Now()
+
+	res := []meters.MeasurementResult{{Measurement: meters.Voltage, Value: float64(d.queries), Timestamp: ts}}
+	if d.queries > 1 {
+		res = append(res, meters.MeasurementResult{Measurement: meters.Frequency, Value: 50, Timestamp: ts})
+	}
+
+	return res, errors.New("timeout")
+}
+
+func TestHandlerPartialResults(t *testing.T) {
+	conn := meters.NewTCP("localhost:502")
+	m := meters.NewManager(conn)
+
+	dev := &flakyDevice{}
+	if err := m.Add(1, dev); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(1, m)
+	control := make(chan ControlSnip, 10)
+	results := make(chan QuerySnip, 10)
+
+	h.queryDevice(context.Background(), control, results, conn, 1, dev, &RuntimeInfo{Online: true}, 2)
+	close(results)
+
+	// partial results are forwarded once, repeated measurements with their latest value
+	snips := make(map[meters.Measurement]float64)
+	for snip := range results {
+		if _, ok := snips[snip.Measurement]; ok {
+			t.Errorf("%s: forwarded twice", snip.Measurement)
+		}
+		snips[snip.Measurement] = snip.Value
+	}
+
+	if len(snips) != 2 || snips[meters.Voltage] != 2 || snips[meters.Frequency] != 50 {
+		t.Errorf("unexpected results %v", snips)
+	}
+}
+
+// orderDevice records the order of its queries
+type orderDevice struct {
+	slowDevice
+	name  string
+	order *[]string
+}
+
+func (d *orderDevice) Query(c modbus.Client) ([]meters.MeasurementResult, error) {
+	d.mu.Lock()
+	*d.order = append(*d.order, d.name)
+	d.mu.Unlock()
+
+	return d.slowDevice.Query(c)
+}
+
+func TestHandlerExecutePriority(t *testing.T) {
+	var (
+		mu                sync.Mutex
+		active, maxActive int
+		order             []string
+	)
+
+	m := meters.NewManager(meters.NewTCP("localhost:502"))
+	for id := uint8(1); id <= 4; id++ {
+		dev := &orderDevice{slowDevice{mu: &mu, active: &active, maxActive: &maxActive}, fmt.Sprintf("poll%d", id), &order}
+		if err := m.Add(id, dev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewHandler(1, m)
+	control := make(chan ControlSnip, 10)
+	results := make(chan QuerySnip, 10)
+
+	h.schedulePolls(control, results, time.Now().Add(time.Minute))
+
+	// one-off requests queued behind the polls
+	var wg sync.WaitGroup
+	for _, req := range []struct {
+		id       uint8
+		priority Priority
+		name     string
+	}{
+		{4, PriorityRead, "read"},
+		{3, PriorityWrite, "write"},
+	} {
+		var dev meters.Device
+		m.Find(func(id uint8, d meters.Device) bool {
+			dev = d
+			return id == req.id
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := h.Execute(context.Background(), req.id, dev, req.priority, time.Now().Add(time.Minute), func(modbus.Client) error {
+				mu.Lock()
+				order = append(order, req.name)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	for start := time.Now(); h.scheduler.status().QueueDepth < 6 && time.Since(start) < 5*time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		h.scheduler.Run(ctx, h.connections())
+		close(done)
+	}()
+
+	wg.Wait()
+	for start := time.Now(); len(results) < 4 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	// writes before reads before queued polls
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(order) != 6 || order[0] != "write" || order[1] != "read" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestHandlerCounters(t *testing.T) {
+	m := meters.NewManager(meters.NewTCP("localhost:502"))
+	dev := &slowDevice{}
+	if err := m.Add(1, dev); err != nil {
+		t.Fatal(err)
+	}
+
+	counters, err := NewCounters("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(2, m)
+	h.Counters = counters
+
+	if id := h.counterID(1, dev); id != "SLOW@localhost:502.1" {
+		t.Errorf("unexpected counter id %s", id)
+	}
+
+	// counter decreases are debounced once
+	ts := time.Now()
+	for _, tc := range []struct {
+		value, virtual float64
+	}{
+		{1234, 1234},
+		{0, 0}, // glitch
+		{1235, 1235},
+		{5, 0}, // reset pending
+		{6, 0}, // reset pending
+		{7, 1242},
+		{8, 1243},
+	} {
+		ts = ts.Add(time.Second)
+		snips := h.validate(1, dev, []meters.MeasurementResult{{Measurement: meters.Import, Value: tc.value, Timestamp: ts}}, &RuntimeInfo{}, handlerLog)
+
+		var virtual float64
+		for _, snip := range snips {
+			if snip.Measurement == meters.VirtualImport {
+				virtual = snip.Value
+			}
+		}
+		if virtual != tc.virtual {
+			t.Errorf("%.0f: expected virtual %.0f, got %.0f", tc.value, tc.virtual, virtual)
+		}
+	}
+
+	if status := counters.Status(); len(status.Events) != 1 || status.Events[0].Kind != CounterReset || status.Counters[0].Device != "SLOW@localhost:502.1" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// configured names identify the counters
+	h.deviceOptions(dev).Name = "garage"
+	if id := h.counterID(1, dev); id != "garage" {
+		t.Errorf("unexpected counter id %s", id)
+	}
+}
+
+// serialDevice reports the serial number of a replaced device once reinitialized
+type serialDevice struct {
+	serial, replaced string
+	value            float64
+}
+
+func (d *serialDevice) Initialize(modbus.Client) error {
+	d.serial = d.replaced
+	return nil
+}
+
+func (d *serialDevice) Descriptor() meters.DeviceDescriptor {
+	return meters.DeviceDescriptor{Type: "SERIAL", Serial: d.serial}
+}
+
+func (d *serialDevice) Probe(modbus.Client) (meters.MeasurementResult, error) {
+	return meters.MeasurementResult{}, nil
+}
+
+func (d *serialDevice) Query(modbus.Client) ([]meters.MeasurementResult, error) {
+	return []meters.MeasurementResult{{Measurement: meters.Import, Value: d.value, Timestamp: time.Now()}}, nil
+}
+
+func TestHandlerReplacedDevice(t *testing.T) {
+	conn := meters.NewTCP("localhost:502")
+	m := meters.NewManager(conn)
+
+	dev := &serialDevice{serial: "A", replaced: "A", value: 100}
+	if err := m.Add(1, dev); err != nil {
+		t.Fatal(err)
+	}
+
+	counters, err := NewCounters("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(1, m)
+	h.Counters = counters
+
+	control := make(chan ControlSnip, 10)
+	results := make(chan QuerySnip, 10)
+	status := &RuntimeInfo{Online: true}
+
+	h.queryDevice(context.Background(), control, results, conn, 1, dev, status, 1)
+
+	// device replaced while offline
+	dev.replaced, dev.value = "B", 5
+	status.Available(false)
+	h.queryDevice(context.Background(), control, results, conn, 1, dev, status, 1)
+
+	if status := counters.Status(); len(status.Events) != 1 || status.Events[0].Kind != CounterReplacement || status.Events[0].Serial != "B" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
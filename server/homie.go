@@ -1,8 +1,9 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"hash/fnv"
 	"sort"
 	"strings"
 	"sync"
@@ -10,60 +11,100 @@ import (
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 
+	"github.com/volkszaehler/mbmd/logger"
 	"github.com/volkszaehler/mbmd/meters"
 )
 
 const (
-	specVersion = "4.0"
-	nodeTopic   = "meter"
-	timeout     = 500 * time.Millisecond
+	nodeTopic = "meter"
+	timeout   = 500 * time.Millisecond
 )
 
-// HomieRunner publishes query results as homie mqtt topics
+var homieLog = logger.Get(logger.Homie)
+
+// HomieRunner publishes query results as homie mqtt topics. All devices are
+// published using a single connection. The connection's last will marks
+// the bridge device as lost, device states are published explicitly.
+// As Homie 4 devices do not inherit the bridge's state, their $state is only
+// valid while the bridge is ready. Device states left over by an unclean
+// disconnect are marked lost on startup.
 type HomieRunner struct {
-	options   *MQTT.ClientOptions
-	qos       byte
-	verbose   bool
-	rootTopic string
+	*MqttClient
+	version   int
+	rootTopic string // base topic, including the version segment for Homie 5
+	bridge    string // bridge device id
 	qe        DeviceInfo
 	cc        <-chan ControlSnip
-	meters    map[string]*homieMeter
+
+	mu       sync.Mutex
+	meters   map[string]*homieMeter
+	retained map[string]bool // retained topics found at startup
 }
 
 type homieMeter struct {
-	*MqttClient
-	rootTopic string
-	meter     string
-	online    bool
-	observed  map[meters.Measurement]bool
+	id       string // device topic
+	name     string
+	model    meters.DeviceDescriptor
+	state    string
+	observed map[meters.Measurement]bool
 }
 
-// NewHomieRunner create new runner for homie IoT spec
-func NewHomieRunner(qe DeviceInfo, cc <-chan ControlSnip, options *MQTT.ClientOptions, qos byte, rootTopic string, verbose bool) *HomieRunner {
+// NewHomieRunner create new runner for homie IoT spec version 4 or 5
+func NewHomieRunner(qe DeviceInfo, cc <-chan ControlSnip, options *MQTT.ClientOptions, qos byte, rootTopic string, version int) (*HomieRunner, error) {
+	if version == 0 {
+		version = 4
+	}
+	if version != 4 && version != 5 {
+		return nil, fmt.Errorf("invalid homie version: %d", version)
+	}
+
+	if version == 5 {
+		rootTopic += "/5"
+	}
+
 	hr := &HomieRunner{
-		options:   options,
-		qos:       qos,
-		verbose:   verbose,
+		version:   version,
 		rootTopic: rootTopic,
+		bridge:    mqttDeviceTopic(mqttSafe(options.ClientID)),
 		qe:        qe,
 		cc:        cc,
 		meters:    make(map[string]*homieMeter),
+		retained:  make(map[string]bool),
 	}
 
-	return hr
+	// separate client id from plain mqtt publisher using the same options
+	opt := hr.cloneOptions(options)
+	opt.SetClientID(options.ClientID + "-homie")
+	opt.SetWill(hr.topic(hr.bridge, "$state"), "lost", qos, true)
+
+	// publish states on connect, restoring them after reconnect
+	connected := make(chan struct{})
+	opt.SetOnConnectHandler(func(MQTT.Client) {
+		<-connected
+
+		hr.mu.Lock()
+		defer hr.mu.Unlock()
+		hr.publishStates()
+	})
+
+	hr.MqttClient = NewMqttClient(opt, qos, homieLog)
+	close(connected)
+
+	return hr, nil
 }
 
 // cloneOptions creates a copy of the relevant mqtt options
-func (hr *HomieRunner) cloneOptions() *MQTT.ClientOptions {
+func (hr *HomieRunner) cloneOptions(options *MQTT.ClientOptions) *MQTT.ClientOptions {
 	opt := MQTT.NewClientOptions()
 
-	opt.SetUsername(hr.options.Username)
-	opt.SetPassword(hr.options.Password)
-	opt.SetClientID(hr.options.ClientID)
-	opt.SetCleanSession(hr.options.CleanSession)
-	opt.SetAutoReconnect(hr.options.AutoReconnect)
+	opt.SetUsername(options.Username)
+	opt.SetPassword(options.Password)
+	opt.SetClientID(options.ClientID)
+	opt.SetCleanSession(options.CleanSession)
+	opt.SetAutoReconnect(options.AutoReconnect)
+	opt.SetTLSConfig(options.TLSConfig)
 
-	for _, b := range hr.options.Servers {
+	for _, b := range options.Servers {
 		opt.AddBroker(b.String())
 	}
 
@@ -72,211 +113,367 @@ func (hr *HomieRunner) cloneOptions() *MQTT.ClientOptions {
 
 // Run MQTT client publisher
 func (hr *HomieRunner) Run(in <-chan QuerySnip) {
-	defer hr.unregister() // cleanup topics
+	hr.collectRetained()
 
-	for {
-		select {
-		case snip, chanOpen := <-in:
-			if !chanOpen {
-				return // channel closed
-			}
-			meter, ok := hr.meters[snip.Device]
-			if !ok {
-				meter = hr.createMeter(snip)
-			}
-			// publish actual message
-			meter.publishMessage(snip)
-		case snip := <-hr.cc:
-			if meter, ok := hr.meters[snip.Device]; ok {
-				meter.status(snip.Status.Online)
-			}
+	go func() {
+		for snip := range hr.cc {
+			hr.status(snip.Device, snip.Status.Online)
 		}
-	}
+	}()
+
+	// publish device attributes once per query cycle, properties carry no quality flag
+	newBatcher(batchWindow, hr.publishBatch).run(in, func(snip QuerySnip) bool {
+		return snip.Quality == QualityGood
+	})
+
+	hr.unregister()
 }
 
-// createMeter creates new homie device
-func (hr *HomieRunner) createMeter(snip QuerySnip) *homieMeter {
-	// new client with unique id
-	options := hr.cloneOptions()
-	clientID := fmt.Sprintf("%s-%s", options.ClientID, mqttDeviceTopic(snip.Device))
-	options.SetClientID(clientID)
+func (hr *HomieRunner) topic(subtopics ...string) string {
+	return hr.rootTopic + "/" + strings.Join(subtopics, "/")
+}
 
-	lwt := fmt.Sprintf("%s/%s/$state", hr.rootTopic, mqttDeviceTopic(snip.Device))
-	options.SetWill(lwt, "lost", hr.qos, true)
+// collectRetained records existing retained topics for removing outdated attributes
+func (hr *HomieRunner) collectRetained() {
+	topic := hr.topic("#")
 
-	client := NewMqttClient(options, hr.qos, hr.verbose)
+	// device states left over by an unclean disconnect
+	var stale []string
 
-	// add meter and publish
-	meter := newHomieMeter(client, hr.rootTopic, snip.Device)
-	hr.meters[snip.Device] = meter
+	token := hr.Client.Subscribe(topic, hr.qos, func(_ MQTT.Client, msg MQTT.Message) {
+		if msg.Retained() && len(msg.Payload()) > 0 {
+			hr.mu.Lock()
+			hr.retained[msg.Topic()] = true
+			if hr.isStale(msg.Topic(), string(msg.Payload())) {
+				stale = append(stale, msg.Topic())
+			}
+			hr.mu.Unlock()
+		}
+	})
+	hr.WaitForToken(token)
 
-	d := hr.qe.DeviceDescriptorByID(snip.Device)
-	meter.publishMeter(d)
+	// wait for timeout according to specification
+	time.Sleep(timeout)
 
-	return meter
-}
+	hr.WaitForToken(hr.Client.Unsubscribe(topic))
 
-// unregister unpublishes device information
-func (hr *HomieRunner) unregister() {
-	for _, meter := range hr.meters {
-		meter.unregister()
+	// devices are not updated before their first readings
+	hr.mu.Lock()
+	for _, topic := range stale {
+		hr.log.Debug("marking stale device lost", "topic", topic)
+		hr.Publish(topic, true, "lost")
 	}
+	hr.mu.Unlock()
 }
 
-// newHomieMeter creates meter on given mqtt client
-func newHomieMeter(client *MqttClient, rootTopic string, meter string) *homieMeter {
-	hm := &homieMeter{
-		MqttClient: client,
-		rootTopic:  rootTopic,
-		meter:      meter,
-		observed:   make(map[meters.Measurement]bool),
+// isStale returns true if the retained topic is a device state not cleared by a clean disconnect
+func (hr *HomieRunner) isStale(topic, payload string) bool {
+	device, ok := strings.CutSuffix(strings.TrimPrefix(topic, hr.rootTopic+"/"), "/$state")
+	if !ok || device == hr.bridge || strings.Contains(device, "/") {
+		return false
 	}
-	return hm
+
+	return payload != "disconnected" && payload != "lost"
 }
 
-// unregister clears meter's retained messages
-func (hr *homieMeter) unregister() {
-	subTopic := mqttDeviceTopic(hr.meter)
-	hr.publish(subTopic+"/$state", "disconnected")
-	hr.Client.Disconnect(uint(timeout.Milliseconds()))
+// cleanup removes retained topics of the device that are not part of attrs. Must be called with lock held.
+func (hr *HomieRunner) cleanup(device string, attrs map[string]string) {
+	prefix := hr.topic(device) + "/"
+
+	for topic := range hr.retained {
+		if !strings.HasPrefix(topic, prefix) {
+			continue
+		}
+
+		delete(hr.retained, topic)
+
+		if _, ok := attrs[strings.TrimPrefix(topic, hr.rootTopic+"/")]; ok {
+			continue
+		}
+
+		hr.log.Debug("unpublish", "topic", topic)
+		hr.Publish(topic, true, []byte{})
+	}
 }
 
-func (hr *homieMeter) publishMeter(descriptor meters.DeviceDescriptor) {
-	subTopic := mqttDeviceTopic(hr.meter)
+// publishAttributes publishes retained device attributes and removes outdated ones. Must be called with lock held.
+func (hr *HomieRunner) publishAttributes(device string, attrs map[string]string) {
+	subtopics := make([]string, 0, len(attrs))
+	for subtopic := range attrs {
+		subtopics = append(subtopics, subtopic)
+	}
+	sort.Strings(subtopics)
 
-	// device
-	hr.publish(subTopic+"/$homie", specVersion)
-	hr.publish(subTopic+"/$name", hr.meter)
-	hr.publish(subTopic+"/$state", "init")
-	hr.publish(subTopic+"/$implementation", "MBMD")
+	for _, subtopic := range subtopics {
+		hr.Publish(hr.topic(subtopic), true, attrs[subtopic])
+	}
+
+	// device state is published separately
+	attrs[device+"/$state"] = ""
+	hr.cleanup(device, attrs)
+}
 
-	// node
-	hr.publish(subTopic+"/$nodes", nodeTopic)
-	hr.unpublish(subTopic, nodeTopic, "$homie", "$name", "$state", "$nodes")
+// publishStates publishes the bridge and device states. Must be called with lock held.
+func (hr *HomieRunner) publishStates() {
+	hr.publishAttributes(hr.bridge, hr.bridgeAttributes())
+	hr.Publish(hr.topic(hr.bridge, "$state"), true, "ready")
 
-	subTopic = fmt.Sprintf("%s/%s", subTopic, nodeTopic)
-	hr.publish(subTopic+"/$name", descriptor.Manufacturer)
-	hr.publish(subTopic+"/$type", descriptor.Model)
+	for _, meter := range hr.meters {
+		hr.Publish(hr.topic(meter.id, "$state"), true, meter.state)
+	}
 }
 
 // status updates a meter's $state attibute when its online status changes
-func (hr *homieMeter) status(online bool) {
-	if hr.online != online {
-		subTopic := mqttDeviceTopic(hr.meter)
-		msg := "alert"
-		if online {
-			msg = "ready"
+func (hr *HomieRunner) status(device string, online bool) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	meter, ok := hr.meters[device]
+	if !ok {
+		return
+	}
+
+	state := "ready"
+	if !online {
+		state = "alert"
+		if hr.version == 5 {
+			state = "lost"
 		}
-		hr.publish(subTopic+"/$state", msg)
-		hr.online = online
+	}
+
+	if meter.state != state {
+		meter.state = state
+		hr.Publish(hr.topic(meter.id, "$state"), true, state)
 	}
 }
 
-func (hr *homieMeter) publishMessage(snip QuerySnip) {
-	// make sure property is published before publishing data
-	if _, ok := hr.observed[snip.Measurement]; !ok {
-		hr.observed[snip.Measurement] = true
-		hr.publishProperties()
+// publishBatch publishes a device's readings, creating or updating the device if required
+func (hr *HomieRunner) publishBatch(batch *DeviceBatch) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	meter, ok := hr.meters[batch.Device]
+	if !ok {
+		meter = &homieMeter{
+			id:       mqttDeviceTopic(batch.Device),
+			name:     batch.Device,
+			model:    hr.qe.DeviceDescriptorByID(batch.Device),
+			state:    "init",
+			observed: make(map[meters.Measurement]bool),
+		}
+		if name := hr.qe.DeviceName(batch.Device); name != "" {
+			meter.name = name
+		}
+
+		hr.meters[batch.Device] = meter
+		hr.Publish(hr.topic(meter.id, "$state"), true, meter.state)
+
+		// add device to bridge
+		hr.publishAttributes(hr.bridge, hr.bridgeAttributes())
 	}
 
-	// publish data
-	topic := fmt.Sprintf("%s/%s/%s/%s",
-		hr.rootTopic,
-		mqttDeviceTopic(snip.Device),
-		nodeTopic,
-		strings.ToLower(snip.Measurement.String()),
-	)
+	var changed bool
+	for m := range batch.Values {
+		if !meter.observed[m] {
+			meter.observed[m] = true
+			changed = true
+		}
+	}
 
-	message := fmt.Sprintf("%.3f", snip.Value)
-	go hr.Publish(topic, false, message)
+	// make sure properties are published before publishing data
+	if changed {
+		hr.publishAttributes(meter.id, hr.meterAttributes(meter))
+	}
+
+	if meter.state == "init" {
+		meter.state = "ready"
+		hr.Publish(hr.topic(meter.id, "$state"), true, meter.state)
+	}
+
+	for _, m := range sortedMeasurements(batch.Values) {
+		topic := hr.topic(meter.id, nodeTopic, strings.ToLower(m.String()))
+		hr.Publish(topic, false, fmt.Sprintf("%.3f", batch.Values[m]))
+	}
 }
 
-func (hr *homieMeter) publishProperties() {
-	subtopic := fmt.Sprintf("%s/%s", mqttDeviceTopic(hr.meter), nodeTopic)
+// unregister marks all devices as disconnected
+func (hr *HomieRunner) unregister() {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
 
-	measurements := make([]meters.Measurement, 0)
-	for k := range hr.observed {
-		measurements = append(measurements, k)
+	for _, meter := range hr.meters {
+		hr.Publish(hr.topic(meter.id, "$state"), true, "disconnected")
 	}
+	hr.Publish(hr.topic(hr.bridge, "$state"), true, "disconnected")
 
-	// sort by measurement type
-	sort.Slice(measurements, func(a, b int) bool {
-		return measurements[a].String() < measurements[b].String()
-	})
+	hr.Client.Disconnect(uint(timeout.Milliseconds()))
+}
 
-	properties := make([]string, len(measurements))
+func sortedMeasurements[T any](values map[meters.Measurement]T) []meters.Measurement {
+	res := make([]meters.Measurement, 0, len(values))
+	for m := range values {
+		res = append(res, m)
+	}
 
-	for i, m := range measurements {
-		property := strings.ToLower(m.String())
-		properties[i] = property
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].String() < res[b].String()
+	})
 
-		description, unit := m.DescriptionAndUnit()
+	return res
+}
 
-		propertySubtopic := fmt.Sprintf("%s/%s", subtopic, property)
-		hr.publish(propertySubtopic+"/$name", description)
-		hr.publish(propertySubtopic+"/$unit", unit)
-		hr.publish(propertySubtopic+"/$datatype", "float")
+// homieFormat returns the value range of non-negative energy counters
+func homieFormat(m meters.Measurement) string {
+	if l := m.Limits(); l.Counter && l.Min >= 0 {
+		return "0:"
 	}
+	return ""
+}
 
-	hr.publish(subtopic+"/$properties", strings.Join(properties, ","))
+// homieDescription is the Homie 5 device description
+type homieDescription struct {
+	Homie    string               `json:"homie"`
+	Version  int64                `json:"version"`
+	Name     string               `json:"name,omitempty"`
+	Root     string               `json:"root,omitempty"`
+	Parent   string               `json:"parent,omitempty"`
+	Children []string             `json:"children,omitempty"`
+	Nodes    map[string]homieNode `json:"nodes,omitempty"`
+}
 
-	// unpublish remains attributes if any
-	exceptions := []string{"$name", "$unit", "$datatype", "$properties"}
-	exceptions = append(exceptions, properties...)
-	hr.unpublish(subtopic, exceptions...)
+type homieNode struct {
+	Name       string                   `json:"name,omitempty"`
+	Type       string                   `json:"type,omitempty"`
+	Properties map[string]homieProperty `json:"properties"`
 }
 
-func (hr *homieMeter) publish(subtopic string, message string) {
-	topic := hr.rootTopic + "/" + subtopic
-	hr.Publish(topic, true, message)
+type homieProperty struct {
+	Name     string `json:"name,omitempty"`
+	Datatype string `json:"datatype"`
+	Format   string `json:"format,omitempty"`
+	Unit     string `json:"unit,omitempty"`
+	Retained bool   `json:"retained"`
 }
 
-// unpublish retained message hierarchy
-func (hr *homieMeter) unpublish(subtopic string, exceptions ...string) {
-	topic := fmt.Sprintf("%s/%s/#", hr.rootTopic, subtopic)
-	if hr.verbose {
-		log.Printf("mqtt: unpublish %s", topic)
-	}
+// marshal creates the description json. The version is derived from the description's content.
+func (d homieDescription) marshal() string {
+	d.Version = 0
+	b, _ := json.Marshal(d)
 
-	var mux sync.Mutex
-	tokens := make([]MQTT.Token, 0)
+	h := fnv.New32a()
+	_, _ = h.Write(b)
+	d.Version = int64(h.Sum32())
 
-	mux.Lock()
-	tokens = append(tokens, hr.Client.Subscribe(topic, hr.qos, func(c MQTT.Client, msg MQTT.Message) {
-		if len(msg.Payload()) == 0 {
-			return // ignore received unpublish messages
+	b, _ = json.Marshal(d)
+	return string(b)
+}
+
+// bridgeAttributes returns the bridge device's attributes
+func (hr *HomieRunner) bridgeAttributes() map[string]string {
+	ids := make([]string, 0, len(hr.meters))
+	for _, meter := range hr.meters {
+		ids = append(ids, meter.id)
+	}
+	sort.Strings(ids)
+
+	if hr.version == 5 {
+		return map[string]string{
+			hr.bridge + "/$description": homieDescription{
+				Homie:    "5.0",
+				Name:     "MBMD",
+				Children: ids,
+			}.marshal(),
 		}
+	}
+
+	attrs := map[string]string{
+		hr.bridge + "/$homie":          "4.0",
+		hr.bridge + "/$name":           "MBMD",
+		hr.bridge + "/$implementation": "MBMD",
+		hr.bridge + "/$nodes":          "devices",
+
+		hr.bridge + "/devices/$name":       "Devices",
+		hr.bridge + "/devices/$type":       "bridge",
+		hr.bridge + "/devices/$properties": "list",
 
-		topic := msg.Topic()
+		hr.bridge + "/devices/list/$name":     "Device ids",
+		hr.bridge + "/devices/list/$datatype": "string",
+	}
+
+	if len(ids) > 0 {
+		attrs[hr.bridge+"/devices/list"] = strings.Join(ids, ",")
+	}
 
-		// don't unpublish if in exception list
-		for _, exception := range exceptions {
-			exceptionTopic := fmt.Sprintf("%s/%s/%s", hr.rootTopic, subtopic, exception)
-			if topic == exceptionTopic || strings.HasPrefix(topic, exceptionTopic+"/") {
-				// log.Printf("unpublish %s -> retain (%s)", topic, exception)
-				return
+	return attrs
+}
+
+// meterAttributes returns the meter device's attributes
+func (hr *HomieRunner) meterAttributes(meter *homieMeter) map[string]string {
+	measurements := sortedMeasurements(meter.observed)
+
+	if hr.version == 5 {
+		node := homieNode{
+			Name:       meter.model.Manufacturer,
+			Type:       meter.model.Model,
+			Properties: make(map[string]homieProperty),
+		}
+
+		for _, m := range measurements {
+			description, unit := m.DescriptionAndUnit()
+			node.Properties[strings.ToLower(m.String())] = homieProperty{
+				Name:     description,
+				Datatype: "float",
+				Format:   homieFormat(m),
+				Unit:     unit,
 			}
 		}
 
-		// log.Printf("unpublish %s", topic)
-		token := hr.Client.Publish(topic, hr.qos, true, []byte{})
+		return map[string]string{
+			meter.id + "/$description": homieDescription{
+				Homie:  "5.0",
+				Name:   meter.name,
+				Root:   hr.bridge,
+				Parent: hr.bridge,
+				Nodes:  map[string]homieNode{nodeTopic: node},
+			}.marshal(),
+		}
+	}
 
-		mux.Lock()
-		defer mux.Unlock()
-		tokens = append(tokens, token)
-	}))
-	mux.Unlock()
+	node := meter.id + "/" + nodeTopic
+	attrs := map[string]string{
+		meter.id + "/$homie":          "4.0",
+		meter.id + "/$name":           meter.name,
+		meter.id + "/$implementation": "MBMD",
+		meter.id + "/$nodes":          nodeTopic,
+		node + "/$name":               meter.model.Manufacturer,
+		node + "/$type":               meter.model.Model,
+	}
 
-	// wait for timeout according to specification
-	<-time.After(timeout)
-	mux.Lock()
-	defer mux.Unlock()
+	properties := make([]string, 0, len(measurements))
+	for _, m := range measurements {
+		property := strings.ToLower(m.String())
+		properties = append(properties, property)
+
+		description, unit := m.DescriptionAndUnit()
 
-	// stop listening
-	hr.Client.Unsubscribe(topic)
+		attrs[node+"/"+property+"/$name"] = description
+		attrs[node+"/"+property+"/$unit"] = unit
+		attrs[node+"/"+property+"/$datatype"] = "float"
+		attrs[node+"/"+property+"/$retained"] = "false"
 
-	// wait for tokens
-	for _, token := range tokens {
-		hr.WaitForToken(token)
+		if format := homieFormat(m); format != "" {
+			attrs[node+"/"+property+"/$format"] = format
+		}
+	}
+
+	attrs[node+"/$properties"] = strings.Join(properties, ",")
+
+	// empty attributes cannot be published as retained messages
+	for k, v := range attrs {
+		if v == "" {
+			delete(attrs, k)
+		}
 	}
+
+	return attrs
 }
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func homieTestMeter() *homieMeter {
+	return &homieMeter{
+		id:    "sdm1-1",
+		name:  "garage",
+		model: meters.DeviceDescriptor{Manufacturer: "SDM", Model: "SDM630"},
+		observed: map[meters.Measurement]bool{
+			meters.Power:  true,
+			meters.Import: true,
+		},
+	}
+}
+
+func TestHomie4Attributes(t *testing.T) {
+	hr := &HomieRunner{version: 4, bridge: "mbmd"}
+	attrs := hr.meterAttributes(homieTestMeter())
+
+	for topic, expected := range map[string]string{
+		"sdm1-1/$homie":                 "4.0",
+		"sdm1-1/$name":                  "garage",
+		"sdm1-1/$nodes":                 "meter",
+		"sdm1-1/meter/$name":            "SDM",
+		"sdm1-1/meter/$type":            "SDM630",
+		"sdm1-1/meter/$properties":      "import,power",
+		"sdm1-1/meter/import/$name":     "Total Import",
+		"sdm1-1/meter/import/$unit":     "kWh",
+		"sdm1-1/meter/import/$datatype": "float",
+		"sdm1-1/meter/import/$format":   "0:",
+		"sdm1-1/meter/import/$retained": "false",
+		"sdm1-1/meter/power/$unit":      "W",
+		"sdm1-1/meter/power/$format":    "", // not published
+	} {
+		if attrs[topic] != expected {
+			t.Errorf("%s: expected %q, got %q", topic, expected, attrs[topic])
+		}
+	}
+}
+
+func TestHomie5Description(t *testing.T) {
+	hr := &HomieRunner{version: 5, bridge: "mbmd"}
+	hr.meters = map[string]*homieMeter{"SDM1.1": homieTestMeter()}
+
+	var bridge homieDescription
+	if err := json.Unmarshal([]byte(hr.bridgeAttributes()["mbmd/$description"]), &bridge); err != nil {
+		t.Fatal(err)
+	}
+	if bridge.Homie != "5.0" || len(bridge.Children) != 1 || bridge.Children[0] != "sdm1-1" || bridge.Version == 0 {
+		t.Errorf("unexpected bridge description %+v", bridge)
+	}
+
+	meter := homieTestMeter()
+	desc := hr.meterAttributes(meter)["sdm1-1/$description"]
+
+	var d homieDescription
+	if err := json.Unmarshal([]byte(desc), &d); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Root != "mbmd" || d.Parent != "mbmd" || d.Name != "garage" {
+		t.Errorf("unexpected description %+v", d)
+	}
+
+	if p := d.Nodes["meter"].Properties["import"]; p.Datatype != "float" || p.Format != "0:" || p.Unit != "kWh" || p.Retained {
+		t.Errorf("unexpected property %+v", p)
+	}
+
+	// version changes with description
+	meter.observed[meters.Frequency] = true
+
+	var updated homieDescription
+	if err := json.Unmarshal([]byte(hr.meterAttributes(meter)["sdm1-1/$description"]), &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Version == d.Version || len(updated.Nodes["meter"].Properties) != 3 {
+		t.Errorf("expected updated version, got %+v", updated)
+	}
+}
+
+func TestHomieFormat(t *testing.T) {
+	for m, expected := range map[meters.Measurement]string{
+		meters.Import:      "0:",
+		meters.HeatEnergy:  "0:",
+		meters.Volume:      "0:",
+		meters.ImportPower: "",
+		meters.Power:       "",
+		meters.Indexed(meters.Import, meters.TariffIndex, 3): "0:",
+	} {
+		if f := homieFormat(m); f != expected {
+			t.Errorf("%s: expected %q, got %q", m, expected, f)
+		}
+	}
+}
+
+func TestHomieStaleState(t *testing.T) {
+	hr := &HomieRunner{rootTopic: "homie", bridge: "mbmd"}
+
+	for _, tc := range []struct {
+		topic, payload string
+		stale          bool
+	}{
+		{"homie/sdm1-1/$state", "ready", true},
+		{"homie/sdm1-1/$state", "alert", true},
+		{"homie/sdm1-1/$state", "disconnected", false},
+		{"homie/sdm1-1/$state", "lost", false},
+		{"homie/mbmd/$state", "ready", false},
+		{"homie/sdm1-1/meter/$state", "ready", false},
+		{"homie/sdm1-1/$name", "ready", false},
+	} {
+		if stale := hr.isStale(tc.topic, tc.payload); stale != tc.stale {
+			t.Errorf("%s %s: expected %v, got %v", tc.topic, tc.payload, tc.stale, stale)
+		}
+	}
+}
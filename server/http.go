@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"runtime"
@@ -15,8 +16,11 @@ import (
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/volkszaehler/mbmd/logger"
 )
 
+var httpLog = logger.Get(logger.HTTP)
+
 // Assets is the embedded assets file system
 var Assets fs.FS
 
@@ -26,6 +30,7 @@ const AssetsDir = "assets"
 // Httpd is an http server
 type Httpd struct {
 	router *mux.Router
+	api    *mux.Router
 	mc     *Cache
 	qe     DeviceInfo
 }
@@ -33,11 +38,11 @@ type Httpd struct {
 func (h *Httpd) mkIndexHandler() func(http.ResponseWriter, *http.Request) {
 	mainTemplate, err := fs.ReadFile(Assets, "index.html")
 	if err != nil {
-		log.Fatal("httpd: failed to load embedded template: " + err.Error())
+		httpLog.Fatal("failed to load embedded template: " + err.Error())
 	}
 	t, err := template.New("mbmd").Parse(string(mainTemplate))
 	if err != nil {
-		log.Fatal("httpd: failed to create main page template: ", err.Error())
+		httpLog.Fatal("failed to create main page template: ", err.Error())
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -52,7 +57,7 @@ func (h *Httpd) mkIndexHandler() func(http.ResponseWriter, *http.Request) {
 		}
 		err := t.Execute(w, data)
 		if err != nil {
-			log.Fatal("httpd: failed to render main page: ", err.Error())
+			httpLog.Fatal("failed to render main page: ", err.Error())
 		}
 	})
 }
@@ -83,7 +88,7 @@ func (h *Httpd) allDevicesHandler(
 
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(res); err != nil {
-			log.Printf("httpd: failed to encode JSON: %s", err.Error())
+			httpLog.Error("failed to encode JSON", "error", err)
 		}
 	})
 }
@@ -111,7 +116,7 @@ func (h *Httpd) singleDeviceHandler(
 
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			log.Printf("httpd: failed to encode JSON %s", err.Error())
+			httpLog.Error("failed to encode JSON", "error", err)
 		}
 	})
 }
@@ -121,7 +126,7 @@ func (h *Httpd) mkStatusHandler(s *Status) func(http.ResponseWriter, *http.Reque
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(s); err != nil {
-			log.Printf("httpd: failed to encode JSON: %s", err.Error())
+			httpLog.Error("failed to encode JSON", "error", err)
 		}
 	})
 }
@@ -174,6 +179,7 @@ func NewHttpd(hub *SocketHub, s *Status, qe DeviceInfo, mc *Cache) *Httpd {
 
 	// api
 	api := srv.router.PathPrefix("/api").Subrouter()
+	srv.api = api
 	api.Use(jsonHandler)
 	api.Use(handlers.CompressHandler)
 
@@ -189,6 +195,16 @@ func NewHttpd(hub *SocketHub, s *Status, qe DeviceInfo, mc *Cache) *Httpd {
 	return srv
 }
 
+// AddCounters provides the tracked energy counters and the audit log of their discontinuities at /api/counters
+func (h *Httpd) AddCounters(c *Counters) {
+	h.api.HandleFunc("/counters", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(c.Status()); err != nil {
+			httpLog.Error("failed to encode JSON", "error", err)
+		}
+	})
+}
+
 // Router returns the root router
 func (h *Httpd) Router() *mux.Router {
 	return h.router
@@ -196,7 +212,7 @@ func (h *Httpd) Router() *mux.Router {
 
 // Run executes the http server
 func (h *Httpd) Run(url string) {
-	log.Printf("httpd: starting api at %s", url)
+	httpLog.Info("starting api", "url", url)
 
 	// debug logger
 	_ = log.New(debugLogger{"superfluous"}, "", 0)
@@ -207,9 +223,9 @@ func (h *Httpd) Run(url string) {
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
-		// ErrorLog: debug,
+		ErrorLog:     slog.NewLogLogger(httpLog.Handler(), slog.LevelWarn),
 	}
 
 	srv.SetKeepAlivesEnabled(true)
-	log.Fatal(srv.ListenAndServe())
+	httpLog.Fatal(srv.ListenAndServe())
 }
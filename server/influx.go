@@ -1,75 +1,197 @@
 package server
 
 import (
-	"fmt"
-	"log"
+	"context"
 	"time"
 
-	influxdb "github.com/influxdata/influxdb-client-go/v2"
-	api "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/volkszaehler/mbmd/logger"
 )
 
-// Influx is an InfluxDB v2 publisher
+const influxForwardTimeout = 30 * time.Second
+
+var influxLog = logger.Get(logger.Influx)
+
+// InfluxOptions describes the InfluxDB publisher configuration
+type InfluxOptions struct {
+	// URL is an InfluxDB http(s) url or a line protocol sink
+	// like file:///path, udp://host:port, tcp://host:port or unix:///path
+	URL          string
+	API          string // v2 (default) or v1 for http(s) urls
+	Database     string
+	Measurement  string
+	Organization string
+	Token        string
+	User         string
+	Password     string
+	Batch        bool              // write one point per device and query cycle
+	Metadata     bool              // tag points with device manufacturer, model, serial and name
+	Tags         map[string]string // static tags
+}
+
+// Influx is an InfluxDB publisher
 type Influx struct {
-	client      influxdb.Client
-	writer      api.WriteAPI
-	measurement string
+	InfluxOptions
+	writer influxWriter
+	qe     DeviceInfo
+	tags   map[string]map[string]string
 }
 
 // NewInfluxClient creates new publisher for influx
-func NewInfluxClient(
-	url string,
-	database string,
-	measurement string,
-	org string,
-	token string,
-	user string,
-	password string,
-) *Influx {
-	// InfluxDB v1 compatibility
-	if token == "" && user != "" {
-		token = fmt.Sprintf("%s:%s", user, password)
+func NewInfluxClient(opts InfluxOptions, qe DeviceInfo) *Influx {
+	if opts.Measurement == "" {
+		influxLog.Fatal("missing measurement")
 	}
 
-	client := influxdb.NewClient(url, token)
-
-	if database == "" {
-		log.Fatal("influx: missing database")
-	}
-	if measurement == "" {
-		log.Fatal("influx: missing measurement")
+	writer, err := newInfluxWriter(opts)
+	if err != nil {
+		influxLog.Fatal(err)
 	}
 
 	return &Influx{
-		client:      client,
-		measurement: measurement,
-		writer:      client.WriteAPI(org, database),
+		InfluxOptions: opts,
+		writer:        writer,
+		qe:            qe,
+		tags:          make(map[string]map[string]string),
 	}
 }
 
-// Run Influx publisher
-func (m *Influx) Run(in <-chan QuerySnip) {
-	// log errors
-	go func() {
-		for err := range m.writer.Errors() {
-			log.Printf("influxdb error: %v", err)
+// deviceTags returns static and metadata tags of the device
+func (m *Influx) deviceTags(device string) map[string]string {
+	if tags, ok := m.tags[device]; ok {
+		return tags
+	}
+
+	tags := make(map[string]string, len(m.Tags)+5)
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+
+	if m.Metadata {
+		desc := m.qe.DeviceDescriptorByID(device)
+		for k, v := range map[string]string{
+			"manufacturer": desc.Manufacturer,
+			"model":        desc.Model,
+			"serial":       desc.Serial,
+			"name":         m.qe.DeviceName(device),
+		} {
+			if v != "" {
+				tags[k] = v
+			}
 		}
-	}()
+	}
 
-	for snip := range in {
-		tags := map[string]string{
-			"device": snip.Device,
-			"type":   snip.Measurement.String(),
+	tags["device"] = device
+	m.tags[device] = tags
+
+	return tags
+}
+
+// point creates a point with the device's tags and the given extra tags
+func (m *Influx) point(device string, extra map[string]string, fields map[string]any, ts time.Time) *write.Point {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	tags := m.deviceTags(device)
+	if len(extra) > 0 {
+		merged := make(map[string]string, len(tags)+len(extra))
+		for k, v := range tags {
+			merged[k] = v
+		}
+		for k, v := range extra {
+			merged[k] = v
 		}
+		tags = merged
+	}
+
+	return write.NewPoint(m.Measurement, tags, fields, ts)
+}
+
+// snipPoint creates a point of a single reading
+func (m *Influx) snipPoint(snip QuerySnip) *write.Point {
+	tags := map[string]string{
+		"type": snip.Measurement.String(),
+	}
+
+	// tag implausible readings
+	if snip.Quality != QualityGood {
+		tags["quality"] = snip.Quality.String()
+	}
 
-		fields := map[string]any{
-			"value": snip.Value,
+	fields := map[string]any{
+		"value": snip.Value,
+	}
+
+	return m.point(snip.Device, tags, fields, snip.Timestamp)
+}
+
+// batchPoint creates a point of a device's readings with each measurement as field
+func (m *Influx) batchPoint(batch *DeviceBatch) *write.Point {
+	fields := make(map[string]any, len(batch.Values))
+	for measurement, v := range batch.Values {
+		fields[measurement.String()] = v
+	}
+
+	return m.point(batch.Device, nil, fields, batch.Timestamp)
+}
+
+// writeSnip writes a single reading
+func (m *Influx) writeSnip(snip QuerySnip) {
+	m.writer.WritePoint(m.snipPoint(snip))
+}
+
+// writeBatch writes a device's readings as single point
+func (m *Influx) writeBatch(batch *DeviceBatch) {
+	m.writer.WritePoint(m.batchPoint(batch))
+}
+
+// Forward implements Forwarder. Points are written synchronously.
+func (m *Influx) Forward(snips []QuerySnip) error {
+	points := make([]*write.Point, 0, len(snips))
+
+	if m.Batch {
+		for _, snip := range snips {
+			if snip.Quality != QualityGood {
+				points = append(points, m.snipPoint(snip))
+			}
 		}
+		for _, batch := range groupBatches(goodSnips(snips)) {
+			points = append(points, m.batchPoint(batch))
+		}
+	} else {
+		for _, snip := range snips {
+			points = append(points, m.snipPoint(snip))
+		}
+	}
 
-		// write asynchronously
-		p := influxdb.NewPoint(m.measurement, tags, fields, time.Now())
-		m.writer.WritePoint(p)
+	if len(points) == 0 {
+		return nil
 	}
 
-	m.client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), influxForwardTimeout)
+	defer cancel()
+
+	return m.writer.Write(ctx, points...)
+}
+
+// Run Influx publisher
+func (m *Influx) Run(in <-chan QuerySnip) {
+	defer m.writer.Close()
+
+	if !m.Batch {
+		for snip := range in {
+			m.writeSnip(snip)
+		}
+		return
+	}
+
+	// implausible readings are written individually with quality tag
+	newBatcher(batchWindow, m.writeBatch).run(in, func(snip QuerySnip) bool {
+		if snip.Quality != QualityGood {
+			m.writeSnip(snip)
+			return false
+		}
+		return true
+	})
 }
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func influxSnips(device string, ts time.Time) []QuerySnip {
+	return []QuerySnip{
+		{Device: device, MeasurementResult: result(meters.Power, 1500, ts)},
+		{Device: device, MeasurementResult: result(meters.Import, 42, ts)},
+	}
+}
+
+func runInflux(opts InfluxOptions, snips []QuerySnip) {
+	influx := NewInfluxClient(opts, deviceNames{"SDM1.1": "garage"})
+
+	in := make(chan QuerySnip, len(snips))
+	for _, snip := range snips {
+		in <- snip
+	}
+	close(in)
+
+	influx.Run(in)
+}
+
+func TestInfluxLineProtocolBatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "readings.lp")
+	ts := time.Unix(1700000000, 0)
+
+	runInflux(InfluxOptions{
+		URL:         "file://" + file,
+		Measurement: "mbmd",
+		Batch:       true,
+		Metadata:    true,
+		Tags:        map[string]string{"site": "home"},
+	}, influxSnips("SDM1.1", ts))
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "mbmd,device=SDM1.1,name=garage,site=home Import=42,Power=1500 1700000000000000000\n"
+	if string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, string(b))
+	}
+}
+
+func TestInfluxV1(t *testing.T) {
+	var body, query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body += string(b)
+		query = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ts := time.Unix(1700000000, 0)
+	runInflux(InfluxOptions{
+		URL:         srv.URL,
+		API:         "v1",
+		Database:    "data",
+		Measurement: "mbmd",
+	}, influxSnips("SDM1.2", ts))
+
+	if query != "/write?db=data&precision=ns" {
+		t.Errorf("unexpected request %s", query)
+	}
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 2 || lines[0] != "mbmd,device=SDM1.2,type=Power value=1500 1700000000000000000" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb-client-go/v2"
+	api "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	influxFlushInterval = time.Second
+	influxBatchSize     = 1000
+)
+
+// influxWriter writes points to InfluxDB or a line protocol sink
+type influxWriter interface {
+	// WritePoint writes asynchronously
+	WritePoint(p *write.Point)
+	// Write writes synchronously
+	Write(ctx context.Context, points ...*write.Point) error
+	Close()
+}
+
+// newInfluxWriter creates a writer depending on the url's scheme
+func newInfluxWriter(opts InfluxOptions) (influxWriter, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if opts.Database == "" {
+			return nil, fmt.Errorf("missing database")
+		}
+		if opts.API == "v1" {
+			return newInfluxV1Writer(u, opts.Database, opts.User, opts.Password), nil
+		}
+		return newInfluxV2Writer(opts), nil
+
+	case "file":
+		return newInfluxLineWriter(func() (io.WriteCloser, error) {
+			return os.OpenFile(u.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		}), nil
+
+	case "udp", "tcp":
+		return newInfluxLineWriter(func() (io.WriteCloser, error) {
+			return net.Dial(u.Scheme, u.Host)
+		}), nil
+
+	case "unix":
+		return newInfluxLineWriter(func() (io.WriteCloser, error) {
+			return net.Dial(u.Scheme, u.Path)
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("invalid url scheme: %s", u.Scheme)
+	}
+}
+
+// influxV2Writer writes using the InfluxDB v2 api. InfluxDB 1.8 is supported using user:password as token.
+type influxV2Writer struct {
+	client   influxdb.Client
+	writer   api.WriteAPI
+	blocking api.WriteAPIBlocking
+}
+
+func newInfluxV2Writer(opts InfluxOptions) *influxV2Writer {
+	token := opts.Token
+
+	// InfluxDB v1 compatibility
+	if token == "" && opts.User != "" {
+		token = fmt.Sprintf("%s:%s", opts.User, opts.Password)
+	}
+
+	client := influxdb.NewClient(opts.URL, token)
+	w := &influxV2Writer{
+		client:   client,
+		writer:   client.WriteAPI(opts.Organization, opts.Database),
+		blocking: client.WriteAPIBlocking(opts.Organization, opts.Database),
+	}
+
+	// log errors
+	go func() {
+		for err := range w.writer.Errors() {
+			influxLog.Error("write failed", "error", err)
+		}
+	}()
+
+	return w
+}
+
+func (w *influxV2Writer) WritePoint(p *write.Point) {
+	w.writer.WritePoint(p)
+}
+
+func (w *influxV2Writer) Write(ctx context.Context, points ...*write.Point) error {
+	return w.blocking.WritePoint(ctx, points...)
+}
+
+func (w *influxV2Writer) Close() {
+	w.client.Close()
+}
+
+// influxV1Writer posts batches of line protocol to the InfluxDB v1 /write endpoint
+type influxV1Writer struct {
+	url            string
+	user, password string
+	client         *http.Client
+	lines          chan string
+	done           chan struct{}
+}
+
+func newInfluxV1Writer(u *url.URL, database, user, password string) *influxV1Writer {
+	u = u.JoinPath("write")
+	u.RawQuery = url.Values{"db": {database}, "precision": {"ns"}}.Encode()
+
+	w := &influxV1Writer{
+		url:      u.String(),
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		lines:    make(chan string, influxBatchSize),
+		done:     make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+func (w *influxV1Writer) WritePoint(p *write.Point) {
+	w.lines <- write.PointToLineProtocol(p, time.Nanosecond)
+}
+
+func (w *influxV1Writer) Write(ctx context.Context, points ...*write.Point) error {
+	var buf bytes.Buffer
+	for _, p := range points {
+		buf.WriteString(write.PointToLineProtocol(p, time.Nanosecond))
+	}
+	return w.post(ctx, buf.Bytes())
+}
+
+func (w *influxV1Writer) Close() {
+	close(w.lines)
+	<-w.done
+}
+
+func (w *influxV1Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(influxFlushInterval)
+	defer ticker.Stop()
+
+	var buf bytes.Buffer
+	var count int
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if err := w.post(context.Background(), buf.Bytes()); err != nil {
+			influxLog.Error("write failed", "error", err, "points", count)
+		}
+		buf.Reset()
+		count = 0
+	}
+
+	for {
+		select {
+		case line, ok := <-w.lines:
+			if !ok {
+				flush()
+				return
+			}
+
+			buf.WriteString(line)
+			if count++; count >= influxBatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (w *influxV1Writer) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// influxLineWriter writes line protocol to a file or socket, reopening it after errors
+type influxLineWriter struct {
+	open func() (io.WriteCloser, error)
+	w    io.WriteCloser
+}
+
+func newInfluxLineWriter(open func() (io.WriteCloser, error)) *influxLineWriter {
+	return &influxLineWriter{open: open}
+}
+
+func (w *influxLineWriter) WritePoint(p *write.Point) {
+	if err := w.Write(context.Background(), p); err != nil {
+		influxLog.Error("write failed", "error", err)
+	}
+}
+
+func (w *influxLineWriter) Write(_ context.Context, points ...*write.Point) error {
+	if w.w == nil {
+		var err error
+		if w.w, err = w.open(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, p := range points {
+		buf.WriteString(write.PointToLineProtocol(p, time.Nanosecond))
+	}
+
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		w.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (w *influxLineWriter) Close() {
+	if w.w != nil {
+		w.w.Close()
+		w.w = nil
+	}
+}
@@ -1,13 +1,19 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"os"
 	"regexp"
 	"strings"
+	"text/template"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/volkszaehler/mbmd/logger"
 	"github.com/volkszaehler/mbmd/meters"
 )
 
@@ -17,13 +23,55 @@ const (
 
 var (
 	topicRE = regexp.MustCompile(`(\w+)([LTS]\d)`)
+	mqttLog = logger.Get(logger.MQTT)
 )
 
 // MqttClient is a MQTT publisher
 type MqttClient struct {
-	Client  MQTT.Client
-	qos     byte
-	verbose bool
+	Client MQTT.Client
+	qos    byte
+	log    *logger.Logger
+}
+
+// MqttTLS describes the TLS settings of a broker connection
+type MqttTLS struct {
+	CA       string // CA certificate file
+	Cert     string // client certificate file
+	Key      string // client key file
+	Insecure bool   // skip server certificate verification
+}
+
+// Config creates the TLS configuration or nil if no TLS settings are given
+func (t MqttTLS) Config() (*tls.Config, error) {
+	if t == (MqttTLS{}) {
+		return nil, nil
+	}
+
+	conf := &tls.Config{
+		InsecureSkipVerify: t.Insecure,
+	}
+
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid CA certificate: %s", t.CA)
+		}
+	}
+
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
 }
 
 // NewMqttOptions creates MQTT client options
@@ -46,31 +94,28 @@ func NewMqttOptions(
 func NewMqttClient(
 	options *MQTT.ClientOptions,
 	qos byte,
-	verbose bool,
+	log *logger.Logger,
 ) *MqttClient {
-	log.Printf("mqtt: connecting %s at %s", options.ClientID, options.Servers)
+	log = log.With("client", options.ClientID)
+	log.Info("connecting", "servers", fmt.Sprint(options.Servers))
 
 	client := MQTT.NewClient(options)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatalf("mqtt: error connecting: %s", token.Error())
-	}
-	if verbose {
-		log.Println("mqtt: connected")
+		log.Fatalf("error connecting: %s", token.Error())
 	}
+	log.Debug("connected")
 
 	return &MqttClient{
-		Client:  client,
-		qos:     qos,
-		verbose: verbose,
+		Client: client,
+		qos:    qos,
+		log:    log,
 	}
 }
 
 // Publish MQTT message with error handling
 func (m *MqttClient) Publish(topic string, retained bool, message interface{}) {
 	token := m.Client.Publish(topic, m.qos, retained, message)
-	if m.verbose {
-		log.Printf("mqtt: publish %s, message: %s", topic, message)
-	}
+	m.log.Debug("publish", "topic", topic, "message", message)
 	go m.WaitForToken(token)
 }
 
@@ -78,10 +123,10 @@ func (m *MqttClient) Publish(topic string, retained bool, message interface{}) {
 func (m *MqttClient) WaitForToken(token MQTT.Token) {
 	if token.WaitTimeout(publishTimeout) {
 		if token.Error() != nil {
-			log.Printf("mqtt: error: %s", token.Error())
+			m.log.Error("publish failed", "error", token.Error())
 		}
-	} else if m.verbose {
-		log.Println("mqtt: timeout")
+	} else {
+		m.log.Debug("timeout")
 	}
 }
 
@@ -91,48 +136,353 @@ func mqttDeviceTopic(deviceID string) string {
 	return strings.ReplaceAll(topic, ".", "-")
 }
 
+// PayloadFormat describes the MQTT message format
+type PayloadFormat int
+
+const (
+	PayloadPlain PayloadFormat = iota // bare value per measurement
+	PayloadJSON                       // json object per measurement
+	PayloadBatch                      // json object per device containing all measurements
+)
+
+// PayloadFormatString parses payload format names plain, json and batch
+func PayloadFormatString(s string) (PayloadFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "plain":
+		return PayloadPlain, nil
+	case "json":
+		return PayloadJSON, nil
+	case "batch":
+		return PayloadBatch, nil
+	default:
+		return 0, fmt.Errorf("invalid payload format: %s", s)
+	}
+}
+
+// DefaultMqttTemplate is the topic template of the default MQTT target
+const DefaultMqttTemplate = "{{.Topic}}/{{.Device}}/{{.Measurement}}/{{.Phase}}"
+
+// MqttTarget describes how readings are published to a broker
+type MqttTarget struct {
+	Topic    string        // root topic, used for status messages and in templates
+	Template string        // topic template, defaults to DefaultMqttTemplate
+	Payload  PayloadFormat // message format
+	Qos      byte
+	Retain   bool
+	Throttle time.Duration // minimum interval between messages on the same topic
+}
+
+// topicData holds the template placeholders for a topic.
+// Empty topic segments are removed after applying the template.
+type topicData struct {
+	Topic       string // root topic
+	Device      string // topic-safe device id
+	Name        string // configured device name, defaults to device
+	Measurement string // measurement name without phase, string, tariff or battery index
+	Phase       string // index suffix like L1, S2, T1 or B1
+	Unit        string
+}
+
 // MqttRunner allows to attach an MqttClient as broadcast receiver
 type MqttRunner struct {
 	*MqttClient
-	topic string
+	MqttTarget
+	qe        DeviceInfo
+	template  *template.Template
+	published map[string]time.Time
 }
 
-// NewMqttRunner create a new runer for plain MQTT
-func NewMqttRunner(options *MQTT.ClientOptions, qos byte, topic string, verbose bool) *MqttRunner {
+// NewMqttRunner create a new runner publishing readings to the given target
+func NewMqttRunner(options *MQTT.ClientOptions, target MqttTarget, qe DeviceInfo) (*MqttRunner, error) {
+	if target.Template == "" {
+		target.Template = DefaultMqttTemplate
+	}
+
+	tmpl, err := template.New("topic").Option("missingkey=error").Parse(target.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic template: %w", err)
+	}
+
 	// set will
-	lwt := fmt.Sprintf("%s/status", topic)
-	options.SetWill(lwt, "disconnected", qos, true)
+	lwt := fmt.Sprintf("%s/status", target.Topic)
+	options.SetWill(lwt, "disconnected", target.Qos, true)
 
-	client := NewMqttClient(options, qos, verbose)
+	client := NewMqttClient(options, target.Qos, mqttLog)
+
+	// notify connection and override will
+	client.Publish(lwt, true, "connected")
 
 	return &MqttRunner{
 		MqttClient: client,
-		topic:      topic,
-	}
+		MqttTarget: target,
+		qe:         qe,
+		template:   tmpl,
+		published:  make(map[string]time.Time),
+	}, nil
 }
 
-// topicFromMeasurement converts measurements of type MeasureLx/MeasureSx/MeasureTx to hierarchical Measure/Lx topics
-func topicFromMeasurement(measurement meters.Measurement) string {
+// splitMeasurement splits measurements of type MeasureLx/MeasureSx/MeasureTx/MeasureBx into name and index suffix
+func splitMeasurement(measurement meters.Measurement) (string, string) {
+	if base, typ, _ := measurement.Index(); typ != meters.NoIndex {
+		return base.String(), strings.TrimPrefix(measurement.String(), base.String())
+	}
+
 	name := measurement.String()
 	match := topicRE.FindStringSubmatch(name)
 	if len(match) != 3 {
+		return name, ""
+	}
+
+	return match[1], match[2]
+}
+
+// topicFromMeasurement converts measurements of type MeasureLx/MeasureSx/MeasureTx/MeasureBx to hierarchical Measure/Lx topics
+func topicFromMeasurement(measurement meters.Measurement) string {
+	name, suffix := splitMeasurement(measurement)
+	if suffix == "" {
 		return name
 	}
+	return fmt.Sprintf("%s/%s", name, suffix)
+}
+
+// mqttSafe removes characters not allowed in topic segments
+func mqttSafe(s string) string {
+	return strings.NewReplacer("/", "-", "#", "", "+", "").Replace(s)
+}
+
+// topic creates the topic for the device and optional measurement
+func (m *MqttRunner) topic(device string, measurement *meters.Measurement) (string, error) {
+	data := topicData{
+		Topic:  m.Topic,
+		Device: mqttDeviceTopic(device),
+		Name:   mqttDeviceTopic(device),
+	}
+
+	if name := m.qe.DeviceName(device); name != "" {
+		data.Name = mqttSafe(name)
+	}
+
+	if measurement != nil {
+		data.Measurement, data.Phase = splitMeasurement(*measurement)
+		_, unit := measurement.DescriptionAndUnit()
+		data.Unit = mqttSafe(unit)
+	}
+
+	var b strings.Builder
+	if err := m.template.Execute(&b, data); err != nil {
+		return "", err
+	}
 
-	topic := fmt.Sprintf("%s/%s", match[1], match[2])
+	// remove empty segments
+	segments := strings.Split(b.String(), "/")
+	res := segments[:0]
+	for _, s := range segments {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+
+	return strings.Join(res, "/"), nil
+}
+
+// throttled returns true if a message was published on the topic within the throttle interval
+func (m *MqttRunner) throttled(topic string, ts time.Time) bool {
+	if m.Throttle <= 0 {
+		return false
+	}
+
+	if last, ok := m.published[topic]; ok && ts.Sub(last) < m.Throttle {
+		return true
+	}
 
-	return topic
+	m.published[topic] = ts
+	return false
 }
 
-// Run MqttClient publisher
+func (m *MqttRunner) publish(topic string, ts time.Time, message interface{}) {
+	if m.throttled(topic, ts) {
+		return
+	}
+	m.Publish(topic, m.Retain, message)
+}
+
+// valueMessage is the json payload of a single reading
+type valueMessage struct {
+	Device      string
+	Name        string `json:",omitempty"`
+	Measurement string
+	Value       float64
+	Unit        string `json:",omitempty"`
+	Timestamp   time.Time
+	Quality     string `json:",omitempty"` // implausible readings only
+}
+
+// batchMessage is the json payload of a device's readings
+type batchMessage struct {
+	Device    string
+	Name      string `json:",omitempty"`
+	Timestamp time.Time
+	Values    map[string]float64
+	Quality   map[string]string `json:",omitempty"` // implausible values only
+}
+
+// flagged returns true if the reading is published. Plain payloads carry no quality flag
+// and are limited to plausible readings.
+func (m *MqttRunner) flagged(snip QuerySnip) bool {
+	return m.Payload != PayloadPlain || snip.Quality == QualityGood
+}
+
+// snipMessage creates topic and message of a single reading
+func (m *MqttRunner) snipMessage(snip QuerySnip) (string, interface{}, error) {
+	topic, err := m.topic(snip.Device, &snip.Measurement)
+	if err != nil {
+		return "", nil, fmt.Errorf("topic template: %w", err)
+	}
+
+	if m.Payload != PayloadJSON {
+		return topic, fmt.Sprintf("%.3f", snip.Value), nil
+	}
+
+	_, unit := snip.Measurement.DescriptionAndUnit()
+	message := valueMessage{
+		Device:      snip.Device,
+		Name:        m.qe.DeviceName(snip.Device),
+		Measurement: snip.Measurement.String(),
+		Value:       snip.Value,
+		Unit:        unit,
+		Timestamp:   snip.Timestamp,
+	}
+	if snip.Quality != QualityGood {
+		message.Quality = snip.Quality.String()
+	}
+
+	b, err := json.Marshal(message)
+
+	return topic, b, err
+}
+
+// batchMessage creates topic and message of a device's readings
+func (m *MqttRunner) batchMessage(batch *DeviceBatch) (string, interface{}, error) {
+	topic, err := m.topic(batch.Device, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("topic template: %w", err)
+	}
+
+	message := batchMessage{
+		Device:    batch.Device,
+		Name:      m.qe.DeviceName(batch.Device),
+		Timestamp: batch.Timestamp,
+		Values:    make(map[string]float64, len(batch.Values)),
+	}
+	for m, v := range batch.Values {
+		message.Values[m.String()] = v
+	}
+	for m, q := range batch.Quality {
+		if message.Quality == nil {
+			message.Quality = make(map[string]string, len(batch.Quality))
+		}
+		message.Quality[m.String()] = q.String()
+	}
+
+	b, err := json.Marshal(message)
+	return topic, b, err
+}
+
+func (m *MqttRunner) publishSnip(snip QuerySnip) {
+	topic, message, err := m.snipMessage(snip)
+	if err != nil {
+		m.log.Error("creating message", "error", err)
+		return
+	}
+
+	m.publish(topic, snip.Timestamp, message)
+}
+
+func (m *MqttRunner) publishBatch(batch *DeviceBatch) {
+	topic, message, err := m.batchMessage(batch)
+	if err != nil {
+		m.log.Error("creating message", "error", err)
+		return
+	}
+
+	m.publish(topic, batch.Timestamp, message)
+}
+
+// Forward implements Forwarder. Messages are published synchronously.
+func (m *MqttRunner) Forward(snips []QuerySnip) error {
+	if !m.Client.IsConnectionOpen() {
+		return errors.New("not connected")
+	}
+
+	type message struct {
+		topic   string
+		ts      time.Time
+		payload interface{}
+	}
+
+	var messages []message
+	add := func(topic string, ts time.Time, payload interface{}, err error) {
+		if err != nil {
+			m.log.Error("creating message", "error", err)
+			return
+		}
+		messages = append(messages, message{topic, ts, payload})
+	}
+
+	if m.Payload == PayloadBatch {
+		for _, batch := range groupBatches(snips) {
+			topic, payload, err := m.batchMessage(batch)
+			add(topic, batch.Timestamp, payload, err)
+		}
+	} else {
+		for _, snip := range snips {
+			if !m.flagged(snip) {
+				continue
+			}
+
+			topic, payload, err := m.snipMessage(snip)
+			add(topic, snip.Timestamp, payload, err)
+		}
+	}
+
+	for _, msg := range messages {
+		if m.throttled(msg.topic, msg.ts) {
+			continue
+		}
+
+		token := m.Client.Publish(msg.topic, m.qos, m.Retain, msg.payload)
+
+		err := errors.New("timeout")
+		if token.WaitTimeout(publishTimeout) {
+			err = token.Error()
+		}
+
+		if err != nil {
+			// allow republishing on retry
+			delete(m.published, msg.topic)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run MqttClient publisher. Implausible readings are only received if publishing
+// them is enabled, json payloads include their quality while plain payloads skip them.
 func (m *MqttRunner) Run(in <-chan QuerySnip) {
-	// notify connection and override will
-	m.Publish(fmt.Sprintf("%s/status", m.topic), true, "connected")
+	if m.Payload == PayloadBatch {
+		m.runBatch(in)
+		return
+	}
 
 	for snip := range in {
-		subtopic := topicFromMeasurement(snip.Measurement)
-		topic := fmt.Sprintf("%s/%s/%s", m.topic, mqttDeviceTopic(snip.Device), subtopic)
-		message := fmt.Sprintf("%.3f", snip.Value)
-		go m.Publish(topic, false, message)
+		if m.flagged(snip) {
+			m.publishSnip(snip)
+		}
 	}
 }
+
+// runBatch collects each device's readings of a query cycle into a single message
+func (m *MqttRunner) runBatch(in <-chan QuerySnip) {
+	newBatcher(batchWindow, m.publishBatch).run(in, nil)
+}
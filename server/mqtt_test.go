@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+type deviceNames map[string]string
+
+func (d deviceNames) DeviceDescriptorByID(id string) meters.DeviceDescriptor {
+	return meters.DeviceDescriptor{}
+}
+
+func (d deviceNames) DeviceName(id string) string {
+	return d[id]
+}
+
+func TestMqttTopic(t *testing.T) {
+	names := deviceNames{"SDM1.1": "garage/main"}
+
+	for _, tc := range []struct {
+		template    string
+		device      string
+		measurement *meters.Measurement
+		topic       string
+	}{
+		{DefaultMqttTemplate, "SDM1.1", measurement(meters.PowerL1), "mbmd/sdm1-1/Power/L1"},
+		{DefaultMqttTemplate, "SDM1.2", measurement(meters.Frequency), "mbmd/sdm1-2/Frequency"},
+		{DefaultMqttTemplate, "SUNS1.1", measurement(meters.Indexed(meters.DCPower, meters.StringIndex, 12)), "mbmd/suns1-1/DCPower/S12"},
+		{"{{.Topic}}/{{.Name}}", "SDM1.1", nil, "mbmd/garage-main"},
+		{"{{.Topic}}/{{.Name}}", "SDM1.2", nil, "mbmd/sdm1-2"},
+		{"home/{{.Name}}/{{.Measurement}}_{{.Unit}}/{{.Phase}}", "SDM1.1", measurement(meters.CurrentL3), "home/garage-main/Current_A/L3"},
+		{"{{.Topic}}/{{.Device}}/{{.Measurement}}_{{.Unit}}", "MBUS1.1", measurement(meters.VolumeFlow), "mbmd/mbus1-1/VolumeFlow_m³-h"},
+	} {
+		m := &MqttRunner{
+			MqttTarget: MqttTarget{Topic: "mbmd"},
+			qe:         names,
+			template:   template.Must(template.New("topic").Parse(tc.template)),
+		}
+
+		topic, err := m.topic(tc.device, tc.measurement)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topic != tc.topic {
+			t.Errorf("expected topic %s, got %s", tc.topic, topic)
+		}
+	}
+}
+
+func TestMqttThrottle(t *testing.T) {
+	m := &MqttRunner{
+		MqttTarget: MqttTarget{Throttle: 10 * time.Second},
+		published:  make(map[string]time.Time),
+	}
+
+	now := time.Now()
+	if m.throttled("a", now) {
+		t.Error("first message must not be throttled")
+	}
+	if !m.throttled("a", now.Add(5*time.Second)) {
+		t.Error("expected message to be throttled")
+	}
+	if m.throttled("b", now.Add(5*time.Second)) {
+		t.Error("topics must be throttled independently")
+	}
+	if m.throttled("a", now.Add(10*time.Second)) {
+		t.Error("expected message after throttle interval")
+	}
+}
+
+func TestMqttQuality(t *testing.T) {
+	m := &MqttRunner{
+		MqttTarget: MqttTarget{Topic: "mbmd", Payload: PayloadJSON},
+		qe:         deviceNames{},
+		template:   template.Must(template.New("topic").Parse(DefaultMqttTemplate)),
+	}
+
+	ts := time.Now()
+	snips := []QuerySnip{
+		{Device: "SDM1.1", MeasurementResult: meters.MeasurementResult{Measurement: meters.Power, Value: 3.4e38, Timestamp: ts}, Quality: QualityInvalid},
+		{Device: "SDM1.1", MeasurementResult: meters.MeasurementResult{Measurement: meters.Import, Value: 12, Timestamp: ts}},
+	}
+
+	_, payload, err := m.snipMessage(snips[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value valueMessage
+	if err := json.Unmarshal(payload.([]byte), &value); err != nil || value.Quality != "invalid" {
+		t.Errorf("expected invalid quality, got %s %v", payload, err)
+	}
+
+	// plain payloads carry no quality flag
+	if !m.flagged(snips[0]) {
+		t.Error("expected json payload to include implausible readings")
+	}
+	if m.Payload = PayloadPlain; m.flagged(snips[0]) || !m.flagged(snips[1]) {
+		t.Error("expected plain payload to skip implausible readings")
+	}
+
+	_, payload, err = m.batchMessage(groupBatches(snips)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var batch batchMessage
+	if err := json.Unmarshal(payload.([]byte), &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Values) != 2 || len(batch.Quality) != 1 || batch.Quality["Power"] != "invalid" {
+		t.Errorf("unexpected batch %s", payload)
+	}
+}
+
+func measurement(m meters.Measurement) *meters.Measurement {
+	return &m
+}
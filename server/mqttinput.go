@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/meters/rest"
+)
+
+// MqttInputType is the device type of devices received via MQTT
+const MqttInputType = "MQTT"
+
+// mqttInputCheckInterval is the interval of checking devices for stale readings
+const mqttInputCheckInterval = time.Second
+
+// MqttInputValue maps a topic's payload to a measurement
+type MqttInputValue struct {
+	Topic       string // topic filter, may contain wildcards
+	Path        string // gjson-style path of JSON payloads, empty for plain numbers
+	Measurement meters.Measurement
+	Scale       float64
+}
+
+// MqttInputDevice describes a device whose readings are received via MQTT
+type MqttInputDevice struct {
+	ID           uint8
+	Availability string        // availability topic
+	Online       string        // availability payload, defaults to online
+	Offline      string        // availability payload, defaults to offline
+	Timeout      time.Duration // devices without readings for timeout are offline
+	Values       []MqttInputValue
+	DeviceOptions
+}
+
+type mqttInputState struct {
+	*MqttInputDevice
+	id        string
+	status    RuntimeInfo
+	last      time.Time // last reading
+	available bool      // availability topic state
+	log       *logger.Logger
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// MqttInput receives readings of devices publishing to MQTT and injects them as query results
+type MqttInput struct {
+	Counters *Counters // energy counter continuity, disabled if nil
+	options  *MQTT.ClientOptions
+	qos      byte
+	devices  []*mqttInputState
+	msgs     chan mqttMessage
+	done     chan struct{}
+}
+
+// NewMqttInput creates an MQTT input for the given devices
+func NewMqttInput(options *MQTT.ClientOptions, qos byte, devices []MqttInputDevice) *MqttInput {
+	m := &MqttInput{
+		options: options,
+		qos:     qos,
+		msgs:    make(chan mqttMessage),
+		done:    make(chan struct{}),
+	}
+
+	for i := range devices {
+		dev := &devices[i]
+		if dev.Online == "" {
+			dev.Online = "online"
+		}
+		if dev.Offline == "" {
+			dev.Offline = "offline"
+		}
+		if dev.Plausibility == nil {
+			dev.Plausibility = NewPlausibility(0, nil)
+		}
+
+		id := fmt.Sprintf("%s1.%d", MqttInputType, dev.ID)
+		m.devices = append(m.devices, &mqttInputState{
+			MqttInputDevice: dev,
+			id:              id,
+			log:             mqttLog.With("device", id),
+		})
+	}
+
+	return m
+}
+
+// Devices implements the Input interface
+func (m *MqttInput) Devices() []InputDevice {
+	res := make([]InputDevice, 0, len(m.devices))
+	for _, dev := range m.devices {
+		res = append(res, InputDevice{
+			ID:   dev.id,
+			Name: dev.Name,
+			Descriptor: meters.DeviceDescriptor{
+				Type:         MqttInputType,
+				Manufacturer: MqttInputType,
+			},
+		})
+	}
+	return res
+}
+
+// topics returns the distinct topics to subscribe
+func (m *MqttInput) topics() map[string]byte {
+	res := make(map[string]byte)
+	for _, dev := range m.devices {
+		if dev.Availability != "" {
+			res[dev.Availability] = m.qos
+		}
+		for _, v := range dev.Values {
+			res[v.Topic] = m.qos
+		}
+	}
+	return res
+}
+
+// Run subscribes to the devices' topics and publishes their readings until the context is cancelled
+func (m *MqttInput) Run(ctx context.Context, control chan<- ControlSnip, results chan<- QuerySnip) {
+	// (re)subscribe on each connect as subscriptions don't survive clean sessions
+	m.options.SetOnConnectHandler(func(client MQTT.Client) {
+		token := client.SubscribeMultiple(m.topics(), nil)
+		if token.Wait() && token.Error() != nil {
+			mqttLog.Error("subscribe failed", "error", token.Error())
+		}
+	})
+
+	m.options.SetDefaultPublishHandler(func(_ MQTT.Client, msg MQTT.Message) {
+		select {
+		case m.msgs <- mqttMessage{topic: msg.Topic(), payload: msg.Payload()}:
+		case <-m.done:
+		}
+	})
+
+	client := NewMqttClient(m.options, m.qos, mqttLog).Client
+
+	// devices are offline until the first reading or availability message
+	for _, dev := range m.devices {
+		control <- ControlSnip{
+			Device: dev.id,
+			Status: dev.status,
+		}
+	}
+
+	ticker := time.NewTicker(mqttInputCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(m.done)
+			client.Disconnect(uint(publishTimeout.Milliseconds()))
+			return
+		case msg := <-m.msgs:
+			m.handle(msg.topic, msg.payload, time.Now(), control, results)
+		case now := <-ticker.C:
+			m.check(now, control)
+		}
+	}
+}
+
+// handle processes a received message
+func (m *MqttInput) handle(topic string, payload []byte, now time.Time, control chan<- ControlSnip, results chan<- QuerySnip) {
+	for _, dev := range m.devices {
+		if dev.Availability == topic {
+			p := strings.TrimSpace(string(payload))
+			switch {
+			case strings.EqualFold(p, dev.Online):
+				dev.available = true
+			case strings.EqualFold(p, dev.Offline):
+				dev.available = false
+			default:
+				dev.log.Warn("unexpected availability payload", "topic", topic, "payload", p)
+			}
+			m.update(dev, now, control)
+		}
+
+		var (
+			received bool
+			snips    []QuerySnip
+		)
+
+		for _, v := range dev.Values {
+			if !topicMatches(v.Topic, topic) {
+				continue
+			}
+
+			dev.status.Requests++
+			f, err := v.extract(payload)
+			if err != nil {
+				dev.status.Errors++
+				dev.log.Warn("invalid payload", "topic", topic, "measurement", v.Measurement.String(), "error", err)
+				continue
+			}
+
+			r := meters.MeasurementResult{
+				Measurement: v.Measurement,
+				Value:       f,
+				Timestamp:   now,
+			}
+
+			received = true
+			dev.last = now
+
+			if !dev.Transforms.apply(&r) {
+				continue
+			}
+
+			decrease := dev.Plausibility.decreases(r)
+
+			snip, ok := dev.validate(dev.id, r, &dev.status, dev.log)
+			if ok {
+				snips = append(snips, snip)
+			}
+
+			// implausible readings are not tracked except for counter decreases debounced by the counters
+			if m.Counters == nil || snip.Quality != QualityGood && !decrease {
+				continue
+			}
+
+			if v, ok := m.Counters.Update(dev.id, "", r); ok {
+				if snip, ok := dev.validate(dev.id, v, &dev.status, dev.log); ok {
+					snips = append(snips, snip)
+				}
+			}
+		}
+
+		if received {
+			m.update(dev, now, control)
+		}
+
+		for _, snip := range snips {
+			results <- snip
+		}
+	}
+}
+
+// check marks devices without recent readings offline
+func (m *MqttInput) check(now time.Time, control chan<- ControlSnip) {
+	for _, dev := range m.devices {
+		if dev.status.Online && !dev.online(now) {
+			m.update(dev, now, control)
+		}
+	}
+}
+
+// online determines the device's online state from its availability and last reading
+func (dev *mqttInputState) online(now time.Time) bool {
+	if dev.Availability != "" && !dev.available {
+		return false
+	}
+
+	if dev.Timeout > 0 && now.Sub(dev.last) > dev.Timeout {
+		return false
+	}
+
+	return dev.available || !dev.last.IsZero()
+}
+
+// update sends the device's status
+func (m *MqttInput) update(dev *mqttInputState, now time.Time, control chan<- ControlSnip) {
+	if online := dev.online(now); online != dev.status.Online {
+		dev.status.Online = online
+		if online {
+			dev.log.Info("device is online")
+		} else {
+			dev.log.Warn("device is offline")
+		}
+	}
+
+	control <- ControlSnip{
+		Device: dev.id,
+		Status: dev.status,
+	}
+}
+
+// extract returns the value's reading from the payload
+func (v MqttInputValue) extract(payload []byte) (float64, error) {
+	var f float64
+
+	if v.Path == "" {
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(string(payload)), 64); err != nil {
+			return 0, err
+		}
+	} else {
+		var doc any
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return 0, err
+		}
+
+		val, ok := rest.Get(doc, v.Path)
+		if !ok {
+			return 0, fmt.Errorf("missing %s", v.Path)
+		}
+
+		if f, ok = rest.Float(val); !ok {
+			return 0, fmt.Errorf("invalid %s: %v", v.Path, val)
+		}
+	}
+
+	if v.Scale != 0 {
+		f *= v.Scale
+	}
+
+	return f, nil
+}
+
+// topicMatches returns true if the topic matches the filter including + and # wildcards
+func topicMatches(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+
+	for i, f := range fs {
+		switch {
+		case f == "#":
+			return true
+		case i >= len(ts):
+			return false
+		case f != "+" && f != ts[i]:
+			return false
+		}
+	}
+
+	return len(fs) == len(ts)
+}
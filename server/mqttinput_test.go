@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestMqttTopicMatches(t *testing.T) {
+	for _, tc := range []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"tele/sml/SENSOR", "tele/sml/SENSOR", true},
+		{"tele/+/SENSOR", "tele/sml/SENSOR", true},
+		{"tele/#", "tele/sml/SENSOR", true},
+		{"tele/+", "tele/sml/SENSOR", false},
+		{"tele/sml/SENSOR", "tele/sml", false},
+		{"tele/sml", "tele/sml/SENSOR", false},
+	} {
+		if match := topicMatches(tc.filter, tc.topic); match != tc.match {
+			t.Errorf("%s %s: expected %v", tc.filter, tc.topic, tc.match)
+		}
+	}
+}
+
+func TestMqttInput(t *testing.T) {
+	m := NewMqttInput(nil, 0, []MqttInputDevice{{
+		ID:           1,
+		Availability: "tele/sml/LWT",
+		Online:       "Online",
+		Timeout:      time.Minute,
+		Values: []MqttInputValue{
+			{Topic: "tele/sml/SENSOR", Path: "SML.Total_in", Measurement: meters.Import},
+			{Topic: "tele/sml/SENSOR", Path: "SML.Power_curr", Measurement: meters.Power},
+			{Topic: "esphome/+/power", Measurement: meters.PowerL1, Scale: 1000},
+		},
+	}})
+
+	if devs := m.Devices(); len(devs) != 1 || devs[0].ID != "MQTT1.1" {
+		t.Fatalf("unexpected devices %v", devs)
+	}
+
+	control := make(chan ControlSnip, 10)
+	results := make(chan QuerySnip, 10)
+	now := time.Now()
+
+	// readings without availability
+	m.handle("tele/sml/SENSOR", []byte(`{"SML":{"Total_in":1234.5,"Power_curr":"500"}}`), now, control, results)
+	if c := <-control; c.Status.Online || c.Status.Requests != 2 {
+		t.Errorf("unexpected status %+v", c.Status)
+	}
+	if len(results) != 2 {
+		t.Fatalf("unexpected results %d", len(results))
+	}
+	for r := range len(results) {
+		snip := <-results
+		if expected := map[meters.Measurement]float64{meters.Import: 1234.5, meters.Power: 500}[snip.Measurement]; snip.Value != expected {
+			t.Errorf("%d: unexpected result %s", r, snip.String())
+		}
+	}
+
+	m.handle("tele/sml/LWT", []byte("Online"), now, control, results)
+	if c := <-control; !c.Status.Online {
+		t.Errorf("unexpected status %+v", c.Status)
+	}
+
+	// plain payload with wildcard topic
+	m.handle("esphome/meter/power", []byte("1.5"), now, control, results)
+	<-control
+	if snip := <-results; snip.Measurement != meters.PowerL1 || snip.Value != 1500 {
+		t.Errorf("unexpected result %s", snip.String())
+	}
+
+	// invalid payload
+	m.handle("esphome/meter/power", []byte("nan!"), now, control, results)
+	if len(control) != 0 || len(results) != 0 || m.devices[0].status.Errors != 1 {
+		t.Errorf("unexpected handling of invalid payload")
+	}
+
+	// stale readings
+	m.check(now.Add(30*time.Second), control)
+	if len(control) != 0 {
+		t.Error("unexpected status update")
+	}
+
+	m.check(now.Add(2*time.Minute), control)
+	if c := <-control; c.Status.Online {
+		t.Errorf("unexpected status %+v", c.Status)
+	}
+
+	// availability
+	m.handle("tele/sml/SENSOR", []byte(`{"SML":{"Total_in":1234.6}}`), now.Add(3*time.Minute), control, results)
+	if c := <-control; !c.Status.Online {
+		t.Errorf("unexpected status %+v", c.Status)
+	}
+	<-results
+
+	m.handle("tele/sml/LWT", []byte("Offline"), now.Add(3*time.Minute), control, results)
+	if c := <-control; c.Status.Online {
+		t.Errorf("unexpected status %+v", c.Status)
+	}
+}
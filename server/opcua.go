@@ -0,0 +1,241 @@
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/opcua"
+)
+
+const opcuaNamespace = 1
+
+var opcuaLog = logger.Get(logger.OPCUA)
+
+// opcuaUnits maps measurement units to UNECE codes and names
+var opcuaUnits = map[string][2]string{
+	"W":     {"WTT", "watt"},
+	"kWh":   {"KWH", "kilowatt hour"},
+	"V":     {"VLT", "volt"},
+	"A":     {"AMP", "ampere"},
+	"Hz":    {"HTZ", "hertz"},
+	"VA":    {"D46", "volt - ampere"},
+	"var":   {"D44", "var"},
+	"kvarh": {"K3", "kilovolt ampere (reactive) hour"},
+	"°C":    {"CEL", "degree Celsius"},
+	"%":     {"P1", "percent"},
+	"°":     {"DD", "degree [unit of angle]"},
+	"K":     {"KEL", "kelvin"},
+	"m³":    {"MTQ", "cubic metre"},
+	"m³/h":  {"MQH", "cubic metre per hour"},
+}
+
+// OpcUaOptions configures the OPC UA server
+type OpcUaOptions struct {
+	Listen string
+}
+
+// OpcUaServer exposes devices and readings as OPC UA address space. Each device
+// is an object below the objects folder with its descriptor as properties, an
+// Online variable and a variable per measurement.
+type OpcUaServer struct {
+	srv      *opcua.Server
+	listener net.Listener
+	qe       DeviceInfo
+	cc       <-chan ControlSnip
+
+	mu      sync.Mutex
+	devices map[string]*opcuaDevice
+}
+
+type opcuaDevice struct {
+	id           string
+	measurements map[meters.Measurement]bool
+}
+
+// NewOpcUaServer creates the OPC UA server and starts listening
+func NewOpcUaServer(opts OpcUaOptions, qe DeviceInfo, cc <-chan ControlSnip) (*OpcUaServer, error) {
+	l, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := opcua.NewServer(opcua.Options{
+		ApplicationURI:  "urn:mbmd:server",
+		ApplicationName: "mbmd",
+		ProductURI:      "https://github.com/volkszaehler/mbmd",
+		NamespaceURI:    "urn:mbmd:devices",
+		Anonymous:       true, // user tokens require a secure policy which is not supported
+	})
+
+	return &OpcUaServer{
+		srv:      srv,
+		listener: l,
+		qe:       qe,
+		cc:       cc,
+		devices:  make(map[string]*opcuaDevice),
+	}, nil
+}
+
+func opcuaNode(id string) opcua.NodeID {
+	return opcua.NewStringNodeID(opcuaNamespace, id)
+}
+
+// device returns the device's object, creating it on first use. Must be called with lock held.
+func (s *OpcUaServer) device(id string) (*opcuaDevice, error) {
+	if dev, ok := s.devices[id]; ok {
+		return dev, nil
+	}
+
+	name := id
+	if n := s.qe.DeviceName(id); n != "" {
+		name = n
+	}
+
+	node := opcuaNode(id)
+	if err := s.srv.AddObject(opcua.ObjectsFolder, node, name, opcua.Organizes); err != nil {
+		return nil, err
+	}
+
+	descriptor := s.qe.DeviceDescriptorByID(id)
+	properties := []struct {
+		name  string
+		value any
+	}{
+		{"Type", descriptor.Type},
+		{"Manufacturer", descriptor.Manufacturer},
+		{"Model", descriptor.Model},
+		{"Options", descriptor.Options},
+		{"Version", descriptor.Version},
+		{"Serial", descriptor.Serial},
+		{"SubDevice", int32(descriptor.SubDevice)},
+	}
+
+	for _, p := range properties {
+		dataType := opcua.StringType
+		if _, ok := p.value.(int32); ok {
+			dataType = opcua.Int32Type
+		}
+		if err := s.srv.AddProperty(node, opcuaNode(id+"."+p.name), p.name, dataType, p.value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.srv.AddVariable(node, opcuaNode(id+".Online"), "Online", opcua.BooleanType, "Device online status"); err != nil {
+		return nil, err
+	}
+
+	dev := &opcuaDevice{
+		id:           id,
+		measurements: make(map[meters.Measurement]bool),
+	}
+	s.devices[id] = dev
+
+	return dev, nil
+}
+
+// measurement returns the measurement's variable, creating it on first use. Must be called with lock held.
+func (s *OpcUaServer) measurement(dev *opcuaDevice, m meters.Measurement) (opcua.NodeID, error) {
+	node := opcuaNode(dev.id + "." + m.String())
+	if dev.measurements[m] {
+		return node, nil
+	}
+
+	description, unit := m.DescriptionAndUnit()
+	if err := s.srv.AddVariable(opcuaNode(dev.id), node, m.String(), opcua.DoubleType, description); err != nil {
+		return node, err
+	}
+
+	eu := opcuaUnits[unit]
+	if err := s.srv.AddProperty(node, opcuaNode(dev.id+"."+m.String()+".EngineeringUnits"), "EngineeringUnits", opcua.EUInformationType, opcua.EUInformation(eu[0], unit, eu[1])); err != nil {
+		return node, err
+	}
+
+	dev.measurements[m] = true
+
+	return node, nil
+}
+
+// opcuaStatus maps reading quality to status codes
+func opcuaStatus(q Quality) opcua.StatusCode {
+	switch q {
+	case QualitySuspicious:
+		return opcua.StatusUncertain
+	case QualityInvalid:
+		return opcua.StatusBadOutOfRange
+	default:
+		return opcua.StatusGood
+	}
+}
+
+// update sets the measurement's value
+func (s *OpcUaServer) update(snip QuerySnip) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dev, err := s.device(snip.Device)
+	if err != nil {
+		opcuaLog.Error("adding device failed", "device", snip.Device, "error", err)
+		return
+	}
+
+	node, err := s.measurement(dev, snip.Measurement)
+	if err != nil {
+		opcuaLog.Error("adding measurement failed", "device", snip.Device, "measurement", snip.Measurement, "error", err)
+		return
+	}
+
+	s.srv.SetValue(node, opcua.DataValue{
+		Value:           snip.Value,
+		Status:          opcuaStatus(snip.Quality),
+		SourceTimestamp: snip.Timestamp,
+	})
+}
+
+// status updates the device's online status. Readings of offline devices are flagged as last usable values.
+func (s *OpcUaServer) status(device string, online bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dev, err := s.device(device)
+	if err != nil {
+		opcuaLog.Error("adding device failed", "device", device, "error", err)
+		return
+	}
+
+	node := opcuaNode(device + ".Online")
+	if v, _ := s.srv.Value(node); v.Value == online {
+		return
+	}
+
+	s.srv.SetValue(node, opcua.DataValue{Value: online})
+
+	if !online {
+		for m := range dev.measurements {
+			s.srv.SetStatus(opcuaNode(device+"."+m.String()), opcua.StatusUncertainLastUsableValue)
+		}
+	}
+}
+
+// Run OPC UA server
+func (s *OpcUaServer) Run(in <-chan QuerySnip) {
+	go func() {
+		for snip := range s.cc {
+			s.status(snip.Device, snip.Status.Online)
+		}
+	}()
+
+	go func() {
+		opcuaLog.Info("listening", "address", s.listener.Addr())
+		if err := s.srv.Serve(s.listener); err != nil {
+			opcuaLog.Error("server failed", "error", err)
+		}
+	}()
+
+	for snip := range in {
+		s.update(snip)
+	}
+
+	_ = s.srv.Close()
+}
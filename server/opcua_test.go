@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+	"github.com/volkszaehler/mbmd/opcua"
+)
+
+func TestOpcUaAddressSpace(t *testing.T) {
+	s, err := NewOpcUaServer(OpcUaOptions{Listen: "127.0.0.1:0"}, deviceNames{"SDM1.1": "main"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.listener.Close()
+
+	ts := time.Now()
+	s.update(QuerySnip{Device: "SDM1.1", MeasurementResult: result(meters.Power, 100, ts)})
+	s.update(QuerySnip{Device: "SDM1.1", MeasurementResult: result(meters.Import, 1, ts), Quality: QualityInvalid})
+	s.status("SDM1.1", true)
+
+	refs, status := s.srv.Browse(opcua.ObjectsFolder, opcua.BrowseForward, opcua.Organizes, false, 0)
+	if status != opcua.StatusGood || len(refs) != 2 || refs[1].BrowseName.Name != "main" {
+		t.Fatalf("unexpected objects %+v", refs)
+	}
+
+	if v, _ := s.srv.Value(opcuaNode("SDM1.1.Power")); v.Value != 100.0 || v.Status != opcua.StatusGood || !v.SourceTimestamp.Equal(ts) {
+		t.Errorf("unexpected power %+v", v)
+	}
+	if v, _ := s.srv.Value(opcuaNode("SDM1.1.Import")); v.Status != opcua.StatusBadOutOfRange {
+		t.Errorf("unexpected import %+v", v)
+	}
+	if v, _ := s.srv.Value(opcuaNode("SDM1.1.Online")); v.Value != true {
+		t.Errorf("unexpected online status %+v", v)
+	}
+
+	eu, _ := s.srv.Value(opcuaNode("SDM1.1.Import.EngineeringUnits"))
+	r := opcua.NewReader(eu.Value.(opcua.ExtensionObject).Body)
+	if r.Str(); r.Int32() != opcua.UnitID("KWH") || r.LocalizedText() != "kWh" {
+		t.Errorf("unexpected engineering units %+v", eu)
+	}
+
+	// readings of offline devices are last usable values
+	s.status("SDM1.1", false)
+	if v, _ := s.srv.Value(opcuaNode("SDM1.1.Power")); v.Value != 100.0 || v.Status != opcua.StatusUncertainLastUsableValue {
+		t.Errorf("unexpected offline power %+v", v)
+	}
+	if v, _ := s.srv.Value(opcuaNode("SDM1.1.Online")); v.Value != false {
+		t.Errorf("unexpected online status %+v", v)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// maxViolations is the number of consecutive implausible readings after which
+// the new value level is accepted as baseline
+const maxViolations = 3
+
+// Quality flags the plausibility of a reading
+type Quality int
+
+const (
+	QualityGood       Quality = iota
+	QualitySuspicious         // rate of change or counter increment exceeded
+	QualityInvalid            // out of physical range or decreasing counter
+)
+
+// String returns the quality's name
+func (q Quality) String() string {
+	switch q {
+	case QualitySuspicious:
+		return "suspicious"
+	case QualityInvalid:
+		return "invalid"
+	default:
+		return "good"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (q Quality) MarshalText() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// QualityStatus represents the number of readings flagged as implausible
+type QualityStatus struct {
+	Suspicious uint64
+	Invalid    uint64
+}
+
+type plausibilityState struct {
+	value      float64
+	timestamp  time.Time
+	violations int
+}
+
+// Plausibility validates readings of a single device against physical range,
+// maximum rate of change and energy counter consistency
+type Plausibility struct {
+	maxPower  float64
+	peakPower float64
+	limits    map[meters.Measurement]meters.Limits
+	last      map[meters.Measurement]*plausibilityState
+}
+
+// NewPlausibility creates a plausibility validator. Limits default to the
+// measurement's metadata and can be overridden per measurement. Energy counter
+// increments are bounded by maxPower (W). If maxPower is zero, the device's
+// observed peak power is used instead.
+func NewPlausibility(maxPower float64, limits map[meters.Measurement]meters.Limits) *Plausibility {
+	if limits == nil {
+		limits = make(map[meters.Measurement]meters.Limits)
+	}
+
+	return &Plausibility{
+		maxPower: maxPower,
+		limits:   limits,
+		last:     make(map[meters.Measurement]*plausibilityState),
+	}
+}
+
+// Limits returns the effective limits for the given measurement
+func (p *Plausibility) Limits(m meters.Measurement) meters.Limits {
+	if l, ok := p.limits[m]; ok {
+		return l
+	}
+
+	// overrides of the base measurement apply to all indexes
+	if base, _, _ := m.Index(); base != m {
+		if l, ok := p.limits[base]; ok {
+			return l
+		}
+	}
+
+	return m.Limits()
+}
+
+// decreases returns true if the reading is an energy counter within its physical range but
+// below the accepted value. Such readings are rated invalid but tracked by energy counters.
+func (p *Plausibility) decreases(r meters.MeasurementResult) bool {
+	limits := p.Limits(r.Measurement)
+	last, ok := p.last[r.Measurement]
+
+	return ok && limits.Counter && r.Value >= limits.Min && r.Value <= limits.Max && r.Value < last.value
+}
+
+// isPower returns true if the measurement represents total active power
+func isPower(m meters.Measurement) bool {
+	return m == meters.Power || m == meters.ImportPower || m == meters.ExportPower
+}
+
+// energy unit conversion factor to Wh
+func energyFactor(m meters.Measurement) float64 {
+	_, unit := m.DescriptionAndUnit()
+	if strings.HasPrefix(unit, "k") {
+		return 1e3
+	}
+	return 1
+}
+
+// Check validates a reading and returns its quality
+func (p *Plausibility) Check(r meters.MeasurementResult) Quality {
+	limits := p.Limits(r.Measurement)
+
+	if math.IsInf(r.Value, 0) || r.Value < limits.Min || r.Value > limits.Max {
+		return QualityInvalid
+	}
+
+	last, ok := p.last[r.Measurement]
+	if !ok {
+		p.accept(r)
+		return QualityGood
+	}
+
+	quality := QualityGood
+	delta := r.Value - last.value
+	seconds := r.Timestamp.Sub(last.timestamp).Seconds()
+
+	if limits.Counter {
+		if delta < 0 {
+			quality = QualityInvalid
+		} else if maxPower := p.counterPower(); maxPower > 0 && seconds > 0 {
+			// increment in Wh must not exceed what the power allows
+			if delta*energyFactor(r.Measurement) > maxPower*seconds/3600 {
+				quality = QualitySuspicious
+			}
+		}
+	} else if limits.Rate > 0 && seconds > 0 && math.Abs(delta)/seconds > limits.Rate {
+		quality = QualitySuspicious
+	}
+
+	if quality == QualityGood {
+		p.accept(r)
+		return quality
+	}
+
+	// accept new level if repeatedly confirmed
+	if last.violations++; last.violations >= maxViolations {
+		p.accept(r)
+	}
+
+	return quality
+}
+
+// counterPower returns the maximum power allowed for energy counter increments
+func (p *Plausibility) counterPower() float64 {
+	if p.maxPower > 0 {
+		return p.maxPower
+	}
+	if p.peakPower > 0 {
+		// allow for transients and unsynchronized counter updates
+		return 2*p.peakPower + 1000
+	}
+	return 0
+}
+
+func (p *Plausibility) accept(r meters.MeasurementResult) {
+	p.last[r.Measurement] = &plausibilityState{
+		value:     r.Value,
+		timestamp: r.Timestamp,
+	}
+
+	if isPower(r.Measurement) {
+		p.peakPower = math.Max(p.peakPower, math.Abs(r.Value))
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func result(m meters.Measurement, v float64, ts time.Time) meters.MeasurementResult {
+	return meters.MeasurementResult{
+		Measurement: m,
+		Value:       v,
+		Timestamp:   ts,
+	}
+}
+
+func TestPlausibilityRange(t *testing.T) {
+	p := NewPlausibility(0, nil)
+	now := time.Now()
+
+	if q := p.Check(result(meters.Power, 3.4e38, now)); q != QualityInvalid {
+		t.Errorf("expected invalid, got %s", q)
+	}
+	if q := p.Check(result(meters.CosphiL1, 1.5, now)); q != QualityInvalid {
+		t.Errorf("expected invalid, got %s", q)
+	}
+	if q := p.Check(result(meters.Power, 1200, now)); q != QualityGood {
+		t.Errorf("expected good, got %s", q)
+	}
+}
+
+func TestPlausibilityDefaultRate(t *testing.T) {
+	p := NewPlausibility(0, nil)
+	now := time.Now()
+
+	for _, tc := range []struct {
+		m           meters.Measurement
+		value, jump float64
+	}{
+		{meters.Power, 2000, 5e8},
+		{meters.CurrentL1, 10, 65535},
+		{meters.VoltageL2, 230, 5e5},
+		{meters.Frequency, 50, 99},
+	} {
+		p.Check(result(tc.m, tc.value, now))
+		if q := p.Check(result(tc.m, tc.jump, now.Add(time.Second))); q != QualitySuspicious {
+			t.Errorf("%s: expected suspicious, got %s", tc.m, q)
+		}
+		if q := p.Check(result(tc.m, tc.value, now.Add(2*time.Second))); q != QualityGood {
+			t.Errorf("%s: expected good, got %s", tc.m, q)
+		}
+	}
+}
+
+func TestPlausibilityRate(t *testing.T) {
+	p := NewPlausibility(0, map[meters.Measurement]meters.Limits{
+		meters.Power: {Min: -1e4, Max: 1e4, Rate: 1000},
+	})
+	now := time.Now()
+
+	p.Check(result(meters.Power, 100, now))
+	if q := p.Check(result(meters.Power, 5000, now.Add(time.Second))); q != QualitySuspicious {
+		t.Errorf("expected suspicious, got %s", q)
+	}
+	if q := p.Check(result(meters.Power, 600, now.Add(2*time.Second))); q != QualityGood {
+		t.Errorf("expected good, got %s", q)
+	}
+
+	// new level is accepted after repeated violations
+	for i := 0; i < maxViolations; i++ {
+		p.Check(result(meters.Power, 8000, now.Add(time.Duration(3+i)*time.Second)))
+	}
+	if q := p.Check(result(meters.Power, 8100, now.Add(10*time.Second))); q != QualityGood {
+		t.Errorf("expected good, got %s", q)
+	}
+}
+
+func TestPlausibilityCounter(t *testing.T) {
+	p := NewPlausibility(0, nil)
+	now := time.Now()
+
+	p.Check(result(meters.Power, 3000, now))
+	p.Check(result(meters.Import, 1000, now))
+
+	if q := p.Check(result(meters.Import, 999, now.Add(time.Hour))); q != QualityInvalid {
+		t.Errorf("expected invalid, got %s", q)
+	}
+	if q := p.Check(result(meters.Import, 1003, now.Add(time.Hour))); q != QualityGood {
+		t.Errorf("expected good, got %s", q)
+	}
+	if q := p.Check(result(meters.Import, 1100, now.Add(2*time.Hour))); q != QualitySuspicious {
+		t.Errorf("expected suspicious, got %s", q)
+	}
+}
@@ -2,23 +2,47 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/grid-x/modbus"
 	"github.com/volkszaehler/mbmd/meters"
 	"golang.org/x/exp/maps"
 )
 
-// DeviceInfo returns device descriptor by device id
+// ErrUnknownDevice is returned for requests of devices not attached to any adapter
+var ErrUnknownDevice = errors.New("unknown device")
+
+// DeviceInfo returns device descriptor and configured name by device id
 type DeviceInfo interface {
 	DeviceDescriptorByID(id string) meters.DeviceDescriptor
+	DeviceName(id string) string
+}
+
+// InputDevice describes a device whose readings are pushed by an input
+type InputDevice struct {
+	ID         string
+	Name       string
+	Descriptor meters.DeviceDescriptor
+}
+
+// Input is a source of readings pushed by devices instead of being queried
+type Input interface {
+	Devices() []InputDevice
+	Run(ctx context.Context, control chan<- ControlSnip, results chan<- QuerySnip)
 }
 
 // QueryEngine executes queries on connections and attached devices
 type QueryEngine struct {
 	handlers    map[string]*Handler
+	inputs      []Input
+	mu          sync.Mutex // guards deviceCache of concurrent output lookups
 	deviceCache map[string]meters.Device
+	descriptors map[string]meters.DeviceDescriptor // input devices
+	names       map[string]string
 }
 
 // NewQueryEngine creates new query engine
@@ -42,17 +66,38 @@ func NewQueryEngine(managers map[string]*meters.Manager) *QueryEngine {
 	qe := &QueryEngine{
 		handlers:    handlers,
 		deviceCache: make(map[string]meters.Device),
+		descriptors: make(map[string]meters.DeviceDescriptor),
+		names:       make(map[string]string),
 	}
 	return qe
 }
 
+// AddInput adds an input pushing device readings. It must be called before Run.
+func (q *QueryEngine) AddInput(in Input) {
+	q.inputs = append(q.inputs, in)
+
+	for _, dev := range in.Devices() {
+		q.descriptors[dev.ID] = dev.Descriptor
+		if dev.Name != "" {
+			q.names[dev.ID] = dev.Name
+		}
+	}
+}
+
 // DeviceDescriptorByID implements DeviceInfo interface
 func (q *QueryEngine) DeviceDescriptorByID(id string) (res meters.DeviceDescriptor) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	// already cached?
 	if dev, ok := q.deviceCache[id]; ok {
 		return dev.Descriptor()
 	}
 
+	if desc, ok := q.descriptors[id]; ok {
+		return desc
+	}
+
 	for _, h := range q.handlers {
 		h.Manager.Find(func(slaveID uint8, dev meters.Device) (found bool) {
 			devID := h.deviceID(slaveID, dev)
@@ -69,6 +114,92 @@ func (q *QueryEngine) DeviceDescriptorByID(id string) (res meters.DeviceDescript
 	return res
 }
 
+// DeviceName implements DeviceInfo interface. It returns the device's configured
+// name or empty string if not configured.
+func (q *QueryEngine) DeviceName(id string) string {
+	return q.names[id]
+}
+
+// Configure applies device options to the given device. It must be called before Run.
+func (q *QueryEngine) Configure(dev meters.Device, opts DeviceOptions) {
+	for _, h := range q.handlers {
+		h.Manager.Find(func(slaveID uint8, d meters.Device) bool {
+			if d == dev {
+				h.options[dev] = &opts
+				if opts.Name != "" {
+					q.names[h.deviceID(slaveID, dev)] = opts.Name
+				}
+				return true
+			}
+			return false
+		})
+	}
+}
+
+// SetMaxBackoff sets the retry interval ceiling for offline devices
+func (q *QueryEngine) SetMaxBackoff(d time.Duration) {
+	for _, h := range q.handlers {
+		h.MaxBackoff = d
+	}
+}
+
+// SetCounters enables tracking energy counter continuity. It must be called before Run.
+func (q *QueryEngine) SetCounters(c *Counters) {
+	for _, h := range q.handlers {
+		h.Counters = c
+	}
+}
+
+// AdapterStatus implements AdapterInfo interface
+func (q *QueryEngine) AdapterStatus() []AdapterStatus {
+	res := make([]AdapterStatus, 0, len(q.handlers))
+	for _, h := range q.handlers {
+		res = append(res, AdapterStatus{
+			Adapter:   h.Manager.Conn.String(),
+			BusStatus: h.bus.status(),
+			Scheduler: h.scheduler.status(),
+			Links:     h.links(),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Adapter < res[j].Adapter
+	})
+
+	return res
+}
+
+// Execute queues a one-off request of the device on its adapter's bus and waits for its result.
+// Requests not started before the deadline fail with ErrDeadlineMissed.
+func (q *QueryEngine) Execute(
+	ctx context.Context,
+	deviceID string,
+	priority Priority,
+	deadline time.Time,
+	fn func(modbus.Client) error,
+) error {
+	for _, h := range q.handlers {
+		var (
+			id  uint8
+			dev meters.Device
+		)
+
+		h.Manager.Find(func(slaveID uint8, d meters.Device) bool {
+			if h.deviceID(slaveID, d) == deviceID {
+				id, dev = slaveID, d
+				return true
+			}
+			return false
+		})
+
+		if dev != nil {
+			return h.Execute(ctx, id, dev, priority, deadline, fn)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnknownDevice, deviceID)
+}
+
 // Run executes the query engine to produce measurement results
 func (q *QueryEngine) Run(
 	ctx context.Context,
@@ -85,24 +216,20 @@ func (q *QueryEngine) Run(
 		wg.Add(1)
 
 		go func(h *Handler) {
-			ticker := time.NewTicker(rate)
-			defer ticker.Stop()
-
-			for {
-				// run handlers
-				h.Run(ctx, control, results)
-
-				// wait for rate limit
-				select {
-				case <-ctx.Done():
-					// abort if context is cancelled
-					wg.Done()
-					return
-				case <-ticker.C:
-				}
-			}
+			h.Run(ctx, rate, control, results)
+			wg.Done()
 		}(h)
 	}
 
+	// run inputs until the context is cancelled
+	for _, in := range q.inputs {
+		wg.Add(1)
+
+		go func(in Input) {
+			in.Run(ctx, control, results)
+			wg.Done()
+		}(in)
+	}
+
 	wg.Wait()
 }
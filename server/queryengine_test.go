@@ -0,0 +1,41 @@
+package server
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestQueryEngineDeviceDescriptor(t *testing.T) {
+	var (
+		mu                sync.Mutex
+		active, maxActive int
+	)
+
+	m := meters.NewManager(meters.NewTCP("localhost:502"))
+	for id := uint8(1); id <= 2; id++ {
+		if err := m.Add(id, &slowDevice{mu: &mu, active: &active, maxActive: &maxActive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	qe := NewQueryEngine(map[string]*meters.Manager{"localhost:502": m})
+
+	// outputs look up descriptors concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if desc := qe.DeviceDescriptorByID(id); desc.Type != "SLOW" {
+				t.Errorf("%s: unexpected descriptor %+v", id, desc)
+			}
+		}([]string{"SLOW1.1", "SLOW1.2"}[i%2])
+	}
+	wg.Wait()
+
+	if desc := qe.DeviceDescriptorByID("SLOW1.3"); desc.Type != "" {
+		t.Errorf("unexpected descriptor %+v", desc)
+	}
+}
@@ -6,29 +6,57 @@ import (
 
 const (
 	retryTimeout = 1 * time.Second
+	maxBackoff   = 5 * time.Minute
 )
 
 // RuntimeInfo represents a single modbus device status
 type RuntimeInfo struct {
 	lastFailure time.Time
+	backoff     time.Duration
+	maxBackoff  time.Duration
 	Online      bool
 	Requests    uint64
 	Errors      uint64
+	QualityStatus
+	Bus         BusStatus
+	Unsupported []string // measurements disabled after illegal data address exceptions
 }
 
-// Available sets the device online status
+// Available sets the device online status.
+// Each failed reactivation doubles the retry interval up to the backoff ceiling.
 func (r *RuntimeInfo) Available(online bool) {
-	if !online {
+	switch {
+	case online:
+		r.backoff = 0
+	case r.Online || r.backoff == 0:
 		r.lastFailure = time.Now()
+		r.backoff = retryTimeout
+	default:
+		r.lastFailure = time.Now()
+		r.backoff *= 2
+	}
+
+	ceiling := r.maxBackoff
+	if ceiling <= 0 {
+		ceiling = maxBackoff
+	}
+	if r.backoff > ceiling {
+		r.backoff = ceiling
 	}
+
 	r.Online = online
 }
 
+// Backoff returns the current retry interval of an offline device
+func (r *RuntimeInfo) Backoff() time.Duration {
+	return r.backoff
+}
+
 // IsQueryable determines if a device can be queries.
 // This is the case if either the device is online or
-// the device is offline and the retryTimeout has elapsed.
+// the device is offline and the backoff interval has elapsed.
 // Returns queryable status and if the offline timeout has elapsed.
 func (r *RuntimeInfo) IsQueryable() (queryable bool, elapsed bool) {
-	retry := r.lastFailure.Add(retryTimeout).Before(time.Now())
+	retry := r.lastFailure.Add(r.backoff).Before(time.Now())
 	return r.Online || retry, !r.Online && retry
 }
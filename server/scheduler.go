@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// Priority determines the order of queued bus jobs
+type Priority int
+
+const (
+	PriorityPoll  Priority = iota // periodic device queries
+	PriorityRead                  // one-off reads
+	PriorityWrite                 // one-off writes
+)
+
+// ErrDeadlineMissed indicates a job that was not started before its deadline
+var ErrDeadlineMissed = errors.New("deadline missed")
+
+// Job is a unit of bus access for a single device
+type Job struct {
+	Device   string          // device id, jobs of the same device never run concurrently
+	Priority Priority        // higher priorities run first
+	Deadline time.Time       // jobs not started before the deadline are skipped, zero for none
+	Periodic bool            // periodic jobs supersede the device's queued periodic job
+	Context  context.Context // jobs whose requester has given up before they are started are dropped, nil for none
+	Run      func(ctx context.Context, conn meters.Connection) error
+	result   chan error // receives the job's result if not nil
+	seq      uint64
+}
+
+// done reports the job's result
+func (j *Job) done(err error) {
+	if j.result != nil {
+		j.result <- err
+	}
+}
+
+// SchedulerStatus represents an adapter's bus utilization
+type SchedulerStatus struct {
+	Workers         int     // connections queried concurrently
+	Busy            float64 // time spent executing jobs in seconds
+	Utilization     float64 // share of the workers' time spent executing jobs
+	QueueDepth      int
+	MaxQueueDepth   int
+	Executed        uint64
+	MissedDeadlines uint64 // stale jobs skipped or superseded before being started
+}
+
+// Scheduler owns an adapter's bus access. Queued jobs are executed by priority.
+// Jobs of equal priority are executed in order of their device's last execution
+// to prevent devices from starving others, stale jobs are skipped.
+type Scheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []*Job
+	running map[string]bool   // devices with a job in progress
+	served  map[string]uint64 // sequence of the devices' last executed job
+	seq     uint64
+	count   uint64
+	started time.Time
+	busy    time.Duration
+	stats   SchedulerStatus
+}
+
+// NewScheduler creates a bus scheduler
+func NewScheduler() *Scheduler {
+	s := &Scheduler{
+		running: make(map[string]bool),
+		served:  make(map[string]uint64),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	return s
+}
+
+// Submit queues a job
+func (s *Scheduler) Submit(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.Periodic {
+		s.queue = slices.DeleteFunc(s.queue, func(j *Job) bool {
+			if j.Periodic && j.Device == job.Device {
+				s.missed(j)
+				return true
+			}
+			return false
+		})
+	}
+
+	s.seq++
+	job.seq = s.seq
+	s.queue = append(s.queue, job)
+	s.stats.MaxQueueDepth = max(s.stats.MaxQueueDepth, len(s.queue))
+
+	s.cond.Broadcast()
+}
+
+// missed records a skipped job. It must be called with the lock held.
+func (s *Scheduler) missed(j *Job) {
+	s.stats.MissedDeadlines++
+	j.done(ErrDeadlineMissed)
+}
+
+// before determines if job a is executed before job b
+func (s *Scheduler) before(a, b *Job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if sa, sb := s.served[a.Device], s.served[b.Device]; sa != sb {
+		return sa < sb
+	}
+	return a.seq < b.seq
+}
+
+// next removes and returns the next executable job or nil if there is none.
+// It must be called with the lock held.
+func (s *Scheduler) next(now time.Time) *Job {
+	s.queue = slices.DeleteFunc(s.queue, func(j *Job) bool {
+		if j.Context != nil && j.Context.Err() != nil {
+			j.done(j.Context.Err())
+			return true
+		}
+		if !j.Deadline.IsZero() && now.After(j.Deadline) {
+			s.missed(j)
+			return true
+		}
+		return false
+	})
+
+	best := -1
+	for i, j := range s.queue {
+		if !s.running[j.Device] && (best < 0 || s.before(j, s.queue[best])) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return nil
+	}
+
+	job := s.queue[best]
+	s.queue = slices.Delete(s.queue, best, best+1)
+
+	s.count++
+	s.served[job.Device] = s.count
+
+	return job
+}
+
+// Run executes queued jobs using one worker per connection until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context, conns []meters.Connection) {
+	s.mu.Lock()
+	s.started = time.Now()
+	s.stats.Workers = len(conns)
+	s.mu.Unlock()
+
+	// wake waiting workers on cancellation
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+
+		go func(conn meters.Connection) {
+			s.work(ctx, conn)
+			wg.Done()
+		}(conn)
+	}
+
+	wg.Wait()
+
+	// release pending one-off jobs
+	s.mu.Lock()
+	for _, j := range s.queue {
+		j.done(ctx.Err())
+	}
+	s.queue = nil
+	s.mu.Unlock()
+}
+
+// work executes jobs on the given connection
+func (s *Scheduler) work(ctx context.Context, conn meters.Connection) {
+	for {
+		s.mu.Lock()
+
+		var job *Job
+		for job == nil && ctx.Err() == nil {
+			if job = s.next(time.Now()); job == nil {
+				s.cond.Wait()
+			}
+		}
+
+		if job == nil {
+			s.mu.Unlock()
+			return
+		}
+
+		s.running[job.Device] = true
+		s.mu.Unlock()
+
+		start := time.Now()
+		err := job.Run(ctx, conn)
+
+		s.mu.Lock()
+		delete(s.running, job.Device)
+		s.busy += time.Since(start)
+		s.stats.Executed++
+		s.cond.Broadcast() // device's further jobs are executable
+		s.mu.Unlock()
+
+		job.done(err)
+	}
+}
+
+// status returns the scheduler's bus utilization
+func (s *Scheduler) status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := s.stats
+	res.QueueDepth = len(s.queue)
+	res.Busy = s.busy.Seconds()
+
+	if elapsed := time.Since(s.started); !s.started.IsZero() && res.Workers > 0 {
+		res.Utilization = s.busy.Seconds() / (elapsed.Seconds() * float64(res.Workers))
+	}
+
+	return res
+}
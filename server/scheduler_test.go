@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestSchedulerOrder(t *testing.T) {
+	s := NewScheduler()
+	now := time.Now()
+
+	s.Submit(&Job{Device: "A", Priority: PriorityPoll})
+	s.Submit(&Job{Device: "A", Priority: PriorityPoll})
+	s.Submit(&Job{Device: "B", Priority: PriorityPoll})
+	s.Submit(&Job{Device: "C", Priority: PriorityRead, Deadline: now.Add(-time.Second)})
+	s.Submit(&Job{Device: "B", Priority: PriorityWrite})
+
+	// writes first, stale read skipped, devices take turns
+	var order string
+	for job := s.next(now); job != nil; job = s.next(now) {
+		order += job.Device
+	}
+
+	if order != "BABA" {
+		t.Errorf("unexpected order %s", order)
+	}
+	if st := s.status(); st.MissedDeadlines != 1 || st.MaxQueueDepth != 5 {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
+
+func TestSchedulerPeriodic(t *testing.T) {
+	s := NewScheduler()
+	now := time.Now()
+
+	// periodic jobs supersede the device's queued periodic job
+	s.Submit(&Job{Device: "A", Periodic: true, Deadline: now.Add(time.Second)})
+	s.Submit(&Job{Device: "A", Periodic: true, Deadline: now.Add(2 * time.Second)})
+
+	job := s.next(now)
+	if job == nil || !job.Deadline.Equal(now.Add(2*time.Second)) || s.next(now) != nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if st := s.status(); st.MissedDeadlines != 1 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	// jobs of running devices are deferred
+	s.running["A"] = true
+	s.Submit(&Job{Device: "A"})
+	if job := s.next(now); job != nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s := NewScheduler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		s.Run(ctx, []meters.Connection{nil})
+		close(done)
+	}()
+
+	errTest := errors.New("test")
+	result := make(chan error, 1)
+	s.Submit(&Job{
+		Device: "A",
+		Run: func(context.Context, meters.Connection) error {
+			return errTest
+		},
+		result: result,
+	})
+
+	if err := <-result; err != errTest {
+		t.Errorf("unexpected result %v", err)
+	}
+
+	// stale jobs report missed deadline
+	s.Submit(&Job{Device: "A", Deadline: time.Now().Add(-time.Second), result: result})
+	if err := <-result; err != ErrDeadlineMissed {
+		t.Errorf("unexpected result %v", err)
+	}
+
+	cancel()
+	<-done
+
+	if st := s.status(); st.Workers != 1 || st.Executed != 1 || st.QueueDepth != 0 {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
+
+func TestSchedulerCancelled(t *testing.T) {
+	s := NewScheduler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	s.Submit(&Job{Device: "A", Priority: PriorityWrite, Context: ctx, result: result})
+	s.Submit(&Job{Device: "B"})
+
+	// jobs of requesters that have given up are dropped
+	cancel()
+	if job := s.next(time.Now()); job == nil || job.Device != "B" || s.next(time.Now()) != nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected result %v", err)
+	}
+	if st := s.status(); st.MissedDeadlines != 0 {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
@@ -18,6 +18,7 @@ type ControlSnip struct {
 type QuerySnip struct {
 	Device string
 	meters.MeasurementResult
+	Quality Quality
 }
 
 // String representation
@@ -33,12 +34,14 @@ func (q *QuerySnip) MarshalJSON() ([]byte, error) {
 		IEC61850    string
 		Description string
 		Timestamp   int64
+		Quality     Quality
 	}{
 		Device:      q.Device,
 		Value:       q.Value,
 		IEC61850:    q.Measurement.String(),
 		Description: q.Description(),
 		Timestamp:   q.Timestamp.UnixNano() / 1e6,
+		Quality:     q.Quality,
 	})
 }
 
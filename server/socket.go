@@ -2,7 +2,6 @@ package server
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
@@ -54,7 +53,7 @@ func (c *SocketClient) writePump() {
 func ServeWebsocket(hub *SocketHub, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		httpLog.Error("websocket upgrade failed", "error", err)
 		return
 	}
 	client := &SocketClient{hub: hub, conn: conn, send: make(chan []byte, 256)}
@@ -95,7 +94,7 @@ func (h *SocketHub) broadcast(i interface{}) {
 	if len(h.clients) > 0 {
 		message, err := json.Marshal(i)
 		if err != nil {
-			log.Fatal(err)
+			httpLog.Fatal(err)
 		}
 
 		for client := range h.clients {
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+const (
+	sparkplugNamespace = "spBv1.0"
+	sparkplugBdSeq     = "bdSeq"
+	sparkplugRebirth   = "Node Control/Rebirth"
+)
+
+var sparkplugLog = logger.Get(logger.Sparkplug)
+
+// SparkplugOptions describes the Sparkplug B edge node
+type SparkplugOptions struct {
+	Group string // group id
+	Node  string // edge node id
+}
+
+// SparkplugRunner publishes readings as Sparkplug B edge node. Each device
+// is published as Sparkplug device named by its configured name or id.
+type SparkplugRunner struct {
+	*MqttClient
+	SparkplugOptions
+	qe DeviceInfo
+	cc <-chan ControlSnip
+
+	mu      sync.Mutex
+	bdSeq   uint64 // birth/death sequence, incremented per connection
+	seq     uint64 // message sequence
+	devices map[string]*spDevice
+}
+
+type spDevice struct {
+	id     string
+	alive  bool // DBIRTH published and no DDEATH since
+	values map[meters.Measurement]float64
+	ts     time.Time
+}
+
+// sparkplugID validates group, node and device ids
+func sparkplugID(id string) error {
+	if id == "" || strings.ContainsAny(id, "/+#") {
+		return fmt.Errorf("invalid sparkplug id: %q", id)
+	}
+	return nil
+}
+
+// NewSparkplugRunner creates a Sparkplug B publisher
+func NewSparkplugRunner(options *MQTT.ClientOptions, opts SparkplugOptions, qos byte, qe DeviceInfo, cc <-chan ControlSnip) (*SparkplugRunner, error) {
+	if err := sparkplugID(opts.Group); err != nil {
+		return nil, err
+	}
+	if err := sparkplugID(opts.Node); err != nil {
+		return nil, err
+	}
+
+	sp := &SparkplugRunner{
+		SparkplugOptions: opts,
+		qe:               qe,
+		cc:               cc,
+		devices:          make(map[string]*spDevice),
+	}
+
+	// sparkplug requires clean sessions and the NDEATH will to match the NBIRTH's bdSeq
+	options.SetCleanSession(true)
+	options.SetBinaryWill(sp.topic("NDEATH", ""), sp.death(), 1, false)
+	options.SetReconnectingHandler(func(_ MQTT.Client, o *MQTT.ClientOptions) {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+
+		sp.bdSeq = (sp.bdSeq + 1) % 256
+		o.SetBinaryWill(sp.topic("NDEATH", ""), sp.death(), 1, false)
+	})
+
+	connected := make(chan struct{})
+	options.SetOnConnectHandler(func(c MQTT.Client) {
+		<-connected
+
+		// subscription is lost with clean session
+		token := c.Subscribe(sp.topic("NCMD", ""), 1, sp.command)
+		sp.WaitForToken(token)
+
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		sp.births()
+	})
+
+	sp.MqttClient = NewMqttClient(options, qos, sparkplugLog)
+	close(connected)
+
+	return sp, nil
+}
+
+// topic creates the topic for the message type and optional device
+func (sp *SparkplugRunner) topic(typ, device string) string {
+	topic := fmt.Sprintf("%s/%s/%s/%s", sparkplugNamespace, sp.Group, typ, sp.Node)
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+func sparkplugTime(ts time.Time) uint64 {
+	return uint64(ts.UnixMilli())
+}
+
+// death creates the NDEATH payload. Must be called with lock held.
+func (sp *SparkplugRunner) death() []byte {
+	return spPayload{
+		Timestamp: sparkplugTime(time.Now()),
+		Metrics: []spMetric{
+			{Name: sparkplugBdSeq, Datatype: spInt64, Value: sp.bdSeq},
+		},
+	}.Marshal()
+}
+
+// nextSeq returns the next message sequence number. Must be called with lock held.
+func (sp *SparkplugRunner) nextSeq() *uint64 {
+	seq := sp.seq
+	sp.seq = (sp.seq + 1) % 256
+	return &seq
+}
+
+// births publishes NBIRTH and DBIRTH for all live devices. Must be called with lock held.
+func (sp *SparkplugRunner) births() {
+	sp.seq = 0
+	now := sparkplugTime(time.Now())
+
+	payload := spPayload{
+		Timestamp: now,
+		Seq:       sp.nextSeq(),
+		Metrics: []spMetric{
+			{Name: sparkplugBdSeq, Timestamp: now, Datatype: spInt64, Value: sp.bdSeq},
+			{Name: sparkplugRebirth, Timestamp: now, Datatype: spBoolean, Value: false},
+		},
+	}
+
+	sp.log.Debug("birth", "bdSeq", sp.bdSeq)
+	sp.Publish(sp.topic("NBIRTH", ""), false, payload.Marshal())
+
+	for _, dev := range sp.devices {
+		if dev.alive {
+			sp.deviceBirth(dev)
+		}
+	}
+}
+
+// deviceBirth publishes DBIRTH with all observed measurements. Must be called with lock held.
+func (sp *SparkplugRunner) deviceBirth(dev *spDevice) {
+	ts := sparkplugTime(dev.ts)
+
+	payload := spPayload{
+		Timestamp: ts,
+		Seq:       sp.nextSeq(),
+	}
+
+	for _, m := range sortedMeasurements(dev.values) {
+		description, unit := m.DescriptionAndUnit()
+		payload.Metrics = append(payload.Metrics, spMetric{
+			Name:      m.String(),
+			Timestamp: ts,
+			Datatype:  spDouble,
+			Value:     dev.values[m],
+			Properties: map[string]string{
+				"description": description,
+				"engUnit":     unit,
+			},
+		})
+	}
+
+	sp.Publish(sp.topic("DBIRTH", dev.id), false, payload.Marshal())
+}
+
+// command handles node commands
+func (sp *SparkplugRunner) command(_ MQTT.Client, msg MQTT.Message) {
+	payload, err := unmarshalPayload(msg.Payload())
+	if err != nil {
+		sp.log.Error("invalid command", "error", err)
+		return
+	}
+
+	for _, m := range payload.Metrics {
+		if m.Name == sparkplugRebirth && m.Value == true {
+			sp.log.Info("rebirth requested")
+
+			sp.mu.Lock()
+			sp.births()
+			sp.mu.Unlock()
+		}
+	}
+}
+
+// status publishes DDEATH when a device goes offline
+func (sp *SparkplugRunner) status(device string, online bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	dev, ok := sp.devices[device]
+	if !ok || online || !dev.alive {
+		return
+	}
+
+	dev.alive = false
+
+	payload := spPayload{
+		Timestamp: sparkplugTime(time.Now()),
+		Seq:       sp.nextSeq(),
+	}
+
+	sp.Publish(sp.topic("DDEATH", dev.id), false, payload.Marshal())
+}
+
+// publishBatch publishes DBIRTH for new or changed measurement sets and DDATA for changed values
+func (sp *SparkplugRunner) publishBatch(batch *DeviceBatch) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	dev, ok := sp.devices[batch.Device]
+	if !ok {
+		id := batch.Device
+		if name := sp.qe.DeviceName(batch.Device); name != "" {
+			id = name
+		}
+
+		dev = &spDevice{
+			id:     mqttSafe(id),
+			values: make(map[meters.Measurement]float64),
+		}
+		sp.devices[batch.Device] = dev
+	}
+
+	birth := !dev.alive
+	changed := make(map[meters.Measurement]float64)
+
+	for m, v := range batch.Values {
+		last, ok := dev.values[m]
+		if !ok {
+			// DBIRTH must list all metrics
+			birth = true
+		}
+		if !ok || last != v {
+			changed[m] = v
+		}
+		dev.values[m] = v
+	}
+	dev.ts = batch.Timestamp
+
+	if birth {
+		dev.alive = true
+		sp.deviceBirth(dev)
+		return
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+
+	ts := sparkplugTime(batch.Timestamp)
+	payload := spPayload{
+		Timestamp: ts,
+		Seq:       sp.nextSeq(),
+	}
+
+	for _, m := range sortedMeasurements(changed) {
+		payload.Metrics = append(payload.Metrics, spMetric{
+			Name:      m.String(),
+			Timestamp: ts,
+			Datatype:  spDouble,
+			Value:     changed[m],
+		})
+	}
+
+	sp.Publish(sp.topic("DDATA", dev.id), false, payload.Marshal())
+}
+
+// Run Sparkplug B publisher
+func (sp *SparkplugRunner) Run(in <-chan QuerySnip) {
+	go func() {
+		for snip := range sp.cc {
+			sp.status(snip.Device, snip.Status.Online)
+		}
+	}()
+
+	newBatcher(batchWindow, sp.publishBatch).run(in, func(snip QuerySnip) bool {
+		return snip.Quality == QualityGood
+	})
+
+	// intentional disconnect does not trigger the will
+	sp.mu.Lock()
+	token := sp.Client.Publish(sp.topic("NDEATH", ""), 1, false, sp.death())
+	sp.mu.Unlock()
+	sp.WaitForToken(token)
+
+	sp.Client.Disconnect(uint(timeout.Milliseconds()))
+}
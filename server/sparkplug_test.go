@@ -0,0 +1,152 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Done() <-chan struct{}          { c := make(chan struct{}); close(c); return c }
+func (doneToken) Error() error                   { return nil }
+
+type published struct {
+	topic   string
+	payload spPayload
+}
+
+// recordingClient records published sparkplug messages
+type recordingClient struct {
+	MQTT.Client
+	mu       sync.Mutex
+	messages []published
+}
+
+func (c *recordingClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	p, err := unmarshalPayload(payload.([]byte))
+	if err != nil {
+		panic(err)
+	}
+
+	c.mu.Lock()
+	c.messages = append(c.messages, published{topic, p})
+	c.mu.Unlock()
+
+	return doneToken{}
+}
+
+func (c *recordingClient) take() []published {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := c.messages
+	c.messages = nil
+	return res
+}
+
+func TestSparkplugPayload(t *testing.T) {
+	seq := uint64(7)
+	b := spPayload{
+		Timestamp: 1700000000000,
+		Seq:       &seq,
+		Metrics: []spMetric{
+			{Name: "Power", Timestamp: 1700000000000, Datatype: spDouble, Value: 1234.5, Properties: map[string]string{"engUnit": "W"}},
+			{Name: sparkplugRebirth, Datatype: spBoolean, Value: true},
+			{Name: "Null", Datatype: spDouble, IsNull: true},
+		},
+	}.Marshal()
+
+	p, err := unmarshalPayload(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Timestamp != 1700000000000 || p.Seq == nil || *p.Seq != 7 || len(p.Metrics) != 3 {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+
+	if m := p.Metrics[0]; m.Name != "Power" || m.Datatype != spDouble || m.Value != 1234.5 {
+		t.Errorf("unexpected metric %+v", m)
+	}
+	if m := p.Metrics[1]; m.Name != sparkplugRebirth || m.Value != true {
+		t.Errorf("unexpected metric %+v", m)
+	}
+	if m := p.Metrics[2]; !m.IsNull || m.Value != nil {
+		t.Errorf("unexpected metric %+v", m)
+	}
+
+	if _, err := unmarshalPayload(b[:len(b)-3]); err == nil {
+		t.Error("expected error for truncated payload")
+	}
+}
+
+func TestSparkplugLifecycle(t *testing.T) {
+	client := &recordingClient{}
+	sp := &SparkplugRunner{
+		MqttClient:       &MqttClient{Client: client, log: sparkplugLog},
+		SparkplugOptions: SparkplugOptions{Group: "plant", Node: "mbmd"},
+		qe:               deviceNames{"SDM1.1": "main"},
+		devices:          make(map[string]*spDevice),
+	}
+
+	sp.births()
+	batch := func(values map[meters.Measurement]float64) *DeviceBatch {
+		return &DeviceBatch{Device: "SDM1.1", Timestamp: time.Now(), Values: values}
+	}
+
+	sp.publishBatch(batch(map[meters.Measurement]float64{meters.Power: 100, meters.Import: 1}))
+	sp.publishBatch(batch(map[meters.Measurement]float64{meters.Power: 200, meters.Import: 1}))
+	sp.publishBatch(batch(map[meters.Measurement]float64{meters.Power: 200, meters.Import: 1}))
+	sp.status("SDM1.1", false)
+	sp.publishBatch(batch(map[meters.Measurement]float64{meters.Power: 200, meters.Import: 1}))
+
+	msgs := client.take()
+	expected := []string{"NBIRTH/mbmd", "DBIRTH/mbmd/main", "DDATA/mbmd/main", "DDEATH/mbmd/main", "DBIRTH/mbmd/main"}
+	if len(msgs) != len(expected) {
+		t.Fatalf("expected %d messages, got %+v", len(expected), msgs)
+	}
+
+	for i, msg := range msgs {
+		if msg.topic != "spBv1.0/plant/"+expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], msg.topic)
+		}
+		if msg.payload.Seq == nil || *msg.payload.Seq != uint64(i) {
+			t.Errorf("%s: unexpected seq %v", msg.topic, msg.payload.Seq)
+		}
+	}
+
+	if m := msgs[0].payload.Metrics; len(m) != 2 || m[0].Name != sparkplugBdSeq || m[1].Name != sparkplugRebirth {
+		t.Errorf("unexpected NBIRTH metrics %+v", m)
+	}
+	if m := msgs[1].payload.Metrics; len(m) != 2 || m[0].Name != "Import" || m[1].Name != "Power" || m[1].Value != 100.0 {
+		t.Errorf("unexpected DBIRTH metrics %+v", m)
+	}
+	if m := msgs[2].payload.Metrics; len(m) != 1 || m[0].Name != "Power" || m[0].Value != 200.0 {
+		t.Errorf("unexpected DDATA metrics %+v", m)
+	}
+
+	// rebirth on command
+	cmd := spPayload{Metrics: []spMetric{{Name: sparkplugRebirth, Datatype: spBoolean, Value: true}}}.Marshal()
+	sp.command(nil, fakeMessage{topic: sp.topic("NCMD", ""), payload: cmd})
+
+	msgs = client.take()
+	if len(msgs) != 2 || !strings.Contains(msgs[0].topic, "NBIRTH") || !strings.Contains(msgs[1].topic, "DBIRTH") || *msgs[0].payload.Seq != 0 {
+		t.Errorf("unexpected rebirth %+v", msgs)
+	}
+}
+
+type fakeMessage struct {
+	MQTT.Message
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Topic() string   { return m.topic }
+func (m fakeMessage) Payload() []byte { return m.payload }
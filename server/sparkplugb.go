@@ -0,0 +1,247 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+)
+
+// Sparkplug B metric data types
+const (
+	spInt64   uint32 = 4
+	spDouble  uint32 = 10
+	spBoolean uint32 = 11
+	spString  uint32 = 12
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// spPayload is a Sparkplug B payload
+type spPayload struct {
+	Timestamp uint64
+	Metrics   []spMetric
+	Seq       *uint64 // omitted for NDEATH
+}
+
+// spMetric is a Sparkplug B metric. Only the value types used by mbmd are supported.
+type spMetric struct {
+	Name       string
+	Timestamp  uint64
+	Datatype   uint32
+	IsNull     bool
+	Properties map[string]string // string properties like engUnit
+	Value      any               // uint64, float64, bool or string
+}
+
+// protoWriter encodes protobuf messages
+type protoWriter []byte
+
+func (w *protoWriter) tag(field, wire int) {
+	*w = binary.AppendUvarint(*w, uint64(field<<3|wire))
+}
+
+func (w *protoWriter) varint(field int, v uint64) {
+	w.tag(field, wireVarint)
+	*w = binary.AppendUvarint(*w, v)
+}
+
+func (w *protoWriter) bool(field int, v bool) {
+	var i uint64
+	if v {
+		i = 1
+	}
+	w.varint(field, i)
+}
+
+func (w *protoWriter) double(field int, v float64) {
+	w.tag(field, wireFixed64)
+	*w = binary.LittleEndian.AppendUint64(*w, math.Float64bits(v))
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	w.tag(field, wireBytes)
+	*w = binary.AppendUvarint(*w, uint64(len(b)))
+	*w = append(*w, b...)
+}
+
+func (w *protoWriter) string(field int, s string) {
+	w.bytes(field, []byte(s))
+}
+
+// Marshal encodes the payload
+func (p spPayload) Marshal() []byte {
+	var w protoWriter
+
+	w.varint(1, p.Timestamp)
+	for _, m := range p.Metrics {
+		w.bytes(2, m.marshal())
+	}
+	if p.Seq != nil {
+		w.varint(3, *p.Seq)
+	}
+
+	return w
+}
+
+func (m spMetric) marshal() []byte {
+	var w protoWriter
+
+	w.string(1, m.Name)
+	w.varint(3, m.Timestamp)
+	w.varint(4, uint64(m.Datatype))
+
+	if len(m.Properties) > 0 {
+		var keys, values protoWriter
+		for _, k := range slices.Sorted(maps.Keys(m.Properties)) {
+			keys.string(1, k)
+
+			var v protoWriter
+			v.varint(1, uint64(spString))
+			v.string(8, m.Properties[k])
+			values.bytes(2, v)
+		}
+		w.bytes(9, append(keys, values...))
+	}
+
+	if m.IsNull {
+		w.bool(7, true)
+		return w
+	}
+
+	switch v := m.Value.(type) {
+	case uint64:
+		w.varint(11, v)
+	case float64:
+		w.double(13, v)
+	case bool:
+		w.bool(14, v)
+	case string:
+		w.string(15, v)
+	}
+
+	return w
+}
+
+// protoField is a decoded protobuf field
+type protoField struct {
+	num  int
+	wire int
+	val  uint64 // varint and fixed values
+	data []byte // length-delimited values
+}
+
+// protoFields decodes the fields of a protobuf message
+func protoFields(b []byte) ([]protoField, error) {
+	var res []protoField
+
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid tag")
+		}
+		b = b[n:]
+
+		f := protoField{num: int(tag >> 3), wire: int(tag & 7)}
+
+		switch f.wire {
+		case wireVarint:
+			if f.val, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("invalid varint")
+			}
+		case wireFixed64:
+			if n = 8; len(b) < n {
+				return nil, errors.New("short fixed64")
+			}
+			f.val = binary.LittleEndian.Uint64(b)
+		case wireFixed32:
+			if n = 4; len(b) < n {
+				return nil, errors.New("short fixed32")
+			}
+			f.val = uint64(binary.LittleEndian.Uint32(b))
+		case wireBytes:
+			l, ln := binary.Uvarint(b)
+			if ln <= 0 || uint64(len(b)-ln) < l {
+				return nil, errors.New("invalid length")
+			}
+			f.data = b[ln : ln+int(l)]
+			n = ln + int(l)
+		default:
+			return nil, errors.New("unsupported wire type")
+		}
+
+		b = b[n:]
+		res = append(res, f)
+	}
+
+	return res, nil
+}
+
+// unmarshalPayload decodes a payload's metrics. Only scalar values are decoded.
+func unmarshalPayload(b []byte) (spPayload, error) {
+	var p spPayload
+
+	fields, err := protoFields(b)
+	if err != nil {
+		return p, err
+	}
+
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			p.Timestamp = f.val
+		case 3:
+			seq := f.val
+			p.Seq = &seq
+		case 2:
+			m, err := unmarshalMetric(f.data)
+			if err != nil {
+				return p, err
+			}
+			p.Metrics = append(p.Metrics, m)
+		}
+	}
+
+	return p, nil
+}
+
+func unmarshalMetric(b []byte) (spMetric, error) {
+	var m spMetric
+
+	fields, err := protoFields(b)
+	if err != nil {
+		return m, err
+	}
+
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			m.Name = string(f.data)
+		case 3:
+			m.Timestamp = f.val
+		case 4:
+			m.Datatype = uint32(f.val)
+		case 7:
+			m.IsNull = f.val != 0
+		case 10, 11:
+			m.Value = f.val
+		case 12:
+			m.Value = float64(math.Float32frombits(uint32(f.val)))
+		case 13:
+			m.Value = math.Float64frombits(f.val)
+		case 14:
+			m.Value = f.val != 0
+		case 15:
+			m.Value = string(f.data)
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,500 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+const (
+	spoolSegmentSize = 1 << 20 // maximum segment file size
+	spoolChunk       = 500     // maximum number of readings forwarded at once
+	spoolRetry       = time.Second
+	spoolMaxRetry    = time.Minute
+	spoolHead        = "head"
+	spoolExt         = ".seg"
+)
+
+var spoolLog = logger.Get(logger.Spool)
+
+// Forwarder delivers readings synchronously. It returns an error if the
+// target is unavailable and delivery should be retried.
+type Forwarder interface {
+	Forward(snips []QuerySnip) error
+}
+
+// SpoolOptions describes the spool location and limits
+type SpoolOptions struct {
+	Dir     string        // base directory, each output uses a subdirectory
+	MaxSize int64         // maximum size in bytes, enforced by segment, zero for unlimited
+	MaxAge  time.Duration // maximum age of readings, zero for unlimited
+}
+
+// spoolRecord is the on-disk representation of a reading
+type spoolRecord struct {
+	Device      string  `json:"d"`
+	Measurement string  `json:"m"`
+	Value       float64 `json:"v"`
+	Timestamp   int64   `json:"t"` // unix nanoseconds
+	Quality     int     `json:"q,omitempty"`
+}
+
+type spoolSegment struct {
+	id      int
+	size    int64
+	records int
+}
+
+// Spool is a disk-backed store-and-forward queue between the broadcaster
+// and an output. Readings are appended to segment files and forwarded in
+// order once the output is available. The read position survives restarts.
+type Spool struct {
+	SpoolOptions
+	name string
+	dir  string
+	fwd  Forwarder
+	log  *logger.Logger
+
+	mu          sync.Mutex
+	segments    []*spoolSegment // oldest first, the last segment is written to
+	file        *os.File
+	readOffset  int64 // read position in first segment
+	readRecords int   // records read from first segment
+	notify      chan struct{}
+
+	queued, delivered, retries, dropped uint64
+}
+
+// NewSpool creates a spool for the named output, resuming previously spooled readings
+func NewSpool(name string, fwd Forwarder, opts SpoolOptions) (*Spool, error) {
+	s := &Spool{
+		SpoolOptions: opts,
+		name:         name,
+		dir:          filepath.Join(opts.Dir, name),
+		fwd:          fwd,
+		log:          spoolLog.With("output", name),
+		notify:       make(chan struct{}, 1),
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if s.queued > 0 {
+		s.log.Info("resuming spooled readings", "queued", s.queued)
+	}
+
+	return s, nil
+}
+
+func (s *Spool) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d%s", id, spoolExt))
+}
+
+// load scans existing segments and the read position
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		id, err := strconv.Atoi(strings.TrimSuffix(e.Name(), spoolExt))
+		if err != nil || !strings.HasSuffix(e.Name(), spoolExt) {
+			continue
+		}
+
+		seg := &spoolSegment{id: id}
+		if seg.size, seg.records, err = countRecords(s.segmentPath(id)); err != nil {
+			return err
+		}
+
+		// remove incomplete record after unclean shutdown
+		if err := os.Truncate(s.segmentPath(id), seg.size); err != nil {
+			return err
+		}
+
+		s.segments = append(s.segments, seg)
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+
+	// restore read position
+	if b, err := os.ReadFile(filepath.Join(s.dir, spoolHead)); err == nil && len(s.segments) > 0 {
+		var id int
+		if _, err := fmt.Sscan(string(b), &id, &s.readOffset, &s.readRecords); err != nil || id != s.segments[0].id {
+			s.readOffset, s.readRecords = 0, 0
+		}
+	}
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, &spoolSegment{id: 1})
+	}
+
+	for _, seg := range s.segments {
+		s.queued += uint64(seg.records)
+	}
+	s.queued -= uint64(s.readRecords)
+
+	last := s.segments[len(s.segments)-1]
+	s.file, err = os.OpenFile(s.segmentPath(last.id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	return err
+}
+
+// countRecords returns the size of complete records and their number
+func countRecords(path string) (int64, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var size int64
+	var records int
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// ignore incomplete record
+			return size, records, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		size += int64(len(line))
+		records++
+	}
+}
+
+// OutputStatus implements OutputInfo interface
+func (s *Spool) OutputStatus() OutputStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+
+	return OutputStatus{
+		Output:     s.name,
+		Delivered:  s.delivered,
+		Retries:    s.retries,
+		Dropped:    s.dropped,
+		Queued:     s.queued,
+		SpoolBytes: size - s.readOffset,
+	}
+}
+
+// append writes a reading to the current segment
+func (s *Spool) append(snip QuerySnip) error {
+	b, err := json.Marshal(spoolRecord{
+		Device:      snip.Device,
+		Measurement: snip.Measurement.String(),
+		Value:       snip.Value,
+		Timestamp:   snip.Timestamp.UnixNano(),
+		Quality:     int(snip.Quality),
+	})
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+int64(len(b)) > s.segmentSize() {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		last = s.segments[len(s.segments)-1]
+	}
+
+	if _, err := s.file.Write(b); err != nil {
+		return err
+	}
+
+	last.size += int64(len(b))
+	last.records++
+	s.queued++
+
+	s.enforceSize()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// segmentSize returns the maximum segment size, capped at the size limit so it can be enforced
+func (s *Spool) segmentSize() int64 {
+	if s.MaxSize > 0 {
+		return min(s.MaxSize, spoolSegmentSize)
+	}
+	return spoolSegmentSize
+}
+
+// rotate starts a new segment. Must be called with lock held.
+func (s *Spool) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	seg := &spoolSegment{id: s.segments[len(s.segments)-1].id + 1}
+
+	var err error
+	if s.file, err = os.OpenFile(s.segmentPath(seg.id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+		return err
+	}
+
+	s.segments = append(s.segments, seg)
+
+	return nil
+}
+
+// removeFirst removes the oldest segment. Must be called with lock held.
+func (s *Spool) removeFirst() {
+	seg := s.segments[0]
+	if err := os.Remove(s.segmentPath(seg.id)); err != nil {
+		s.log.Error("removing segment", "error", err)
+	}
+
+	s.segments = s.segments[1:]
+	s.readOffset, s.readRecords = 0, 0
+	s.saveHead()
+}
+
+// enforceSize drops the oldest segments exceeding the size limit. Must be called with lock held.
+func (s *Spool) enforceSize() {
+	if s.MaxSize <= 0 {
+		return
+	}
+
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+
+	for size > s.MaxSize && len(s.segments) > 1 {
+		seg := s.segments[0]
+		lost := uint64(seg.records - s.readRecords)
+		s.log.Warn("spool full, dropping oldest readings", "dropped", lost)
+
+		s.dropped += lost
+		s.queued -= lost
+		size -= seg.size
+		s.removeFirst()
+	}
+}
+
+// saveHead persists the read position. Must be called with lock held.
+func (s *Spool) saveHead() {
+	head := fmt.Sprintf("%d %d %d\n", s.segments[0].id, s.readOffset, s.readRecords)
+	if err := os.WriteFile(filepath.Join(s.dir, spoolHead), []byte(head), 0o644); err != nil {
+		s.log.Error("saving read position", "error", err)
+	}
+}
+
+// spoolRange is a range of records read from a segment
+type spoolRange struct {
+	id      int
+	end     int64
+	records int
+	snips   []QuerySnip
+}
+
+// read returns the next readings to forward. Expired and corrupted records are skipped.
+func (s *Spool) read() (spoolRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		seg := s.segments[0]
+		if s.readOffset >= seg.size {
+			if len(s.segments) == 1 {
+				return spoolRange{}, nil
+			}
+
+			// segment completely forwarded
+			s.removeFirst()
+			continue
+		}
+
+		f, err := os.Open(s.segmentPath(seg.id))
+		if err != nil {
+			return spoolRange{}, err
+		}
+		defer f.Close()
+
+		if _, err := f.Seek(s.readOffset, io.SeekStart); err != nil {
+			return spoolRange{}, err
+		}
+
+		res := spoolRange{id: seg.id, end: s.readOffset}
+		r := bufio.NewReader(f)
+
+		for res.end < seg.size && len(res.snips) < spoolChunk {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return spoolRange{}, err
+			}
+
+			res.end += int64(len(line))
+			res.records++
+
+			snip, err := decodeRecord(line)
+			if err != nil {
+				s.log.Warn("skipping corrupted record", "error", err)
+				s.dropped++
+				continue
+			}
+
+			if s.MaxAge > 0 && time.Since(snip.Timestamp) > s.MaxAge {
+				s.dropped++
+				continue
+			}
+
+			res.snips = append(res.snips, snip)
+		}
+
+		return res, nil
+	}
+}
+
+func decodeRecord(line []byte) (QuerySnip, error) {
+	var rec spoolRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return QuerySnip{}, err
+	}
+
+	m, err := meters.MeasurementString(rec.Measurement)
+	if err != nil {
+		return QuerySnip{}, err
+	}
+
+	return QuerySnip{
+		Device: rec.Device,
+		MeasurementResult: meters.MeasurementResult{
+			Measurement: m,
+			Value:       rec.Value,
+			Timestamp:   time.Unix(0, rec.Timestamp),
+		},
+		Quality: Quality(rec.Quality),
+	}, nil
+}
+
+// commit advances the read position after forwarding
+func (s *Spool) commit(r spoolRange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// segment has been dropped meanwhile
+	if s.segments[0].id != r.id {
+		return
+	}
+
+	s.readOffset = r.end
+	s.readRecords += r.records
+	s.queued -= uint64(r.records)
+	s.delivered += uint64(len(r.snips))
+	s.saveHead()
+}
+
+// forward delivers spooled readings in order until done is closed
+func (s *Spool) forward(done <-chan struct{}) {
+	backoff := spoolRetry
+
+	for {
+		r, err := s.read()
+		if err != nil {
+			s.log.Error("reading spool", "error", err)
+		}
+
+		if r.records == 0 {
+			select {
+			case <-s.notify:
+				continue
+			case <-done:
+				return
+			case <-time.After(spoolRetry):
+				continue
+			}
+		}
+
+		for len(r.snips) > 0 {
+			err := s.fwd.Forward(r.snips)
+			if err == nil {
+				break
+			}
+
+			s.mu.Lock()
+			s.retries++
+			queued := s.queued
+			s.mu.Unlock()
+
+			s.log.Warn("output unavailable, spooling", "queued", queued, "retry", backoff, "error", err)
+
+			select {
+			case <-done:
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff = min(2*backoff, spoolMaxRetry)
+		}
+
+		backoff = spoolRetry
+		s.commit(r)
+	}
+}
+
+// Run spools readings and forwards them to the output
+func (s *Spool) Run(in <-chan QuerySnip) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		s.forward(done)
+		close(finished)
+	}()
+
+	for snip := range in {
+		if err := s.append(snip); err != nil {
+			s.log.Error("spooling reading", "error", err)
+		}
+	}
+
+	close(done)
+	<-finished
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Close(); err != nil {
+		s.log.Error("closing spool", "error", err)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+type testForwarder struct {
+	mu        sync.Mutex
+	available bool
+	snips     []QuerySnip
+}
+
+func (f *testForwarder) Forward(snips []QuerySnip) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.available {
+		return errors.New("unavailable")
+	}
+
+	f.snips = append(f.snips, snips...)
+	return nil
+}
+
+func (f *testForwarder) received() []QuerySnip {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]QuerySnip{}, f.snips...)
+}
+
+func spoolSnip(i int) QuerySnip {
+	return QuerySnip{
+		Device:            "SDM1.1",
+		MeasurementResult: result(meters.Import, float64(i), time.Unix(1700000000+int64(i), 0)),
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	dir := t.TempDir()
+	fwd := &testForwarder{}
+
+	s, err := NewSpool("test", fwd, SpoolOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// output unavailable
+	in := make(chan QuerySnip)
+	done := make(chan struct{})
+	go func() {
+		s.Run(in)
+		close(done)
+	}()
+
+	for i := 0; i < 10; i++ {
+		in <- spoolSnip(i)
+	}
+	close(in)
+	<-done
+
+	if q := s.OutputStatus().Queued; q != 10 {
+		t.Fatalf("expected 10 queued readings, got %d", q)
+	}
+
+	// restart with output available
+	fwd.available = true
+	if s, err = NewSpool("test", fwd, SpoolOptions{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	in = make(chan QuerySnip)
+	done = make(chan struct{})
+	go func() {
+		s.Run(in)
+		close(done)
+	}()
+
+	in <- spoolSnip(10)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fwd.received()) < 11 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(in)
+	<-done
+
+	received := fwd.received()
+	if len(received) != 11 {
+		t.Fatalf("expected 11 readings, got %d", len(received))
+	}
+
+	for i, snip := range received {
+		if snip.Value != float64(i) || !snip.Timestamp.Equal(spoolSnip(i).Timestamp) || snip.Measurement != meters.Import {
+			t.Errorf("unexpected reading %d: %v", i, snip)
+		}
+	}
+
+	if status := s.OutputStatus(); status.Queued != 0 || status.Delivered != 11 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestSpoolSmallLimit(t *testing.T) {
+	const maxSize = 4 << 10
+
+	s, err := NewSpool("test", &testForwarder{}, SpoolOptions{
+		Dir:     t.TempDir(),
+		MaxSize: maxSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// limits below the segment size are enforced as well
+	for i := range 1000 {
+		if err := s.append(spoolSnip(i)); err != nil {
+			t.Fatal(err)
+		}
+		if status := s.OutputStatus(); status.SpoolBytes > maxSize {
+			t.Fatalf("spool exceeds limit: %+v", status)
+		}
+	}
+
+	if status := s.OutputStatus(); status.Dropped == 0 {
+		t.Errorf("expected dropped readings, got %+v", status)
+	}
+}
+
+func TestSpoolLimits(t *testing.T) {
+	fwd := &testForwarder{}
+
+	s, err := NewSpool("test", fwd, SpoolOptions{
+		Dir:     t.TempDir(),
+		MaxSize: spoolSegmentSize,
+		MaxAge:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fill until the oldest segment is dropped
+	var records int
+	for s.OutputStatus().Dropped == 0 {
+		if err := s.append(spoolSnip(records)); err != nil {
+			t.Fatal(err)
+		}
+		records++
+	}
+
+	status := s.OutputStatus()
+	if status.Dropped == 0 || status.Queued+status.Dropped != uint64(records) || status.SpoolBytes > spoolSegmentSize {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// all readings are expired
+	r, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.records == 0 || len(r.snips) != 0 {
+		t.Errorf("expected expired readings to be skipped, got %d of %d", len(r.snips), r.records)
+	}
+}
@@ -27,6 +27,27 @@ type DeviceStatus struct {
 	Type   string
 	Online bool
 	ModbusStatus
+	Quality QualityStatus
+	Bus     BusStatus
+	Backoff float64 // retry interval in seconds while offline
+
+	Unsupported []string `json:",omitempty"` // measurements disabled after illegal data address exceptions
+}
+
+// OutputStatus represents an output's delivery status
+type OutputStatus struct {
+	Output     string
+	Delivered  uint64 // successful requests
+	Failed     uint64 // requests failed after retries
+	Retries    uint64
+	Dropped    uint64 // readings or batches dropped due to queue limits
+	Queued     uint64 // pending readings or batches
+	SpoolBytes int64  `json:",omitempty"` // disk usage of spooled readings
+}
+
+// OutputInfo provides an output's delivery status
+type OutputInfo interface {
+	OutputStatus() OutputStatus
 }
 
 func memoryStatus() MemoryStatus {
@@ -48,7 +69,12 @@ type Status struct {
 	Goroutines int
 	Memory     MemoryStatus
 	Meters     []DeviceStatus
+	Adapters   []AdapterStatus
+	Outputs    []OutputStatus
+	Queues     []QueueStatus
 	meterMap   map[string]DeviceStatus
+	outputs    []OutputInfo
+	queues     []QueueInfo
 }
 
 // NewStatus creates status cache that collects device status from control channel.
@@ -82,6 +108,10 @@ func NewStatus(qe DeviceInfo, control <-chan ControlSnip) *Status {
 				Type:         desc.Manufacturer,
 				Online:       c.Status.Online,
 				ModbusStatus: mbs,
+				Quality:      c.Status.QualityStatus,
+				Bus:          c.Status.Bus,
+				Backoff:      c.Status.Backoff().Seconds(),
+				Unsupported:  c.Status.Unsupported,
 			}
 			s.meterMap[c.Device] = ds
 
@@ -92,6 +122,22 @@ func NewStatus(qe DeviceInfo, control <-chan ControlSnip) *Status {
 	return s
 }
 
+// AddOutput adds an output's delivery status to the status
+func (s *Status) AddOutput(o OutputInfo) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.outputs = append(s.outputs, o)
+}
+
+// AddQueues adds a broadcaster's recipient queues to the status
+func (s *Status) AddQueues(q QueueInfo) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.queues = append(s.queues, q)
+}
+
 // Online returns device's online status or false if the device does not exist
 func (s *Status) Online(device string) bool {
 	s.Lock()
@@ -114,6 +160,20 @@ func (s *Status) update() {
 	for _, ms := range s.meterMap {
 		s.Meters = append(s.Meters, ms)
 	}
+
+	if ai, ok := s.qe.(AdapterInfo); ok {
+		s.Adapters = ai.AdapterStatus()
+	}
+
+	s.Outputs = make([]OutputStatus, 0, len(s.outputs))
+	for _, o := range s.outputs {
+		s.Outputs = append(s.Outputs, o.OutputStatus())
+	}
+
+	s.Queues = make([]QueueStatus, 0)
+	for _, q := range s.queues {
+		s.Queues = append(s.Queues, q.QueueStatus()...)
+	}
 }
 
 // MarshalJSON will syncronize access to the status object
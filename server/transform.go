@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+// TransformOp is the operation of a transform step
+type TransformOp int
+
+const (
+	_                 TransformOp = iota
+	TransformMultiply             // multiply by value, e.g. CT or VT ratio
+	TransformInvert               // invert sign, e.g. power of meters installed backwards
+	TransformSwap                 // swap import and export measurements
+	TransformOffset               // add value, e.g. energy counters after meter exchange
+	TransformRename               // replace measurement by target
+	TransformDrop                 // discard measurement
+)
+
+var transformOps = map[string]TransformOp{
+	"multiply": TransformMultiply,
+	"invert":   TransformInvert,
+	"swap":     TransformSwap,
+	"offset":   TransformOffset,
+	"rename":   TransformRename,
+	"drop":     TransformDrop,
+}
+
+// TransformOpString returns the transform operation by name
+func TransformOpString(s string) (TransformOp, error) {
+	if op, ok := transformOps[strings.ToLower(s)]; ok {
+		return op, nil
+	}
+	return 0, fmt.Errorf("invalid transform: %s", s)
+}
+
+// swapped are the counterparts of import and export measurements
+var swapped = map[meters.Measurement]meters.Measurement{
+	meters.Import:           meters.Export,
+	meters.ImportT1:         meters.ExportT1,
+	meters.ImportT2:         meters.ExportT2,
+	meters.ImportL1:         meters.ExportL1,
+	meters.ImportL2:         meters.ExportL2,
+	meters.ImportL3:         meters.ExportL3,
+	meters.ImportPower:      meters.ExportPower,
+	meters.ImportPowerL1:    meters.ExportPowerL1,
+	meters.ImportPowerL2:    meters.ExportPowerL2,
+	meters.ImportPowerL3:    meters.ExportPowerL3,
+	meters.ReactiveImport:   meters.ReactiveExport,
+	meters.ReactiveImportT1: meters.ReactiveExportT1,
+	meters.ReactiveImportT2: meters.ReactiveExportT2,
+	meters.ReactiveImportL1: meters.ReactiveExportL1,
+	meters.ReactiveImportL2: meters.ReactiveExportL2,
+	meters.ReactiveImportL3: meters.ReactiveExportL3,
+}
+
+func init() {
+	for m, counterpart := range swapped {
+		swapped[counterpart] = m
+	}
+}
+
+// swap returns the import or export counterpart of the measurement
+func swap(m meters.Measurement) meters.Measurement {
+	if counterpart, ok := swapped[m]; ok {
+		return counterpart
+	}
+
+	if base, typ, index := m.Index(); base != m {
+		if counterpart, ok := swapped[base]; ok {
+			return meters.Indexed(counterpart, typ, index)
+		}
+	}
+
+	return m
+}
+
+// Transform is a step of a device's transform chain, correcting readings before validation
+type Transform struct {
+	Op           TransformOp
+	Measurements []meters.Measurement // measurements the step applies to
+	Units        []string             // units of measurements the step applies to, all measurements if both are empty
+	Value        float64              // factor or offset
+	To           meters.Measurement   // rename target
+}
+
+// matches returns true if the step applies to the measurement or its base measurement
+func (t Transform) matches(m meters.Measurement) bool {
+	if len(t.Measurements) == 0 && len(t.Units) == 0 {
+		return true
+	}
+
+	_, unit := m.DescriptionAndUnit()
+	if slices.Contains(t.Measurements, m) || slices.Contains(t.Units, unit) {
+		return true
+	}
+
+	// indexed measurements like tariffs match their base measurement, except for renames to a single target
+	base, _, _ := m.Index()
+	return t.Op != TransformRename && base != m && slices.Contains(t.Measurements, base)
+}
+
+// apply transforms the result and returns false if it is dropped
+func (t Transform) apply(r *meters.MeasurementResult) bool {
+	if !t.matches(r.Measurement) {
+		return true
+	}
+
+	switch t.Op {
+	case TransformMultiply:
+		r.Value *= t.Value
+	case TransformInvert:
+		r.Value = -r.Value
+	case TransformSwap:
+		r.Measurement = swap(r.Measurement)
+	case TransformOffset:
+		r.Value += t.Value
+	case TransformRename:
+		r.Measurement = t.To
+	case TransformDrop:
+		return false
+	}
+
+	return true
+}
+
+// Transforms is a transform chain applied in order
+type Transforms []Transform
+
+// Apply transforms the results, dropped results are removed
+func (ts Transforms) Apply(results []meters.MeasurementResult) []meters.MeasurementResult {
+	if len(ts) == 0 {
+		return results
+	}
+
+	res := make([]meters.MeasurementResult, 0, len(results))
+	for _, r := range results {
+		if ts.apply(&r) {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// apply transforms the result and returns false if it is dropped
+func (ts Transforms) apply(r *meters.MeasurementResult) bool {
+	for _, t := range ts {
+		if !t.apply(r) {
+			return false
+		}
+	}
+	return true
+}
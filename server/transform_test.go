@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestTransforms(t *testing.T) {
+	ts := Transforms{
+		{Op: TransformMultiply, Units: []string{"A", "W"}, Value: 40},
+		{Op: TransformInvert, Measurements: []meters.Measurement{meters.Power}},
+		{Op: TransformSwap},
+		{Op: TransformOffset, Measurements: []meters.Measurement{meters.Export}, Value: 1000},
+		{Op: TransformRename, Measurements: []meters.Measurement{meters.Frequency}, To: meters.FrequencyL1},
+		{Op: TransformDrop, Measurements: []meters.Measurement{meters.Voltage}},
+	}
+
+	res := ts.Apply([]meters.MeasurementResult{
+		{Measurement: meters.Current, Value: 1.5},
+		{Measurement: meters.Power, Value: 100},
+		{Measurement: meters.Voltage, Value: 230},
+		{Measurement: meters.Import, Value: 12},
+		{Measurement: meters.Export, Value: 3},
+		{Measurement: meters.Indexed(meters.Import, meters.TariffIndex, 3), Value: 4},
+		{Measurement: meters.Frequency, Value: 50},
+	})
+
+	expected := []meters.MeasurementResult{
+		{Measurement: meters.Current, Value: 60},
+		{Measurement: meters.Power, Value: -4000},
+		{Measurement: meters.Export, Value: 1012},
+		{Measurement: meters.Import, Value: 3},
+		{Measurement: meters.Indexed(meters.Export, meters.TariffIndex, 3), Value: 1004}, // indexed measurements match their base
+		{Measurement: meters.FrequencyL1, Value: 50},
+	}
+
+	if len(res) != len(expected) {
+		t.Fatalf("unexpected results %v", res)
+	}
+
+	for i, r := range res {
+		if r.Measurement != expected[i].Measurement || r.Value != expected[i].Value {
+			t.Errorf("%d: expected %s, got %s", i, expected[i].String(), r.String())
+		}
+	}
+}
+
+func TestTransformMatches(t *testing.T) {
+	tariff := meters.Indexed(meters.Import, meters.TariffIndex, 3)
+
+	if !(Transform{Op: TransformDrop, Measurements: []meters.Measurement{meters.Import}}).matches(tariff) {
+		t.Error("expected tariff to match base measurement")
+	}
+	if (Transform{Op: TransformDrop, Measurements: []meters.Measurement{tariff}}).matches(meters.Import) {
+		t.Error("unexpected base measurement match")
+	}
+	if (Transform{Op: TransformRename, Measurements: []meters.Measurement{meters.Import}, To: meters.Export}).matches(tariff) {
+		t.Error("unexpected rename of tariff")
+	}
+}
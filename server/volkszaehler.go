@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+const (
+	vzPostInterval = 10 * time.Second
+	vzBufferSize   = 10000
+	vzTimeout      = 10 * time.Second
+)
+
+var vzLog = logger.Get(logger.Volkszaehler)
+
+// VolkszaehlerChannel maps a device's measurement to a middleware channel
+type VolkszaehlerChannel struct {
+	Device      string // device id or configured device name
+	Measurement meters.Measurement
+	UUID        string
+	Interval    time.Duration // minimum interval between readings, zero to send all readings
+}
+
+// VolkszaehlerOptions describes the middleware publisher configuration
+type VolkszaehlerOptions struct {
+	URL          string        // middleware url, e.g. http://localhost/middleware.php
+	PostInterval time.Duration // interval for posting batches of readings
+	Buffer       int           // maximum number of buffered readings per channel during outages
+	Channels     []VolkszaehlerChannel
+}
+
+type vzKey struct {
+	device      string
+	measurement meters.Measurement
+}
+
+// vzTuple is a middleware reading of timestamp in ms and value
+type vzTuple [2]float64
+
+type vzChannel struct {
+	VolkszaehlerChannel
+	last    time.Time
+	pending []vzTuple
+}
+
+// Volkszaehler publishes readings to the volkszaehler middleware
+type Volkszaehler struct {
+	VolkszaehlerOptions
+	qe       DeviceInfo
+	client   *http.Client
+	mu       sync.Mutex
+	channels map[vzKey]*vzChannel
+}
+
+// NewVolkszaehler creates a volkszaehler middleware publisher
+func NewVolkszaehler(opts VolkszaehlerOptions, qe DeviceInfo) (*Volkszaehler, error) {
+	if opts.URL == "" {
+		return nil, errors.New("missing middleware url")
+	}
+	if opts.PostInterval <= 0 {
+		opts.PostInterval = vzPostInterval
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = vzBufferSize
+	}
+
+	vz := &Volkszaehler{
+		VolkszaehlerOptions: opts,
+		qe:                  qe,
+		client:              &http.Client{Timeout: vzTimeout},
+		channels:            make(map[vzKey]*vzChannel),
+	}
+
+	for _, c := range opts.Channels {
+		if c.UUID == "" {
+			return nil, fmt.Errorf("missing uuid for %s %s", c.Device, c.Measurement)
+		}
+		vz.channels[vzKey{strings.ToLower(c.Device), c.Measurement}] = &vzChannel{VolkszaehlerChannel: c}
+	}
+
+	return vz, nil
+}
+
+// channel returns the channel mapped by device id or configured name
+func (vz *Volkszaehler) channel(snip QuerySnip) *vzChannel {
+	if c, ok := vz.channels[vzKey{strings.ToLower(snip.Device), snip.Measurement}]; ok {
+		return c
+	}
+	if name := vz.qe.DeviceName(snip.Device); name != "" {
+		return vz.channels[vzKey{strings.ToLower(name), snip.Measurement}]
+	}
+	return nil
+}
+
+// add queues a reading respecting the channel's interval and buffer size
+func (vz *Volkszaehler) add(snip QuerySnip) {
+	vz.mu.Lock()
+	defer vz.mu.Unlock()
+
+	c := vz.channel(snip)
+	if c == nil || snip.Timestamp.Sub(c.last) < c.Interval {
+		return
+	}
+
+	c.last = snip.Timestamp
+	c.pending = append(c.pending, vzTuple{float64(snip.Timestamp.UnixMilli()), snip.Value})
+
+	// drop oldest readings if middleware is unavailable for too long
+	if over := len(c.pending) - vz.Buffer; over > 0 {
+		vzLog.Warn("buffer full, dropping readings", "uuid", c.UUID, "dropped", over)
+		c.pending = c.pending[over:]
+	}
+}
+
+// flush posts all pending readings. Readings remain buffered if posting fails.
+func (vz *Volkszaehler) flush() {
+	vz.mu.Lock()
+	batches := make(map[*vzChannel][]vzTuple)
+	for _, c := range vz.channels {
+		if len(c.pending) > 0 {
+			batches[c] = c.pending
+			c.pending = nil
+		}
+	}
+	vz.mu.Unlock()
+
+	for c, tuples := range batches {
+		if err := vz.post(c.UUID, tuples); err != nil {
+			vzLog.Error("posting readings failed", "uuid", c.UUID, "readings", len(tuples), "error", err)
+
+			// requeue in order before readings received in the meantime
+			vz.mu.Lock()
+			c.pending = append(tuples, c.pending...)
+			if over := len(c.pending) - vz.Buffer; over > 0 {
+				c.pending = c.pending[over:]
+			}
+			vz.mu.Unlock()
+			continue
+		}
+
+		vzLog.Debug("posted readings", "uuid", c.UUID, "readings", len(tuples))
+	}
+}
+
+func (vz *Volkszaehler) post(uuid string, tuples []vzTuple) error {
+	body, err := json.Marshal(tuples)
+	if err != nil {
+		return err
+	}
+
+	uri := fmt.Sprintf("%s/data/%s.json", strings.TrimSuffix(vz.URL, "/"), url.PathEscape(uuid))
+	resp, err := vz.client.Post(uri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return vzError(resp)
+}
+
+// vzError returns the middleware's exception message for unsuccessful responses
+func vzError(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	var res struct {
+		Exception struct {
+			Message string
+		}
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err := json.Unmarshal(b, &res); err == nil && res.Exception.Message != "" {
+		return fmt.Errorf("middleware: %s", res.Exception.Message)
+	}
+
+	return fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// Run volkszaehler publisher
+func (vz *Volkszaehler) Run(in <-chan QuerySnip) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(vz.PostInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				vz.flush()
+			case <-done:
+				vz.flush()
+				return
+			}
+		}
+	}()
+
+	for snip := range in {
+		if snip.Quality == QualityGood {
+			vz.add(snip)
+		}
+	}
+
+	close(done)
+}
+
+// VolkszaehlerChannelType returns the middleware channel type for the measurement
+func VolkszaehlerChannelType(m meters.Measurement) (string, error) {
+	_, unit := m.DescriptionAndUnit()
+
+	switch unit {
+	case "W":
+		return "powersensor", nil
+	case "kWh":
+		return "electric meter", nil
+	case "V":
+		return "voltage", nil
+	case "A":
+		return "current", nil
+	case "°C":
+		return "temperature", nil
+	default:
+		return "", fmt.Errorf("no channel type for %s (%s)", m, unit)
+	}
+}
+
+// CreateVolkszaehlerChannel creates a public middleware channel and returns its uuid
+func CreateVolkszaehlerChannel(uri, typ, title string) (string, error) {
+	params := url.Values{
+		"type":   {typ},
+		"title":  {title},
+		"public": {"1"},
+	}
+
+	// absolute meter readings are sent in kWh
+	if typ == "electric meter" {
+		params.Set("resolution", "1")
+	}
+
+	client := &http.Client{Timeout: vzTimeout}
+	resp, err := client.PostForm(strings.TrimSuffix(uri, "/")+"/channel.json", params)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := vzError(resp); err != nil {
+		return "", err
+	}
+
+	var res struct {
+		Entity struct {
+			UUID string
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", err
+	}
+	if res.Entity.UUID == "" {
+		return "", errors.New("middleware: missing channel uuid")
+	}
+
+	return res.Entity.UUID, nil
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestVolkszaehler(t *testing.T) {
+	var fail bool
+	posted := make(map[string][]vzTuple)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"exception":{"message":"database unavailable"}}`))
+			return
+		}
+
+		var tuples []vzTuple
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &tuples); err != nil {
+			t.Error(err)
+		}
+		posted[r.URL.Path] = append(posted[r.URL.Path], tuples...)
+	}))
+	defer srv.Close()
+
+	vz, err := NewVolkszaehler(VolkszaehlerOptions{
+		URL: srv.URL,
+		Channels: []VolkszaehlerChannel{
+			{Device: "SDM1.1", Measurement: meters.Power, UUID: "power", Interval: time.Minute},
+			{Device: "garage", Measurement: meters.Import, UUID: "import"},
+		},
+	}, deviceNames{"SDM1.1": "garage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Unix(1700000000, 0)
+	add := func(m meters.Measurement, v float64, ts time.Time) {
+		vz.add(QuerySnip{Device: "SDM1.1", MeasurementResult: result(m, v, ts)})
+	}
+
+	// middleware outage
+	fail = true
+	add(meters.Power, 100, ts)
+	add(meters.Import, 1, ts)
+	vz.flush()
+
+	fail = false
+	add(meters.Power, 200, ts.Add(time.Second)) // within channel interval
+	add(meters.Import, 2, ts.Add(time.Second))
+	add(meters.Frequency, 50, ts.Add(time.Second)) // not mapped
+	vz.flush()
+
+	if p := posted["/data/power.json"]; len(p) != 1 || p[0] != (vzTuple{1700000000000, 100}) {
+		t.Errorf("unexpected power readings %v", p)
+	}
+	if p := posted["/data/import.json"]; len(p) != 2 || p[0][1] != 1 || p[1][1] != 2 {
+		t.Errorf("unexpected import readings %v", p)
+	}
+	if len(posted) != 2 {
+		t.Errorf("unexpected channels %v", posted)
+	}
+}
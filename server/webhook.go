@@ -0,0 +1,350 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/volkszaehler/mbmd/logger"
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+const (
+	webhookWindow     = time.Second
+	webhookRetries    = 5
+	webhookBackoff    = time.Second
+	webhookMaxBackoff = time.Minute
+	webhookQueue      = 100
+	webhookTimeout    = 10 * time.Second
+)
+
+// DefaultWebhookTemplate renders all readings as json array
+const DefaultWebhookTemplate = "{{json .Readings}}"
+
+var webhookLog = logger.Get(logger.Webhook)
+
+// WebhookOptions describes a webhook target
+type WebhookOptions struct {
+	Name         string // name for logging and status, defaults to url
+	URL          string
+	Method       string            // defaults to POST
+	Headers      map[string]string // additional request headers
+	User         string            // basic auth
+	Password     string
+	Token        string        // bearer token auth
+	Template     string        // body template, defaults to DefaultWebhookTemplate
+	Window       time.Duration // batching window
+	Retries      int           // maximum number of retries per batch, negative to disable
+	Backoff      time.Duration // initial retry delay, doubled for each retry
+	Devices      []string      // device ids or configured names, empty for all devices
+	Measurements []meters.Measurement
+}
+
+// WebhookReading is a single reading passed to the body template
+type WebhookReading struct {
+	Device      string
+	Name        string
+	Measurement string
+	Value       float64
+	Unit        string
+	Timestamp   time.Time
+}
+
+// WebhookData is passed to the body template
+type WebhookData struct {
+	Timestamp time.Time // batch creation time
+	Readings  []WebhookReading
+}
+
+// Webhook publishes batches of readings using templated http requests
+type Webhook struct {
+	WebhookOptions
+	qe                                  DeviceInfo
+	log                                 *logger.Logger
+	template                            *template.Template
+	client                              *http.Client
+	queue                               chan []byte
+	delivered, failed, retries, dropped atomic.Uint64
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"unix": func(t time.Time) int64 {
+		return t.Unix()
+	},
+	"unixMilli": func(t time.Time) int64 {
+		return t.UnixMilli()
+	},
+}
+
+// NewWebhook creates a webhook publisher
+func NewWebhook(opts WebhookOptions, qe DeviceInfo) (*Webhook, error) {
+	if opts.URL == "" {
+		return nil, errors.New("missing url")
+	}
+	if opts.Name == "" {
+		opts.Name = opts.URL
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.Template == "" {
+		opts.Template = DefaultWebhookTemplate
+	}
+	if opts.Window <= 0 {
+		opts.Window = webhookWindow
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = webhookRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = webhookBackoff
+	}
+
+	tmpl, err := template.New("body").Funcs(webhookFuncs).Parse(opts.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return &Webhook{
+		WebhookOptions: opts,
+		qe:             qe,
+		log:            webhookLog.With("webhook", opts.Name),
+		template:       tmpl,
+		client:         &http.Client{Timeout: webhookTimeout},
+		queue:          make(chan []byte, webhookQueue),
+	}, nil
+}
+
+// OutputStatus implements OutputInfo interface
+func (w *Webhook) OutputStatus() OutputStatus {
+	return OutputStatus{
+		Output:    w.Name,
+		Delivered: w.delivered.Load(),
+		Failed:    w.failed.Load(),
+		Retries:   w.retries.Load(),
+		Dropped:   w.dropped.Load(),
+		Queued:    uint64(len(w.queue)),
+	}
+}
+
+// matches applies the device and measurement filters
+func (w *Webhook) matches(snip QuerySnip) bool {
+	if len(w.Devices) > 0 {
+		name := w.qe.DeviceName(snip.Device)
+
+		var ok bool
+		for _, d := range w.Devices {
+			if strings.EqualFold(d, snip.Device) || (name != "" && strings.EqualFold(d, name)) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(w.Measurements) > 0 {
+		base, _, _ := snip.Measurement.Index()
+		for _, m := range w.Measurements {
+			if m == snip.Measurement || m == base {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// render executes the body template
+func (w *Webhook) render(snips []QuerySnip) ([]byte, error) {
+	data := WebhookData{
+		Timestamp: time.Now(),
+		Readings:  make([]WebhookReading, 0, len(snips)),
+	}
+
+	for _, snip := range snips {
+		_, unit := snip.Measurement.DescriptionAndUnit()
+		data.Readings = append(data.Readings, WebhookReading{
+			Device:      snip.Device,
+			Name:        w.qe.DeviceName(snip.Device),
+			Measurement: snip.Measurement.String(),
+			Value:       snip.Value,
+			Unit:        unit,
+			Timestamp:   snip.Timestamp,
+		})
+	}
+
+	var buf bytes.Buffer
+	err := w.template.Execute(&buf, data)
+	return buf.Bytes(), err
+}
+
+// send executes a single request
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	} else if w.User != "" {
+		req.SetBasicAuth(w.User, w.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// deliver sends the body, retrying with exponential backoff
+func (w *Webhook) deliver(ctx context.Context, body []byte) {
+	backoff := w.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := w.send(ctx, body)
+		if err == nil {
+			w.delivered.Add(1)
+			return
+		}
+
+		if attempt >= w.Retries || ctx.Err() != nil {
+			w.failed.Add(1)
+			w.log.Error("delivery failed", "attempts", attempt+1, "error", err)
+			return
+		}
+
+		w.retries.Add(1)
+		w.log.Warn("delivery failed, retrying", "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, webhookMaxBackoff)
+	}
+}
+
+// Forward implements Forwarder. Readings are sent synchronously without retry.
+func (w *Webhook) Forward(snips []QuerySnip) error {
+	var matched []QuerySnip
+	for _, snip := range snips {
+		if snip.Quality == QualityGood && w.matches(snip) {
+			matched = append(matched, snip)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil
+	}
+
+	body, err := w.render(matched)
+	if err != nil {
+		w.log.Error("template", "error", err)
+		return nil
+	}
+
+	if err := w.send(context.Background(), body); err != nil {
+		return err
+	}
+
+	w.delivered.Add(1)
+	return nil
+}
+
+// enqueue queues a batch for delivery without blocking the broadcaster
+func (w *Webhook) enqueue(snips []QuerySnip) {
+	body, err := w.render(snips)
+	if err != nil {
+		w.log.Error("template", "error", err)
+		return
+	}
+
+	select {
+	case w.queue <- body:
+	default:
+		w.dropped.Add(1)
+		w.log.Warn("queue full, dropping batch", "readings", len(snips))
+	}
+}
+
+// Run webhook publisher
+func (w *Webhook) Run(in <-chan QuerySnip) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		for body := range w.queue {
+			w.deliver(ctx, body)
+		}
+		close(done)
+	}()
+
+	var batch []QuerySnip
+	timer := time.NewTimer(w.Window)
+	timer.Stop()
+
+	for {
+		select {
+		case snip, ok := <-in:
+			if !ok {
+				if len(batch) > 0 {
+					w.enqueue(batch)
+				}
+				close(w.queue)
+
+				// finish pending deliveries without further retries
+				time.AfterFunc(w.Window, cancel)
+				<-done
+				cancel()
+				return
+			}
+
+			if snip.Quality != QualityGood || !w.matches(snip) {
+				continue
+			}
+
+			if len(batch) == 0 {
+				timer.Reset(w.Window)
+			}
+			batch = append(batch, snip)
+
+		case <-timer.C:
+			w.enqueue(batch)
+			batch = nil
+		}
+	}
+}
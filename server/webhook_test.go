@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/volkszaehler/mbmd/meters"
+)
+
+func TestWebhook(t *testing.T) {
+	var requests int
+	var body, auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	webhook, err := NewWebhook(WebhookOptions{
+		URL:          srv.URL,
+		Token:        "secret",
+		Template:     `{{range .Readings}}{{.Name}}:{{.Measurement}}={{.Value}}@{{unix .Timestamp}};{{end}}`,
+		Window:       10 * time.Millisecond,
+		Backoff:      time.Millisecond,
+		Devices:      []string{"garage"},
+		Measurements: []meters.Measurement{meters.Power},
+	}, deviceNames{"SDM1.1": "garage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Unix(1700000000, 0)
+	in := make(chan QuerySnip, 4)
+	in <- QuerySnip{Device: "SDM1.1", MeasurementResult: result(meters.PowerL1, 100, ts)}
+	in <- QuerySnip{Device: "SDM1.1", MeasurementResult: result(meters.Frequency, 50, ts)}
+	in <- QuerySnip{Device: "SDM1.2", MeasurementResult: result(meters.PowerL1, 200, ts)}
+	in <- QuerySnip{Device: "SDM1.1", MeasurementResult: result(meters.Power, 300, ts)}
+	close(in)
+
+	webhook.Run(in)
+
+	if expected := "garage:PowerL1=100@1700000000;garage:Power=300@1700000000;"; body != expected {
+		t.Errorf("expected body %q, got %q", expected, body)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+
+	status := webhook.OutputStatus()
+	if status.Delivered != 1 || status.Retries != 1 || status.Failed != 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}